@@ -1,8 +1,12 @@
 package exec
 
 import (
+	"context"
 	"errors"
+	"os"
 	"runtime"
+	"strings"
+	"sync"
 	"unicode"
 
 	"github.com/frostyeti/mvps/go/env"
@@ -19,6 +23,7 @@ type Executable struct {
 
 type ExecutableRegistry struct {
 	data map[string]Executable
+	mu   sync.RWMutex
 }
 
 type EnvLike interface {
@@ -28,15 +33,23 @@ type EnvLike interface {
 	SplitPath() []string
 }
 
+// SetEnvLike sets the environment Find uses when the options have no Env.
 func SetEnvLike(e EnvLike) {
+	envLikeMu.Lock()
+	defer envLikeMu.Unlock()
 	envLike = e
 }
 
 func GetEnvLike() EnvLike {
+	envLikeMu.RLock()
+	defer envLikeMu.RUnlock()
 	return envLike
 }
 
-var envLike EnvLike
+var (
+	envLike   EnvLike
+	envLikeMu sync.RWMutex
+)
 
 type defaultEnvLike struct{}
 
@@ -56,6 +69,53 @@ func (d *defaultEnvLike) SplitPath() []string {
 	return env.SplitPath()
 }
 
+// listEnvLike is an environment of KEY=VALUE pairs, e.g. the env of a Cmd,
+// so that a command finds its executable with its own PATH.
+type listEnvLike map[string]string
+
+func newListEnvLike(pairs []string) listEnvLike {
+	l := listEnvLike{}
+	for _, pair := range pairs {
+		if k, v, ok := strings.Cut(pair, "="); ok {
+			l[k] = v
+		}
+	}
+
+	return l
+}
+
+func (l listEnvLike) Get(key string) string {
+	if v, ok := l[key]; ok || runtime.GOOS != "windows" {
+		return v
+	}
+
+	for k, v := range l {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+
+	return ""
+}
+
+func (l listEnvLike) Expand(s string) (string, error) {
+	return env.ExpandWithOptions(s, &env.ExpandOptions{
+		Get: l.Get,
+		Set: func(key, value string) error {
+			l[key] = value
+			return nil
+		},
+	})
+}
+
+func (l listEnvLike) Set(key, value string) {
+	l[key] = value
+}
+
+func (l listEnvLike) SplitPath() []string {
+	return strings.Split(l.Get(env.PATH), string(os.PathListSeparator))
+}
+
 func init() {
 	envLike = &defaultEnvLike{}
 }
@@ -63,29 +123,41 @@ func init() {
 var Registry = &ExecutableRegistry{data: make(map[string]Executable)}
 
 func (r *ExecutableRegistry) Register(name string, exe *Executable) {
-	r.data[name] = *exe
-
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	if exe.Variable == "" {
 		sb := underscore([]rune(name), &underscoreOptions{Screaming: true})
 		exe.Variable = string(sb)
 	}
+
+	r.data[name] = *exe
 }
 
 func (r *ExecutableRegistry) Set(name string, exe *Executable) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	r.data[name] = *exe
 }
 
 func (r *ExecutableRegistry) Get(name string) (*Executable, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	item, ok := r.data[name]
 	return &item, ok
 }
 
 func (r *ExecutableRegistry) Has(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	_, ok := r.data[name]
 	return ok
 }
 
+// Find returns the path of the executable registered with the name. The
+// variable of the executable, e.g. BASH for bash, and the paths are read
+// from options.Env, or from the environment set with SetEnvLike.
 func (r *ExecutableRegistry) Find(name string, options *WhichOptions) (string, error) {
+	r.mu.Lock()
 	m, ok := r.data[name]
 	if !ok {
 		sb := underscore([]rune(name), &underscoreOptions{Screaming: true})
@@ -93,11 +165,17 @@ func (r *ExecutableRegistry) Find(name string, options *WhichOptions) (string, e
 		m.Variable = string(sb)
 		r.data[name] = m
 	}
+	r.mu.Unlock()
 
 	if options == nil {
 		options = &WhichOptions{}
 	}
 
+	envLike := options.Env
+	if envLike == nil {
+		envLike = GetEnvLike()
+	}
+
 	if options.UseCache && m.Path != "" {
 		return m.Path, nil
 	}
@@ -142,7 +220,7 @@ func (r *ExecutableRegistry) Find(name string, options *WhichOptions) (string, e
 			}
 		}
 
-		return "", errors.New("executable not found: " + name)
+		return findOnPath(name, envLike, options)
 	}
 
 	if runtime.GOOS == "darwin" {
@@ -183,6 +261,19 @@ func (r *ExecutableRegistry) Find(name string, options *WhichOptions) (string, e
 		}
 	}
 
+	return findOnPath(name, envLike, options)
+}
+
+// findOnPath looks for the executable on the PATH of envLike once the
+// variable and the known locations did not have it, so that a tool in a
+// directory that the env adds to its PATH is found as well.
+func findOnPath(name string, envLike EnvLike, options *WhichOptions) (string, error) {
+	next := *options
+	next.Env = envLike
+	if path, ok := WhichFirst(name, &next); ok {
+		return path, nil
+	}
+
 	return "", errors.New("executable not found: " + name)
 }
 
@@ -277,3 +368,38 @@ func underscore(runes []rune, options *underscoreOptions) []rune {
 
 	return sb
 }
+
+type envLikeKey struct{}
+
+// WithEnvLike returns a copy of ctx that carries the environment in which
+// commands created with the context find their executables, e.g. the env
+// of a task rather than that of the process.
+func WithEnvLike(ctx context.Context, e EnvLike) context.Context {
+	return context.WithValue(ctx, envLikeKey{}, e)
+}
+
+// EnvLikeFromContext returns the environment set with WithEnvLike, or nil
+// when ctx has none.
+func EnvLikeFromContext(ctx context.Context) EnvLike {
+	if ctx == nil {
+		return nil
+	}
+
+	e, _ := ctx.Value(envLikeKey{}).(EnvLike)
+	return e
+}
+
+// FindContext is Find with the environment of ctx, see WithEnvLike, when
+// options has no Env.
+func FindContext(ctx context.Context, name string, options *WhichOptions) (string, error) {
+	next := WhichOptions{}
+	if options != nil {
+		next = *options
+	}
+
+	if next.Env == nil {
+		next.Env = EnvLikeFromContext(ctx)
+	}
+
+	return Find(name, &next)
+}
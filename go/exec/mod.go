@@ -21,6 +21,10 @@ const (
 
 var (
 	logger func(cmd *Cmd)
+
+	// GracePeriod is how long a command whose context was cancelled has to
+	// exit after it was asked to stop before it is killed.
+	GracePeriod = 5 * time.Second
 )
 
 type Cmd struct {
@@ -29,6 +33,11 @@ type Cmd struct {
 	logger        func(cmd *Cmd)
 	disableLogger bool
 	TempFile      *string
+	done          chan struct{}
+	// tty is the terminal whose foreground group the command was made,
+	// when foreground is set.
+	tty        int
+	foreground bool
 }
 
 func New(name string, args ...string) *Cmd {
@@ -231,11 +240,18 @@ func (c *Cmd) Quiet() (*Result, error) {
 
 // Runs the command and waits for it to finish
 // PsOutputs are inherited from the current process and
-// are not captured
+// are not captured, unless a writer or reader was already
+// set with WithStdout, WithStderr or WithStdin
 func (c *Cmd) Run() (*Result, error) {
-	c.Cmd.Stdout = os.Stdout
-	c.Cmd.Stderr = os.Stderr
-	c.Cmd.Stdin = os.Stdin
+	if c.Cmd.Stdout == nil {
+		c.Cmd.Stdout = os.Stdout
+	}
+	if c.Cmd.Stderr == nil {
+		c.Cmd.Stderr = os.Stderr
+	}
+	if c.Cmd.Stdin == nil {
+		c.Cmd.Stdin = os.Stdin
+	}
 	var out Result
 	out.FileName = c.Cmd.Path
 	out.Args = c.Cmd.Args
@@ -255,6 +271,9 @@ func (c *Cmd) Run() (*Result, error) {
 	if err != nil {
 		out.EndedAt = time.Now().UTC()
 		out.Code = 1
+		if c.Cmd.ProcessState != nil && c.Cmd.ProcessState.ExitCode() > 0 {
+			out.Code = c.Cmd.ProcessState.ExitCode()
+		}
 		return &out, err
 	}
 
@@ -294,6 +313,9 @@ func (c *Cmd) Output() (*Result, error) {
 	if err != nil {
 		out.EndedAt = time.Now().UTC()
 		out.Code = 1
+		if c.Cmd.ProcessState != nil && c.Cmd.ProcessState.ExitCode() > 0 {
+			out.Code = c.Cmd.ProcessState.ExitCode()
+		}
 		return &out, err
 	}
 
@@ -309,8 +331,12 @@ func (c *Cmd) Output() (*Result, error) {
 }
 
 func (c *Cmd) Start() error {
+	if c.ctx != nil {
+		c.prepareCancel()
+	}
+
 	if c.disableLogger {
-		return c.Cmd.Start()
+		return c.start()
 	}
 
 	if c.logger != nil {
@@ -323,15 +349,38 @@ func (c *Cmd) Start() error {
 
 	p := c.Cmd.Path
 	if p != "" && !filepath.IsAbs(p) {
-		p2, err := Find(p, nil)
+		options := &WhichOptions{}
+		if c.Cmd.Env != nil {
+			options.Env = newListEnvLike(c.Cmd.Env)
+		}
+
+		p2, err := Find(p, options)
 		if err == nil {
 			c.Cmd.Path = p2
 		}
 	}
 
-	return c.Cmd.Start()
+	return c.start()
+}
+
+// start starts the command and takes the terminal back when a command that
+// was handed it failed to start.
+func (c *Cmd) start() error {
+	err := c.Cmd.Start()
+	if err != nil {
+		c.restoreTerminal()
+	}
+
+	return err
 }
 
 func (c *Cmd) Wait() error {
-	return c.Cmd.Wait()
+	err := c.Cmd.Wait()
+	c.restoreTerminal()
+	if c.done != nil {
+		close(c.done)
+		c.done = nil
+	}
+
+	return err
 }
@@ -3,6 +3,106 @@
 
 package exec
 
+import (
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+)
+
 const (
 	EOL = "\n" // POSIX line endings
 )
+
+// prepareCancel runs the command in its own process group so that cancelling
+// its context stops every process it started, not only the command itself.
+// The group is sent SIGTERM and then SIGKILL once GracePeriod has passed.
+//
+// A background group is stopped when it reads from the terminal, so the
+// group of a command that reads from the terminal is made the foreground
+// group of the terminal while it runs, the way a shell runs a job. Ctrl-C
+// then reaches the command. The terminal is handed back in Wait.
+func (c *Cmd) prepareCancel() {
+	if c.Cmd.SysProcAttr == nil {
+		c.Cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	c.Cmd.SysProcAttr.Setpgid = true
+
+	if fd, ok := foregroundTerminal(c.Cmd.Stdin); ok {
+		c.Cmd.SysProcAttr.Foreground = true
+		c.Cmd.SysProcAttr.Ctty = fd
+		c.tty = fd
+		c.foreground = true
+	}
+
+	done := make(chan struct{})
+	c.done = done
+	c.Cmd.Cancel = func() error {
+		pid := -c.Cmd.Process.Pid
+		err := syscall.Kill(pid, syscall.SIGTERM)
+		if err == syscall.ESRCH {
+			return os.ErrProcessDone
+		}
+
+		go func() {
+			select {
+			case <-done:
+			case <-time.After(GracePeriod):
+				syscall.Kill(pid, syscall.SIGKILL)
+			}
+		}()
+
+		return err
+	}
+
+	c.Cmd.WaitDelay = GracePeriod + time.Second
+}
+
+// foregroundTerminal returns the file descriptor of r when r is a terminal
+// whose foreground group is that of this process, which is the only case in
+// which the terminal can be handed to a command.
+func foregroundTerminal(r io.Reader) (int, bool) {
+	if !isTerminal(r) {
+		return 0, false
+	}
+
+	fd := int(r.(*os.File).Fd())
+	pgrp, err := unix.IoctlGetInt(fd, unix.TIOCGPGRP)
+	if err != nil || pgrp != unix.Getpgrp() {
+		return 0, false
+	}
+
+	return fd, true
+}
+
+// restoreTerminal makes the group of this process the foreground group of
+// the terminal again once the command that was handed the terminal exited.
+// SIGTTOU is ignored meanwhile, as a background group that sets the
+// foreground group of its terminal is otherwise stopped.
+func (c *Cmd) restoreTerminal() {
+	if !c.foreground {
+		return
+	}
+	c.foreground = false
+
+	ignored := signal.Ignored(syscall.SIGTTOU)
+	if !ignored {
+		signal.Ignore(syscall.SIGTTOU)
+		defer signal.Reset(syscall.SIGTTOU)
+	}
+
+	unix.IoctlSetPointerInt(c.tty, unix.TIOCSPGRP, unix.Getpgrp())
+}
+
+func isTerminal(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	if !ok {
+		return false
+	}
+
+	return term.IsTerminal(int(f.Fd()))
+}
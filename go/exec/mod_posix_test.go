@@ -0,0 +1,124 @@
+//go:build !windows
+// +build !windows
+
+package exec
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsTerminal(t *testing.T) {
+	null, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer null.Close()
+
+	// /dev/null is a character device but not a terminal
+	assert.False(t, isTerminal(null))
+	assert.False(t, isTerminal(&bytes.Buffer{}))
+	assert.False(t, isTerminal(nil))
+}
+
+func TestPrepareCancelProcessGroup(t *testing.T) {
+	null, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer null.Close()
+
+	tests := []struct {
+		name  string
+		stdin *os.File
+	}{
+		{"no stdin", nil},
+		{"not a terminal", null},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			cmd := NewContext(ctx, "sleep", "5")
+			if tt.stdin != nil {
+				cmd.Stdin = tt.stdin
+			}
+			cmd.DisableLogger()
+			assert.NoError(t, cmd.Start())
+
+			// the command leads a group of its own and is not handed the
+			// terminal
+			pgid, err := syscall.Getpgid(cmd.Process.Pid)
+			assert.NoError(t, err)
+			assert.Equal(t, cmd.Process.Pid, pgid)
+			assert.False(t, cmd.SysProcAttr.Foreground)
+
+			cancel()
+			assert.Error(t, cmd.Wait())
+		})
+	}
+}
+
+// TestCancelStopsProcessGroup checks that cancelling a command stops the
+// processes it started as well.
+func TestCancelStopsProcessGroup(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cmd := NewContext(ctx, "sh", "-c", "sleep 30 & echo $! > "+pidFile+"; wait")
+	cmd.DisableLogger()
+	assert.NoError(t, cmd.Start())
+
+	var pid int
+	assert.Eventually(t, func() bool {
+		data, err := os.ReadFile(pidFile)
+		if err != nil || !bytes.HasSuffix(data, []byte("\n")) {
+			return false
+		}
+
+		pid, err = strconv.Atoi(string(bytes.TrimSpace(data)))
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	assert.Error(t, cmd.Wait())
+
+	assert.Eventually(t, func() bool {
+		return syscall.Kill(pid, 0) == syscall.ESRCH
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestForegroundTerminal(t *testing.T) {
+	null, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer null.Close()
+
+	_, ok := foregroundTerminal(null)
+	assert.False(t, ok)
+	_, ok = foregroundTerminal(&bytes.Buffer{})
+	assert.False(t, ok)
+
+	// a terminal that is not the controlling terminal of this process is
+	// not handed to commands
+	ptmx, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Skip("no pseudo terminals")
+	}
+	defer ptmx.Close()
+
+	_, ok = foregroundTerminal(ptmx)
+	assert.False(t, ok)
+}
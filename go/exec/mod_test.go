@@ -1,7 +1,12 @@
 package exec_test
 
 import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/frostyeti/mvps/go/exec"
@@ -47,3 +52,103 @@ func TestPipeCommand(t *testing.T) {
 	assert.Equal(t, 0, o.Code)
 	assert.Equal(t, "Hello World", strings.TrimSpace(o.Text()))
 }
+
+type mapEnv map[string]string
+
+func (m mapEnv) Get(key string) string { return m[key] }
+
+func (m mapEnv) Expand(s string) (string, error) { return s, nil }
+
+func (m mapEnv) Set(key, value string) { m[key] = value }
+
+func (m mapEnv) SplitPath() []string { return filepath.SplitList(m["PATH"]) }
+
+func TestWhichFirstEnv(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the tool is a shell script")
+	}
+
+	one := t.TempDir()
+	two := t.TempDir()
+	for _, dir := range []string{one, two} {
+		err := os.WriteFile(filepath.Join(dir, "mvps-which-tool"), []byte("#!/bin/sh\n"), 0o755)
+		assert.NoError(t, err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		dir := one
+		if i%2 == 1 {
+			dir = two
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			path, ok := exec.WhichFirst("mvps-which-tool", &exec.WhichOptions{Env: mapEnv{"PATH": dir}})
+			assert.True(t, ok)
+			assert.Equal(t, filepath.Join(dir, "mvps-which-tool"), path)
+		}()
+	}
+	wg.Wait()
+
+	_, ok := exec.WhichFirst("mvps-which-tool", &exec.WhichOptions{Env: mapEnv{"PATH": t.TempDir()}})
+	assert.False(t, ok)
+}
+
+func TestFindEnvVariable(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the tool is a shell script")
+	}
+
+	dir := t.TempDir()
+	tool := filepath.Join(dir, "mvps-find-tool")
+	assert.NoError(t, os.WriteFile(tool, []byte("#!/bin/sh\n"), 0o755))
+
+	path, err := exec.Find("mvps-find-tool", &exec.WhichOptions{Env: mapEnv{"MVPS_FIND_TOOL": tool}})
+	assert.NoError(t, err)
+	assert.Equal(t, tool, path)
+
+	_, err = exec.Find("mvps-find-tool", &exec.WhichOptions{Env: mapEnv{}})
+	assert.Error(t, err)
+}
+
+func TestFindContext(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the tool is a shell script")
+	}
+
+	dir := t.TempDir()
+	tool := filepath.Join(dir, "mvps-context-tool")
+	assert.NoError(t, os.WriteFile(tool, []byte("#!/bin/sh\n"), 0o755))
+
+	tests := []struct {
+		name string
+		env  exec.EnvLike
+		want string
+	}{
+		{"variable", mapEnv{"MVPS_CONTEXT_TOOL": tool}, tool},
+		{"path", mapEnv{"PATH": dir}, tool},
+		{"not found", mapEnv{"PATH": t.TempDir()}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := exec.WithEnvLike(context.Background(), tt.env)
+			path, err := exec.FindContext(ctx, "mvps-context-tool", nil)
+			if tt.want == "" {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, path)
+		})
+	}
+
+	// the env of the options wins over that of the context
+	ctx := exec.WithEnvLike(context.Background(), mapEnv{})
+	path, err := exec.FindContext(ctx, "mvps-context-tool", &exec.WhichOptions{Env: mapEnv{"PATH": dir}})
+	assert.NoError(t, err)
+	assert.Equal(t, tool, path)
+}
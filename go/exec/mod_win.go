@@ -7,3 +7,13 @@ package exec
 const (
 	EOL = "\r\n" // Windows line endings
 )
+
+// prepareCancel gives the command GracePeriod to close its output after its
+// context was cancelled. Windows has no equivalent of SIGTERM for console
+// processes, so the command itself is killed right away.
+func (c *Cmd) prepareCancel() {
+	c.Cmd.WaitDelay = GracePeriod
+}
+
+// restoreTerminal does nothing, as commands are not handed the console.
+func (c *Cmd) restoreTerminal() {}
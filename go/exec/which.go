@@ -6,18 +6,22 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 	"unicode"
-
-	"github.com/frostyeti/mvps/go/env"
 )
 
 var (
-	whichCache = make(map[string]string)
+	whichCache   = make(map[string]string)
+	whichCacheMu sync.Mutex
 )
 
 type WhichOptions struct {
 	UseCache     bool
 	PrependPaths []string
+	// Env is the environment whose PATH is searched, the process
+	// environment when nil. Lookups with an Env are not cached, as the
+	// cache is shared by every environment.
+	Env EnvLike
 }
 
 func Which(command string) (string, bool) {
@@ -36,13 +40,29 @@ func WhichFirst(command string, options *WhichOptions) (string, bool) {
 	base := filepath.Base(command)
 	ext := filepath.Ext(command)
 	name := base[0 : len(base)-len(ext)]
-	if options.UseCache {
+	cached := options.Env == nil
+	if options.UseCache && cached {
+		whichCacheMu.Lock()
 		path, ok := whichCache[name]
+		whichCacheMu.Unlock()
 		if ok {
 			return path, true
 		}
 	}
 
+	cache := func(path string) {
+		if cached {
+			whichCacheMu.Lock()
+			whichCache[name] = path
+			whichCacheMu.Unlock()
+		}
+	}
+
+	var e EnvLike = &defaultEnvLike{}
+	if options.Env != nil {
+		e = options.Env
+	}
+
 	if filepath.IsAbs(command) {
 		fi, err := os.Lstat(command)
 
@@ -57,11 +77,17 @@ func WhichFirst(command string, options *WhichOptions) (string, bool) {
 			}
 
 			if options.UseCache {
-				whichCache[name] = path
+				cache(path)
 			}
 
 			return path, true
 		}
+
+		// an absolute path is the executable itself rather than a name
+		// to look for on the PATH
+		if fi.Mode().IsRegular() {
+			return command, true
+		}
 	}
 
 	pathSegments := []string{}
@@ -69,10 +95,10 @@ func WhichFirst(command string, options *WhichOptions) (string, bool) {
 		pathSegments = append(pathSegments, options.PrependPaths...)
 	}
 
-	pathSegments = append(pathSegments, env.SplitPath()...)
+	pathSegments = append(pathSegments, e.SplitPath()...)
 
 	for i, path := range pathSegments {
-		value, _ := env.Expand(path)
+		value, _ := e.Expand(path)
 		if value == "" {
 			continue
 		}
@@ -86,7 +112,7 @@ func WhichFirst(command string, options *WhichOptions) (string, bool) {
 		}
 
 		if runtime.GOOS == "windows" {
-			pathExt := env.Get("PATHEXT")
+			pathExt := e.Get("PATHEXT")
 			if emptySpace(pathExt) {
 				pathExt = ".com;.exe;.bat;.cmd;.vbs;.vbe;.js;.jse;.wsf;.wsh"
 			} else {
@@ -117,7 +143,7 @@ func WhichFirst(command string, options *WhichOptions) (string, bool) {
 				if hasExt {
 					if strings.EqualFold(entry.Name(), command) {
 						fp := filepath.Join(path, entry.Name())
-						whichCache[name] = fp
+						cache(fp)
 						return fp, true
 					}
 
@@ -129,7 +155,7 @@ func WhichFirst(command string, options *WhichOptions) (string, bool) {
 				for _, n := range extSegments {
 					if strings.EqualFold(n, entryExt) {
 						fp := filepath.Join(path, entryName)
-						whichCache[name] = fp
+						cache(fp)
 						return fp, true
 					}
 				}
@@ -147,7 +173,7 @@ func WhichFirst(command string, options *WhichOptions) (string, bool) {
 
 				if strings.EqualFold(entry.Name(), name) {
 					fp := filepath.Join(path, entry.Name())
-					whichCache[name] = fp
+					cache(fp)
 					return fp, true
 				}
 			}
@@ -23,7 +23,7 @@ func New(args ...string) *exec.Cmd {
 }
 
 func NewContext(ctx context.Context, args ...string) *exec.Cmd {
-	exe, _ := exec.Find(NAME, nil)
+	exe, _ := exec.FindContext(ctx, NAME, nil)
 	if exe == "" {
 		exe = "bash"
 	}
@@ -54,14 +54,14 @@ func ScriptContext(ctx context.Context, script string, args ...string) *exec.Cmd
 }
 
 func File(path string, args ...string) *exec.Cmd {
-	path = resolveScriptFile(path)
+	path = resolveScriptFile(context.Background(), path)
 	splat := append(ScriptArgs, path)
 	splat = append(splat, args...)
 	return New(splat...)
 }
 
 func FileContext(ctx context.Context, path string, args ...string) *exec.Cmd {
-	path = resolveScriptFile(path)
+	path = resolveScriptFile(ctx, path)
 	splat := append(ScriptArgs, path)
 	splat = append(splat, args...)
 	return NewContext(ctx, splat...)
@@ -2,7 +2,11 @@
 
 package bash
 
-import "github.com/frostyeti/mvps/go/exec"
+import (
+	"context"
+
+	"github.com/frostyeti/mvps/go/exec"
+)
 
 func init() {
 	exec.Register("bash", &exec.Executable{
@@ -15,6 +19,6 @@ func init() {
 	})
 }
 
-func resolveScriptFile(script string) string {
+func resolveScriptFile(ctx context.Context, script string) string {
 	return script
 }
@@ -3,6 +3,7 @@
 package bash
 
 import (
+	"context"
 	"path/filepath"
 	"strings"
 
@@ -21,7 +22,7 @@ func init() {
 	})
 }
 
-func resolveScriptFile(script string) string {
+func resolveScriptFile(ctx context.Context, script string) string {
 	if !filepath.IsAbs(script) {
 		file, err := filepath.Abs(script)
 		if err != nil {
@@ -30,7 +31,7 @@ func resolveScriptFile(script string) string {
 	}
 
 	// determine if bash is the WSL one.
-	bash, _ := exec.Find("bash", nil)
+	bash, _ := exec.FindContext(ctx, "bash", nil)
 	if !strings.Contains(strings.ToLower(bash), "system32") {
 		return script
 	}
@@ -27,7 +27,7 @@ func New(args ...string) *exec.Cmd {
 }
 
 func NewContext(ctx context.Context, args ...string) *exec.Cmd {
-	exe, _ := exec.Find(NAME, nil)
+	exe, _ := exec.FindContext(ctx, NAME, nil)
 	if exe == "" {
 		exe = "go"
 	}
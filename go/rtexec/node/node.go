@@ -23,7 +23,7 @@ func New(args ...string) *exec.Cmd {
 }
 
 func NewContext(ctx context.Context, args ...string) *exec.Cmd {
-	var exe, _ = exec.Find(NAME, nil)
+	var exe, _ = exec.FindContext(ctx, NAME, nil)
 	if exe == "" {
 		exe = "node"
 	}
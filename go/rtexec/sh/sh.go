@@ -21,7 +21,7 @@ func New(args ...string) *exec.Cmd {
 }
 
 func NewContext(ctx context.Context, args ...string) *exec.Cmd {
-	exe, _ := exec.Find(NAME, nil)
+	exe, _ := exec.FindContext(ctx, NAME, nil)
 	if exe == "" {
 		exe = "sh"
 	}
@@ -40,13 +40,13 @@ func FileContext(ctx context.Context, path string, args ...string) *exec.Cmd {
 }
 
 func Inline(script string, args ...string) *exec.Cmd {
-	splat := append(ScriptArgs, script)
+	splat := append(ScriptArgs, "-c", script)
 	splat = append(splat, args...)
 	return New(splat...)
 }
 
 func InlineContext(ctx context.Context, script string, args ...string) *exec.Cmd {
-	splat := append(ScriptArgs, script)
+	splat := append(ScriptArgs, "-c", script)
 	splat = append(splat, args...)
 	return NewContext(ctx, splat...)
 }
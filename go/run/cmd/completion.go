@@ -0,0 +1,271 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/frostyeti/mvps/go/run/schema"
+	"github.com/frostyeti/mvps/go/run/workflows"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// completeRun completes the target and the flags of run and run task from
+// the runfile the command would load. run task does not parse its flags,
+// so args holds the flags as well and the values of the flags are
+// completed here too.
+func completeRun(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	flags := newRunFlags()
+	if len(args) > 0 {
+		prev := args[len(args)-1]
+		switch prev {
+		case "-c", "--context":
+			return completeContexts(cmd, args[:len(args)-1], toComplete)
+		case "--input":
+			return completeInputs(cmd, args[:len(args)-1], toComplete, "")
+		case "-f", "--file", "-E", "--dotenv", "--report-file":
+			return nil, cobra.ShellCompDirectiveDefault
+		case "-d", "--dir":
+			return nil, cobra.ShellCompDirectiveFilterDirs
+		case "--report":
+			return []string{"json", "junit"}, cobra.ShellCompDirectiveNoFileComp
+		}
+
+		if strings.HasPrefix(prev, "-") && !strings.HasPrefix(toComplete, "-") && takesValue(flags, prev) {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+	}
+
+	if value, ok := strings.CutPrefix(toComplete, "--input="); ok {
+		return completeInputs(cmd, args, value, "--input=")
+	}
+
+	if value, ok := strings.CutPrefix(toComplete, "--context="); ok {
+		completions, directive := completeContexts(cmd, args, value)
+		for i, c := range completions {
+			completions[i] = "--context=" + c
+		}
+		return completions, directive
+	}
+
+	targets, _, remaining := splitRunArgs(flags, args)
+	if len(targets) > 0 || len(remaining) > 0 {
+		// the arguments after the target belong to the task
+		if strings.HasPrefix(toComplete, "-") && !slices.Contains(args, "--") {
+			return []string{"--input\t" + flags.Lookup("input").Usage}, cobra.ShellCompDirectiveNoFileComp
+		}
+
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+
+	if strings.HasPrefix(toComplete, "-") {
+		completions := []string{}
+		flags.VisitAll(func(flag *pflag.Flag) {
+			name := "--" + flag.Name
+			if strings.HasPrefix(name, toComplete) {
+				completions = append(completions, name+"\t"+flag.Usage)
+			}
+		})
+		return completions, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	wf := completionWorkflow(cmd, args)
+	if wf == nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	completions := []string{}
+	for _, key := range wf.Tasks.Keys() {
+		if !strings.HasPrefix(key, toComplete) {
+			continue
+		}
+
+		task, _ := wf.Tasks.Get(key)
+		desc := ""
+		if task.Desc != nil {
+			desc = strings.TrimSpace(strings.SplitN(*task.Desc, "\n", 2)[0])
+		}
+
+		if desc != "" {
+			completions = append(completions, key+"\t"+desc)
+		} else {
+			completions = append(completions, key)
+		}
+	}
+
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeContexts completes the contexts of the runfile: the suffixes of
+// its task:context tasks that are not hooks of the task.
+func completeContexts(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	wf := completionWorkflow(cmd, args)
+	if wf == nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	contexts := append([]string{}, wf.Contexts...)
+	for _, key := range wf.Tasks.Keys() {
+		i := strings.LastIndex(key, ":")
+		if i <= 0 {
+			continue
+		}
+
+		base, suffix := key[:i], key[i+1:]
+		task, ok := wf.Tasks.Get(base)
+		if !ok || slices.Contains(task.Hooks.Before, suffix) || slices.Contains(task.Hooks.After, suffix) {
+			continue
+		}
+
+		contexts = append(contexts, suffix)
+	}
+
+	slices.Sort(contexts)
+	completions := []string{}
+	for _, c := range slices.Compact(contexts) {
+		if strings.HasPrefix(c, toComplete) {
+			completions = append(completions, c)
+		}
+	}
+
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeInputs completes key= for the inputs of the tasks the target
+// runs, or of every task without a target, and the values of an input
+// after key=: its selection, true or false for bool inputs and the hosts
+// and groups of the runfile for inputs named host or hosts.
+func completeInputs(cmd *cobra.Command, args []string, toComplete string, prefix string) ([]string, cobra.ShellCompDirective) {
+	wf := completionWorkflow(cmd, args)
+	if wf == nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	targets, _, _ := splitRunArgs(newRunFlags(), args)
+
+	taskList := []schema.Task{}
+	if len(targets) > 0 {
+		contextName := wf.ContextName
+		if contextName == "" {
+			contextName = "default"
+		}
+
+		flat, err := wf.Tasks.FlattenTasks(targets[:1], contextName)
+		if err == nil {
+			taskList = flat
+		}
+	} else {
+		for _, key := range wf.Tasks.Keys() {
+			task, _ := wf.Tasks.Get(key)
+			taskList = append(taskList, task)
+		}
+	}
+
+	inputs := map[string]schema.Input{}
+	ids := []string{}
+	for _, task := range taskList {
+		for _, input := range task.Inputs {
+			if _, ok := inputs[input.Id]; !ok {
+				ids = append(ids, input.Id)
+			}
+			inputs[input.Id] = input
+		}
+	}
+
+	completions := []string{}
+	if key, value, ok := strings.Cut(toComplete, "="); ok {
+		input, found := inputs[key]
+		if !found {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+
+		values := input.Selection
+		switch {
+		case input.InputType() == schema.InputBool:
+			values = []string{"true", "false"}
+		case input.InputType() == schema.InputPath:
+			return nil, cobra.ShellCompDirectiveDefault
+		case len(values) == 0 && (key == "host" || key == "hosts"):
+			values = wf.Hosts.Keys()
+			for _, name := range wf.Hosts.Keys() {
+				host, _ := wf.Hosts.Get(name)
+				values = append(values, host.Groups...)
+			}
+			slices.Sort(values)
+			values = slices.Compact(values)
+		}
+
+		for _, v := range values {
+			if strings.HasPrefix(v, value) {
+				completions = append(completions, prefix+key+"="+v)
+			}
+		}
+
+		return completions, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	slices.Sort(ids)
+	for _, id := range ids {
+		if !strings.HasPrefix(id, toComplete) {
+			continue
+		}
+
+		completion := prefix + id + "="
+		if input := inputs[id]; input.Desc != nil && len(*input.Desc) > 0 {
+			completion += "\t" + *input.Desc
+		}
+		completions = append(completions, completion)
+	}
+
+	return completions, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+}
+
+// completionWorkflow loads the runfile for completions, without command
+// substitution, or returns nil when it cannot be loaded. The file, dir
+// and context flags are read from args or from the parsed flags of cmd.
+func completionWorkflow(cmd *cobra.Command, args []string) *workflows.Workflow {
+	flags := newRunFlags()
+	_, cmdArgs, _ := splitRunArgs(flags, args)
+	flags.Parse(cmdArgs)
+
+	value := func(name string) string {
+		if f := flags.Lookup(name); f != nil && f.Changed {
+			return f.Value.String()
+		}
+
+		if f := cmd.Flags().Lookup(name); f != nil {
+			return f.Value.String()
+		}
+
+		return ""
+	}
+
+	file, err := getFile(value("file"), value("dir"))
+	if err != nil {
+		return nil
+	}
+
+	rf := schema.NewRunfile()
+	if err := rf.DecodeYAMLFile(file); err != nil {
+		return nil
+	}
+	rf.Path = file
+	rf.Config.Substitution = false
+
+	wf := workflows.NewWorkflow()
+	wf.Context = cmd.Context()
+	if contextName := value("context"); contextName != "" {
+		wf.ContextName = contextName
+	}
+
+	err = wf.Load(*rf)
+	wf.Cleanup()
+	if err != nil {
+		return nil
+	}
+
+	return wf
+}
@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+const completionRunfile = `
+contexts:
+  prod: {}
+hosts:
+  web1:
+    host: 10.0.0.1
+    groups: [web]
+include:
+  api: api
+tasks:
+  build:
+    desc: |
+      Builds the app
+      with go
+    run: go build
+  build:ci:
+    run: go build -v
+  test:
+    hooks:
+      before: [setup]
+    run: go test
+  test:setup:
+    run: echo setup
+  deploy:
+    needs: [build]
+    inputs:
+      - id: target
+        desc: Where to deploy
+        selection: [staging, prod]
+      - id: dry
+        type: bool
+      - id: hosts
+    run: echo deploy
+`
+
+// writeCompletionRunfile writes the runfile and the runfile it includes
+// and returns the path of the runfile.
+func writeCompletionRunfile(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"runfile":     completionRunfile,
+		"api/runfile": "tasks:\n  serve:\n    desc: Serves the api\n    run: go run .\n",
+	}
+
+	for name, content := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return filepath.Join(dir, "runfile")
+}
+
+func TestCompleteRun(t *testing.T) {
+	file := writeCompletionRunfile(t)
+
+	tests := []struct {
+		name       string
+		args       []string
+		toComplete string
+		want       []string
+		directive  cobra.ShellCompDirective
+	}{
+		{
+			name: "tasks",
+			args: []string{"-f", file},
+			want: []string{
+				"build\tBuilds the app", "build:ci", "test", "test:setup", "deploy", "api:serve\tServes the api",
+			},
+			directive: cobra.ShellCompDirectiveNoFileComp,
+		},
+		{
+			name:       "tasks with prefix",
+			args:       []string{"--file", file},
+			toComplete: "api:",
+			want:       []string{"api:serve\tServes the api"},
+			directive:  cobra.ShellCompDirectiveNoFileComp,
+		},
+		{
+			name:      "contexts",
+			args:      []string{"-f", file, "--context"},
+			want:      []string{"ci", "default", "prod"},
+			directive: cobra.ShellCompDirectiveNoFileComp,
+		},
+		{
+			name:       "context flag value",
+			args:       []string{"-f", file},
+			toComplete: "--context=p",
+			want:       []string{"--context=prod"},
+			directive:  cobra.ShellCompDirectiveNoFileComp,
+		},
+		{
+			name:      "input keys of the target",
+			args:      []string{"-f", file, "deploy", "--input"},
+			want:      []string{"dry=", "hosts=", "target=\tWhere to deploy"},
+			directive: cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace,
+		},
+		{
+			name:       "input selection",
+			args:       []string{"-f", file, "deploy"},
+			toComplete: "--input=target=s",
+			want:       []string{"--input=target=staging"},
+			directive:  cobra.ShellCompDirectiveNoFileComp,
+		},
+		{
+			name:       "bool input",
+			args:       []string{"-f", file, "deploy", "--input"},
+			toComplete: "dry=",
+			want:       []string{"dry=true", "dry=false"},
+			directive:  cobra.ShellCompDirectiveNoFileComp,
+		},
+		{
+			name:       "host input",
+			args:       []string{"-f", file, "deploy", "--input"},
+			toComplete: "hosts=",
+			want:       []string{"hosts=web", "hosts=web1"},
+			directive:  cobra.ShellCompDirectiveNoFileComp,
+		},
+		{
+			name:       "flags",
+			args:       []string{"-f", file},
+			toComplete: "--no-",
+			want:       []string{"--no-input\tNever prompt for missing inputs and values, fail instead"},
+			directive:  cobra.ShellCompDirectiveNoFileComp,
+		},
+		{
+			name:      "task arguments",
+			args:      []string{"-f", file, "build"},
+			directive: cobra.ShellCompDirectiveDefault,
+		},
+		{
+			name:      "report format",
+			args:      []string{"--report"},
+			want:      []string{"json", "junit"},
+			directive: cobra.ShellCompDirectiveNoFileComp,
+		},
+		{
+			name:      "missing runfile",
+			args:      []string{"-f", filepath.Join(t.TempDir(), "runfile")},
+			directive: cobra.ShellCompDirectiveNoFileComp,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, directive := completeRun(&cobra.Command{}, tt.args, tt.toComplete)
+			if tt.want == nil {
+				assert.Empty(t, got)
+			} else {
+				assert.Equal(t, tt.want, got)
+			}
+			assert.Equal(t, tt.directive, directive)
+		})
+	}
+}
+
+// TestCompletionCommand checks the output the shell scripts of run
+// completion read.
+func TestCompletionCommand(t *testing.T) {
+	file := writeCompletionRunfile(t)
+
+	out := &bytes.Buffer{}
+	rootCmd.SetOut(out)
+	rootCmd.SetArgs([]string{cobra.ShellCompRequestCmd, "-f", file, "te"})
+	defer rootCmd.SetArgs(nil)
+	defer rootCmd.SetOut(nil)
+
+	assert.NoError(t, rootCmd.Execute())
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Equal(t, []string{"test", "test:setup", ":4"}, lines)
+}
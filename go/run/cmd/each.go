@@ -0,0 +1,193 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/frostyeti/mvps/go/run/schema"
+	"github.com/frostyeti/mvps/go/run/tasks/statuses"
+	"github.com/frostyeti/mvps/go/run/workflows"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// eachCmd represents the each command
+var eachCmd = &cobra.Command{
+	Use:   "each [OPTIONS] [TASK...] [--] [REMAINING_ARGS...]",
+	Short: "Runs a task in every project under config.dirs.projects.",
+	Long: `Run a task in every project under config.dirs.projects, the same as run --all.
+A project is a directory with its own runfile. The task runs with its before
+and after hooks in up to --parallel-projects projects at once and a summary
+of the projects is written at the end. Projects without the task are skipped.
+--parallel sets how many tasks run at once within each project.
+
+After a project fails no other project is started. --fail-fast also cancels
+the projects that are running and --keep-going runs every project.`,
+	Example: `run each build
+  run each --parallel-projects 4 --keep-going test
+  run --all --fail-fast lint`,
+	Args:               cobra.ArbitraryArgs,
+	DisableFlagParsing: true,
+	Run: func(cmd *cobra.Command, a []string) {
+		args := os.Args
+		if len(args) > 0 {
+			// always will be the cli command
+			args = args[1:]
+			for i, arg := range args {
+				if arg == "each" {
+					args = append(args[:i], args[i+1:]...)
+					break
+				}
+			}
+		}
+
+		flags := newRunFlags()
+		targets, cmdArgs, remainingArgs := splitRunArgs(flags, args)
+		if len(targets) == 0 {
+			targets = append(targets, "default")
+		}
+
+		err := flags.Parse(cmdArgs)
+		if err != nil {
+			cmd.PrintErrf("Error parsing flags: %v\n", err)
+			os.Exit(1)
+		}
+
+		inputValues, _ := flags.GetStringArray("input")
+		inputs, err := parseInputs(inputValues)
+		if err != nil {
+			cmd.PrintErrf("Error parsing flags: %v\n", err)
+			os.Exit(1)
+		}
+
+		file, _ := flags.GetString("file")
+		dir, _ := flags.GetString("dir")
+		file, err = getFile(file, dir)
+		if err != nil {
+			cmd.PrintErrf("Error resolving file: %v\n", err)
+			os.Exit(1)
+		}
+
+		tf := schema.NewRunfile()
+		err = tf.DecodeYAMLFile(file)
+		tf.Path = file
+		if err != nil {
+			cmd.PrintErrf("Error loading runfile: %v\n", err)
+			os.Exit(1)
+		}
+
+		if dotenvFiles, _ := flags.GetStringArray("dotenv"); len(dotenvFiles) > 0 {
+			tf.DotEnv = append(tf.DotEnv, dotenvFiles...)
+		}
+
+		envVars, _ := flags.GetStringToString("env")
+		for k, v := range envVars {
+			tf.Env.Set(k, v)
+		}
+
+		wf := workflows.NewWorkflow()
+		wf.Context = cmd.Context()
+		if contextName, _ := flags.GetString("context"); contextName != "" {
+			wf.ContextName = contextName
+		}
+		wf.Parallel, _ = flags.GetInt("parallel")
+		wf.Force, _ = flags.GetBool("force")
+		wf.Inputs = inputs
+		wf.NoInput, _ = flags.GetBool("no-input")
+		wf.AssumeYes, _ = flags.GetBool("yes")
+		wf.DryRun, _ = flags.GetBool("dry-run")
+		wf.Affected, _ = flags.GetBool("affected")
+		wf.Since, _ = flags.GetString("since")
+
+		err = wf.Load(*tf)
+		if err != nil {
+			cmd.PrintErrf("Error loading runfile: %v\n", err)
+			os.Exit(1)
+		}
+
+		os.Exit(runEach(cmd, wf, flags, targets, remainingArgs))
+	},
+}
+
+// runEach runs the targets in every project of the workflow, writes the
+// summary of the projects and returns the exit code.
+func runEach(cmd *cobra.Command, wf *workflows.Workflow, flags *pflag.FlagSet, targets []string, args []string) int {
+	wf.FailFast, _ = flags.GetBool("fail-fast")
+	wf.KeepGoing, _ = flags.GetBool("keep-going")
+	wf.ProjectParallelism, _ = flags.GetInt("parallel-projects")
+
+	results, err := wf.RunEach(targets, args)
+	if len(results) > 0 {
+		writeProjectResults(results)
+	}
+
+	if err != nil {
+		cmd.PrintErrf("error running workflow: %v\n", err)
+		if cmd.Context().Err() != nil {
+			// interrupted, exit like a shell does for SIGINT
+			return 130
+		}
+		return 1
+	}
+
+	return 0
+}
+
+// writeProjectResults writes a table of the projects with their status,
+// how long they ran and the first line of their error or message.
+func writeProjectResults(results []workflows.ProjectResult) {
+	longest := len("PROJECT")
+	for _, r := range results {
+		if len(r.Project.Name) > longest {
+			longest = len(r.Project.Name)
+		}
+	}
+
+	fmt.Fprintln(os.Stdout)
+	fmt.Fprintln(os.Stdout, "\x1b[1m"+pad("PROJECT", longest)+"  "+pad("STATUS", 9)+"  "+pad("DURATION", 9)+"  MESSAGE\x1b[22m")
+	for _, r := range results {
+		color := "\x1b[33m"
+		switch r.Status {
+		case statuses.Ok:
+			color = "\x1b[32m"
+		case statuses.Error:
+			color = "\x1b[31m"
+		}
+
+		duration := "-"
+		if d := r.Duration(); d > 0 {
+			duration = d.Round(time.Millisecond).String()
+		}
+
+		message := r.Message
+		if r.Err != nil {
+			message = r.Err.Error()
+		}
+		message = strings.TrimSpace(strings.SplitN(message, "\n", 2)[0])
+
+		line := pad(r.Project.Name, longest) + "  " + color + pad(statuses.Name(r.Status), 9) + "\x1b[0m  " + pad(duration, 9)
+		if message != "" {
+			line += "  " + message
+		}
+		fmt.Fprintln(os.Stdout, strings.TrimRight(line, " "))
+	}
+}
+
+// pad pads s with spaces to width.
+func pad(s string, width int) string {
+	if len(s) >= width {
+		return s
+	}
+
+	return s + strings.Repeat(" ", width-len(s))
+}
+
+func init() {
+	rootCmd.AddCommand(eachCmd)
+	eachCmd.ValidArgsFunction = completeRun
+}
@@ -4,36 +4,129 @@ Copyright © 2025 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
-	"fmt"
+	"os"
 
+	"github.com/frostyeti/mvps/go/run/schema"
+	"github.com/frostyeti/mvps/go/run/workflows"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 // execCmd represents the exec command
 var execCmd = &cobra.Command{
-	Use:   "exec",
-	Short: "A brief description of your command",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("exec called")
+	Use:   "exec [OPTIONS] [--] COMMAND [ARGS...]",
+	Short: "Runs a command with the environment of the runfile.",
+	Long: `Run a command with the environment of the runfile.
+The environment includes the env and dotenv files of the runfile and the
+context, the path additions of the config, ./bin and ./node_modules/.bin.
+The command runs in the directory of the runfile and its exit code is
+the exit code of run. The -- separator may be used to keep flags of the
+command from being parsed as flags of run.`,
+	Example: `run exec -- go test ./...
+  run exec -c staging -E .env.local -- terraform plan
+  run exec -e DEBUG=1 node script.js`,
+	Args:               cobra.ArbitraryArgs,
+	DisableFlagParsing: true,
+	Run: func(cmd *cobra.Command, a []string) {
+		args := os.Args
+		for i, arg := range args {
+			if arg == "exec" {
+				args = args[i+1:]
+				break
+			}
+		}
+
+		flags := newRunFlags()
+		cmdArgs, command := splitExecArgs(flags, args)
+
+		err := flags.Parse(cmdArgs)
+		if err != nil {
+			cmd.PrintErrf("Error parsing flags: %v\n", err)
+			os.Exit(1)
+		}
+
+		if len(command) == 0 {
+			cmd.PrintErrln("Error: no command given")
+			os.Exit(1)
+		}
+
+		file, _ := flags.GetString("file")
+		dir, _ := flags.GetString("dir")
+
+		file, err = getFile(file, dir)
+		if err != nil {
+			cmd.PrintErrf("Error resolving file: %v\n", err)
+			os.Exit(1)
+		}
+
+		dotenvFiles, _ := flags.GetStringArray("dotenv")
+		envVars, _ := flags.GetStringToString("env")
+
+		tf := schema.NewRunfile()
+
+		err = tf.DecodeYAMLFile(file)
+		tf.Path = file
+
+		if err != nil {
+			cmd.PrintErrf("Error loading runfile: %v\n", err)
+			os.Exit(1)
+		}
+
+		if len(dotenvFiles) > 0 {
+			tf.DotEnv = append(tf.DotEnv, dotenvFiles...)
+		}
+
+		for k, v := range envVars {
+			tf.Env.Set(k, v)
+		}
+
+		wf := workflows.NewWorkflow()
+		wf.Context = cmd.Context()
+		wf.ContextName, _ = flags.GetString("context")
+
+		err = wf.Load(*tf)
+		if err != nil {
+			cmd.PrintErrf("Error loading runfile: %v\n", err)
+			os.Exit(1)
+		}
+
+		code, err := wf.Exec(command)
+		if err != nil {
+			cmd.PrintErrf("Error running command: %v\n", err)
+		}
+
+		os.Exit(code)
 	},
 }
 
-func init() {
-	rootCmd.AddCommand(execCmd)
+// splitExecArgs splits the arguments of exec into the flags of run and the
+// command, which starts after -- or at the first argument that is not a
+// flag or the value of one.
+func splitExecArgs(flags *pflag.FlagSet, args []string) ([]string, []string) {
+	cmdArgs := []string{}
+	command := []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			command = args[i+1:]
+			break
+		}
+
+		if len(arg) < 2 || arg[0] != '-' {
+			command = args[i:]
+			break
+		}
 
-	// Here you will define your flags and configuration settings.
+		cmdArgs = append(cmdArgs, arg)
+		if takesValue(flags, arg) && i+1 < len(args) {
+			i++
+			cmdArgs = append(cmdArgs, args[i])
+		}
+	}
 
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// execCmd.PersistentFlags().String("foo", "", "A help for foo")
+	return cmdArgs, command
+}
 
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// execCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+func init() {
+	rootCmd.AddCommand(execCmd)
 }
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitExecArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		flags   []string
+		command []string
+	}{
+		{
+			name:    "command",
+			args:    []string{"go", "test", "./..."},
+			flags:   []string{},
+			command: []string{"go", "test", "./..."},
+		},
+		{
+			name:    "separator",
+			args:    []string{"-c", "staging", "--", "terraform", "plan", "-out", "plan"},
+			flags:   []string{"-c", "staging"},
+			command: []string{"terraform", "plan", "-out", "plan"},
+		},
+		{
+			name:    "flags without separator",
+			args:    []string{"-e", "DEBUG=1", "--dotenv=.env.local", "-y", "node", "--inspect", "script.js"},
+			flags:   []string{"-e", "DEBUG=1", "--dotenv=.env.local", "-y"},
+			command: []string{"node", "--inspect", "script.js"},
+		},
+		{
+			name:    "value that looks like a flag",
+			args:    []string{"--file", "-runfile", "ls"},
+			flags:   []string{"--file", "-runfile"},
+			command: []string{"ls"},
+		},
+		{
+			name:    "no command",
+			args:    []string{"-c", "staging", "--"},
+			flags:   []string{"-c", "staging"},
+			command: []string{},
+		},
+		{
+			name:    "dash",
+			args:    []string{"-", "cat"},
+			flags:   []string{},
+			command: []string{"-", "cat"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags, command := splitExecArgs(newRunFlags(), tt.args)
+			assert.Equal(t, tt.flags, flags)
+			assert.Equal(t, tt.command, command)
+		})
+	}
+}
@@ -0,0 +1,97 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"os"
+
+	"github.com/frostyeti/mvps/go/run/schema"
+	"github.com/frostyeti/mvps/go/run/workflows"
+	"github.com/spf13/cobra"
+)
+
+// graphCmd represents the graph command
+var graphCmd = &cobra.Command{
+	Use:   "graph [OPTIONS] [TASK...]",
+	Short: "Prints the dependency graph of the tasks.",
+	Long: `Print the dependency graph of the tasks in the runfile.
+The graph shows needs, before and after hooks, context specific tasks
+(task:context) and the dynamic tasks that tasks use. Cycles in the needs
+of the tasks are highlighted. Without tasks, the graph holds every task.`,
+	Example: `run graph --format mermaid deploy
+  run graph build test | dot -Tsvg > graph.svg
+  run graph --format json`,
+	Args: cobra.ArbitraryArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString("format")
+		switch format {
+		case "dot", "mermaid", "json":
+		default:
+			cmd.PrintErrf("Error parsing flags: unsupported graph format: %s\n", format)
+			os.Exit(1)
+		}
+
+		file, _ := cmd.Flags().GetString("file")
+		dir, _ := cmd.Flags().GetString("dir")
+		file, err := getFile(file, dir)
+		if err != nil {
+			cmd.PrintErrf("Error resolving file: %v\n", err)
+			os.Exit(1)
+		}
+
+		rf := schema.NewRunfile()
+		err = rf.DecodeYAMLFile(file)
+		rf.Path = file
+		if err != nil {
+			cmd.PrintErrf("Error loading runfile: %v\n", err)
+			os.Exit(1)
+		}
+
+		wf := workflows.NewWorkflow()
+		wf.Context = cmd.Context()
+		if contextName, _ := cmd.Flags().GetString("context"); contextName != "" {
+			wf.ContextName = contextName
+		}
+
+		err = wf.Load(*rf)
+		if err != nil {
+			cmd.PrintErrf("Error loading runfile: %v\n", err)
+			os.Exit(1)
+		}
+
+		graph, err := wf.Graph(args)
+		if err != nil {
+			cmd.PrintErrf("Error building graph: %v\n", err)
+			os.Exit(1)
+		}
+
+		switch format {
+		case "mermaid":
+			err = graph.WriteMermaid(os.Stdout)
+		case "json":
+			err = graph.WriteJSON(os.Stdout)
+		default:
+			err = graph.WriteDot(os.Stdout)
+		}
+
+		if err != nil {
+			cmd.PrintErrf("Error writing graph: %v\n", err)
+			os.Exit(1)
+		}
+
+		if len(graph.Cycles) > 0 {
+			cmd.PrintErr(&workflows.CyclicalReferenceError{Paths: graph.Cycles})
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(graphCmd)
+
+	graphCmd.Flags().String("format", "dot", "Format of the graph. One of dot, mermaid or json")
+	graphCmd.Flags().StringP("file", "f", os.Getenv("RUN_FILE"), "Path to the runfile (default is ./runfile)")
+	graphCmd.Flags().StringP("dir", "d", os.Getenv("RUN_DIR"), "Directory of the runfile (default is current directory)")
+	graphCmd.Flags().StringP("context", "c", os.Getenv("RUN_CONTEXT"), "Context to use.")
+}
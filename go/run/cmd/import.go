@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/frostyeti/mvps/go/run/schema"
+	"github.com/frostyeti/mvps/go/run/workflows"
+	"github.com/spf13/cobra"
+)
+
+// importCmd represents the import command
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Manage remote task imports",
+	Long:  `Commands for the remote task imports of the runfile.`,
+}
+
+// importLockCmd represents the import lock command
+var importLockCmd = &cobra.Command{
+	Use:   "lock",
+	Short: "Pin the digests of remote task imports",
+	Long: `Fetches every https:// and git+https:// task import of the runfile, ignoring
+the cache, and writes their sha256 digests to runfile.lock next to the runfile.
+Later runs verify remote imports without a declared checksum against the lockfile.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		file, _ := cmd.Flags().GetString("file")
+		dir, _ := cmd.Flags().GetString("dir")
+		file, err := getFile(file, dir)
+		if err != nil {
+			cmd.PrintErrf("Error loading runfile: %v\n", err)
+			os.Exit(1)
+		}
+
+		rf := schema.NewRunfile()
+		err = rf.DecodeYAMLFile(file)
+		if err != nil {
+			cmd.PrintErrf("Error decoding runfile: %v\n", err)
+			os.Exit(1)
+		}
+
+		lockfile, err := workflows.LockImports(cmd.Context(), *rf)
+		if err != nil {
+			cmd.PrintErrf("Error locking imports: %v\n", err)
+			os.Exit(1)
+		}
+
+		for _, imp := range lockfile.Imports {
+			cmd.Printf("%s %s\n", imp.Checksum, imp.Source)
+		}
+
+		cmd.Printf("wrote %s\n", lockfile.Path)
+	},
+}
+
+func init() {
+	flags := importLockCmd.Flags()
+	flags.StringP("file", "f", "", "Path to the runfile")
+	flags.StringP("dir", "d", "", "Directory to search for the runfile")
+	importCmd.AddCommand(importLockCmd)
+	rootCmd.AddCommand(importCmd)
+}
@@ -4,6 +4,7 @@ Copyright © 2025 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"fmt"
 	"os"
 	"slices"
 	"strings"
@@ -88,6 +89,44 @@ var listCmd = &cobra.Command{
 	},
 }
 
+// writeContexts writes the contexts of the workflow with their
+// descriptions, marking the context in use.
+func writeContexts(wf *workflows.Workflow) {
+	contexts := wf.ListContexts()
+	longest := 0
+	for _, c := range contexts {
+		if len(c.Name) > longest {
+			longest = len(c.Name)
+		}
+	}
+
+	current := wf.ContextName
+	if current == "" {
+		current = "default"
+	}
+
+	for _, c := range contexts {
+		marker := "  "
+		if c.Name == current {
+			marker = "* "
+		}
+
+		desc := ""
+		if c.Desc != nil {
+			desc = strings.TrimSpace(strings.SplitN(*c.Desc, "\n", 2)[0])
+		}
+		if c.Extends != "" {
+			desc = strings.TrimSpace(desc + " (extends " + c.Extends + ")")
+		}
+
+		line := marker + "\x1b[34m" + c.Name + "\x1b[0m"
+		if desc != "" {
+			line += strings.Repeat(" ", longest-len(c.Name)+2) + desc
+		}
+		fmt.Fprintln(os.Stdout, line)
+	}
+}
+
 func init() {
 	taskCmd.AddCommand(listCmd)
 }
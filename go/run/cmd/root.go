@@ -4,9 +4,12 @@ Copyright © 2025 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
 	"github.com/frostyeti/mvps/go/env"
 	"github.com/frostyeti/mvps/go/run/schema"
@@ -71,44 +74,8 @@ to quickly create a Cobra application.`,
 			}
 		}
 
-		flags := pflag.NewFlagSet("", pflag.ContinueOnError)
-		flags.StringP("file", "f", env.Get("RUN_FILE"), "Path to the runfile (default is ./runfile)")
-		flags.StringP("dir", "d", env.Get("RUN_DIR"), "Directory to run the task in (default is current directory)")
-		flags.StringArrayP("dotenv", "E", []string{}, "List of dotenv files to load")
-		flags.StringToStringP("env", "e", map[string]string{}, "List of environment variables to set")
-		flags.StringP("context", "c", env.Get("RUN_CONTEXT"), "Context to use.")
-
-		targets := []string{}
-		cmdArgs := []string{}
-		remainingArgs := []string{}
-		size := len(args)
-		inRemaining := false
-		for i := 0; i < size; i++ {
-			n := args[i]
-			if n == "--" {
-				inRemaining = true
-				continue
-			}
-
-			if inRemaining {
-				remainingArgs = append(remainingArgs, args[i])
-				continue
-			}
-
-			if len(n) > 0 && n[0] == '-' {
-				cmdArgs = append(cmdArgs, n)
-				j := i + 1
-				if j < size && len(args[j]) > 0 && args[j][0] != '-' {
-					cmdArgs = append(cmdArgs, args[j])
-					i++ // Skip the next argument as it's a value for the flag
-				}
-
-				continue
-			}
-
-			targets = append(targets, n)
-			inRemaining = true
-		}
+		flags := newRunFlags()
+		targets, cmdArgs, remainingArgs := splitRunArgs(flags, args)
 
 		if len(targets) == 0 {
 			targets = append(targets, "default")
@@ -120,6 +87,21 @@ to quickly create a Cobra application.`,
 			os.Exit(1)
 		}
 
+		reportFormat, _ := flags.GetString("report")
+		switch reportFormat {
+		case "", "json", "junit", "xml":
+		default:
+			cmd.PrintErrf("Error parsing flags: unsupported report format: %s\n", reportFormat)
+			os.Exit(1)
+		}
+
+		inputValues, _ := flags.GetStringArray("input")
+		inputs, err := parseInputs(inputValues)
+		if err != nil {
+			cmd.PrintErrf("Error parsing flags: %v\n", err)
+			os.Exit(1)
+		}
+
 		file, _ := flags.GetString("file")
 		dir, _ := flags.GetString("dir")
 
@@ -154,6 +136,18 @@ to quickly create a Cobra application.`,
 		}
 
 		wf := workflows.NewWorkflow()
+		wf.Context = cmd.Context()
+		if contextName, _ := flags.GetString("context"); contextName != "" {
+			wf.ContextName = contextName
+		}
+		wf.Parallel, _ = flags.GetInt("parallel")
+		wf.Force, _ = flags.GetBool("force")
+		wf.Inputs = inputs
+		wf.NoInput, _ = flags.GetBool("no-input")
+		wf.AssumeYes, _ = flags.GetBool("yes")
+		wf.DryRun, _ = flags.GetBool("dry-run")
+		wf.Affected, _ = flags.GetBool("affected")
+		wf.Since, _ = flags.GetString("since")
 
 		err = wf.Load(*tf)
 		if err != nil {
@@ -161,6 +155,15 @@ to quickly create a Cobra application.`,
 			os.Exit(1)
 		}
 
+		if list, _ := flags.GetBool("list-contexts"); list {
+			writeContexts(wf)
+			os.Exit(0)
+		}
+
+		if all, _ := flags.GetBool("all"); all {
+			os.Exit(runEach(cmd, wf, flags, targets, remainingArgs))
+		}
+
 		foundOneTarget := false
 		for _, t := range targets {
 			_, ok := wf.Tasks.Get(t)
@@ -176,11 +179,27 @@ to quickly create a Cobra application.`,
 			os.Exit(1)
 		}
 
-		err = wf.Run(targets, remainingArgs)
+		if watch, _ := flags.GetBool("watch"); watch {
+			err = wf.Watch(targets, remainingArgs)
+		} else {
+			err = wf.Run(targets, remainingArgs)
+		}
+
+		if reportFormat != "" {
+			reportFile, _ := flags.GetString("report-file")
+			if err := writeReport(wf, err, reportFormat, reportFile); err != nil {
+				cmd.PrintErrf("Error writing report: %v\n", err)
+				os.Exit(1)
+			}
+		}
 
 		if err != nil {
 			msg := fmt.Errorf("error running workflow: %w", err)
 			cmd.PrintErrf("%v\n", msg)
+			if cmd.Context().Err() != nil {
+				// interrupted, exit like a shell does for SIGINT
+				os.Exit(130)
+			}
 			os.Exit(1)
 		}
 
@@ -196,7 +215,12 @@ to quickly create a Cobra application.`,
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	err := rootCmd.Execute()
+	// SIGINT and SIGTERM cancel the context, which stops the running tasks
+	// and their processes instead of killing run outright.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err := rootCmd.ExecuteContext(ctx)
 	if err != nil {
 		os.Exit(1)
 	}
@@ -219,4 +243,21 @@ func init() {
 	rootCmd.PersistentFlags().StringP("dir", "d", dir, "Directory to run the task in (default is current directory).")
 	rootCmd.PersistentFlags().StringP("context", "c", context, "The context to use. If not set, the 'default' context is used.")
 
+	// RunE parses os.Args itself, the run flags are registered so that
+	// cobra accepts them and lists them in the help output. file, dir and
+	// context are the persistent flags above.
+	newRunFlags().VisitAll(func(flag *pflag.Flag) {
+		if rootCmd.PersistentFlags().Lookup(flag.Name) == nil {
+			rootCmd.Flags().AddFlag(flag)
+		}
+	})
+
+	rootCmd.ValidArgsFunction = completeRun
+	rootCmd.RegisterFlagCompletionFunc("context", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return completeContexts(cmd, nil, toComplete)
+	})
+	rootCmd.RegisterFlagCompletionFunc("input", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return completeInputs(cmd, args, toComplete, "")
+	})
+
 }
@@ -7,11 +7,9 @@ import (
 	"fmt"
 	"os"
 
-	"github.com/frostyeti/mvps/go/env"
 	"github.com/frostyeti/mvps/go/run/schema"
 	"github.com/frostyeti/mvps/go/run/workflows"
 	"github.com/spf13/cobra"
-	"github.com/spf13/pflag"
 )
 
 // taskCmd represents the run command
@@ -52,44 +50,8 @@ force all subsequent arguments to be treated as remaining arguments.`,
 			}
 		}
 
-		flags := pflag.NewFlagSet("", pflag.ContinueOnError)
-		flags.StringP("file", "f", env.Get("RUN_FILE"), "Path to the runfile (default is ./runfile)")
-		flags.StringP("dir", "d", env.Get("RUN_DIR"), "Directory to run the task in (default is current directory)")
-		flags.StringArrayP("dotenv", "E", []string{}, "List of dotenv files to load")
-		flags.StringToStringP("env", "e", map[string]string{}, "List of environment variables to set")
-		flags.StringP("context", "c", env.Get("RUN_CONTEXT"), "Context to use.")
-
-		targets := []string{}
-		cmdArgs := []string{}
-		remainingArgs := []string{}
-		size := len(args)
-		inRemaining := false
-		for i := 0; i < size; i++ {
-			n := args[i]
-			if n == "--" {
-				inRemaining = true
-				continue
-			}
-
-			if inRemaining {
-				remainingArgs = append(remainingArgs, args[i])
-				continue
-			}
-
-			if len(n) > 0 && n[0] == '-' {
-				cmdArgs = append(cmdArgs, n)
-				j := i + 1
-				if j < size && len(args[j]) > 0 && args[j][0] != '-' {
-					cmdArgs = append(cmdArgs, args[j])
-					i++ // Skip the next argument as it's a value for the flag
-				}
-
-				continue
-			}
-
-			targets = append(targets, n)
-			inRemaining = true
-		}
+		flags := newRunFlags()
+		targets, cmdArgs, remainingArgs := splitRunArgs(flags, args)
 
 		if len(targets) == 0 {
 			targets = append(targets, "default")
@@ -101,6 +63,21 @@ force all subsequent arguments to be treated as remaining arguments.`,
 			os.Exit(1)
 		}
 
+		reportFormat, _ := flags.GetString("report")
+		switch reportFormat {
+		case "", "json", "junit", "xml":
+		default:
+			cmd.PrintErrf("Error parsing flags: unsupported report format: %s\n", reportFormat)
+			os.Exit(1)
+		}
+
+		inputValues, _ := flags.GetStringArray("input")
+		inputs, err := parseInputs(inputValues)
+		if err != nil {
+			cmd.PrintErrf("Error parsing flags: %v\n", err)
+			os.Exit(1)
+		}
+
 		file, _ := flags.GetString("file")
 		dir, _ := flags.GetString("dir")
 
@@ -135,6 +112,18 @@ force all subsequent arguments to be treated as remaining arguments.`,
 		}
 
 		wf := workflows.NewWorkflow()
+		wf.Context = cmd.Context()
+		if contextName, _ := flags.GetString("context"); contextName != "" {
+			wf.ContextName = contextName
+		}
+		wf.Parallel, _ = flags.GetInt("parallel")
+		wf.Force, _ = flags.GetBool("force")
+		wf.Inputs = inputs
+		wf.NoInput, _ = flags.GetBool("no-input")
+		wf.AssumeYes, _ = flags.GetBool("yes")
+		wf.DryRun, _ = flags.GetBool("dry-run")
+		wf.Affected, _ = flags.GetBool("affected")
+		wf.Since, _ = flags.GetString("since")
 
 		err = wf.Load(*tf)
 		if err != nil {
@@ -142,11 +131,36 @@ force all subsequent arguments to be treated as remaining arguments.`,
 			os.Exit(1)
 		}
 
-		err = wf.Run(targets, remainingArgs)
+		if list, _ := flags.GetBool("list-contexts"); list {
+			writeContexts(wf)
+			os.Exit(0)
+		}
+
+		if all, _ := flags.GetBool("all"); all {
+			os.Exit(runEach(cmd, wf, flags, targets, remainingArgs))
+		}
+
+		if watch, _ := flags.GetBool("watch"); watch {
+			err = wf.Watch(targets, remainingArgs)
+		} else {
+			err = wf.Run(targets, remainingArgs)
+		}
+
+		if reportFormat != "" {
+			reportFile, _ := flags.GetString("report-file")
+			if err := writeReport(wf, err, reportFormat, reportFile); err != nil {
+				cmd.PrintErrf("Error writing report: %v\n", err)
+				os.Exit(1)
+			}
+		}
 
 		if err != nil {
 			msg := fmt.Errorf("error running workflow: %w", err)
 			cmd.PrintErrf("%v\n", msg)
+			if cmd.Context().Err() != nil {
+				// interrupted, exit like a shell does for SIGINT
+				os.Exit(130)
+			}
 			os.Exit(1)
 		}
 
@@ -156,6 +170,7 @@ force all subsequent arguments to be treated as remaining arguments.`,
 
 func init() {
 	rootCmd.AddCommand(taskCmd)
+	taskCmd.ValidArgsFunction = completeRun
 
 	taskCmd.Flags().StringArrayP("dotenv", "E", []string{}, "List of dotenv files to load")
 	taskCmd.Flags().StringToStringP("env", "e", map[string]string{}, "List of environment variables to  ")
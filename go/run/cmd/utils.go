@@ -5,13 +5,179 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/frostyeti/mvps/go/env"
 	"github.com/frostyeti/mvps/go/run/schema"
 	"github.com/frostyeti/mvps/go/run/workflows"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"go.yaml.in/yaml/v4"
 )
 
+// newRunFlags returns the flags understood when running tasks. The root
+// and task commands parse os.Args with these themselves so that anything
+// after the first target is passed to the task untouched.
+func newRunFlags() *pflag.FlagSet {
+	flags := pflag.NewFlagSet("", pflag.ContinueOnError)
+	flags.StringP("file", "f", env.Get("RUN_FILE"), "Path to the runfile (default is ./runfile)")
+	flags.StringP("dir", "d", env.Get("RUN_DIR"), "Directory to run the task in (default is current directory)")
+	flags.StringArrayP("dotenv", "E", []string{}, "List of dotenv files to load")
+	flags.StringToStringP("env", "e", map[string]string{}, "List of environment variables to set")
+	flags.StringP("context", "c", env.Get("RUN_CONTEXT"), "Context to use.")
+	flags.IntP("parallel", "p", 0, "Maximum number of tasks to run at the same time (default is config.parallelism or 1)")
+	flags.Bool("force", false, "Run tasks even when their sources are up to date")
+	flags.String("report", "", "Write a report of the run. One of json or junit")
+	flags.String("report-file", "", "The file to write the report to, or - for stdout (default is run-report.json or run-report.xml)")
+	flags.StringArray("input", []string{}, "Set an input of the target tasks as key=value")
+	flags.Bool("no-input", false, "Never prompt for missing inputs and values, fail instead")
+	flags.BoolP("yes", "y", false, "Confirm tasks that ask for confirmation without prompting")
+	flags.Bool("dry-run", false, "Print what the tasks would do without running them")
+	flags.Bool("watch", false, "Run the tasks again when their watch or sources files change")
+	flags.Bool("affected", false, "Only run the tasks whose sources, cwd or project changed since --since, the tasks that need them and the tasks they need")
+	flags.String("since", "", "The git ref --affected compares against (default is HEAD)")
+	flags.Bool("list-contexts", false, "List the contexts of the runfile")
+	flags.Bool("all", false, "Run the target in every project under config.dirs.projects")
+	flags.Int("parallel-projects", 1, "With --all, maximum number of projects to run at the same time")
+	flags.Bool("fail-fast", false, "With --all, cancel the running projects when one fails")
+	flags.Bool("keep-going", false, "With --all, run every project even when one fails")
+	return flags
+}
+
+// splitRunArgs splits args into targets, flags and the remaining
+// arguments for the task. The first non-flag argument is a target and
+// every argument after it, or after --, is a remaining argument, except
+// for --input flags given between the target and --.
+func splitRunArgs(flags *pflag.FlagSet, args []string) ([]string, []string, []string) {
+	targets := []string{}
+	cmdArgs := []string{}
+	remainingArgs := []string{}
+	size := len(args)
+	inRemaining := false
+	afterDashes := false
+	for i := 0; i < size; i++ {
+		n := args[i]
+		if n == "--" && !afterDashes {
+			inRemaining = true
+			afterDashes = true
+			continue
+		}
+
+		if inRemaining && !afterDashes {
+			if strings.HasPrefix(n, "--input=") {
+				cmdArgs = append(cmdArgs, n)
+				continue
+			}
+
+			if n == "--input" && i+1 < size {
+				cmdArgs = append(cmdArgs, n, args[i+1])
+				i++
+				continue
+			}
+		}
+
+		if inRemaining {
+			remainingArgs = append(remainingArgs, args[i])
+			continue
+		}
+
+		if len(n) > 0 && n[0] == '-' {
+			cmdArgs = append(cmdArgs, n)
+			j := i + 1
+			if takesValue(flags, n) && j < size && len(args[j]) > 0 && args[j][0] != '-' {
+				cmdArgs = append(cmdArgs, args[j])
+				i++ // Skip the next argument as it's a value for the flag
+			}
+
+			continue
+		}
+
+		targets = append(targets, n)
+		inRemaining = true
+	}
+
+	return targets, cmdArgs, remainingArgs
+}
+
+// takesValue reports whether the flag in arg expects its value in the
+// next argument. Unknown flags are assumed to take a value.
+func takesValue(flags *pflag.FlagSet, arg string) bool {
+	if strings.ContainsRune(arg, '=') {
+		return false
+	}
+
+	var flag *pflag.Flag
+	if strings.HasPrefix(arg, "--") {
+		flag = flags.Lookup(arg[2:])
+	} else if len(arg) == 2 {
+		flag = flags.ShorthandLookup(arg[1:])
+	} else {
+		return false
+	}
+
+	if flag == nil {
+		return true
+	}
+
+	return flag.NoOptDefVal == ""
+}
+
+// parseInputs parses the values of --input flags in the form key=value.
+func parseInputs(values []string) (map[string]string, error) {
+	inputs := map[string]string{}
+	for _, v := range values {
+		key, value, ok := strings.Cut(v, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid input %q, expected key=value", v)
+		}
+
+		inputs[key] = value
+	}
+
+	return inputs, nil
+}
+
+// writeReport writes the report of the workflow's last run in the given
+// format to file, or to stdout when file is "-". The report is written to
+// run-report.json or run-report.xml when file is empty, so that it is not
+// mixed with the output of the tasks.
+func writeReport(wf *workflows.Workflow, runErr error, format string, file string) error {
+	report := wf.Report(runErr)
+
+	if file == "" {
+		file = "run-report.json"
+		if format != "json" {
+			file = "run-report.xml"
+		}
+	}
+
+	w := os.Stdout
+	if file != "-" {
+		if dir := filepath.Dir(file); dir != "" {
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				return err
+			}
+		}
+
+		f, err := os.Create(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	switch format {
+	case "json":
+		return report.WriteJSON(w)
+	case "junit", "xml":
+		return report.WriteJUnit(w)
+	default:
+		return fmt.Errorf("unsupported report format: %s", format)
+	}
+}
+
 func getFile(file string, dir string) (string, error) {
 
 	if file == "" && dir == "" {
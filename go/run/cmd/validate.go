@@ -0,0 +1,99 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/frostyeti/mvps/go/run/validate"
+	"github.com/spf13/cobra"
+)
+
+// validateCmd represents the validate command
+var validateCmd = &cobra.Command{
+	Use:   "validate [OPTIONS] [FILE]",
+	Short: "Validates a runfile and the files it imports.",
+	Long: `Validate a runfile, the task definition files and the hosts files it
+imports against the json schema of run. Unknown fields are reported at
+every level. It also reports needs of tasks that do not exist, hooks
+pointing to missing tasks, unknown uses handlers, hosts that no task uses
+and invalid durations. Problems are printed as file:line:column.`,
+	Example: `run validate
+  run validate ./ci/runfile
+  run validate --format json`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString("format")
+		switch format {
+		case "text", "json":
+		default:
+			cmd.PrintErrf("Error parsing flags: unsupported format: %s\n", format)
+			os.Exit(1)
+		}
+
+		file, _ := cmd.Flags().GetString("file")
+		if len(args) > 0 {
+			file = args[0]
+		}
+		dir, _ := cmd.Flags().GetString("dir")
+		file, err := getFile(file, dir)
+		if err != nil {
+			cmd.PrintErrf("Error resolving file: %v\n", err)
+			os.Exit(1)
+		}
+
+		problems, err := validate.File(file)
+		if err != nil {
+			cmd.PrintErrf("Error validating runfile: %v\n", err)
+			os.Exit(1)
+		}
+
+		wd, _ := os.Getwd()
+		for i, p := range problems {
+			if rel, err := filepath.Rel(wd, p.File); err == nil && !strings.HasPrefix(rel, "..") {
+				problems[i].File = rel
+			}
+		}
+
+		if format == "json" {
+			data, err := json.MarshalIndent(problems, "", "  ")
+			if err != nil {
+				cmd.PrintErrf("Error writing problems: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Println(string(data))
+		} else {
+			errs, warnings := 0, 0
+			for _, p := range problems {
+				fmt.Println(p.String())
+				if p.Severity == validate.SeverityError {
+					errs++
+				} else {
+					warnings++
+				}
+			}
+
+			if len(problems) == 0 {
+				fmt.Println("No problems found.")
+			} else {
+				fmt.Println(strconv.Itoa(errs) + " error(s), " + strconv.Itoa(warnings) + " warning(s)")
+			}
+		}
+
+		if validate.HasErrors(problems) {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+
+	validateCmd.Flags().String("format", "text", "Format of the problems. One of text or json")
+}
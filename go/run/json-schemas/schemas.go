@@ -0,0 +1,10 @@
+// Package jsonschemas embeds the json schemas of the files run reads.
+package jsonschemas
+
+import _ "embed"
+
+// Runfile is the json schema of runfiles. Its definitions hold the schemas
+// of imported task definition files (taskdefs) and hosts files (hostsfile).
+//
+//go:embed runfile.schema.json
+var Runfile []byte
@@ -0,0 +1,198 @@
+package prompts
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+var (
+	// ErrNotInteractive is returned when a prompt is needed but stdin is not
+	// a terminal.
+	ErrNotInteractive = errors.New("stdin is not a terminal")
+
+	mu sync.Mutex
+	// in is read without a buffer, so that the input after an answer is
+	// left to the commands that read stdin once the prompts are done.
+	in           io.Reader = os.Stdin
+	out          io.Writer = os.Stderr
+	isTerminal             = func() bool { return term.IsTerminal(int(os.Stdin.Fd())) }
+	readPassword           = func() ([]byte, error) { return term.ReadPassword(int(os.Stdin.Fd())) }
+)
+
+// Interactive reports whether stdin is a terminal that prompts can read.
+func Interactive() bool {
+	mu.Lock()
+	defer mu.Unlock()
+
+	return isTerminal()
+}
+
+// Redirect makes the prompts read their answers from r and write their
+// questions to w as if r was a terminal, with secrets read as lines of r.
+// The returned function restores stdin and stderr.
+func Redirect(r io.Reader, w io.Writer) func() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	prevIn, prevOut, prevTerminal, prevPassword := in, out, isTerminal, readPassword
+	in = r
+	out = w
+	isTerminal = func() bool { return true }
+	readPassword = func() ([]byte, error) {
+		line, err := readRawLine()
+		return []byte(line), err
+	}
+
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+
+		in, out, isTerminal, readPassword = prevIn, prevOut, prevTerminal, prevPassword
+	}
+}
+
+// Text prompts for a line of text. An empty answer returns def.
+func Text(label string, def string) (string, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if def != "" {
+		fmt.Fprintf(out, "%s [%s]: ", label, def)
+	} else {
+		fmt.Fprintf(out, "%s: ", label)
+	}
+
+	answer, err := readLine()
+	if err != nil {
+		return "", err
+	}
+
+	if answer == "" {
+		return def, nil
+	}
+
+	return answer, nil
+}
+
+// Secret prompts for a value without echoing it to the terminal.
+func Secret(label string) (string, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if !isTerminal() {
+		return "", ErrNotInteractive
+	}
+
+	fmt.Fprintf(out, "%s: ", label)
+	b, err := readPassword()
+	fmt.Fprintln(out)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+// Select shows the options as a numbered menu and prompts until one is
+// chosen by number or by value. An empty answer returns def when it is set.
+func Select(label string, options []string, def string) (string, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	fmt.Fprintf(out, "%s:\n", label)
+	for i, option := range options {
+		marker := " "
+		if option == def {
+			marker = "*"
+		}
+		fmt.Fprintf(out, " %s %d) %s\n", marker, i+1, option)
+	}
+
+	for {
+		fmt.Fprintf(out, "Choose [1-%d]: ", len(options))
+		answer, err := readLine()
+		if err != nil {
+			return "", err
+		}
+
+		if answer == "" && def != "" {
+			return def, nil
+		}
+
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(options) {
+			return options[n-1], nil
+		}
+
+		for _, option := range options {
+			if option == answer {
+				return option, nil
+			}
+		}
+
+		fmt.Fprintf(out, "'%s' is not one of the options\n", answer)
+	}
+}
+
+// Confirm asks a yes or no question. Anything other than y or yes is no.
+func Confirm(message string) (bool, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	fmt.Fprintf(out, "%s [y/N]: ", message)
+	answer, err := readLine()
+	if err != nil {
+		return false, err
+	}
+
+	switch strings.ToLower(answer) {
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+func readLine() (string, error) {
+	if !isTerminal() {
+		return "", ErrNotInteractive
+	}
+
+	line, err := readRawLine()
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(line), nil
+}
+
+// readRawLine reads a line from in a byte at a time, so that nothing past
+// the line is consumed. A last line without a newline is returned as is.
+func readRawLine() (string, error) {
+	line := []byte{}
+	b := make([]byte, 1)
+	for {
+		n, err := in.Read(b)
+		if n > 0 {
+			if b[0] == '\n' {
+				return strings.TrimSuffix(string(line), "\r"), nil
+			}
+
+			line = append(line, b[0])
+		}
+
+		if err != nil {
+			if errors.Is(err, io.EOF) && len(line) > 0 {
+				return string(line), nil
+			}
+
+			return "", err
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package prompts
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestText(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		def   string
+		want  string
+		err   bool
+	}{
+		{name: "answer", input: "web\n", want: "web"},
+		{name: "trimmed", input: "  web \r\n", want: "web"},
+		{name: "default", input: "\n", def: "api", want: "api"},
+		{name: "last line", input: "web", want: "web"},
+		{name: "eof", input: "", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			defer Redirect(strings.NewReader(tt.input), out)()
+
+			got, err := Text("name", tt.def)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestTextLabel(t *testing.T) {
+	out := &bytes.Buffer{}
+	defer Redirect(strings.NewReader("\n\n"), out)()
+
+	_, _ = Text("name", "")
+	_, _ = Text("name", "api")
+	assert.Equal(t, "name: name [api]: ", out.String())
+}
+
+func TestSecret(t *testing.T) {
+	out := &bytes.Buffer{}
+	defer Redirect(strings.NewReader("s3cr3t\n"), out)()
+
+	got, err := Secret("token")
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cr3t", got)
+	assert.Equal(t, "token: \n", out.String())
+}
+
+func TestSelect(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		def   string
+		want  string
+	}{
+		{name: "number", input: "2\n", want: "staging"},
+		{name: "value", input: "prod\n", want: "prod"},
+		{name: "default", input: "\n", def: "dev", want: "dev"},
+		{name: "retry", input: "4\nqa\n\n1\n", want: "dev"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			defer Redirect(strings.NewReader(tt.input), out)()
+
+			got, err := Select("env", []string{"dev", "staging", "prod"}, tt.def)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSelectMenu(t *testing.T) {
+	out := &bytes.Buffer{}
+	defer Redirect(strings.NewReader("4\n2\n"), out)()
+
+	_, err := Select("env", []string{"dev", "prod"}, "prod")
+	assert.NoError(t, err)
+	assert.Equal(t, "env:\n   1) dev\n * 2) prod\nChoose [1-2]: '4' is not one of the options\nChoose [1-2]: ", out.String())
+}
+
+func TestConfirm(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{"y\n", true},
+		{"YES\n", true},
+		{"n\n", false},
+		{"\n", false},
+		{"sure\n", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.TrimSpace(tt.input), func(t *testing.T) {
+			defer Redirect(strings.NewReader(tt.input), io.Discard)()
+
+			got, err := Confirm("deploy?")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// TestPromptsLeaveInput checks that a prompt reads only its line, leaving
+// the rest of the input to whatever reads it next.
+func TestPromptsLeaveInput(t *testing.T) {
+	input := strings.NewReader("web\nrest of stdin\n")
+	defer Redirect(input, io.Discard)()
+
+	got, err := Text("name", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "web", got)
+
+	rest, err := io.ReadAll(input)
+	assert.NoError(t, err)
+	assert.Equal(t, "rest of stdin\n", string(rest))
+}
+
+func TestRedirectRestores(t *testing.T) {
+	restore := Redirect(strings.NewReader(""), io.Discard)
+	assert.True(t, Interactive())
+	restore()
+
+	assert.Equal(t, isTerminal(), Interactive())
+	_, ok := in.(*strings.Reader)
+	assert.False(t, ok)
+}
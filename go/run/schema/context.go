@@ -0,0 +1,239 @@
+package schema
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/frostyeti/mvps/go/errors"
+	"go.yaml.in/yaml/v4"
+)
+
+// Context holds what a runfile sets for one context, e.g. dev, staging or
+// prod, selected with --context or RUN_CONTEXT. Its env, dotenv files,
+// hosts, values and shell apply on top of those of the runfile. A context
+// that extends another starts from the settings of that context.
+type Context struct {
+	Name    string
+	Desc    *string
+	Extends string
+	Env     *Environment
+	DotEnv  []string
+	Hosts   HostImports
+	Values  map[string]interface{}
+	Shell   *string
+}
+
+type Contexts []Context
+
+func NewContext(name string) *Context {
+	return &Context{
+		Name:   name,
+		Env:    NewEnv(),
+		DotEnv: []string{},
+		Hosts:  *NewHostImports(),
+		Values: map[string]interface{}{},
+	}
+}
+
+func (c *Context) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.MappingNode {
+		return yamlErrorf(*value, "expected yaml mapping for context")
+	}
+
+	for i := 0; i < len(value.Content); i += 2 {
+		keyNode := value.Content[i]
+		valueNode := value.Content[i+1]
+
+		key := keyNode.Value
+		switch key {
+		case "desc":
+			if valueNode.Kind != yaml.ScalarNode {
+				return yamlErrorf(*valueNode, "expected yaml scalar for 'desc' field")
+			}
+			c.Desc = &valueNode.Value
+		case "extends":
+			if valueNode.Kind != yaml.ScalarNode {
+				return yamlErrorf(*valueNode, "expected yaml scalar for 'extends' field")
+			}
+			c.Extends = valueNode.Value
+		case "env":
+			if valueNode.Kind != yaml.MappingNode {
+				return yamlErrorf(*valueNode, "expected yaml mapping for 'env' field")
+			}
+			if err := valueNode.Decode(c.Env); err != nil {
+				return err
+			}
+		case "dotenv", "dot-env", "dot_env":
+			switch valueNode.Kind {
+			case yaml.ScalarNode:
+				c.DotEnv = []string{valueNode.Value}
+			case yaml.SequenceNode:
+				for _, v := range valueNode.Content {
+					if v.Kind != yaml.ScalarNode {
+						return yamlErrorf(*v, "expected yaml scalar in 'dotenv' array")
+					}
+					c.DotEnv = append(c.DotEnv, v.Value)
+				}
+			default:
+				return yamlErrorf(*valueNode, "expected yaml scalar or array for 'dotenv' field")
+			}
+		case "hosts":
+			if err := valueNode.Decode(&c.Hosts); err != nil {
+				return yamlErrorf(*valueNode, "failed to decode 'hosts' field: %v", err)
+			}
+		case "values":
+			if valueNode.Kind != yaml.MappingNode {
+				return yamlErrorf(*valueNode, "expected yaml mapping for 'values' field")
+			}
+			if err := valueNode.Decode(&c.Values); err != nil {
+				return yamlErrorf(*valueNode, "failed to decode 'values' field: %v", err)
+			}
+		case "shell":
+			if valueNode.Kind != yaml.ScalarNode {
+				return yamlErrorf(*valueNode, "expected yaml scalar for 'shell' field")
+			}
+			c.Shell = &valueNode.Value
+		default:
+			return yamlErrorf(*keyNode, "unexpected field '%s' in context", key)
+		}
+	}
+
+	return nil
+}
+
+func (x *Contexts) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.MappingNode {
+		return yamlErrorf(*value, "expected yaml mapping for 'contexts' field")
+	}
+
+	contexts := Contexts{}
+	extends := map[string]*yaml.Node{}
+	for i := 0; i < len(value.Content); i += 2 {
+		keyNode := value.Content[i]
+		valueNode := value.Content[i+1]
+
+		name := keyNode.Value
+		if len(name) == 0 || strings.ContainsAny(name, ": \t") {
+			return yamlErrorf(*keyNode, "invalid context name '%s', it must not be empty or contain ':' or spaces", name)
+		}
+
+		if _, ok := contexts.Get(name); ok {
+			return yamlErrorf(*keyNode, "duplicate context '%s'", name)
+		}
+
+		context := NewContext(name)
+		if !(valueNode.Kind == yaml.ScalarNode && valueNode.Tag == "!!null") {
+			if err := valueNode.Decode(context); err != nil {
+				return err
+			}
+		}
+
+		for j := 0; j+1 < len(valueNode.Content); j += 2 {
+			if valueNode.Content[j].Value == "extends" {
+				extends[name] = valueNode.Content[j+1]
+			}
+		}
+
+		contexts = append(contexts, *context)
+	}
+
+	for _, context := range contexts {
+		if context.Extends == "" {
+			continue
+		}
+
+		if _, ok := contexts.Get(context.Extends); !ok {
+			return yamlErrorf(*extends[context.Name], "context '%s' extends unknown context '%s'", context.Name, context.Extends)
+		}
+
+		if _, err := contexts.Resolve(context.Name); err != nil {
+			return yamlErrorf(*extends[context.Name], "%v", err)
+		}
+	}
+
+	*x = contexts
+	return nil
+}
+
+// Get returns the context with the name as it is declared.
+func (x Contexts) Get(name string) (*Context, bool) {
+	for i := range x {
+		if x[i].Name == name {
+			return &x[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// Names returns the names of the contexts in the order they are declared.
+func (x Contexts) Names() []string {
+	names := make([]string, 0, len(x))
+	for _, c := range x {
+		names = append(names, c.Name)
+	}
+
+	return names
+}
+
+// Resolve returns the context with the name merged with the contexts it
+// extends, the settings of the context overriding those it extends. A
+// context that is not declared resolves to an empty context, as contexts
+// may only be used to pick task:context tasks.
+func (x Contexts) Resolve(name string) (*Context, error) {
+	chain := []*Context{}
+	names := []string{}
+	for next := name; next != ""; {
+		if i := slices.Index(names, next); i >= 0 {
+			return nil, errors.New("context '" + next + "' extends itself: " + strings.Join(append(names[i:], next), " -> "))
+		}
+		names = append(names, next)
+
+		context, ok := x.Get(next)
+		if !ok {
+			if next == name {
+				break
+			}
+
+			return nil, errors.New("context '" + name + "' extends unknown context '" + next + "'")
+		}
+
+		chain = append(chain, context)
+		next = context.Extends
+	}
+
+	resolved := NewContext(name)
+	for i := len(chain) - 1; i >= 0; i-- {
+		context := chain[i]
+		if i == 0 {
+			resolved.Desc = context.Desc
+			resolved.Extends = context.Extends
+		}
+
+		if context.Env != nil {
+			for k, v := range context.Env.Iter() {
+				if context.Env.IsSecret(k) {
+					resolved.Env.SetSecret(k, v)
+				} else {
+					resolved.Env.Set(k, v)
+				}
+			}
+		}
+
+		resolved.DotEnv = append(resolved.DotEnv, context.DotEnv...)
+		resolved.Hosts.Imports = append(resolved.Hosts.Imports, context.Hosts.Imports...)
+		for k, v := range context.Hosts.Hosts.Iter() {
+			resolved.Hosts.Hosts.Set(k, &v)
+		}
+
+		for k, v := range context.Values {
+			resolved.Values[k] = v
+		}
+
+		if context.Shell != nil && len(*context.Shell) > 0 {
+			resolved.Shell = context.Shell
+		}
+	}
+
+	return resolved, nil
+}
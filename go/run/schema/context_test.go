@@ -0,0 +1,80 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.yaml.in/yaml/v4"
+)
+
+func TestContextsResolve(t *testing.T) {
+	contexts := Contexts{}
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+base:
+  env:
+    REGION: us-east-1
+    LEVEL: info
+  shell: bash
+staging:
+  extends: base
+  env:
+    LEVEL: debug
+  values:
+    replicas: 1
+prod:
+  extends: staging
+  values:
+    replicas: 3
+`), &contexts))
+
+	prod, err := contexts.Resolve("prod")
+	assert.NoError(t, err)
+	assert.Equal(t, "prod", prod.Name)
+	assert.Equal(t, "staging", prod.Extends)
+	assert.Equal(t, "us-east-1", prod.Env.GetString("REGION"))
+	assert.Equal(t, "debug", prod.Env.GetString("LEVEL"))
+	assert.Equal(t, "bash", *prod.Shell)
+	assert.Equal(t, 3, prod.Values["replicas"])
+
+	// a context that is not declared is empty
+	other, err := contexts.Resolve("other")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, other.Env.Len())
+}
+
+func TestContextsErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		err  string
+	}{
+		{
+			name: "cycle",
+			yaml: "a:\n  extends: b\nb:\n  extends: c\nc:\n  extends: a\n",
+			err:  "context 'a' extends itself: a -> b -> c -> a on line 2, at column 12",
+		},
+		{
+			name: "cycle through another context",
+			yaml: "a:\n  extends: b\nb:\n  extends: c\nc:\n  extends: b\n",
+			err:  "context 'b' extends itself: b -> c -> b on line 2, at column 12",
+		},
+		{
+			name: "unknown extends",
+			yaml: "a:\n  extends: nope\n",
+			err:  "context 'a' extends unknown context 'nope' on line 2, at column 12",
+		},
+		{
+			name: "invalid name",
+			yaml: "'a:b': {}\n",
+			err:  "invalid context name 'a:b', it must not be empty or contain ':' or spaces on line 1, at column 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contexts := Contexts{}
+			err := yaml.Unmarshal([]byte(tt.yaml), &contexts)
+			assert.ErrorContains(t, err, tt.err)
+		})
+	}
+}
@@ -25,7 +25,7 @@ type environmentVariable struct {
 	IsSecret bool
 }
 
-func (ev *environmentVariable) UnmarshalYAML(node yaml.Node) error {
+func (ev *environmentVariable) UnmarshalYAML(node *yaml.Node) error {
 	if ev == nil {
 		ev = &environmentVariable{}
 	}
@@ -44,7 +44,7 @@ func (ev *environmentVariable) UnmarshalYAML(node yaml.Node) error {
 			ev.IsSecret = true
 			return nil
 		} else {
-			return yamlErrorf(node, "invalid environment variable format, expected 'KEY=VALUE' or 'KEY:VALUE'")
+			return yamlErrorf(*node, "invalid environment variable format, expected 'KEY=VALUE' or 'KEY:VALUE'")
 		}
 	}
 
@@ -83,10 +83,10 @@ func (ev *environmentVariable) UnmarshalYAML(node yaml.Node) error {
 		return nil
 	}
 
-	return yamlErrorf(node, "expected yaml scalar or mapping for environment variable")
+	return yamlErrorf(*node, "expected yaml scalar or mapping for environment variable")
 }
 
-func (e *Environment) UnmarshalYAML(node yaml.Node) error {
+func (e *Environment) UnmarshalYAML(node *yaml.Node) error {
 	if e == nil {
 		e = &Environment{}
 	}
@@ -206,7 +206,7 @@ func (e *Environment) UnmarshalYAML(node yaml.Node) error {
 		return nil
 	}
 
-	return yamlErrorf(node, "expected yaml sequence for environment")
+	return yamlErrorf(*node, "expected yaml sequence for environment")
 }
 
 func NewEnv() *Environment {
@@ -262,6 +262,14 @@ func (e *Environment) Set(key, value string) {
 	e.values[key] = value
 }
 
+// SetSecret sets the variable and marks its value as a secret.
+func (e *Environment) SetSecret(key, value string) {
+	e.Set(key, value)
+	if !e.IsSecret(key) {
+		e.secrets = append(e.secrets, key)
+	}
+}
+
 func (e *Environment) Get(key string) (string, bool) {
 	e.init()
 	val, ok := e.values[key]
@@ -5,11 +5,18 @@ import (
 	"iter"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/frostyeti/mvps/go/errors"
 	"go.yaml.in/yaml/v4"
 )
 
+const (
+	KnownHostsStrict    = "strict"
+	KnownHostsAcceptNew = "accept-new"
+	KnownHostsOff       = "off"
+)
+
 type HostEntry struct {
 	Host         string
 	Port         *uint
@@ -20,6 +27,13 @@ type HostEntry struct {
 	Meta         map[string]interface{}
 	OS           *OS
 	Defaults     string
+	// KnownHosts is how the host key is verified: strict, accept-new or off.
+	KnownHosts     *string
+	KnownHostsFile *string
+	// Jump lists the hosts to connect through, in order, as names of other
+	// host entries or as [user@]host[:port].
+	Jump      []string
+	KeepAlive *time.Duration
 }
 
 type Hosts struct {
@@ -262,6 +276,63 @@ func (he *HostEntry) UnmarshalYAML(value *yaml.Node) error {
 				return yamlErrorf(*valueNode, "expected yaml scalar for 'defaults' field")
 			}
 			he.Defaults = valueNode.Value
+		case "known-hosts", "known_hosts", "knownHosts":
+			if valueNode.Kind != yaml.ScalarNode {
+				return yamlErrorf(*valueNode, "expected yaml scalar for 'known-hosts' field")
+			}
+			mode := strings.ToLower(strings.TrimSpace(valueNode.Value))
+			switch mode {
+			case "yes", "true":
+				mode = KnownHostsStrict
+			case "no", "false":
+				mode = KnownHostsOff
+			}
+
+			switch mode {
+			case KnownHostsStrict, KnownHostsAcceptNew, KnownHostsOff:
+				he.KnownHosts = &mode
+			default:
+				return yamlErrorf(*valueNode, "expected 'strict', 'accept-new' or 'off' for 'known-hosts' field")
+			}
+		case "known-hosts-file", "known_hosts_file", "knownHostsFile":
+			if valueNode.Kind != yaml.ScalarNode {
+				return yamlErrorf(*valueNode, "expected yaml scalar for 'known-hosts-file' field")
+			}
+			file := valueNode.Value
+			he.KnownHostsFile = &file
+		case "jump", "proxy-jump", "proxyJump":
+			switch valueNode.Kind {
+			case yaml.ScalarNode:
+				he.Jump = []string{}
+				for _, hop := range strings.Split(valueNode.Value, ",") {
+					if hop = strings.TrimSpace(hop); hop != "" {
+						he.Jump = append(he.Jump, hop)
+					}
+				}
+			case yaml.SequenceNode:
+				he.Jump = []string{}
+				for _, item := range valueNode.Content {
+					if item.Kind != yaml.ScalarNode {
+						return yamlErrorf(*item, "expected yaml scalar in 'jump' list")
+					}
+					he.Jump = append(he.Jump, item.Value)
+				}
+			default:
+				return yamlErrorf(*valueNode, "expected yaml scalar or sequence for 'jump' field")
+			}
+		case "keepalive", "keep-alive":
+			if valueNode.Kind != yaml.ScalarNode {
+				return yamlErrorf(*valueNode, "expected yaml scalar for 'keepalive' field")
+			}
+			interval, err := time.ParseDuration(valueNode.Value)
+			if err != nil {
+				seconds, err2 := strconv.Atoi(valueNode.Value)
+				if err2 != nil {
+					return yamlErrorf(*valueNode, "invalid duration for 'keepalive' field: %v", err)
+				}
+				interval = time.Duration(seconds) * time.Second
+			}
+			he.KeepAlive = &interval
 		default:
 			return yamlErrorf(*keyNode, "unexpected field '%s' in host entry", key)
 		}
@@ -0,0 +1,67 @@
+package schema
+
+import (
+	"strings"
+
+	"go.yaml.in/yaml/v4"
+)
+
+// Include is a runfile whose tasks, env, hosts and values are pulled into
+// the namespace of the including runfile, e.g. include: {api: ./api/runfile}
+// exposes the build task of ./api/runfile as api:build. A path that ends
+// with ? is optional.
+type Include struct {
+	Namespace string
+	Path      string
+}
+
+type Includes []Include
+
+func (x *Includes) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.MappingNode {
+		return yamlErrorf(*value, "expected yaml mapping for 'include' field")
+	}
+
+	includes := Includes{}
+	for i := 0; i < len(value.Content); i += 2 {
+		keyNode := value.Content[i]
+		valueNode := value.Content[i+1]
+
+		namespace := keyNode.Value
+		if len(namespace) == 0 || strings.ContainsAny(namespace, ": \t") {
+			return yamlErrorf(*keyNode, "invalid include namespace '%s', it must not be empty or contain ':' or spaces", namespace)
+		}
+
+		include := Include{Namespace: namespace}
+		switch valueNode.Kind {
+		case yaml.ScalarNode:
+			include.Path = valueNode.Value
+		case yaml.MappingNode:
+			for j := 0; j < len(valueNode.Content); j += 2 {
+				subKeyNode := valueNode.Content[j]
+				subValueNode := valueNode.Content[j+1]
+
+				switch subKeyNode.Value {
+				case "path":
+					if subValueNode.Kind != yaml.ScalarNode {
+						return yamlErrorf(*subValueNode, "expected yaml scalar for 'path' field")
+					}
+					include.Path = subValueNode.Value
+				default:
+					return yamlErrorf(*subKeyNode, "unexpected field '%s' in include", subKeyNode.Value)
+				}
+			}
+		default:
+			return yamlErrorf(*valueNode, "expected yaml scalar or mapping for include '%s'", namespace)
+		}
+
+		if len(strings.TrimSpace(include.Path)) == 0 {
+			return yamlErrorf(*valueNode, "include '%s' has an empty path", namespace)
+		}
+
+		includes = append(includes, include)
+	}
+
+	*x = includes
+	return nil
+}
@@ -1,11 +1,31 @@
 package schema
 
 import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 
+	"github.com/frostyeti/mvps/go/errors"
 	"go.yaml.in/yaml/v4"
 )
 
+const (
+	InputString = "string"
+	InputInt    = "int"
+	InputBool   = "bool"
+	InputEnum   = "enum"
+	InputList   = "list"
+	InputPath   = "path"
+	InputSecret = "secret"
+)
+
+// Input declares an input of a task. Type is one of string, int, bool,
+// enum, list, path or secret and defaults to enum when Selection is set and
+// string otherwise. Min and Max bound the value of int inputs, the number
+// of items of list inputs and the length of other inputs. Pattern must
+// match the value, or every item of a list.
 type Input struct {
 	Id        string
 	Name      *string
@@ -13,6 +33,13 @@ type Input struct {
 	Default   *string
 	Required  *bool
 	Selection []string
+	Type      string
+	Pattern   *string
+	Min       *float64
+	Max       *float64
+	pattern   *regexp.Regexp
+	line      int
+	column    int
 }
 
 func (input *Input) UnmarshalYAML(value *yaml.Node) error {
@@ -20,6 +47,10 @@ func (input *Input) UnmarshalYAML(value *yaml.Node) error {
 		return yamlErrorf(*value, "expected yaml mapping for input")
 	}
 
+	input.line = value.Line
+	input.column = value.Column
+	var defaultNode *yaml.Node
+
 	for i := 0; i < len(value.Content); i += 2 {
 		keyNode := value.Content[i]
 		valueNode := value.Content[i+1]
@@ -44,11 +75,24 @@ func (input *Input) UnmarshalYAML(value *yaml.Node) error {
 			desc := valueNode.Value
 			input.Desc = &desc
 		case "default":
-			if valueNode.Kind != yaml.ScalarNode {
-				return yamlErrorf(*valueNode, "expected yaml scalar for 'default' field")
+			defaultNode = valueNode
+			switch valueNode.Kind {
+			case yaml.ScalarNode:
+				defaultVal := valueNode.Value
+				input.Default = &defaultVal
+			case yaml.SequenceNode:
+				items := []string{}
+				for _, item := range valueNode.Content {
+					if item.Kind != yaml.ScalarNode {
+						return yamlErrorf(*item, "expected yaml scalar in 'default' list")
+					}
+					items = append(items, item.Value)
+				}
+				defaultVal := strings.Join(items, ",")
+				input.Default = &defaultVal
+			default:
+				return yamlErrorf(*valueNode, "expected yaml scalar or sequence for 'default' field")
 			}
-			defaultVal := valueNode.Value
-			input.Default = &defaultVal
 		case "required":
 			if valueNode.Kind != yaml.ScalarNode {
 				return yamlErrorf(*valueNode, "expected yaml scalar for 'required' field")
@@ -69,10 +113,336 @@ func (input *Input) UnmarshalYAML(value *yaml.Node) error {
 				trimmedVal := strings.TrimSpace(v.Value)
 				input.Selection = append(input.Selection, trimmedVal)
 			}
+		case "type":
+			if valueNode.Kind != yaml.ScalarNode {
+				return yamlErrorf(*valueNode, "expected yaml scalar for 'type' field")
+			}
+			t := strings.ToLower(strings.TrimSpace(valueNode.Value))
+			switch t {
+			case "integer", "number":
+				t = InputInt
+			case "boolean":
+				t = InputBool
+			}
+
+			switch t {
+			case InputString, InputInt, InputBool, InputEnum, InputList, InputPath, InputSecret:
+				input.Type = t
+			default:
+				return yamlErrorf(*valueNode, "unknown input type '%s', expected string, int, bool, enum, list, path or secret", valueNode.Value)
+			}
+		case "pattern":
+			if valueNode.Kind != yaml.ScalarNode {
+				return yamlErrorf(*valueNode, "expected yaml scalar for 'pattern' field")
+			}
+			re, err := regexp.Compile(valueNode.Value)
+			if err != nil {
+				return yamlErrorf(*valueNode, "invalid pattern for input: %v", err)
+			}
+			pattern := valueNode.Value
+			input.Pattern = &pattern
+			input.pattern = re
+		case "min", "max":
+			if valueNode.Kind != yaml.ScalarNode {
+				return yamlErrorf(*valueNode, "expected yaml scalar for '%s' field", key)
+			}
+			n, err := strconv.ParseFloat(strings.TrimSpace(valueNode.Value), 64)
+			if err != nil {
+				return yamlErrorf(*valueNode, "expected a number for '%s' field", key)
+			}
+			if key == "min" {
+				input.Min = &n
+			} else {
+				input.Max = &n
+			}
 		default:
 			return yamlErrorf(*keyNode, "unexpected field '%s' in input", key)
 		}
 	}
 
+	if input.Type == InputEnum && len(input.Selection) == 0 {
+		return yamlErrorf(*value, "input of type enum requires a 'selection' field")
+	}
+
+	if input.Min != nil && input.Max != nil && *input.Min > *input.Max {
+		return yamlErrorf(*value, "'min' is greater than 'max' for input")
+	}
+
+	if input.Default != nil && defaultNode != nil {
+		if _, err := input.normalize(*input.Default); err != nil {
+			return yamlErrorf(*defaultNode, "invalid default for input: %s", err.Error())
+		}
+	}
+
 	return nil
 }
+
+// decodeInputs decodes a sequence of inputs or a mapping of input ids to
+// inputs.
+func decodeInputs(node *yaml.Node) ([]Input, error) {
+	inputs := []Input{}
+	switch node.Kind {
+	case yaml.SequenceNode:
+		for _, inputNode := range node.Content {
+			var input Input
+			err := inputNode.Decode(&input)
+			if err != nil {
+				return nil, yamlErrorf(*inputNode, "failed to decode input: %v", err)
+			}
+			inputs = append(inputs, input)
+		}
+	case yaml.MappingNode:
+		for i := 0; i < len(node.Content); i += 2 {
+			keyNode := node.Content[i]
+			valueNode := node.Content[i+1]
+
+			var input Input
+			err := valueNode.Decode(&input)
+			if err != nil {
+				return nil, yamlErrorf(*valueNode, "failed to decode input: %v", err)
+			}
+			input.Id = keyNode.Value
+			inputs = append(inputs, input)
+		}
+	default:
+		return nil, yamlErrorf(*node, "expected yaml sequence or mapping for 'inputs' field")
+	}
+
+	return inputs, nil
+}
+
+// isInputDeclarations reports whether an inputs node declares inputs rather
+// than setting their values, which older runfiles did with the same key.
+func isInputDeclarations(node *yaml.Node) bool {
+	if node.Kind == yaml.SequenceNode {
+		return true
+	}
+
+	if node.Kind != yaml.MappingNode || len(node.Content) == 0 {
+		return false
+	}
+
+	for i := 1; i < len(node.Content); i += 2 {
+		if node.Content[i].Kind != yaml.MappingNode {
+			return false
+		}
+	}
+
+	return true
+}
+
+// InputType returns the declared type of the input or the type implied by
+// its other fields.
+func (input *Input) InputType() string {
+	if input.Type != "" {
+		return input.Type
+	}
+
+	if len(input.Selection) > 0 {
+		return InputEnum
+	}
+
+	return InputString
+}
+
+// IsSecret reports whether the value of the input must be masked.
+func (input *Input) IsSecret() bool {
+	return input.InputType() == InputSecret
+}
+
+// Resolve returns the value of the input from with, or its default, in the
+// string form used for INPUT_ variables. Lists are joined with commas and
+// booleans are true or false. ok is false when the input has no value and
+// is not required. Errors point at the declaration of the input.
+func (input *Input) Resolve(with With) (value string, ok bool, err error) {
+	raw, found := with.TryGetValue(input.Id)
+	if found && raw != nil {
+		value, err = formatInputValue(raw)
+		if err != nil {
+			return "", false, input.errorf("invalid value for input '%s': %s", input.Id, err.Error())
+		}
+	} else if input.Default != nil {
+		value = *input.Default
+		found = true
+	} else {
+		found = false
+	}
+
+	if !found {
+		if input.Required != nil && *input.Required {
+			return "", false, input.errorf("missing required input '%s'", input.Id)
+		}
+
+		return "", false, nil
+	}
+
+	value, err = input.normalize(value)
+	if err != nil {
+		return "", false, input.errorf("invalid value for input '%s': %s", input.Id, err.Error())
+	}
+
+	return value, true, nil
+}
+
+// Validate checks a value against the declaration of the input.
+func (input *Input) Validate(value string) error {
+	if _, err := input.normalize(value); err != nil {
+		return input.errorf("invalid value for input '%s': %s", input.Id, err.Error())
+	}
+
+	return nil
+}
+
+// normalize validates the value and returns it in canonical form.
+func (input *Input) normalize(value string) (string, error) {
+	if input.Pattern != nil && input.pattern == nil {
+		re, err := regexp.Compile(*input.Pattern)
+		if err != nil {
+			return "", fmt.Errorf("invalid pattern: %v", err)
+		}
+		input.pattern = re
+	}
+
+	switch input.InputType() {
+	case InputInt:
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return "", fmt.Errorf("expected an integer")
+		}
+		if input.Min != nil && float64(n) < *input.Min {
+			return "", fmt.Errorf("must be at least %v", *input.Min)
+		}
+		if input.Max != nil && float64(n) > *input.Max {
+			return "", fmt.Errorf("must be at most %v", *input.Max)
+		}
+		value = strconv.Itoa(n)
+		if len(input.Selection) > 0 && !input.selected(value) {
+			return "", fmt.Errorf("must be one of %s", strings.Join(input.Selection, ", "))
+		}
+		if err := input.match(value); err != nil {
+			return "", err
+		}
+		return value, nil
+	case InputBool:
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			switch strings.ToLower(strings.TrimSpace(value)) {
+			case "yes", "y", "on":
+				b = true
+			case "no", "n", "off":
+				b = false
+			default:
+				return "", fmt.Errorf("expected true or false")
+			}
+		}
+		return strconv.FormatBool(b), nil
+	case InputList:
+		items := []string{}
+		for _, item := range strings.Split(value, ",") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			if len(input.Selection) > 0 && !input.selected(item) {
+				return "", fmt.Errorf("item '%s' must be one of %s", item, strings.Join(input.Selection, ", "))
+			}
+			if err := input.match(item); err != nil {
+				return "", err
+			}
+			items = append(items, item)
+		}
+		if input.Min != nil && float64(len(items)) < *input.Min {
+			return "", fmt.Errorf("must have at least %v items", *input.Min)
+		}
+		if input.Max != nil && float64(len(items)) > *input.Max {
+			return "", fmt.Errorf("must have at most %v items", *input.Max)
+		}
+		return strings.Join(items, ","), nil
+	case InputEnum:
+		if !input.selected(value) {
+			return "", fmt.Errorf("must be one of %s", strings.Join(input.Selection, ", "))
+		}
+	case InputPath:
+		if strings.TrimSpace(value) == "" || strings.ContainsRune(value, 0) {
+			return "", fmt.Errorf("expected a path")
+		}
+		value = filepath.Clean(value)
+	}
+
+	if len(input.Selection) > 0 && !input.selected(value) {
+		return "", fmt.Errorf("must be one of %s", strings.Join(input.Selection, ", "))
+	}
+
+	if input.Min != nil && float64(len(value)) < *input.Min {
+		return "", fmt.Errorf("must be at least %v characters", *input.Min)
+	}
+
+	if input.Max != nil && float64(len(value)) > *input.Max {
+		return "", fmt.Errorf("must be at most %v characters", *input.Max)
+	}
+
+	if err := input.match(value); err != nil {
+		return "", err
+	}
+
+	return value, nil
+}
+
+func (input *Input) selected(value string) bool {
+	for _, option := range input.Selection {
+		if option == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (input *Input) match(value string) error {
+	if input.pattern != nil && !input.pattern.MatchString(value) {
+		return fmt.Errorf("must match pattern %s", *input.Pattern)
+	}
+
+	return nil
+}
+
+func (input *Input) errorf(format string, args ...interface{}) error {
+	if input.line > 0 {
+		return yamlErrorf(yaml.Node{Line: input.line, Column: input.column}, format, args...)
+	}
+
+	return errors.New(fmt.Sprintf(format, args...))
+}
+
+// formatInputValue converts a value decoded from yaml, or set on the
+// command line, to the string form of an input.
+func formatInputValue(raw interface{}) (string, error) {
+	switch v := raw.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case []string:
+		return strings.Join(v, ","), nil
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			s, err := formatInputValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, ","), nil
+	default:
+		return "", fmt.Errorf("expected a scalar or list")
+	}
+}
@@ -0,0 +1,53 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.yaml.in/yaml/v4"
+)
+
+func TestInputNormalize(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		value string
+		want  string
+		err   string
+	}{
+		{name: "string", input: "{id: name}", value: "api", want: "api"},
+		{name: "string max", input: "{id: name, max: 3}", value: "apis", err: "must be at most 3 characters"},
+		{name: "string pattern", input: "{id: name, pattern: '^[a-z]+$'}", value: "Api", err: "must match pattern ^[a-z]+$"},
+		{name: "int", input: "{id: count, type: int}", value: " 007 ", want: "7"},
+		{name: "int not a number", input: "{id: count, type: int}", value: "seven", err: "expected an integer"},
+		{name: "int min", input: "{id: count, type: int, min: 1}", value: "0", err: "must be at least 1"},
+		{name: "int max", input: "{id: count, type: int, max: 10}", value: "11", err: "must be at most 10"},
+		{name: "bool", input: "{id: dry, type: bool}", value: "TRUE", want: "true"},
+		{name: "bool yes", input: "{id: dry, type: bool}", value: "yes", want: "true"},
+		{name: "bool off", input: "{id: dry, type: bool}", value: "off", want: "false"},
+		{name: "bool invalid", input: "{id: dry, type: bool}", value: "maybe", err: "expected true or false"},
+		{name: "enum", input: "{id: env, selection: [dev, prod]}", value: "prod", want: "prod"},
+		{name: "enum not selected", input: "{id: env, selection: [dev, prod]}", value: "qa", err: "must be one of dev, prod"},
+		{name: "list", input: "{id: tags, type: list}", value: " a, ,b ,c", want: "a,b,c"},
+		{name: "list selection", input: "{id: tags, type: list, selection: [a, b]}", value: "a,c", err: "item 'c' must be one of a, b"},
+		{name: "list max", input: "{id: tags, type: list, max: 2}", value: "a,b,c", err: "must have at most 2 items"},
+		{name: "path", input: "{id: dir, type: path}", value: "./src/../bin/", want: "bin"},
+		{name: "path empty", input: "{id: dir, type: path}", value: " ", err: "expected a path"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := &Input{}
+			assert.NoError(t, yaml.Unmarshal([]byte(tt.input), input))
+
+			got, err := input.normalize(tt.value)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
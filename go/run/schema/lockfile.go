@@ -0,0 +1,95 @@
+package schema
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+
+	"go.yaml.in/yaml/v4"
+)
+
+// LockfileName is the name of the lockfile written next to the runfile by
+// `run import lock`.
+const LockfileName = "runfile.lock"
+
+// Lockfile pins the digests of remote task imports so that later runs
+// fail when the fetched content changes.
+type Lockfile struct {
+	Path    string         `yaml:"-"`
+	Imports []LockedImport `yaml:"imports"`
+}
+
+type LockedImport struct {
+	Source   string `yaml:"source"`
+	Checksum string `yaml:"checksum"`
+}
+
+func NewLockfile(path string) *Lockfile {
+	return &Lockfile{
+		Path:    path,
+		Imports: []LockedImport{},
+	}
+}
+
+// Get returns the checksum pinned for the source.
+func (l *Lockfile) Get(source string) (string, bool) {
+	if l == nil {
+		return "", false
+	}
+
+	for _, imp := range l.Imports {
+		if imp.Source == source {
+			return imp.Checksum, true
+		}
+	}
+
+	return "", false
+}
+
+func (l *Lockfile) Set(source string, checksum string) {
+	for i, imp := range l.Imports {
+		if imp.Source == source {
+			l.Imports[i].Checksum = checksum
+			return
+		}
+	}
+
+	l.Imports = append(l.Imports, LockedImport{Source: source, Checksum: checksum})
+}
+
+// DecodeYAMLFile reads the lockfile at path. A missing lockfile is not an
+// error and leaves the lockfile empty.
+func (l *Lockfile) DecodeYAMLFile(path string) error {
+	if !filepath.IsAbs(path) {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		path = absPath
+	}
+
+	l.Path = path
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	return yaml.Unmarshal(data, l)
+}
+
+// WriteFile writes the lockfile to its path with the imports sorted by source.
+func (l *Lockfile) WriteFile() error {
+	sort.Slice(l.Imports, func(i, j int) bool {
+		return l.Imports[i].Source < l.Imports[j].Source
+	})
+
+	data, err := yaml.Marshal(l)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(l.Path, data, 0o644)
+}
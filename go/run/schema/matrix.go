@@ -0,0 +1,361 @@
+package schema
+
+import (
+	"sort"
+	"strings"
+
+	"go.yaml.in/yaml/v4"
+)
+
+// Matrix expands a task into one task per combination of the values of
+// its axes. Exclude removes the combinations that match every key of an
+// entry. Include adds keys to the combinations that match the entry's axis
+// values, or adds the entry as a new combination when none match.
+type Matrix struct {
+	axes    map[string][]string
+	keys    []string
+	Include []map[string]string
+	Exclude []map[string]string
+}
+
+// MatrixValues is a single combination of matrix values, ordered by the
+// axes of the matrix followed by any keys added by include.
+type MatrixValues struct {
+	values map[string]string
+	keys   []string
+}
+
+func NewMatrix() *Matrix {
+	return &Matrix{
+		axes:    map[string][]string{},
+		keys:    []string{},
+		Include: []map[string]string{},
+		Exclude: []map[string]string{},
+	}
+}
+
+func (m *Matrix) UnmarshalYAML(value *yaml.Node) error {
+	if m.axes == nil {
+		*m = *NewMatrix()
+	}
+
+	if value.Kind != yaml.MappingNode {
+		return yamlErrorf(*value, "expected yaml mapping for matrix")
+	}
+
+	for i := 0; i < len(value.Content); i += 2 {
+		keyNode := value.Content[i]
+		valueNode := value.Content[i+1]
+
+		key := keyNode.Value
+		switch key {
+		case "include", "exclude":
+			if valueNode.Kind != yaml.SequenceNode {
+				return yamlErrorf(*valueNode, "expected yaml sequence for '%s' field", key)
+			}
+
+			entries := []map[string]string{}
+			for _, item := range valueNode.Content {
+				if item.Kind != yaml.MappingNode {
+					return yamlErrorf(*item, "expected yaml mapping in '%s' list", key)
+				}
+
+				entry := map[string]string{}
+				for j := 0; j < len(item.Content); j += 2 {
+					if item.Content[j+1].Kind != yaml.ScalarNode {
+						return yamlErrorf(*item.Content[j+1], "expected yaml scalar for matrix value '%s'", item.Content[j].Value)
+					}
+					entry[item.Content[j].Value] = item.Content[j+1].Value
+				}
+
+				entries = append(entries, entry)
+			}
+
+			if key == "include" {
+				m.Include = entries
+			} else {
+				m.Exclude = entries
+			}
+		default:
+			values := []string{}
+			switch valueNode.Kind {
+			case yaml.ScalarNode:
+				values = append(values, valueNode.Value)
+			case yaml.SequenceNode:
+				for _, item := range valueNode.Content {
+					if item.Kind != yaml.ScalarNode {
+						return yamlErrorf(*item, "expected yaml scalar in matrix axis '%s'", key)
+					}
+					values = append(values, item.Value)
+				}
+			default:
+				return yamlErrorf(*valueNode, "expected yaml scalar or sequence for matrix axis '%s'", key)
+			}
+
+			m.Set(key, values)
+		}
+	}
+
+	return nil
+}
+
+func (m *Matrix) Set(axis string, values []string) {
+	if m.axes == nil {
+		m.axes = map[string][]string{}
+	}
+
+	if _, ok := m.axes[axis]; !ok {
+		m.keys = append(m.keys, axis)
+	}
+
+	m.axes[axis] = values
+}
+
+func (m *Matrix) Get(axis string) ([]string, bool) {
+	if m == nil || m.axes == nil {
+		return nil, false
+	}
+
+	values, ok := m.axes[axis]
+	return values, ok
+}
+
+func (m *Matrix) Keys() []string {
+	if m == nil {
+		return []string{}
+	}
+
+	return m.keys
+}
+
+// Expand returns every combination of the matrix after exclude and include
+// are applied.
+func (m *Matrix) Expand() []MatrixValues {
+	if m == nil {
+		return []MatrixValues{}
+	}
+
+	combinations := []MatrixValues{}
+	if len(m.keys) > 0 {
+		combinations = append(combinations, MatrixValues{values: map[string]string{}, keys: []string{}})
+	}
+
+	for _, axis := range m.keys {
+		next := []MatrixValues{}
+		for _, c := range combinations {
+			for _, v := range m.axes[axis] {
+				n := c.clone()
+				n.Set(axis, v)
+				next = append(next, n)
+			}
+		}
+		combinations = next
+	}
+
+	filtered := []MatrixValues{}
+	for _, c := range combinations {
+		excluded := false
+		for _, exclude := range m.Exclude {
+			if c.matches(exclude, nil) {
+				excluded = true
+				break
+			}
+		}
+
+		if !excluded {
+			filtered = append(filtered, c)
+		}
+	}
+
+	for _, include := range m.Include {
+		matched := false
+		for i := range filtered {
+			if filtered[i].matches(include, m.axes) {
+				matched = true
+				for _, k := range sortedKeys(include) {
+					if _, isAxis := m.axes[k]; !isAxis {
+						filtered[i].Set(k, include[k])
+					}
+				}
+			}
+		}
+
+		if !matched {
+			n := MatrixValues{values: map[string]string{}, keys: []string{}}
+			for _, axis := range m.keys {
+				if v, ok := include[axis]; ok {
+					n.Set(axis, v)
+				}
+			}
+
+			for _, k := range sortedKeys(include) {
+				n.Set(k, include[k])
+			}
+
+			filtered = append(filtered, n)
+		}
+	}
+
+	return filtered
+}
+
+func (v MatrixValues) Get(key string) (string, bool) {
+	value, ok := v.values[key]
+	return value, ok
+}
+
+func (v *MatrixValues) Set(key, value string) {
+	if v.values == nil {
+		v.values = map[string]string{}
+	}
+
+	if _, ok := v.values[key]; !ok {
+		v.keys = append(v.keys, key)
+	}
+
+	v.values[key] = value
+}
+
+func (v MatrixValues) Keys() []string {
+	return v.keys
+}
+
+func (v MatrixValues) ToMap() map[string]string {
+	m := make(map[string]string, len(v.values))
+	for k, value := range v.values {
+		m[k] = value
+	}
+	return m
+}
+
+// String returns the values in the form used for task ids, go=1.22,os=linux.
+func (v MatrixValues) String() string {
+	parts := make([]string, 0, len(v.keys))
+	for _, k := range v.keys {
+		parts = append(parts, k+"="+v.values[k])
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// EnvName returns the environment variable for a matrix key, MATRIX_ followed
+// by the key in upper case with characters other than letters and digits
+// replaced by underscores.
+func (v MatrixValues) EnvName(key string) string {
+	return "MATRIX_" + strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, key)
+}
+
+func (v MatrixValues) clone() MatrixValues {
+	return MatrixValues{
+		values: v.ToMap(),
+		keys:   append([]string{}, v.keys...),
+	}
+}
+
+// matches reports whether the values match every key of entry. When axes
+// is not nil only the keys that are axes of the matrix are compared.
+func (v MatrixValues) matches(entry map[string]string, axes map[string][]string) bool {
+	for k, expected := range entry {
+		if axes != nil {
+			if _, ok := axes[k]; !ok {
+				continue
+			}
+		}
+
+		if actual, ok := v.values[k]; !ok || actual != expected {
+			return false
+		}
+	}
+
+	return true
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// ExpandMatrices replaces every task that has a matrix with one task per
+// combination, with ids such as test[go=1.22,os=linux]. The original id
+// remains as a task without a run that needs all of the combinations, so
+// that running or needing it runs the whole matrix. Hooks stay on the
+// original task, and every combination needs its before hooks so that they
+// run before the first combination.
+func (t *Tasks) ExpandMatrices() {
+	if t == nil || t.entries == nil {
+		return
+	}
+
+	keys := append([]string{}, t.keys...)
+	for _, key := range keys {
+		task := t.entries[key]
+		if task.Matrix == nil || task.MatrixValues != nil {
+			continue
+		}
+
+		before := []string{}
+		for _, suffix := range task.Hooks.Before {
+			if hook, ok := t.Get(task.Id + ":" + suffix); ok {
+				before = append(before, hook.Id)
+			}
+		}
+
+		needs := []string{}
+		for _, values := range task.Matrix.Expand() {
+			v := values
+			next := task
+			next.Id = task.Id + "[" + v.String() + "]"
+			name := task.Id
+			if task.Name != nil && len(*task.Name) > 0 {
+				name = *task.Name
+			}
+			name = name + "[" + v.String() + "]"
+			next.Name = &name
+			next.MatrixValues = &v
+			next.Hooks = Hooks{Before: []string{}, After: []string{}}
+			next.Needs = append(append([]string{}, task.Needs...), before...)
+
+			env := NewEnv()
+			for _, k := range v.Keys() {
+				env.Set(v.EnvName(k), v.values[k])
+			}
+
+			if task.Env != nil {
+				for k, value := range task.Env.Iter() {
+					env.Set(k, value)
+				}
+				env.secrets = append(env.secrets, task.Env.Secrets()...)
+			}
+			next.Env = env
+
+			t.Set(&next)
+			needs = append(needs, next.Id)
+		}
+
+		aggregate := task
+		aggregate.Run = nil
+		aggregate.Uses = nil
+		aggregate.With = nil
+		aggregate.Condition = nil
+		aggregate.Confirm = nil
+		aggregate.Hosts = nil
+		aggregate.Sources = nil
+		aggregate.Generates = nil
+		aggregate.Service = nil
+		aggregate.Needs = needs
+		t.Set(&aggregate)
+	}
+}
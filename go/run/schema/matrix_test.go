@@ -0,0 +1,113 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.yaml.in/yaml/v4"
+)
+
+func TestMatrixExpand(t *testing.T) {
+	tests := []struct {
+		name   string
+		matrix string
+		want   []string
+	}{
+		{
+			name:   "axes",
+			matrix: "{os: [linux, windows], go: ['1.22', '1.23']}",
+			want:   []string{"os=linux,go=1.22", "os=linux,go=1.23", "os=windows,go=1.22", "os=windows,go=1.23"},
+		},
+		{
+			name:   "exclude",
+			matrix: "{os: [linux, windows], go: ['1.22', '1.23'], exclude: [{os: windows, go: '1.22'}]}",
+			want:   []string{"os=linux,go=1.22", "os=linux,go=1.23", "os=windows,go=1.23"},
+		},
+		{
+			name:   "include adds keys to matching combinations",
+			matrix: "{os: [linux, windows], include: [{os: linux, arch: arm64}]}",
+			want:   []string{"os=linux,arch=arm64", "os=windows"},
+		},
+		{
+			name:   "include adds a combination",
+			matrix: "{os: [linux], include: [{os: darwin, arch: arm64}]}",
+			want:   []string{"os=linux", "os=darwin,arch=arm64"},
+		},
+		{
+			name:   "empty",
+			matrix: "{}",
+			want:   []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMatrix()
+			assert.NoError(t, yaml.Unmarshal([]byte(tt.matrix), m))
+
+			got := []string{}
+			for _, values := range m.Expand() {
+				got = append(got, values.String())
+			}
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestExpandMatrices(t *testing.T) {
+	tasks := &Tasks{}
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+test:pre:
+  run: echo pre
+test:
+  needs: [build]
+  matrix:
+    os: [linux, windows]
+  hooks:
+    before: [pre]
+    after: [post]
+  env:
+    TOKEN: abc
+  run: echo $MATRIX_OS
+test:post:
+  run: echo post
+build:
+  run: echo build
+`), tasks))
+
+	tasks.ExpandMatrices()
+
+	linux, ok := tasks.Get("test[os=linux]")
+	assert.True(t, ok)
+	assert.Equal(t, "test[os=linux]", *linux.Name)
+	assert.Equal(t, []string{"build", "test:pre"}, linux.Needs)
+	assert.Empty(t, linux.Hooks.Before)
+	assert.Empty(t, linux.Hooks.After)
+	assert.Equal(t, "linux", linux.Env.GetString("MATRIX_OS"))
+	assert.Equal(t, "abc", linux.Env.GetString("TOKEN"))
+
+	windows, ok := tasks.Get("test[os=windows]")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"build", "test:pre"}, windows.Needs)
+
+	aggregate, ok := tasks.Get("test")
+	assert.True(t, ok)
+	assert.Nil(t, aggregate.Run)
+	assert.Equal(t, []string{"test[os=linux]", "test[os=windows]"}, aggregate.Needs)
+	assert.Equal(t, []string{"pre"}, aggregate.Hooks.Before)
+	assert.Equal(t, []string{"post"}, aggregate.Hooks.After)
+
+	// the before hook comes before every combination, the after hook last
+	flat, err := FlattenTasks([]string{"test"}, *tasks, []Task{}, "")
+	assert.NoError(t, err)
+	order := []string{}
+	seen := map[string]bool{}
+	for _, task := range flat {
+		if !seen[task.Id] {
+			seen[task.Id] = true
+			order = append(order, task.Id)
+		}
+	}
+	assert.Equal(t, []string{"build", "test:pre", "test[os=linux]", "test[os=windows]", "test", "test:post"}, order)
+}
@@ -0,0 +1,160 @@
+package schema
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v4"
+)
+
+const (
+	BackoffConstant    = "constant"
+	BackoffLinear      = "linear"
+	BackoffExponential = "exponential"
+)
+
+// MaxBackoffDelay caps the delay that a linear or exponential backoff grows
+// to. A delay that is longer to begin with is used as is.
+const MaxBackoffDelay = time.Hour
+
+// Retry is the retry policy of a task or step. A failed attempt is retried
+// until Attempts attempts were made. When OnExitCodes is not empty, only
+// failures with one of those exit codes are retried.
+type Retry struct {
+	Attempts    int
+	Delay       time.Duration
+	Backoff     string
+	OnExitCodes []int
+}
+
+func NewRetry() *Retry {
+	return &Retry{
+		Attempts:    1,
+		Delay:       time.Second,
+		Backoff:     BackoffConstant,
+		OnExitCodes: []int{},
+	}
+}
+
+func (r *Retry) UnmarshalYAML(value *yaml.Node) error {
+	if r.Backoff == "" {
+		*r = *NewRetry()
+	}
+
+	if value.Kind == yaml.ScalarNode {
+		attempts, err := strconv.Atoi(value.Value)
+		if err != nil || attempts < 1 {
+			return yamlErrorf(*value, "expected a positive integer for 'retry' field")
+		}
+		r.Attempts = attempts
+		return nil
+	}
+
+	if value.Kind != yaml.MappingNode {
+		return yamlErrorf(*value, "expected yaml scalar or mapping for retry")
+	}
+
+	for i := 0; i < len(value.Content); i += 2 {
+		keyNode := value.Content[i]
+		valueNode := value.Content[i+1]
+
+		key := keyNode.Value
+		switch key {
+		case "attempts":
+			if valueNode.Kind != yaml.ScalarNode {
+				return yamlErrorf(*valueNode, "expected yaml scalar for 'attempts' field")
+			}
+			attempts, err := strconv.Atoi(valueNode.Value)
+			if err != nil || attempts < 1 {
+				return yamlErrorf(*valueNode, "expected a positive integer for 'attempts' field")
+			}
+			r.Attempts = attempts
+		case "delay":
+			if valueNode.Kind != yaml.ScalarNode {
+				return yamlErrorf(*valueNode, "expected yaml scalar for 'delay' field")
+			}
+			delay, err := time.ParseDuration(valueNode.Value)
+			if err != nil {
+				return yamlErrorf(*valueNode, "invalid duration for 'delay' field: %v", err)
+			}
+			r.Delay = delay
+		case "backoff":
+			if valueNode.Kind != yaml.ScalarNode {
+				return yamlErrorf(*valueNode, "expected yaml scalar for 'backoff' field")
+			}
+			backoff := strings.ToLower(valueNode.Value)
+			switch backoff {
+			case BackoffConstant, BackoffLinear, BackoffExponential:
+				r.Backoff = backoff
+			default:
+				return yamlErrorf(*valueNode, "expected 'constant', 'linear' or 'exponential' for 'backoff' field")
+			}
+		case "on-exit-codes", "on_exit_codes", "onExitCodes":
+			if valueNode.Kind != yaml.SequenceNode {
+				return yamlErrorf(*valueNode, "expected yaml sequence for 'on-exit-codes' field")
+			}
+			r.OnExitCodes = make([]int, 0)
+			for _, item := range valueNode.Content {
+				code, err := strconv.Atoi(item.Value)
+				if item.Kind != yaml.ScalarNode || err != nil {
+					return yamlErrorf(*item, "expected integer in 'on-exit-codes' list")
+				}
+				r.OnExitCodes = append(r.OnExitCodes, code)
+			}
+		default:
+			return yamlErrorf(*keyNode, "unexpected field '%s' in retry", key)
+		}
+	}
+
+	return nil
+}
+
+// DelayAfter returns how long to wait after the given failed attempt,
+// starting at 1, before the next attempt. Backoff delays grow up to
+// MaxBackoffDelay.
+func (r *Retry) DelayAfter(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	var factor int64
+	switch r.Backoff {
+	case BackoffLinear:
+		factor = int64(attempt)
+	case BackoffExponential:
+		// 1<<62 is the largest factor that fits, larger ones are capped
+		// below anyway
+		factor = 1 << 62
+		if attempt <= 62 {
+			factor = 1 << (attempt - 1)
+		}
+	default:
+		return r.Delay
+	}
+
+	if r.Delay <= 0 || r.Delay >= MaxBackoffDelay {
+		return r.Delay
+	}
+
+	if factor > int64(MaxBackoffDelay/r.Delay) {
+		return MaxBackoffDelay
+	}
+
+	return r.Delay * time.Duration(factor)
+}
+
+// RetriesExitCode reports whether a failure with the exit code is retried.
+func (r *Retry) RetriesExitCode(code int) bool {
+	if len(r.OnExitCodes) == 0 {
+		return true
+	}
+
+	for _, c := range r.OnExitCodes {
+		if c == code {
+			return true
+		}
+	}
+
+	return false
+}
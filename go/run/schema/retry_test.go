@@ -0,0 +1,87 @@
+package schema
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.yaml.in/yaml/v4"
+)
+
+func TestRetryDelayAfter(t *testing.T) {
+	tests := []struct {
+		backoff string
+		delay   time.Duration
+		attempt int
+		want    time.Duration
+	}{
+		{BackoffConstant, time.Second, 1, time.Second},
+		{BackoffConstant, time.Second, 3, time.Second},
+		{BackoffConstant, 2 * time.Hour, 3, 2 * time.Hour},
+		{BackoffLinear, time.Second, 0, time.Second},
+		{BackoffLinear, time.Second, 1, time.Second},
+		{BackoffLinear, time.Second, 3, 3 * time.Second},
+		{BackoffLinear, time.Second, 3600, time.Hour},
+		{BackoffLinear, time.Second, 3601, MaxBackoffDelay},
+		{BackoffLinear, time.Minute, math.MaxInt, MaxBackoffDelay},
+		{BackoffExponential, time.Second, 1, time.Second},
+		{BackoffExponential, time.Second, 2, 2 * time.Second},
+		{BackoffExponential, time.Second, 4, 8 * time.Second},
+		{BackoffExponential, time.Second, 12, 2048 * time.Second},
+		{BackoffExponential, time.Second, 13, MaxBackoffDelay},
+		{BackoffExponential, time.Second, 40, MaxBackoffDelay},
+		{BackoffExponential, time.Second, 64, MaxBackoffDelay},
+		{BackoffExponential, time.Second, math.MaxInt, MaxBackoffDelay},
+		{BackoffExponential, time.Nanosecond, 63, MaxBackoffDelay},
+		{BackoffExponential, 2 * time.Hour, 5, 2 * time.Hour},
+		{BackoffExponential, 0, 5, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.backoff, func(t *testing.T) {
+			r := NewRetry()
+			r.Backoff = tt.backoff
+			r.Delay = tt.delay
+			assert.Equal(t, tt.want, r.DelayAfter(tt.attempt))
+		})
+	}
+}
+
+func TestRetryUnmarshal(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want *Retry
+		err  bool
+	}{
+		{
+			name: "attempts",
+			yaml: "3",
+			want: &Retry{Attempts: 3, Delay: time.Second, Backoff: BackoffConstant, OnExitCodes: []int{}},
+		},
+		{
+			name: "mapping",
+			yaml: "{attempts: 5, delay: 2s, backoff: Linear, on-exit-codes: [1, 137]}",
+			want: &Retry{Attempts: 5, Delay: 2 * time.Second, Backoff: BackoffLinear, OnExitCodes: []int{1, 137}},
+		},
+		{name: "zero attempts", yaml: "0", err: true},
+		{name: "invalid backoff", yaml: "{backoff: random}", err: true},
+		{name: "invalid delay", yaml: "{delay: soon}", err: true},
+		{name: "unknown field", yaml: "{tries: 2}", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRetry()
+			err := yaml.Unmarshal([]byte(tt.yaml), r)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, r)
+		})
+	}
+}
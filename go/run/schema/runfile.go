@@ -24,6 +24,8 @@ type Runfile struct {
 	DotEnv      []string
 	Tasks       Tasks
 	HostImports HostImports
+	Includes    Includes
+	Contexts    Contexts
 	Values      map[string]interface{}
 	Args        []string
 }
@@ -48,6 +50,11 @@ func (x *Runfile) UnmarshalYAML(value *yaml.Node) error {
 				return yamlErrorf(*valueNode, "expected yaml scalar for 'name' field")
 			}
 			x.Name = valueNode.Value
+		case "description":
+			// the description documents the runfile for its readers
+			if valueNode.Kind != yaml.ScalarNode {
+				return yamlErrorf(*valueNode, "expected yaml scalar for 'description' field")
+			}
 		case "config":
 			if valueNode.Kind != yaml.MappingNode {
 				return yamlErrorf(*valueNode, "expected yaml mapping for 'config' field")
@@ -55,6 +62,13 @@ func (x *Runfile) UnmarshalYAML(value *yaml.Node) error {
 			if err := valueNode.Decode(&x.Config); err != nil {
 				return yamlErrorf(*valueNode, "failed to decode 'config' field: %v", err)
 			}
+		case "import", "imports":
+			if valueNode.Kind != yaml.MappingNode {
+				return yamlErrorf(*valueNode, "expected yaml mapping for 'import' field")
+			}
+			if err := valueNode.Decode(&x.Import); err != nil {
+				return yamlErrorf(*valueNode, "failed to decode 'import' field: %v", err)
+			}
 		case "env":
 			if valueNode.Kind != yaml.MappingNode {
 				return yamlErrorf(*valueNode, "expected yaml mapping for 'env' field")
@@ -81,13 +95,17 @@ func (x *Runfile) UnmarshalYAML(value *yaml.Node) error {
 				return yamlErrorf(*valueNode, "failed to decode 'tasks' field: %v", err)
 			}
 		case "hosts", "host-imports", "hostimports":
-			if valueNode.Kind != yaml.MappingNode {
-				return yamlErrorf(*valueNode, "expected yaml mapping for 'host_imports' field")
+			if valueNode.Kind != yaml.MappingNode && valueNode.Kind != yaml.SequenceNode {
+				return yamlErrorf(*valueNode, "expected yaml mapping or array for 'host_imports' field")
 			}
 
 			if err := valueNode.Decode(&x.HostImports); err != nil {
 				return yamlErrorf(*valueNode, "failed to decode 'host_imports' field: %v", err)
 			}
+		case "include", "includes":
+			if err := valueNode.Decode(&x.Includes); err != nil {
+				return yamlErrorf(*valueNode, "failed to decode 'include' field: %v", err)
+			}
 		case "values":
 			if valueNode.Kind != yaml.MappingNode {
 				return yamlErrorf(*valueNode, "expected yaml mapping for 'values' field")
@@ -95,9 +113,14 @@ func (x *Runfile) UnmarshalYAML(value *yaml.Node) error {
 			if err := valueNode.Decode(&x.Values); err != nil {
 				return yamlErrorf(*valueNode, "failed to decode 'values' field: %v", err)
 			}
+		case "contexts":
+			// the errors of contexts already hold the position of the
+			// extends that caused them
+			if err := valueNode.Decode(&x.Contexts); err != nil {
+				return err
+			}
 		default:
-			// Ignore unknown fields for forward compatibility
-			continue
+			return yamlErrorf(*keyNode, "unexpected field '%s' in runfile", key)
 		}
 	}
 
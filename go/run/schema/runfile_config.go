@@ -1,6 +1,11 @@
 package schema
 
-import "go.yaml.in/yaml/v4"
+import (
+	"strconv"
+	"time"
+
+	"go.yaml.in/yaml/v4"
+)
 
 type RunfileConfig struct {
 	Paths        Paths
@@ -9,6 +14,9 @@ type RunfileConfig struct {
 	Substitution bool
 	Context      *string
 	Shell        *string
+	Parallelism  int
+	// Timeout limits how long a whole run of the workflow may take.
+	Timeout time.Duration
 }
 
 func (rc *RunfileConfig) UnmarshalYAML(value *yaml.Node) error {
@@ -69,6 +77,24 @@ func (rc *RunfileConfig) UnmarshalYAML(value *yaml.Node) error {
 				return yamlErrorf(*valueNode, "expected yaml scalar for 'shell' field")
 			}
 			rc.Shell = &valueNode.Value
+		case "parallelism", "parallel":
+			if valueNode.Kind != yaml.ScalarNode {
+				return yamlErrorf(*valueNode, "expected yaml scalar for 'parallelism' field")
+			}
+			n, err := strconv.Atoi(valueNode.Value)
+			if err != nil || n < 0 {
+				return yamlErrorf(*valueNode, "expected a positive integer for 'parallelism' field")
+			}
+			rc.Parallelism = n
+		case "timeout":
+			if valueNode.Kind != yaml.ScalarNode {
+				return yamlErrorf(*valueNode, "expected yaml scalar for 'timeout' field")
+			}
+			timeout, err := time.ParseDuration(valueNode.Value)
+			if err != nil || timeout < 0 {
+				return yamlErrorf(*valueNode, "expected a duration such as 30m for 'timeout' field")
+			}
+			rc.Timeout = timeout
 		default:
 			return yamlErrorf(*keyNode, "unexpected field '%s' in runfile config", key)
 		}
@@ -0,0 +1,34 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.yaml.in/yaml/v4"
+)
+
+func TestRunfileUnmarshal(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		err  string
+	}{
+		{name: "tasks", yaml: "name: app\ndescription: builds the app\ntasks:\n  build:\n    run: go build\n"},
+		{name: "hosts mapping", yaml: "hosts:\n  web1: 10.0.0.1\n"},
+		{name: "hosts imports", yaml: "hosts:\n  - hosts.yaml\n"},
+		{name: "unknown field", yaml: "name: app\ntaks:\n  build:\n    run: go build\n", err: "unexpected field 'taks' in runfile"},
+		{name: "description mapping", yaml: "description: {a: b}\n", err: "expected yaml scalar for 'description' field"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := yaml.Unmarshal([]byte(tt.yaml), NewRunfile())
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+
+			assert.NoError(t, err)
+		})
+	}
+}
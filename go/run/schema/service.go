@@ -0,0 +1,129 @@
+package schema
+
+import (
+	"regexp"
+	"time"
+
+	"go.yaml.in/yaml/v4"
+)
+
+const (
+	ProbeTcp  = "tcp"
+	ProbeHttp = "http"
+	ProbeLog  = "log"
+	ProbeRun  = "run"
+)
+
+// Service makes a task run in the background while the tasks after it run.
+// The tasks after it start once its Ready probe passes, or as soon as it
+// started when it has no probe. Services are stopped when the workflow
+// ends, the last started first.
+type Service struct {
+	Ready *Probe
+}
+
+// Probe checks whether a service is ready. Kind is one of ProbeTcp, where
+// Target is an address that accepts connections, ProbeHttp, where Target
+// is a url that returns 200, ProbeLog, where Target is a regular
+// expression a line of the output of the service matches, or ProbeRun,
+// where Target is a command that exits with 0. The probe is tried every
+// Interval until it passes or Timeout has passed.
+type Probe struct {
+	Kind     string
+	Target   string
+	Timeout  time.Duration
+	Interval time.Duration
+}
+
+func NewService() *Service {
+	return &Service{}
+}
+
+func NewProbe() *Probe {
+	return &Probe{
+		Timeout:  30 * time.Second,
+		Interval: time.Second,
+	}
+}
+
+func (s *Service) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.MappingNode {
+		return yamlErrorf(*value, "expected yaml mapping for service")
+	}
+
+	for i := 0; i < len(value.Content); i += 2 {
+		keyNode := value.Content[i]
+		valueNode := value.Content[i+1]
+
+		key := keyNode.Value
+		switch key {
+		case "ready", "probe":
+			probe := NewProbe()
+			if err := valueNode.Decode(probe); err != nil {
+				return err
+			}
+			s.Ready = probe
+		default:
+			return yamlErrorf(*keyNode, "unexpected field '%s' in service", key)
+		}
+	}
+
+	return nil
+}
+
+func (p *Probe) UnmarshalYAML(value *yaml.Node) error {
+	if p.Interval == 0 {
+		*p = *NewProbe()
+	}
+
+	if value.Kind != yaml.MappingNode {
+		return yamlErrorf(*value, "expected yaml mapping for probe")
+	}
+
+	for i := 0; i < len(value.Content); i += 2 {
+		keyNode := value.Content[i]
+		valueNode := value.Content[i+1]
+
+		key := keyNode.Value
+		switch key {
+		case ProbeTcp, ProbeHttp, ProbeLog, ProbeRun:
+			if valueNode.Kind != yaml.ScalarNode {
+				return yamlErrorf(*valueNode, "expected yaml scalar for '%s' field", key)
+			}
+
+			if p.Kind != "" {
+				return yamlErrorf(*keyNode, "probe has both '%s' and '%s', expected one of tcp, http, log or run", p.Kind, key)
+			}
+
+			if key == ProbeLog {
+				if _, err := regexp.Compile(valueNode.Value); err != nil {
+					return yamlErrorf(*valueNode, "invalid regular expression for 'log' field: %v", err)
+				}
+			}
+
+			p.Kind = key
+			p.Target = valueNode.Value
+		case "timeout", "interval":
+			if valueNode.Kind != yaml.ScalarNode {
+				return yamlErrorf(*valueNode, "expected yaml scalar for '%s' field", key)
+			}
+			d, err := time.ParseDuration(valueNode.Value)
+			if err != nil || d <= 0 {
+				return yamlErrorf(*valueNode, "invalid duration for '%s' field", key)
+			}
+			if key == "timeout" {
+				p.Timeout = d
+			} else {
+				p.Interval = d
+			}
+		default:
+			return yamlErrorf(*keyNode, "unexpected field '%s' in probe", key)
+		}
+	}
+
+	if p.Kind == "" {
+		return yamlErrorf(*value, "expected one of tcp, http, log or run for probe")
+	}
+
+	return nil
+}
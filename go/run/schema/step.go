@@ -3,6 +3,7 @@ package schema
 import (
 	"os"
 	"path/filepath"
+	"strconv"
 
 	"github.com/frostyeti/mvps/go/errors"
 	"go.yaml.in/yaml/v4"
@@ -19,6 +20,7 @@ type Step struct {
 	Desc      *string
 	Force     *string
 	Condition *string
+	Retry     *Retry
 }
 
 type TaskDef struct {
@@ -30,6 +32,9 @@ type TaskDef struct {
 	Steps       []Step
 	Inputs      []Input
 	Outputs     []Output
+	// Remote runs the script steps on the hosts of the task over ssh
+	// instead of on the local machine.
+	Remote bool
 }
 
 type TaskDefs struct {
@@ -160,6 +165,12 @@ func (s *Step) UnmarshalYAML(value *yaml.Node) error {
 			}
 			condition := valueNode.Value
 			s.Condition = &condition
+		case "retry":
+			retry := NewRetry()
+			if err := valueNode.Decode(retry); err != nil {
+				return yamlErrorf(*valueNode, "failed to decode 'retry' field: %v", err)
+			}
+			s.Retry = retry
 		default:
 			return yamlErrorf(*keyNode, "unexpected field '%s' in step", key)
 		}
@@ -201,6 +212,15 @@ func (t *TaskDef) UnmarshalYAML(value *yaml.Node) error {
 			}
 			desc := valueNode.Value
 			t.Description = &desc
+		case "remote":
+			if valueNode.Kind != yaml.ScalarNode {
+				return yamlErrorf(*valueNode, "expected yaml scalar for 'remote' field")
+			}
+			remote, err := strconv.ParseBool(valueNode.Value)
+			if err != nil {
+				return yamlErrorf(*valueNode, "expected 'true' or 'false' for 'remote' field")
+			}
+			t.Remote = remote
 		case "steps":
 			if valueNode.Kind != yaml.SequenceNode {
 				return yamlErrorf(*valueNode, "expected yaml sequence for 'steps' field")
@@ -214,32 +234,11 @@ func (t *TaskDef) UnmarshalYAML(value *yaml.Node) error {
 				t.Steps = append(t.Steps, step)
 			}
 		case "inputs":
-			switch valueNode.Kind {
-			case yaml.SequenceNode:
-				for _, inputNode := range valueNode.Content {
-					var input Input
-					err := inputNode.Decode(&input)
-					if err != nil {
-						return yamlErrorf(*inputNode, "failed to decode input: %v", err)
-					}
-					t.Inputs = append(t.Inputs, input)
-				}
-			case yaml.MappingNode:
-				for i := 0; i < len(valueNode.Content); i += 2 {
-					keyNode := valueNode.Content[i]
-					valueNode := valueNode.Content[i+1]
-
-					var input Input
-					err := valueNode.Decode(&input)
-					if err != nil {
-						return yamlErrorf(*valueNode, "failed to decode input: %v", err)
-					}
-					input.Id = keyNode.Value
-					t.Inputs = append(t.Inputs, input)
-				}
-			default:
-				return yamlErrorf(*valueNode, "expected yaml sequence or mapping for 'inputs' field")
+			inputs, err := decodeInputs(valueNode)
+			if err != nil {
+				return err
 			}
+			t.Inputs = append(t.Inputs, inputs...)
 
 		case "outputs":
 			switch valueNode.Kind {
@@ -0,0 +1,121 @@
+package schema
+
+import (
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v4"
+)
+
+// Strategy controls how a task runs across its hosts. Hosts run in batches
+// of Serial hosts, or SerialPercent percent of the hosts, with at most
+// Parallel hosts of a batch running at once. Up to MaxFail hosts may fail
+// without failing the task. Once more hosts have failed, the remaining
+// hosts are skipped and the task fails.
+type Strategy struct {
+	Parallel      int
+	Serial        int
+	SerialPercent int
+	MaxFail       int
+}
+
+func NewStrategy() *Strategy {
+	return &Strategy{
+		Parallel: 1,
+	}
+}
+
+func (s *Strategy) UnmarshalYAML(value *yaml.Node) error {
+	if s.Parallel == 0 {
+		*s = *NewStrategy()
+	}
+
+	if value.Kind == yaml.ScalarNode {
+		parallel, err := strconv.Atoi(value.Value)
+		if err != nil || parallel < 1 {
+			return yamlErrorf(*value, "expected a positive integer for 'strategy' field")
+		}
+		s.Parallel = parallel
+		return nil
+	}
+
+	if value.Kind != yaml.MappingNode {
+		return yamlErrorf(*value, "expected yaml scalar or mapping for strategy")
+	}
+
+	for i := 0; i < len(value.Content); i += 2 {
+		keyNode := value.Content[i]
+		valueNode := value.Content[i+1]
+
+		key := keyNode.Value
+		switch key {
+		case "parallel":
+			if valueNode.Kind != yaml.ScalarNode {
+				return yamlErrorf(*valueNode, "expected yaml scalar for 'parallel' field")
+			}
+			parallel, err := strconv.Atoi(valueNode.Value)
+			if err != nil || parallel < 1 {
+				return yamlErrorf(*valueNode, "expected a positive integer for 'parallel' field")
+			}
+			s.Parallel = parallel
+		case "serial":
+			if valueNode.Kind != yaml.ScalarNode {
+				return yamlErrorf(*valueNode, "expected yaml scalar for 'serial' field")
+			}
+			raw := strings.TrimSpace(valueNode.Value)
+			if percent, ok := strings.CutSuffix(raw, "%"); ok {
+				n, err := strconv.Atoi(strings.TrimSpace(percent))
+				if err != nil || n < 1 || n > 100 {
+					return yamlErrorf(*valueNode, "expected a percentage between 1%% and 100%% for 'serial' field")
+				}
+				s.SerialPercent = n
+				s.Serial = 0
+				continue
+			}
+
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 1 {
+				return yamlErrorf(*valueNode, "expected a positive integer or a percentage for 'serial' field")
+			}
+			s.Serial = n
+			s.SerialPercent = 0
+		case "max-fail", "max_fail", "maxFail":
+			if valueNode.Kind != yaml.ScalarNode {
+				return yamlErrorf(*valueNode, "expected yaml scalar for 'max-fail' field")
+			}
+			n, err := strconv.Atoi(valueNode.Value)
+			if err != nil || n < 0 {
+				return yamlErrorf(*valueNode, "expected a non-negative integer for 'max-fail' field")
+			}
+			s.MaxFail = n
+		default:
+			return yamlErrorf(*keyNode, "unexpected field '%s' in strategy", key)
+		}
+	}
+
+	return nil
+}
+
+// BatchSize returns how many of total hosts run in each batch.
+func (s *Strategy) BatchSize(total int) int {
+	if s == nil || total < 1 {
+		return total
+	}
+
+	size := total
+	if s.Serial > 0 {
+		size = s.Serial
+	} else if s.SerialPercent > 0 {
+		size = (total*s.SerialPercent + 99) / 100
+	}
+
+	if size < 1 {
+		size = 1
+	}
+
+	if size > total {
+		size = total
+	}
+
+	return size
+}
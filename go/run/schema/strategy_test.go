@@ -0,0 +1,62 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.yaml.in/yaml/v4"
+)
+
+func TestStrategyBatchSize(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy *Strategy
+		total    int
+		want     int
+	}{
+		{name: "nil", strategy: nil, total: 5, want: 5},
+		{name: "all hosts", strategy: NewStrategy(), total: 5, want: 5},
+		{name: "no hosts", strategy: &Strategy{Serial: 2}, total: 0, want: 0},
+		{name: "serial", strategy: &Strategy{Serial: 2}, total: 5, want: 2},
+		{name: "serial above total", strategy: &Strategy{Serial: 10}, total: 5, want: 5},
+		{name: "percent rounds up", strategy: &Strategy{SerialPercent: 30}, total: 5, want: 2},
+		{name: "percent of one host", strategy: &Strategy{SerialPercent: 1}, total: 1, want: 1},
+		{name: "all percent", strategy: &Strategy{SerialPercent: 100}, total: 7, want: 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.strategy.BatchSize(tt.total))
+		})
+	}
+}
+
+func TestStrategyUnmarshal(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want *Strategy
+		err  bool
+	}{
+		{name: "parallel", yaml: "4", want: &Strategy{Parallel: 4}},
+		{name: "serial", yaml: "{serial: 2, max-fail: 1}", want: &Strategy{Parallel: 1, Serial: 2, MaxFail: 1}},
+		{name: "serial percent", yaml: "{parallel: 3, serial: 25%}", want: &Strategy{Parallel: 3, SerialPercent: 25}},
+		{name: "percent above 100", yaml: "{serial: 150%}", err: true},
+		{name: "negative max-fail", yaml: "{max-fail: -1}", err: true},
+		{name: "unknown field", yaml: "{batch: 2}", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewStrategy()
+			err := yaml.Unmarshal([]byte(tt.yaml), s)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, s)
+		})
+	}
+}
@@ -24,10 +24,21 @@ type Task struct {
 	Args      []string
 	Needs     []string
 	With      With
+	Inputs    []Input
 	Hosts     []string
 	Condition *string
+	Confirm   *string
 	Hooks     Hooks
 	Force     bool
+	Sources   []string
+	Generates []string
+	Watch     []string
+	Service   *Service
+	Matrix    *Matrix
+	Retry     *Retry
+	Strategy  *Strategy
+	// MatrixValues is set on the tasks expanded from a matrix.
+	MatrixValues *MatrixValues
 }
 
 func NewTasks() *Tasks {
@@ -147,7 +158,22 @@ func (t *Task) UnmarshalYAML(value *yaml.Node) error {
 				}
 				t.Needs = append(t.Needs, item.Value)
 			}
-		case "with", "input", "inputs":
+		case "inputs":
+			if isInputDeclarations(valueNode) {
+				inputs, err := decodeInputs(valueNode)
+				if err != nil {
+					return err
+				}
+				t.Inputs = inputs
+				continue
+			}
+
+			var with With
+			if err := valueNode.Decode(&with); err != nil {
+				return err
+			}
+			t.With = with
+		case "with", "input":
 			var with With
 			if err := valueNode.Decode(&with); err != nil {
 				return err
@@ -169,6 +195,88 @@ func (t *Task) UnmarshalYAML(value *yaml.Node) error {
 				return yamlErrorf(*valueNode, "expected yaml scalar for 'condition' field")
 			}
 			t.Condition = &valueNode.Value
+		case "confirm":
+			if valueNode.Kind != yaml.ScalarNode {
+				return yamlErrorf(*valueNode, "expected yaml scalar for 'confirm' field")
+			}
+			t.Confirm = &valueNode.Value
+		case "force":
+			if valueNode.Kind != yaml.ScalarNode {
+				return yamlErrorf(*valueNode, "expected yaml scalar for 'force' field")
+			}
+			force, err := strconv.ParseBool(valueNode.Value)
+			if err != nil {
+				return yamlErrorf(*valueNode, "expected 'true' or 'false' for 'force' field")
+			}
+			t.Force = force
+		case "sources":
+			if valueNode.Kind != yaml.SequenceNode {
+				return yamlErrorf(*valueNode, "expected yaml sequence for 'sources' field")
+			}
+			t.Sources = make([]string, 0)
+			for _, item := range valueNode.Content {
+				if item.Kind != yaml.ScalarNode {
+					return yamlErrorf(*item, "expected yaml scalar in 'sources' list")
+				}
+				t.Sources = append(t.Sources, item.Value)
+			}
+		case "generates":
+			if valueNode.Kind != yaml.SequenceNode {
+				return yamlErrorf(*valueNode, "expected yaml sequence for 'generates' field")
+			}
+			t.Generates = make([]string, 0)
+			for _, item := range valueNode.Content {
+				if item.Kind != yaml.ScalarNode {
+					return yamlErrorf(*item, "expected yaml scalar in 'generates' list")
+				}
+				t.Generates = append(t.Generates, item.Value)
+			}
+		case "watch":
+			if valueNode.Kind != yaml.SequenceNode {
+				return yamlErrorf(*valueNode, "expected yaml sequence for 'watch' field")
+			}
+			t.Watch = make([]string, 0)
+			for _, item := range valueNode.Content {
+				if item.Kind != yaml.ScalarNode {
+					return yamlErrorf(*item, "expected yaml scalar in 'watch' list")
+				}
+				t.Watch = append(t.Watch, item.Value)
+			}
+		case "service":
+			if valueNode.Kind == yaml.ScalarNode {
+				service, err := strconv.ParseBool(valueNode.Value)
+				if err != nil {
+					return yamlErrorf(*valueNode, "expected 'true', 'false' or a mapping for 'service' field")
+				}
+				t.Service = nil
+				if service {
+					t.Service = NewService()
+				}
+				continue
+			}
+			svc := NewService()
+			if err := valueNode.Decode(svc); err != nil {
+				return err
+			}
+			t.Service = svc
+		case "retry":
+			retry := NewRetry()
+			if err := valueNode.Decode(retry); err != nil {
+				return yamlErrorf(*valueNode, "failed to decode 'retry' field: %v", err)
+			}
+			t.Retry = retry
+		case "strategy":
+			strategy := NewStrategy()
+			if err := valueNode.Decode(strategy); err != nil {
+				return err
+			}
+			t.Strategy = strategy
+		case "matrix":
+			matrix := NewMatrix()
+			if err := valueNode.Decode(matrix); err != nil {
+				return err
+			}
+			t.Matrix = matrix
 		default:
 			return yamlErrorf(*keyNode, "unexpected field '%s' in task", key)
 		}
@@ -449,7 +557,7 @@ func FindCyclicalReferences(tasks []Task) []Task {
 	var resolve func(task Task) bool
 	resolve = func(task Task) bool {
 		for _, t := range stack {
-			if task.Id == t.Id {
+			if strings.EqualFold(task.Id, t.Id) {
 				return false
 			}
 		}
@@ -459,7 +567,7 @@ func FindCyclicalReferences(tasks []Task) []Task {
 		if len(task.Needs) > 0 {
 			for _, need := range task.Needs {
 				for _, nextTask := range tasks {
-					if nextTask.Id == need {
+					if strings.EqualFold(nextTask.Id, need) {
 						if !resolve(nextTask) {
 							return false
 						}
@@ -480,3 +588,86 @@ func FindCyclicalReferences(tasks []Task) []Task {
 
 	return cycles
 }
+
+// FindCycles returns the full path of the cycles in the needs of the
+// tasks, starting and ending with the same task, e.g. [a b c a]. Each
+// cycle is reported once, starting from the task of the cycle that comes
+// first in tasks.
+func FindCycles(tasks []Task) [][]string {
+	// needs are matched ignoring case, as Tasks.Get does
+	index := map[string]int{}
+	for i, task := range tasks {
+		index[strings.ToLower(task.Id)] = i
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make([]int, len(tasks))
+	stack := []int{}
+	seen := map[string]bool{}
+	cycles := [][]string{}
+
+	var visit func(i int)
+	visit = func(i int) {
+		state[i] = visiting
+		stack = append(stack, i)
+
+		for _, need := range tasks[i].Needs {
+			next, ok := index[strings.ToLower(need)]
+			if !ok {
+				continue
+			}
+
+			switch state[next] {
+			case unvisited:
+				visit(next)
+			case visiting:
+				start := 0
+				for j, k := range stack {
+					if k == next {
+						start = j
+						break
+					}
+				}
+
+				// rotate the cycle to begin with its first task so the same
+				// cycle found from another task is only reported once.
+				loop := append([]int{}, stack[start:]...)
+				first := 0
+				for j, k := range loop {
+					if k < loop[first] {
+						first = j
+					}
+				}
+				loop = append(loop[first:], loop[:first]...)
+
+				path := []string{}
+				for _, k := range loop {
+					path = append(path, tasks[k].Id)
+				}
+				path = append(path, path[0])
+
+				key := strings.Join(path, "\x00")
+				if !seen[key] {
+					seen[key] = true
+					cycles = append(cycles, path)
+				}
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		state[i] = visited
+	}
+
+	for i := range tasks {
+		if state[i] == unvisited {
+			visit(i)
+		}
+	}
+
+	return cycles
+}
@@ -0,0 +1,77 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindCycles(t *testing.T) {
+	task := func(id string, needs ...string) Task {
+		return Task{Id: id, Needs: needs}
+	}
+
+	tests := []struct {
+		name  string
+		tasks []Task
+		want  [][]string
+	}{
+		{
+			name:  "no cycle",
+			tasks: []Task{task("a", "b", "c"), task("b", "c"), task("c")},
+			want:  [][]string{},
+		},
+		{
+			name:  "itself",
+			tasks: []Task{task("a", "a")},
+			want:  [][]string{{"a", "a"}},
+		},
+		{
+			name:  "two tasks",
+			tasks: []Task{task("a", "b"), task("b", "a")},
+			want:  [][]string{{"a", "b", "a"}},
+		},
+		{
+			name:  "starts with the first task of the cycle",
+			tasks: []Task{task("x", "c"), task("a", "b"), task("b", "c"), task("c", "a")},
+			want:  [][]string{{"a", "b", "c", "a"}},
+		},
+		{
+			name:  "two cycles",
+			tasks: []Task{task("a", "b"), task("b", "a", "c"), task("c", "d"), task("d", "c")},
+			want:  [][]string{{"a", "b", "a"}, {"c", "d", "c"}},
+		},
+		{
+			name:  "ignores case",
+			tasks: []Task{task("Build", "test"), task("test", "build")},
+			want:  [][]string{{"Build", "test", "Build"}},
+		},
+		{
+			name:  "missing needs",
+			tasks: []Task{task("a", "missing"), task("b", "a")},
+			want:  [][]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, FindCycles(tt.tasks))
+		})
+	}
+}
+
+func TestFindCyclicalReferences(t *testing.T) {
+	tasks := []Task{
+		{Id: "Build", Needs: []string{"test"}},
+		{Id: "test", Needs: []string{"build"}},
+		{Id: "lint"},
+	}
+
+	cycles := FindCyclicalReferences(tasks)
+	ids := []string{}
+	for _, task := range cycles {
+		ids = append(ids, task.Id)
+	}
+
+	assert.Equal(t, []string{"Build", "test"}, ids)
+}
@@ -0,0 +1,218 @@
+package tasks
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/frostyeti/mvps/go/errors"
+	"github.com/frostyeti/mvps/go/run/schema"
+	"github.com/frostyeti/mvps/go/run/tasks/statuses"
+)
+
+// hostTarget is a host a task runs on and the name it is shown with.
+type hostTarget struct {
+	name  string
+	entry schema.HostEntry
+}
+
+// taskHosts returns the hosts of the task in the order they were declared.
+func taskHosts(ctx TaskContext) []hostTarget {
+	targets := []hostTarget{}
+	for name, entry := range ctx.Task.Hosts.Iter() {
+		targets = append(targets, hostTarget{name: name, entry: entry})
+	}
+
+	return targets
+}
+
+// runOnHosts runs fn for every target following the strategy of the task
+// and records the outcome on each host in the result. When there is more
+// than one target, the output of each host is prefixed with its name. Up to
+// max-fail hosts may fail without failing the task, their failures are still
+// recorded and shown in the host table. Once more hosts failed, the remaining
+// hosts are skipped and the task fails.
+func runOnHosts(ctx TaskContext, targets []hostTarget, fn func(ctx TaskContext, target hostTarget) error) *TaskResult {
+	res := NewTaskResult()
+	strategy := ctx.Task.Strategy
+	if strategy == nil {
+		strategy = schema.NewStrategy()
+	}
+
+	parent := ctx.Context
+	if parent == nil {
+		parent = context.Background()
+	}
+
+	hosts := make([]HostResult, len(targets))
+	for i, target := range targets {
+		hosts[i] = HostResult{Host: target.name, Status: statuses.None}
+	}
+
+	var mu sync.Mutex
+	var lock sync.Mutex
+	failed := []int{}
+	stopped := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(failed) > strategy.MaxFail || parent.Err() != nil
+	}
+
+	batch := strategy.BatchSize(len(targets))
+	for start := 0; start < len(targets) && !stopped(); start += batch {
+		end := min(start+batch, len(targets))
+		sem := make(chan struct{}, max(strategy.Parallel, 1))
+		var wg sync.WaitGroup
+		for i := start; i < end; i++ {
+			sem <- struct{}{}
+			if stopped() {
+				<-sem
+				break
+			}
+
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				target := targets[i]
+				hostCtx := ctx
+				hostCtx.Context = parent
+				var stdout, stderr *PrefixWriter
+				if len(targets) > 1 {
+					stdout = &PrefixWriter{w: ctx.Out(), prefix: []byte("[" + target.name + "] "), buf: []byte{}, lock: &lock}
+					stderr = &PrefixWriter{w: ctx.Err(), prefix: []byte("[" + target.name + "] "), buf: []byte{}, lock: &lock}
+					hostCtx.Stdout = stdout
+					hostCtx.Stderr = stderr
+				}
+
+				startedAt := time.Now().UTC()
+				err := fn(hostCtx, target)
+				if stdout != nil {
+					stdout.Flush()
+					stderr.Flush()
+				}
+
+				host := HostResult{
+					Host:      target.name,
+					Status:    statuses.Ok,
+					StartedAt: startedAt,
+					EndedAt:   time.Now().UTC(),
+				}
+
+				switch {
+				case err == nil:
+				case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+					host.Status = statuses.Cancelled
+					host.Err = err
+				default:
+					host.Status = statuses.Error
+					host.Err = err
+					if code, ok := exitCode(err); ok {
+						host.ExitCode = code
+					}
+				}
+
+				mu.Lock()
+				hosts[i] = host
+				if host.Status == statuses.Error {
+					failed = append(failed, i)
+				}
+				mu.Unlock()
+			}(i)
+		}
+
+		wg.Wait()
+	}
+
+	for i := range hosts {
+		if hosts[i].Status != statuses.None {
+			continue
+		}
+
+		if parent.Err() != nil {
+			hosts[i].Status = statuses.Cancelled
+			hosts[i].Message = "cancelled before the host ran"
+		} else {
+			hosts[i].Status = statuses.Skipped
+			hosts[i].Message = "skipped after more than " + strconv.Itoa(strategy.MaxFail) + " hosts failed"
+		}
+	}
+
+	res.Hosts = hosts
+	if len(targets) > 1 {
+		writeHostTable(ctx, hosts)
+	}
+
+	if errors.Is(parent.Err(), context.DeadlineExceeded) {
+		return res.Cancel("Task " + ctx.Task.Id + " cancelled due to timeout")
+	}
+
+	if parent.Err() != nil {
+		return res.Cancel("Task " + ctx.Task.Id + " cancelled")
+	}
+
+	sort.Ints(failed)
+	if len(failed) > 0 && len(failed) <= strategy.MaxFail {
+		names := []string{}
+		for _, i := range failed {
+			names = append(names, hosts[i].Host)
+		}
+
+		res.Message = strconv.Itoa(len(failed)) + " of " + strconv.Itoa(len(targets)) + " hosts failed within max-fail " + strconv.Itoa(strategy.MaxFail) + ": " + strings.Join(names, ", ")
+		WriteLine(ctx.Err(), ctx.Task.Id+": "+res.Message)
+		return res.Ok()
+	}
+
+	if len(failed) == 1 {
+		return res.Fail(hosts[failed[0]].Err)
+	}
+
+	if len(failed) > 1 {
+		names := []string{}
+		for _, i := range failed {
+			names = append(names, hosts[i].Host)
+		}
+
+		err := errors.New(strconv.Itoa(len(failed)) + " of " + strconv.Itoa(len(targets)) + " hosts failed: " + strings.Join(names, ", "))
+		return res.Fail(errors.WithCause(err, hosts[failed[0]].Err))
+	}
+
+	return res.Ok()
+}
+
+// writeHostTable writes the outcome on each host as a table.
+func writeHostTable(ctx TaskContext, hosts []HostResult) {
+	width := len("HOST")
+	for _, host := range hosts {
+		width = max(width, len(host.Host))
+	}
+
+	pad := func(s string, n int) string {
+		if len(s) >= n {
+			return s
+		}
+		return s + strings.Repeat(" ", n-len(s))
+	}
+
+	lines := []string{pad("HOST", width) + "  " + pad("STATUS", 9) + "  " + pad("DURATION", 8) + "  MESSAGE"}
+	for _, host := range hosts {
+		duration := ""
+		if !host.StartedAt.IsZero() {
+			duration = host.EndedAt.Sub(host.StartedAt).Round(time.Millisecond).String()
+		}
+
+		message := host.Message
+		if host.Err != nil {
+			message = host.Err.Error()
+		}
+
+		line := pad(host.Host, width) + "  " + pad(statuses.Name(host.Status), 9) + "  " + pad(duration, 8) + "  " + message
+		lines = append(lines, strings.TrimRight(line, " "))
+	}
+
+	WriteLine(ctx.Out(), strings.Join(lines, "\n"))
+}
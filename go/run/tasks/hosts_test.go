@@ -0,0 +1,80 @@
+package tasks
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/frostyeti/mvps/go/run/schema"
+	"github.com/frostyeti/mvps/go/run/tasks/statuses"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunOnHosts(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy *schema.Strategy
+		fail     map[string]bool
+		status   int
+		hosts    []int
+	}{
+		{
+			name:     "all ok",
+			strategy: schema.NewStrategy(),
+			status:   statuses.Ok,
+			hosts:    []int{statuses.Ok, statuses.Ok, statuses.Ok},
+		},
+		{
+			name:     "failure fails the task",
+			strategy: schema.NewStrategy(),
+			fail:     map[string]bool{"b": true},
+			status:   statuses.Error,
+			hosts:    []int{statuses.Ok, statuses.Error, statuses.Skipped},
+		},
+		{
+			name:     "failures within max-fail",
+			strategy: &schema.Strategy{Parallel: 1, MaxFail: 1},
+			fail:     map[string]bool{"b": true},
+			status:   statuses.Ok,
+			hosts:    []int{statuses.Ok, statuses.Error, statuses.Ok},
+		},
+		{
+			name:     "failures above max-fail",
+			strategy: &schema.Strategy{Parallel: 1, MaxFail: 1},
+			fail:     map[string]bool{"a": true, "b": true},
+			status:   statuses.Error,
+			hosts:    []int{statuses.Error, statuses.Error, statuses.Skipped},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			ctx := TaskContext{
+				Task:   &TaskModel{Id: "deploy", Strategy: tt.strategy},
+				Stdout: out,
+				Stderr: out,
+			}
+
+			targets := []hostTarget{{name: "a"}, {name: "b"}, {name: "c"}}
+			res := runOnHosts(ctx, targets, func(ctx TaskContext, target hostTarget) error {
+				if tt.fail[target.name] {
+					return errors.New("failed on " + target.name)
+				}
+				return nil
+			})
+
+			assert.Equal(t, tt.status, res.Status)
+			hosts := []int{}
+			for _, host := range res.Hosts {
+				hosts = append(hosts, host.Status)
+			}
+			assert.Equal(t, tt.hosts, hosts)
+
+			// failed hosts are shown in the table even when tolerated
+			for name := range tt.fail {
+				assert.Contains(t, out.String(), "failed on "+name)
+			}
+		})
+	}
+}
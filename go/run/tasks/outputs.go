@@ -0,0 +1,34 @@
+package tasks
+
+import (
+	"os"
+
+	"github.com/frostyeti/mvps/go/dotenv"
+	"github.com/frostyeti/mvps/go/errors"
+)
+
+// ReadOutputs parses a RUN_OUTPUTS file. Output names are kept as they
+// are written, so BUILD_ID=1 is read as .tasks.build.outputs.BUILD_ID.
+func ReadOutputs(file string) (map[string]interface{}, error) {
+	outputs := map[string]interface{}{}
+
+	outputBytes, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return outputs, nil
+		}
+
+		return nil, errors.New("Failed to read outputs file: " + err.Error())
+	}
+
+	doc, err := dotenv.Parse(string(outputBytes))
+	if err != nil {
+		return nil, errors.New("Failed to parse outputs file: " + err.Error())
+	}
+
+	for k, v := range doc.ToMap() {
+		outputs[k] = v
+	}
+
+	return outputs, nil
+}
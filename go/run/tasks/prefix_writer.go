@@ -0,0 +1,97 @@
+package tasks
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// outputLock serializes writes from every PrefixWriter so that lines
+// from concurrently running tasks are never interleaved mid-line.
+var outputLock sync.Mutex
+
+// PrefixWriter buffers output and writes it to the underlying writer
+// one complete line at a time, with the prefix prepended to each line.
+type PrefixWriter struct {
+	w      io.Writer
+	prefix []byte
+	buf    []byte
+	mu     sync.Mutex
+	// lock is held while a line is written, outputLock unless the writer
+	// writes to another PrefixWriter, which takes outputLock itself.
+	lock *sync.Mutex
+}
+
+func NewPrefixWriter(w io.Writer, prefix string) *PrefixWriter {
+	lock := &outputLock
+	if _, ok := w.(*PrefixWriter); ok {
+		lock = &sync.Mutex{}
+	}
+
+	return &PrefixWriter{
+		w:      w,
+		prefix: []byte(prefix),
+		buf:    []byte{},
+		lock:   lock,
+	}
+}
+
+func (p *PrefixWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+
+		if err := p.writeLine(p.buf[:i+1]); err != nil {
+			return len(b), err
+		}
+
+		p.buf = p.buf[i+1:]
+	}
+
+	return len(b), nil
+}
+
+// Flush writes any buffered partial line, terminating it with a newline.
+func (p *PrefixWriter) Flush() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.buf) == 0 {
+		return nil
+	}
+
+	line := append(p.buf, '\n')
+	p.buf = []byte{}
+	return p.writeLine(line)
+}
+
+func (p *PrefixWriter) writeLine(line []byte) error {
+	out := make([]byte, 0, len(p.prefix)+len(line))
+	out = append(out, p.prefix...)
+	out = append(out, line...)
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	_, err := p.w.Write(out)
+	return err
+}
+
+// WriteLine writes a single line to w while holding the same lock used by
+// PrefixWriter, so status lines do not interleave with task output.
+// A PrefixWriter takes the lock itself when it writes the line.
+func WriteLine(w io.Writer, line string) {
+	if _, ok := w.(*PrefixWriter); ok {
+		io.WriteString(w, line+"\n")
+		return
+	}
+
+	outputLock.Lock()
+	defer outputLock.Unlock()
+	io.WriteString(w, line+"\n")
+}
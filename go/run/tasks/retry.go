@@ -0,0 +1,120 @@
+package tasks
+
+import (
+	"fmt"
+	"os"
+	osexec "os/exec"
+	"strconv"
+	"time"
+
+	"github.com/frostyeti/mvps/go/errors"
+	"github.com/frostyeti/mvps/go/run/tasks/statuses"
+	"golang.org/x/crypto/ssh"
+	"mvdan.cc/sh/v3/interp"
+)
+
+// attemptFiles are the variables of the files a task appends its env, path
+// and outputs to.
+var attemptFiles = []string{"RUN_ENV", "RUN_PATH", "RUN_OUTPUTS"}
+
+// runWithRetry runs the handler and, when the task has a retry policy,
+// runs it again after each failure until it succeeds, the attempts are
+// used up, the exit code is not one the policy retries, or the task's
+// context is done. Every attempt is recorded on the returned result.
+//
+// Each attempt starts with the env, path and outputs files as they were
+// before the first attempt, so only the writes of the last attempt are kept.
+func runWithRetry(ctx TaskContext, handler TaskHandler) *TaskResult {
+	policy := ctx.Task.Retry
+	if policy == nil || policy.Attempts <= 1 {
+		return handler(ctx)
+	}
+
+	sizes := map[string]int64{}
+	for _, key := range attemptFiles {
+		file := ctx.Task.Env.GetString(key)
+		if file == "" {
+			continue
+		}
+
+		sizes[file] = 0
+		if info, err := os.Stat(file); err == nil {
+			sizes[file] = info.Size()
+		}
+	}
+
+	attempts := []TaskAttempt{}
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 {
+			for file, size := range sizes {
+				if err := os.Truncate(file, size); err != nil && !os.IsNotExist(err) {
+					res := NewTaskResult().Fail(errors.New("failed to reset " + file + " for attempt " + strconv.Itoa(attempt) + ": " + err.Error()))
+					res.Attempts = attempts
+					return res
+				}
+			}
+		}
+
+		res := handler(ctx)
+		attempts = append(attempts, TaskAttempt{
+			Attempt:   attempt,
+			Status:    res.Status,
+			ExitCode:  res.ExitCode,
+			Err:       res.Err,
+			StartedAt: res.StartedAt,
+			EndedAt:   res.EndedAt,
+		})
+
+		if res.Status != statuses.Error || attempt >= policy.Attempts || !policy.RetriesExitCode(res.ExitCode) {
+			res.Attempts = attempts
+			return res
+		}
+
+		delay := policy.DelayAfter(attempt)
+		WriteLine(ctx.Err(), fmt.Sprintf("%s: attempt %d of %d failed, retrying in %s", ctx.Task.Id, attempt, policy.Attempts, delay))
+
+		if ctx.Context == nil {
+			time.Sleep(delay)
+			continue
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Context.Done():
+			timer.Stop()
+			res.Attempts = attempts
+			return res
+		case <-timer.C:
+		}
+	}
+}
+
+// exitCode returns the exit code of the process, ssh command or shell
+// script that caused err, following both wrapped errors and the causes of
+// this module's errors.
+func exitCode(err error) (int, bool) {
+	for err != nil {
+		switch e := err.(type) {
+		case *osexec.ExitError:
+			return e.ExitCode(), true
+		case *ssh.ExitError:
+			return e.ExitStatus(), true
+		case interp.ExitStatus:
+			return int(e), true
+		}
+
+		if next := errors.Unwrap(err); next != nil {
+			err = next
+			continue
+		}
+
+		if cause, ok := err.(errors.Cause); ok {
+			err = cause.Cause()
+			continue
+		}
+
+		return 0, false
+	}
+
+	return 0, false
+}
@@ -1,13 +1,14 @@
 package tasks
 
 import (
+	"context"
 	"net/url"
 	"strings"
 
 	"github.com/frostyeti/mvps/go/env"
 	"github.com/frostyeti/mvps/go/errors"
-	"github.com/frostyeti/mvps/go/exec"
 	"github.com/frostyeti/mvps/go/run/schema"
+	"github.com/frostyeti/mvps/go/run/tasks/statuses"
 )
 
 type taskEnvLike struct {
@@ -53,14 +54,6 @@ func (t *taskEnvLike) SplitPath() []string {
 }
 
 func Run(ctx TaskContext) *TaskResult {
-
-	// Set custom env like for exec package
-	// so that the task env is used for finding executables
-	oldEnv := exec.GetEnvLike()
-	defer exec.SetEnvLike(oldEnv)
-	envLike := &taskEnvLike{Env: &ctx.Task.Env}
-	exec.SetEnvLike(envLike)
-
 	uses := ctx.Task.Uses
 	if strings.Contains(uses, "://") {
 		uri, err := url.Parse(uses)
@@ -75,9 +68,41 @@ func Run(ctx TaskContext) *TaskResult {
 
 	var handler = GlobalTaskHandlers[strings.ToLower(uses)]
 	if handler != nil {
-		return handler(ctx)
+		flush := ctx.maskOutput(&ctx.Task.Env)
+		defer flush()
+
+		res := runWithRetry(ctx, handler)
+
+		// a handler whose process was stopped because the context ended
+		// reports an error, the task was cancelled rather than failed.
+		if res.Status == statuses.Error && ctx.Context != nil && ctx.Context.Err() != nil {
+			msg := "Task " + ctx.Task.Id + " cancelled"
+			if errors.Is(ctx.Context.Err(), context.DeadlineExceeded) {
+				msg = "Task " + ctx.Task.Id + " cancelled due to timeout"
+			}
+			res.Cancel(msg)
+		}
+
+		return res
 	}
 
 	res := NewTaskResult()
 	return res.Fail(errors.New("Unsupported task type: " + uses))
 }
+
+// HandlerName returns the name of the handler that runs a task that uses
+// the given value and whether a handler of that name is registered.
+func HandlerName(uses string) (string, bool) {
+	if strings.Contains(uses, "://") {
+		uri, err := url.Parse(uses)
+		if err != nil {
+			return uses, false
+		}
+
+		uses = uri.Scheme
+	}
+
+	name := strings.ToLower(uses)
+	_, ok := GlobalTaskHandlers[name]
+	return name, ok
+}
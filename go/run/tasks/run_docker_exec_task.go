@@ -83,6 +83,8 @@ func runDocker(ctx TaskContext) *TaskResult {
 
 	cmd := exec.NewContext(ctx.Context, "docker", dockerArgs...)
 	cmd.WithEnvMap(ctx.Task.Env.ToMap())
+	cmd.WithStdout(ctx.Out())
+	cmd.WithStderr(ctx.Err())
 
 	output, err := cmd.Run()
 	if err != nil {
@@ -11,7 +11,6 @@ import (
 	"unicode"
 
 	"github.com/Masterminds/sprig"
-	"github.com/frostyeti/mvps/go/dotenv"
 	"github.com/frostyeti/mvps/go/env"
 	"github.com/frostyeti/mvps/go/errors"
 	"github.com/frostyeti/mvps/go/run/schema"
@@ -59,45 +58,24 @@ func RegisterDynamicTask(id string, taskDef schema.TaskDef) error {
 		}()
 
 		for _, inputDef := range taskDef.Inputs {
-			inputValue, ok := ctx.Task.With.TryGetString(inputDef.Id)
-			required := false
-			if inputDef.Required != nil {
-				required = *inputDef.Required
-			}
-
-			defaultValue := ""
-			if inputDef.Default != nil {
-				defaultValue = *inputDef.Default
-			}
-
-			if !ok && defaultValue != "" {
-				inputValue = defaultValue
-				ok = true
-			}
-
-			if required && !ok {
-				return res.Fail(errors.New("Missing required input: " + inputDef.Id))
-			}
-
-			if len(inputDef.Selection) > 0 {
-
-				valid := false
-				for _, option := range inputDef.Selection {
-					if option == inputValue {
-						valid = true
-						break
-					}
-				}
-
-				if !valid {
-					return res.Fail(errors.New("Invalid value for input " + inputDef.Id))
-				}
+			inputValue, _, err := inputDef.Resolve(ctx.Task.With)
+			if err != nil {
+				return res.Fail(errors.New("Task " + ctx.Task.Id + ": " + err.Error()))
 			}
 
 			envName := "INPUT_" + string(ScreamingCase([]rune(inputDef.Id)))
-			taskEnv.Set(envName, inputValue)
+			if inputDef.IsSecret() {
+				taskEnv.SetSecret(envName, inputValue)
+			} else {
+				taskEnv.Set(envName, inputValue)
+			}
 		}
 
+		// secret inputs are only known now, mask them in the output of the
+		// steps as well.
+		flush := ctx.maskOutput(taskEnv)
+		defer flush()
+
 		results := []TaskResult{}
 		failed := false
 
@@ -116,6 +94,9 @@ func RegisterDynamicTask(id string, taskDef schema.TaskDef) error {
 				step.Name = &name
 			}
 
+			nextRes.Id = stepId
+			nextRes.Name = *step.Name
+
 			taskEnv.Set("RUN_STEP_ID", *step.Id)
 			taskEnv.Set("RUN_STEP_NAME", *step.Name)
 			taskEnv.Set("RUN_STEP_INDEX", strconv.Itoa(i))
@@ -141,6 +122,10 @@ func RegisterDynamicTask(id string, taskDef schema.TaskDef) error {
 			}
 
 			handler, ok := GlobalTaskHandlers[uses]
+			if _, remote := remoteShells[uses]; remote && taskDef.Remote {
+				handler = remoteScriptHandler(uses)
+			}
+
 			if !ok {
 				nextRes.Fail(errors.New("Step " + *step.Id + " has unsupported 'uses' value: " + uses))
 				results = append(results, *nextRes)
@@ -190,28 +175,15 @@ func RegisterDynamicTask(id string, taskDef schema.TaskDef) error {
 			run := step.Run
 			runTrimmed := strings.TrimSpace(run)
 
-			if cwd != ctx.Task.Cwd {
-				os.Chdir(cwd)
-
-				defer func() {
-					os.Chdir(ctx.Task.Cwd)
-				}()
-			}
-
-			// must be a file path and a single line, and not an absolute path
+			// must be a file path and a single line, and not an absolute path.
+			// The file is relative to the task file, the step runs in cwd
+			// without changing the working directory of the process, as
+			// tasks run at the same time.
 			if len(runTrimmed) > 0 && !strings.ContainsAny(runTrimmed, "\n\r") {
 				ext := filepath.Ext(runTrimmed)
 				if ext != "" && !filepath.IsAbs(runTrimmed) {
-
-					if cwd != runTaskDir {
-						os.Chdir(runTaskDir)
-						p, _ := filepath.Abs(runTrimmed)
-						run = p
-						os.Chdir(cwd)
-					} else {
-						p, _ := filepath.Abs(runTrimmed)
-						run = p
-					}
+					p, _ := filepath.Abs(filepath.Join(runTaskDir, runTrimmed))
+					run = p
 				}
 			}
 
@@ -305,28 +277,32 @@ func RegisterDynamicTask(id string, taskDef schema.TaskDef) error {
 
 			if !condition {
 				nextRes.Skip("condition was false")
+				results = append(results, *nextRes)
 				continue
 			}
 
 			if failed && !force {
 				nextRes.Skip("previous step failed and force is false")
+				results = append(results, *nextRes)
 				continue
 			}
 
 			nextTask := &TaskModel{
-				Id:      *step.Id,
-				Name:    *step.Name,
-				Uses:    step.Uses,
-				Run:     step.Run,
-				With:    step.With,
-				Env:     *taskEnv,
-				Cwd:     cwd,
-				Desc:    desc,
-				Args:    ctx.Task.Args,
-				Timeout: ctx.Task.Timeout,
-				Force:   force,
-				Hosts:   ctx.Task.Hosts,
-				Needs:   ctx.Task.Needs,
+				Id:       *step.Id,
+				Name:     *step.Name,
+				Uses:     step.Uses,
+				Run:      step.Run,
+				With:     step.With,
+				Env:      *taskEnv,
+				Cwd:      cwd,
+				Desc:     desc,
+				Args:     ctx.Task.Args,
+				Timeout:  ctx.Task.Timeout,
+				Force:    force,
+				Hosts:    ctx.Task.Hosts,
+				Needs:    ctx.Task.Needs,
+				Retry:    step.Retry,
+				Strategy: ctx.Task.Strategy,
 			}
 
 			nextCtx := TaskContext{
@@ -335,9 +311,15 @@ func RegisterDynamicTask(id string, taskDef schema.TaskDef) error {
 				Args:        ctx.Args,
 				Schema:      ctx.Schema,
 				ContextName: ctx.ContextName,
+				Stdout:      ctx.Stdout,
+				Stderr:      ctx.Stderr,
+				Masker:      ctx.Masker,
+				Inventory:   ctx.Inventory,
 			}
 
-			res2 := handler(nextCtx)
+			res2 := runWithRetry(nextCtx, handler)
+			res2.Id = stepId
+			res2.Name = *step.Name
 			if res2.Status == statuses.Error {
 				failed = true
 			}
@@ -347,26 +329,28 @@ func RegisterDynamicTask(id string, taskDef schema.TaskDef) error {
 
 		file := taskEnv.GetString("RUN_OUTPUTS")
 		if len(file) > 0 {
-			outputBytes, err := os.ReadFile(file)
-
+			outputs, err := ReadOutputs(file)
 			if err != nil {
-				return res.Fail(errors.New("Failed to read outputs file: " + err.Error()))
+				return res.Fail(err)
 			}
 
-			outputStr := string(outputBytes)
-			doc, err := dotenv.Parse(outputStr)
-			if err != nil {
-				return res.Fail(errors.New("Failed to parse outputs file: " + err.Error()))
+			for k, v := range outputs {
+				res.Output[k] = v
+			}
+		}
+
+		for _, output := range taskDef.Outputs {
+			if output.Default == nil {
+				continue
 			}
 
-			outputMap := doc.ToMap()
-			for k, v := range outputMap {
-				outputName := strings.ToLower(k)
-				outputName = strings.ReplaceAll(outputName, "_", "-")
-				res.Output[outputName] = v
+			if _, ok := res.Output[output.Id]; !ok {
+				res.Output[output.Id] = *output.Default
 			}
 		}
 
+		res.Steps = results
+
 		if failed {
 			builder := &strings.Builder{}
 			builder.WriteString("Task " + ctx.Task.Id + " failed: \n")
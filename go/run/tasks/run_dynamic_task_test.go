@@ -0,0 +1,97 @@
+package tasks
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/frostyeti/mvps/go/run/schema"
+	"github.com/frostyeti/mvps/go/run/tasks/statuses"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDynamicTaskStepCwd(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "sub")
+	assert.NoError(t, os.MkdirAll(sub, 0o755))
+
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+
+	cwd := "sub"
+	def := schema.TaskDef{
+		Id:   "test-dynamic-cwd",
+		Name: "cwd",
+		Path: filepath.Join(dir, "tasks.yaml"),
+		Steps: []schema.Step{
+			{Uses: "shell", Run: `echo "step=$PWD" >> "$RUN_OUTPUTS"`, Cwd: &cwd},
+			{Uses: "shell", Run: `echo "task=$PWD" >> "$RUN_OUTPUTS"`},
+		},
+	}
+	assert.NoError(t, RegisterDynamicTask(def.Id, def))
+	defer delete(GlobalTaskHandlers, def.Id)
+
+	res := GlobalTaskHandlers[def.Id](TaskContext{
+		Task: &TaskModel{Id: "cwd", Uses: def.Id, Cwd: dir, Env: *schema.NewEnv()},
+	})
+
+	assert.Equal(t, statuses.Ok, res.Status, "%v", res.Err)
+	assert.Equal(t, sub, res.Output["step"])
+	assert.Equal(t, dir, res.Output["task"])
+
+	// the steps run in their cwd without changing that of the process
+	after, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.Equal(t, wd, after)
+}
+
+func TestDynamicTaskOutputDefaults(t *testing.T) {
+	dir := t.TempDir()
+	str := func(s string) *string { return &s }
+
+	def := schema.TaskDef{
+		Id:   "test-dynamic-outputs",
+		Name: "outputs",
+		Path: filepath.Join(dir, "tasks.yaml"),
+		Outputs: []schema.Output{
+			{Id: "version", Default: str("0.0.0")},
+			{Id: "channel", Default: str("stable")},
+			{Id: "commit"},
+		},
+		Steps: []schema.Step{
+			{Uses: "shell", Run: `echo "version=2" >> "$RUN_OUTPUTS"`},
+		},
+	}
+	assert.NoError(t, RegisterDynamicTask(def.Id, def))
+	defer delete(GlobalTaskHandlers, def.Id)
+
+	res := GlobalTaskHandlers[def.Id](TaskContext{
+		Task: &TaskModel{Id: "outputs", Uses: def.Id, Cwd: dir, Env: *schema.NewEnv()},
+	})
+
+	// written outputs win over defaults and outputs without a default are
+	// left unset
+	assert.Equal(t, statuses.Ok, res.Status, "%v", res.Err)
+	assert.Equal(t, map[string]interface{}{"version": "2", "channel": "stable"}, res.Output)
+}
+
+func TestTaskContextPath(t *testing.T) {
+	tests := []struct {
+		cwd  string
+		path string
+		want string
+	}{
+		{"/src", "values.yaml", "/src/values.yaml"},
+		{"/src", "../values.yaml", "/values.yaml"},
+		{"/src", "/etc/values.yaml", "/etc/values.yaml"},
+		{"/src", "", ""},
+		{"", "values.yaml", "values.yaml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cwd+" "+tt.path, func(t *testing.T) {
+			ctx := TaskContext{Task: &TaskModel{Cwd: tt.cwd}}
+			assert.Equal(t, filepath.FromSlash(tt.want), ctx.Path(filepath.FromSlash(tt.path)))
+		})
+	}
+}
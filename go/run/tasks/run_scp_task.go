@@ -3,7 +3,6 @@ package tasks
 import (
 	"context"
 	"io"
-	"net"
 	"net/url"
 	"os"
 	"strconv"
@@ -12,7 +11,6 @@ import (
 	"github.com/frostyeti/mvps/go/errors"
 	"github.com/frostyeti/mvps/go/run/schema"
 	goph "github.com/melbahja/goph"
-	"golang.org/x/crypto/ssh"
 )
 
 func runSCP(ctx TaskContext) *TaskResult {
@@ -63,7 +61,7 @@ func runSCP(ctx TaskContext) *TaskResult {
 		}
 	}
 
-	targets := []schema.HostEntry{}
+	targets := []hostTarget{}
 	if uri.Host != "" {
 		user := ""
 		if uri.User != nil {
@@ -90,88 +88,31 @@ func runSCP(ctx TaskContext) *TaskResult {
 
 		identity := uri.Query().Get("identity")
 
-		targets = append(targets, schema.HostEntry{
-			Host:         uri.Host,
-			User:         &user,
-			Port:         &port,
-			IdentityFile: &identity,
-			Password:     &password,
+		targets = append(targets, hostTarget{
+			name: uri.Hostname(),
+			entry: schema.HostEntry{
+				Host:         uri.Hostname(),
+				User:         &user,
+				Port:         &port,
+				IdentityFile: &identity,
+				Password:     &password,
+			},
 		})
-
-	} else if ctx.Task.Hosts.Len() > 0 {
-		for _, h := range ctx.Task.Hosts.Entries() {
-			targets = append(targets, h)
-		}
+	} else {
+		targets = taskHosts(ctx)
 	}
 
 	if len(targets) == 0 {
 		return res.Fail(errors.New("No targets found for SSH task"))
 	}
 
-	for _, target := range targets {
-		if err := runScpTarget(ctx.Context, direction, ctx, target, files); err != nil {
-			return res.Fail(err)
-		}
-	}
-
-	res.End()
-
-	// Placeholder for running an SSH command
-	// This would typically involve executing the command over SSH
-	return res.Ok()
+	return runOnHosts(ctx, targets, func(ctx TaskContext, target hostTarget) error {
+		return runScpTarget(ctx.Context, direction, ctx, target.entry, files)
+	})
 }
 
 func runScpTarget(ctx context.Context, direction string, taskContext TaskContext, target schema.HostEntry, files []string) error {
-	var auth goph.Auth
-	var err error
-	identity := ""
-	password := ""
-	if target.IdentityFile != nil {
-		identity = *target.IdentityFile
-	}
-	if target.Password != nil {
-		password = *target.Password
-		if password != "" {
-			p, ok := taskContext.Task.Env.Get(password)
-			if ok {
-				password = p
-			}
-		}
-	}
-
-	if identity == "" && password != "" {
-		auth = goph.Password(password)
-	} else if goph.HasAgent() {
-		auth, err = goph.UseAgent()
-	} else if identity != "" {
-		auth, err = goph.Key(identity, password)
-	} else {
-		return errors.New("No authentication method provided for SSH task")
-	}
-
-	if err != nil {
-		return errors.New("Failed to create SSH authentication: " + err.Error())
-	}
-
-	port := 22
-	if target.Port != nil && *target.Port > 0 {
-		port = int(*target.Port)
-	}
-	user := ""
-	if target.User != nil && *target.User != "" {
-		user = *target.User
-	}
-
-	client, err := goph.NewConn(&goph.Config{
-		User: user,
-		Addr: target.Host,
-		Port: uint(port),
-		Auth: auth,
-		Callback: func(host string, remote net.Addr, key ssh.PublicKey) error {
-			return nil
-		},
-	})
-
+	client, err := dialSSH(ctx, taskContext, target)
 	if err != nil {
 		err2 := errors.New("Failed to connect to SSH target " + target.Host + ": " + err.Error())
 		err2 = errors.WithCause(err2, err)
@@ -191,11 +132,11 @@ func runScpTarget(ctx context.Context, direction string, taskContext TaskContext
 		destination := parts[1]
 
 		if direction != "download" {
-			os.Stdout.WriteString("Uploading " + source + " to " + destination + " on " + target.Host + "\n")
-			err = Upload(ctx, client, source, destination)
+			io.WriteString(taskContext.Out(), "Uploading "+source+" to "+destination+" on "+target.Host+"\n")
+			err = Upload(ctx, client.Client, taskContext.Path(source), destination)
 		} else {
-			os.Stdout.WriteString("Downloading " + source + " to " + destination + " from " + target.Host + "\n")
-			err = Download(ctx, client, destination, source)
+			io.WriteString(taskContext.Out(), "Downloading "+source+" to "+destination+" from "+target.Host+"\n")
+			err = Download(ctx, client.Client, destination, taskContext.Path(source))
 		}
 
 		if err != nil {
@@ -1,12 +1,11 @@
 package tasks
 
 import (
-	"bufio"
+	"context"
+	"os"
 	"strconv"
 	"strings"
 
-	"github.com/frostyeti/mvps/go/cmdargs"
-	"github.com/frostyeti/mvps/go/env"
 	"github.com/frostyeti/mvps/go/errors"
 	"github.com/frostyeti/mvps/go/exec"
 	"github.com/frostyeti/mvps/go/rtexec/bash"
@@ -21,6 +20,9 @@ import (
 	"github.com/frostyeti/mvps/go/rtexec/python"
 	"github.com/frostyeti/mvps/go/rtexec/ruby"
 	"github.com/frostyeti/mvps/go/rtexec/sh"
+	"mvdan.cc/sh/v3/expand"
+	"mvdan.cc/sh/v3/interp"
+	"mvdan.cc/sh/v3/syntax"
 )
 
 func runShell(ctx TaskContext) *TaskResult {
@@ -40,51 +42,59 @@ func runShell(ctx TaskContext) *TaskResult {
 	run := ctx.Task.Run
 	splat := ctx.Task.Args
 
+	// tasks run at the same time, so the shell is found with the PATH and
+	// variables of the task rather than those of the process
+	runCtx := ctx.Context
+	if runCtx == nil {
+		runCtx = context.Background()
+	}
+	runCtx = exec.WithEnvLike(runCtx, &taskEnvLike{Env: &ctx.Task.Env})
+
 	switch ctx.Task.Uses {
 	case "runshell":
 		fallthrough
 	case "shell":
 		return runXPlatShell(run, ctx)
 	case "bash":
-		cmd = bash.ScriptContext(ctx.Context, run, splat...)
+		cmd = bash.ScriptContext(runCtx, run, splat...)
 
 	case "pwsh":
-		cmd = pwsh.ScriptContext(ctx.Context, run, splat...)
+		cmd = pwsh.ScriptContext(runCtx, run, splat...)
 	case "powershell":
-		cmd = powershell.ScriptContext(ctx.Context, run, splat...)
+		cmd = powershell.ScriptContext(runCtx, run, splat...)
 
 	case "sh":
-		cmd = sh.ScriptContext(ctx.Context, run, splat...)
+		cmd = sh.ScriptContext(runCtx, run, splat...)
 
 	case "go":
 		fallthrough
 	case "golang":
-		cmd = golang.ScriptContext(ctx.Context, run, splat...)
+		cmd = golang.ScriptContext(runCtx, run, splat...)
 
 	case "dotnet":
 		fallthrough
 	case "csharp":
-		cmd = dotnet.ScriptContext(ctx.Context, run, splat...)
+		cmd = dotnet.ScriptContext(runCtx, run, splat...)
 
 	case "deno":
-		cmd = deno.ScriptContext(ctx.Context, run, splat...)
+		cmd = deno.ScriptContext(runCtx, run, splat...)
 
 	case "node":
-		cmd = node.ScriptContext(ctx.Context, run, splat...)
+		cmd = node.ScriptContext(runCtx, run, splat...)
 
 	case "bun":
-		cmd = bun.ScriptContext(ctx.Context, run, splat...)
+		cmd = bun.ScriptContext(runCtx, run, splat...)
 
 	case "python":
-		cmd = python.ScriptContext(ctx.Context, run, splat...)
+		cmd = python.ScriptContext(runCtx, run, splat...)
 
 	case "nushell":
 		fallthrough
 	case "nu":
-		cmd = nushell.ScriptContext(ctx.Context, run, splat...)
+		cmd = nushell.ScriptContext(runCtx, run, splat...)
 
 	case "ruby":
-		cmd = ruby.ScriptContext(ctx.Context, run, splat...)
+		cmd = ruby.ScriptContext(runCtx, run, splat...)
 
 	default:
 		err := errors.New("Unsupported shell: " + ctx.Task.Uses)
@@ -99,6 +109,9 @@ func runShell(ctx TaskContext) *TaskResult {
 		cmd.WithEnvMap(ctx.Task.Env.ToMap())
 	}
 
+	cmd.WithStdout(ctx.Out())
+	cmd.WithStderr(ctx.Err())
+
 	res.Start()
 	o, err := cmd.Run()
 	if err != nil {
@@ -115,237 +128,74 @@ func runShell(ctx TaskContext) *TaskResult {
 	return res.Ok()
 }
 
+// runXPlatShell runs the script with an embedded POSIX shell, so that
+// shell tasks behave the same on every platform whether or not a shell is
+// installed. Like sh -e, the script stops at the first failing command.
 func runXPlatShell(script string, ctx TaskContext) *TaskResult {
+	res := NewTaskResult()
 
-	opts := &env.ExpandOptions{
-		Get: func(key string) string {
-			s, ok := ctx.Task.Env.Get(key)
-			if ok {
-				return s
-			}
-
-			return ""
-		},
-		Set: func(key, value string) error {
-			ctx.Task.Env.Set(key, value)
-			return nil
-		},
-		Keys:                ctx.Task.Env.Keys(),
-		ExpandUnixArgs:      true,
-		ExpandWindowsVars:   false,
-		CommandSubstitution: true,
-	}
-
-	script, err := env.ExpandWithOptions(script, opts)
+	file, err := syntax.NewParser().Parse(strings.NewReader(script), ctx.Task.Id)
 	if err != nil {
-		res := NewTaskResult()
-		return res.Fail(err)
+		return res.Fail(errors.New("Failed to parse shell script for task " + ctx.Task.Id + ": " + err.Error()))
 	}
 
-	commands := []string{}
-	sb := strings.Builder{}
-
-	res := NewTaskResult()
-	res.Start()
-
-	scanner := bufio.NewScanner(strings.NewReader(script))
-	for scanner.Scan() {
-		line := scanner.Text()
-		trimmed := strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-
-		if strings.HasPrefix(trimmed, "#") {
-			continue
-		}
-
-		if strings.HasSuffix(trimmed, "\\") || strings.HasSuffix(trimmed, "`") {
-			sb.WriteString(trimmed)
-			continue
-		}
-
-		sb.WriteString(trimmed)
-		commands = append(commands, sb.String())
-		sb.Reset()
+	pairs := []string{}
+	for k, v := range ctx.Task.Env.ToMap() {
+		pairs = append(pairs, k+"="+v)
 	}
 
-	if sb.Len() > 0 {
-		commands = append(commands, sb.String())
+	dir := ctx.Task.Cwd
+	if dir == "" {
+		dir, _ = os.Getwd()
 	}
 
-	for _, command := range commands {
-		args := cmdargs.Split(command)
-		hasOps := false
-		for _, arg := range args.ToArray() {
-
-			if arg == "&&" || arg == "||" || arg == "|" || arg == ";" {
-				hasOps = true
-				break
-			}
-		}
-
-		if !hasOps && args.Len() > 0 {
-			exe := args.Shift()
-			cmd := exec.New(exe, args.ToArray()...)
-			cmd.WithEnvMap(ctx.Task.Env.ToMap())
-			cmd.WithCwd(ctx.Task.Cwd)
-
-			o, err := cmd.Run()
-			if err != nil {
-				return res.Fail(err)
-			}
-
-			if o.Code != 0 {
-				err := errors.New("Task " + ctx.Task.Id + " failed with exit code " + strconv.Itoa(o.Code))
-				return res.Fail(err)
-			}
-
-			continue
-		}
-
-		ops := []*commandOperation{}
-		currentOp := &commandOperation{}
-		for _, part := range args.ToArray() {
-			if part == "&&" || part == "||" || part == "|" || part == ";" {
-				currentOp.Operation = part
-				next := currentOp
-				ops = append(ops, next)
-
-				currentOp = &commandOperation{}
-				continue
-			}
-
-			if part == "" {
-				continue
-			}
+	params := append([]string{"-e", "--"}, ctx.Task.Args...)
+	runner, err := interp.New(
+		interp.Env(expand.ListEnviron(pairs...)),
+		interp.Dir(dir),
+		interp.Params(params...),
+		interp.StdIO(os.Stdin, ctx.Out(), ctx.Err()),
+		interp.ExecHandlers(registryExecHandler(&taskEnvLike{Env: &ctx.Task.Env})),
+	)
+	if err != nil {
+		return res.Fail(errors.New("Failed to create shell for task " + ctx.Task.Id + ": " + err.Error()))
+	}
 
-			currentOp.Command.Append(part)
-		}
+	runCtx := ctx.Context
+	if runCtx == nil {
+		runCtx = context.Background()
+	}
 
-		if currentOp.Command.Len() > 0 {
-			ops = append(ops, currentOp)
+	res.Start()
+	err = runner.Run(runCtx, file)
+	if err != nil {
+		var status interp.ExitStatus
+		if errors.As(err, &status) {
+			err2 := errors.New("Task " + ctx.Task.Id + " failed with exit code " + strconv.Itoa(int(status)))
+			return res.Fail(errors.WithCause(err2, err))
 		}
 
-		lastOperation := ""
-		for i := 0; i < len(ops); i++ {
-			op := *ops[i]
-			if op.IsPipe() {
-				exe := op.Command.Shift()
-				cmd0 := exec.New(exe, op.Command.ToArray()...)
-				cmd0.WithEnvMap(ctx.Task.Env.ToMap())
-				cmd0.WithCwd(ctx.Task.Cwd)
-
-				j := 1
-				var pipe *exec.Pipeline
-				l := len(ops)
-				nextOp := &commandOperation{}
-				j = i + 1
-				for j < l {
-
-					nextOp := ops[j]
-					lastOperation = nextOp.Operation
-
-					if pipe == nil {
-						exe := nextOp.Command.Shift()
-						nextCmd := exec.New(exe, nextOp.Command.ToArray()...)
-						nextCmd.WithEnvMap(ctx.Task.Env.ToMap())
-						nextCmd.WithCwd(ctx.Task.Cwd)
-						pipe = cmd0.Pipe(nextCmd)
-					} else {
-						exe := nextOp.Command.Shift()
-						nextCmd := exec.New(exe, nextOp.Command.ToArray()...)
-						nextCmd.WithEnvMap(ctx.Task.Env.ToMap())
-						nextCmd.WithCwd(ctx.Task.Cwd)
-						pipe = pipe.Pipe(nextCmd)
-					}
-
-					if !nextOp.IsPipe() {
-						break
-					}
-
-					j++
-					if j >= l {
-						break
-					}
-				}
-
-				nextOp = ops[j]
-				i = j
-				o, err := pipe.Run()
-				if o.Code == 0 {
-					if nextOp.IsOr() {
-						return res.Ok()
-					}
-
-					continue
-				}
-
-				if nextOp.IsOr() {
-					continue
-				}
-
-				if err != nil {
-					return res.Fail(err)
-				}
-
-				err = errors.New("Task " + ctx.Task.Id + " failed with exit code " + strconv.Itoa(o.Code))
-				return res.Fail(err)
-			}
+		return res.Fail(err)
+	}
 
-			exe3 := op.Command.Shift()
-			cmd3 := exec.New(exe3, op.Command.ToArray()...)
-			cmd3.WithEnvMap(ctx.Task.Env.ToMap())
-			cmd3.WithCwd(ctx.Task.Cwd)
+	return res.Ok()
+}
 
-			o, err := cmd3.Run()
-			if o.Code == 0 {
-				if lastOperation == "||" || op.IsOr() {
-					return res.Ok()
+// registryExecHandler runs commands with the executables registered with
+// the exec package, e.g. bash from Git on Windows, before falling back to
+// the PATH of the task. The executables are found with the env of the task.
+// Commands that are stopped get the same grace period as other processes.
+func registryExecHandler(envLike exec.EnvLike) func(next interp.ExecHandlerFunc) interp.ExecHandlerFunc {
+	return func(next interp.ExecHandlerFunc) interp.ExecHandlerFunc {
+		run := interp.DefaultExecHandler(exec.GracePeriod)
+		return func(ctx context.Context, args []string) error {
+			if len(args) > 0 && exec.Registry.Has(args[0]) {
+				if exe, err := exec.Find(args[0], &exec.WhichOptions{Env: envLike}); err == nil {
+					args = append([]string{exe}, args[1:]...)
 				}
-
-				lastOperation = op.Operation
-				continue
 			}
 
-			if lastOperation == "||" || op.IsOr() {
-				lastOperation = op.Operation
-				continue
-			}
-
-			if err != nil {
-				return res.Fail(err)
-			}
-
-			err = errors.New("Task " + ctx.Task.Id + " failed with exit code " + strconv.Itoa(o.Code))
-			return res.Fail(err)
+			return run(ctx, args)
 		}
 	}
-
-	return res.Ok()
-}
-
-type commandOperation struct {
-	Command   cmdargs.Args
-	Operation string // "pipe", "and", "or", "sequence"
-}
-
-func (s *commandOperation) IsPipe() bool {
-	return s.Operation == "|"
-}
-
-func (s *commandOperation) IsAnd() bool {
-	return s.Operation == "&&"
-}
-
-func (s *commandOperation) IsOr() bool {
-	return s.Operation == "||"
-}
-
-func (s *commandOperation) IsSequence() bool {
-	return s.Operation == ";"
-}
-
-func (s *commandOperation) IsNoop() bool {
-	return s.Operation == ""
 }
@@ -0,0 +1,122 @@
+package tasks
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/frostyeti/mvps/go/run/schema"
+	"github.com/frostyeti/mvps/go/run/tasks/statuses"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeFakeExe writes an executable shell script to dir that appends its
+// name and arguments to the file in $FAKE_LOG.
+func writeFakeExe(t *testing.T, dir string, name string) string {
+	t.Helper()
+
+	file := filepath.Join(dir, name)
+	script := "#!/bin/sh\necho \"" + name + " $*\" >> \"$FAKE_LOG\"\n"
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(file, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	return file
+}
+
+func TestRunShellFindsShellWithTaskEnv(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake shells are written as shell scripts")
+	}
+
+	for _, p := range []string{"/bin/nu", "/usr/bin/nu"} {
+		if _, err := os.Stat(p); err == nil {
+			t.Skip("nu is installed in a known location")
+		}
+	}
+
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "bin")
+	taskSh := writeFakeExe(t, filepath.Join(dir, "task"), "task-sh")
+	processSh := writeFakeExe(t, filepath.Join(dir, "process"), "process-sh")
+	writeFakeExe(t, bin, "nu")
+
+	// the process finds other shells, which the tasks must not use
+	t.Setenv("SH_EXE", processSh)
+	t.Setenv("PATH", filepath.Join(dir, "process")+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	tests := []struct {
+		name string
+		uses string
+		env  map[string]string
+		want string
+	}{
+		{name: "variable", uses: "sh", env: map[string]string{"SH_EXE": taskSh}, want: "task-sh -e -c echo hi"},
+		{name: "path", uses: "nu", env: map[string]string{"PATH": bin + string(os.PathListSeparator) + "/usr/bin:/bin"}, want: "nu -c echo hi"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := filepath.Join(t.TempDir(), "log")
+			env := schema.NewEnv()
+			env.Set("FAKE_LOG", log)
+			for k, v := range tt.env {
+				env.Set(k, v)
+			}
+
+			res := runShell(TaskContext{
+				Task: &TaskModel{Id: tt.name, Uses: tt.uses, Run: "echo hi", Cwd: dir, Env: *env},
+			})
+
+			assert.Equal(t, statuses.Ok, res.Status, "%v", res.Err)
+			data, err := os.ReadFile(log)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, strings.TrimSpace(string(data)))
+		})
+	}
+}
+
+func TestRunXPlatShellRewritesRegisteredCommands(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake shells are written as shell scripts")
+	}
+
+	dir := t.TempDir()
+	taskSh := writeFakeExe(t, filepath.Join(dir, "task"), "task-sh")
+	processSh := writeFakeExe(t, filepath.Join(dir, "process"), "process-sh")
+	writeFakeExe(t, filepath.Join(dir, "bin"), "tool")
+	t.Setenv("SH_EXE", processSh)
+
+	log := filepath.Join(dir, "log")
+	env := schema.NewEnv()
+	env.Set("FAKE_LOG", log)
+	env.Set("SH_EXE", taskSh)
+	env.Set("PATH", filepath.Join(dir, "bin")+string(os.PathListSeparator)+"/usr/bin:/bin")
+
+	res := runXPlatShell("sh build.sh one\ntool two\necho three >> \"$FAKE_LOG\"", TaskContext{
+		Task: &TaskModel{Id: "xplat", Uses: "shell", Cwd: dir, Env: *env},
+	})
+
+	assert.Equal(t, statuses.Ok, res.Status, "%v", res.Err)
+	data, err := os.ReadFile(log)
+	assert.NoError(t, err)
+
+	// sh is registered and rewritten to the SH_EXE of the task, tool is
+	// not and runs from the PATH of the task
+	assert.Equal(t, "task-sh build.sh one\ntool two\nthree\n", string(data))
+}
+
+func TestRunXPlatShellExitCode(t *testing.T) {
+	res := runXPlatShell("exit 3\necho unreachable", TaskContext{
+		Task: &TaskModel{Id: "fail", Uses: "shell", Cwd: t.TempDir(), Env: *schema.NewEnv()},
+	})
+
+	assert.Equal(t, statuses.Error, res.Status)
+	assert.ErrorContains(t, res.Err, "failed with exit code 3")
+}
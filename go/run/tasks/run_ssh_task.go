@@ -2,14 +2,13 @@ package tasks
 
 import (
 	"context"
-	"net"
 	"net/url"
-	"os"
 	"strconv"
+	"time"
 
 	"github.com/frostyeti/mvps/go/errors"
+	"github.com/frostyeti/mvps/go/exec"
 	"github.com/frostyeti/mvps/go/run/schema"
-	goph "github.com/melbahja/goph"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -31,7 +30,7 @@ func runSshTask(ctx TaskContext) *TaskResult {
 		return res.Fail(errors.New("Invalid SSH URI scheme: " + uri.Scheme))
 	}
 
-	targets := []schema.HostEntry{}
+	targets := []hostTarget{}
 	if uri.Host != "" {
 		user := ""
 		if uri.User != nil {
@@ -57,106 +56,69 @@ func runSshTask(ctx TaskContext) *TaskResult {
 		}
 
 		identity := uri.Query().Get("identity")
-		targets = append(targets, schema.HostEntry{
-			Host:         uri.Host,
-			User:         &user,
-			Port:         &port,
-			IdentityFile: &identity,
-			Password:     &password,
+		targets = append(targets, hostTarget{
+			name: uri.Hostname(),
+			entry: schema.HostEntry{
+				Host:         uri.Hostname(),
+				User:         &user,
+				Port:         &port,
+				IdentityFile: &identity,
+				Password:     &password,
+			},
 		})
 	} else {
-		for _, t := range ctx.Task.Hosts.Entries() {
-			targets = append(targets, schema.HostEntry{
-				Host:         t.Host,
-				User:         t.User,
-				Port:         t.Port,
-				IdentityFile: t.IdentityFile,
-				Password:     t.Password,
-			})
-		}
-	}
-
-	if len(targets) == 0 {
-		return res.Fail(errors.New("No targets found for SSH task"))
+		targets = taskHosts(ctx)
 	}
 
-	for _, target := range targets {
-		err := runSSHTarget(ctx.Context, ctx, target)
-		if errors.Is(err, context.Canceled) {
-			return res.Cancel("Task " + ctx.Task.Id + " cancelled")
-		}
-
-		if errors.Is(err, context.DeadlineExceeded) {
-			return res.Cancel("Task " + ctx.Task.Id + " cancelled due to timeout")
-		}
-
-		if err != nil {
-			return res.Fail(errors.New("Failed to run SSH task on target " + target.Host + ": " + err.Error()))
-		}
+	shell := uri.Query().Get("shell")
+	if v, ok := ctx.Task.With["shell"].(string); ok && v != "" {
+		shell = v
 	}
 
-	res.End()
-
-	// Placeholder for running an SSH command
-	// This would typically involve executing the command over SSH
-	return res.Ok()
+	return runSshTargets(ctx, targets, shell)
 }
 
-type SshRun struct {
-	Error error
+// remoteScriptHandler returns a handler that runs the script of a step on
+// the hosts of its task, for task definitions that run remotely.
+func remoteScriptHandler(shell string) TaskHandler {
+	return func(ctx TaskContext) *TaskResult {
+		return runSshTargets(ctx, taskHosts(ctx), shell)
+	}
 }
 
-func runSSHTarget(ctx context.Context, taskContext TaskContext, target schema.HostEntry) error {
-	signal := make(chan SshRun)
-
-	var auth goph.Auth
-	var err error
-	identity := ""
-	password := ""
-	run := ""
-	if target.IdentityFile != nil {
-		identity = *target.IdentityFile
+// runSshTargets runs the task on each target. Without a shell the run of
+// the task is sent as a command, with one it is uploaded and run as a
+// script of that type.
+func runSshTargets(ctx TaskContext, targets []hostTarget, shell string) *TaskResult {
+	if len(targets) == 0 {
+		res := NewTaskResult()
+		return res.Fail(errors.New("No targets found for SSH task"))
 	}
 
-	if target.Password != nil {
-		password = *target.Password
+	if _, ok := remoteShells[shell]; shell != "" && !ok {
+		res := NewTaskResult()
+		return res.Fail(errors.New("Unsupported remote shell: " + shell))
 	}
 
-	run = taskContext.Task.Run
-
-	if identity == "" && password != "" {
-		auth = goph.Password(password)
-	} else if goph.HasAgent() {
-		auth, err = goph.UseAgent()
-	} else if identity != "" {
-		auth, err = goph.Key(identity, password)
-	} else {
-		return errors.New("No authentication method provided for SSH task")
-	}
+	return runOnHosts(ctx, targets, func(ctx TaskContext, target hostTarget) error {
+		err := runSSHTarget(ctx.Context, ctx, target.entry, shell)
+		if err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+			return errors.WithCause(errors.New("Failed to run SSH task on target "+target.name+": "+err.Error()), err)
+		}
 
-	if err != nil {
-		signal <- SshRun{Error: errors.New("Failed to create SSH authentication: " + err.Error())}
-	}
+		return err
+	})
+}
 
-	port := 22
-	if target.Port != nil && *target.Port > 0 {
-		port = int(*target.Port)
-	}
-	user := ""
-	if target.User != nil && *target.User != "" {
-		user = *target.User
-	}
+type SshRun struct {
+	Error error
+}
 
-	client, err := goph.NewConn(&goph.Config{
-		User: user,
-		Addr: target.Host,
-		Port: uint(port),
-		Auth: auth,
-		Callback: func(host string, remote net.Addr, key ssh.PublicKey) error {
-			return nil
-		},
-	})
+func runSSHTarget(ctx context.Context, taskContext TaskContext, target schema.HostEntry, shell string) error {
+	signal := make(chan SshRun, 1)
 
+	run := taskContext.Task.Run
+	client, err := dialSSH(ctx, taskContext, target)
 	if err != nil {
 		err2 := errors.New("Failed to connect to SSH target " + target.Host + ": " + err.Error())
 		err2 = errors.WithCause(err2, err)
@@ -165,6 +127,16 @@ func runSSHTarget(ctx context.Context, taskContext TaskContext, target schema.Ho
 
 	defer client.Close()
 
+	var script *remoteScript
+	if shell != "" {
+		script, err = uploadScript(client, taskContext, shell)
+		if err != nil {
+			return errors.WithCause(errors.New("Failed to upload script to SSH target "+target.Host+": "+err.Error()), err)
+		}
+		defer script.cleanup()
+		run = script.command
+	}
+
 	var sess *ssh.Session
 
 	if sess, err = client.NewSession(); err != nil {
@@ -176,7 +148,8 @@ func runSSHTarget(ctx context.Context, taskContext TaskContext, target schema.Ho
 
 	go func() {
 
-		if taskContext.Task.Env.Len() > 0 {
+		// scripts read their env from the file uploaded with them
+		if script == nil && taskContext.Task.Env.Len() > 0 {
 			// only set env values that are explicitly set in the task
 			for _, key := range taskContext.Task.Env.Keys() {
 				value, _ := taskContext.Task.Env.Get(key)
@@ -184,8 +157,8 @@ func runSSHTarget(ctx context.Context, taskContext TaskContext, target schema.Ho
 			}
 		}
 
-		sess.Stdout = os.Stdout
-		sess.Stderr = os.Stderr
+		sess.Stdout = taskContext.Out()
+		sess.Stderr = taskContext.Err()
 		err = sess.Run(run)
 
 		if err != nil {
@@ -200,9 +173,21 @@ func runSSHTarget(ctx context.Context, taskContext TaskContext, target schema.Ho
 
 	select {
 	case <-ctx.Done():
+		// ask the remote command to stop and give it the same grace period
+		// as local processes before the session is closed.
 		sess.Signal(ssh.SIGINT)
+		select {
+		case <-signal:
+		case <-time.After(exec.GracePeriod):
+		}
 		return ctx.Err()
 	case result := <-signal:
+		if script != nil {
+			if err := script.forward(taskContext); err != nil && result.Error == nil {
+				return err
+			}
+		}
+
 		return result.Error
 	}
 }
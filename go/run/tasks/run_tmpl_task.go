@@ -84,7 +84,7 @@ func runTpl(ctx TaskContext) *TaskResult {
 
 	values := map[string]interface{}{}
 	if len(valuesFile) > 0 && valuesFile != "/" {
-		bytes, err := os.ReadFile(valuesFile)
+		bytes, err := os.ReadFile(ctx.Path(valuesFile))
 		if err != nil {
 			return res.Fail(errors.New("Failed to read values file: " + err.Error()))
 		}
@@ -119,7 +119,7 @@ func runTpl(ctx TaskContext) *TaskResult {
 			}
 		}
 
-		bytes, err := os.ReadFile(src)
+		bytes, err := os.ReadFile(ctx.Path(src))
 		if err != nil {
 			return res.Fail(errors.New("Failed to read template file: " + err.Error()))
 		}
@@ -147,7 +147,7 @@ func runTpl(ctx TaskContext) *TaskResult {
 			content = updatedContent
 
 			if !useTmpl {
-				err := os.WriteFile(dest, []byte(content), 0644)
+				err := os.WriteFile(ctx.Path(dest), []byte(content), 0644)
 				if err != nil {
 					return res.Fail(errors.New("Failed to write output file: " + err.Error()))
 				}
@@ -160,7 +160,7 @@ func runTpl(ctx TaskContext) *TaskResult {
 				return res.Fail(errors.New("Failed to parse template file: " + err.Error()))
 			}
 
-			out, err := os.Create(dest)
+			out, err := os.Create(ctx.Path(dest))
 			if err != nil {
 				return res.Fail(errors.New("Failed to create output file: " + err.Error()))
 			}
@@ -0,0 +1,168 @@
+package tasks
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// sshConfigBlock is a Host block of an OpenSSH client config file.
+type sshConfigBlock struct {
+	patterns []string
+	options  map[string]string
+}
+
+// sshConfig holds the Host blocks of ~/.ssh/config. Like ssh, the first
+// value found for an option is the one that is used.
+type sshConfig struct {
+	blocks []sshConfigBlock
+}
+
+var (
+	userSSHConfig     *sshConfig
+	userSSHConfigOnce sync.Once
+)
+
+// loadUserSSHConfig reads ~/.ssh/config once. A missing or unreadable file
+// is treated as empty.
+func loadUserSSHConfig() *sshConfig {
+	userSSHConfigOnce.Do(func() {
+		userSSHConfig = &sshConfig{}
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return
+		}
+
+		userSSHConfig.parseFile(filepath.Join(home, ".ssh", "config"), 0)
+	})
+
+	return userSSHConfig
+}
+
+func (c *sshConfig) parseFile(file string, depth int) {
+	f, err := os.Open(file)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	// options before the first Host block apply to every host
+	current := sshConfigBlock{patterns: []string{"*"}, options: map[string]string{}}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value := splitSSHConfigLine(line)
+		if key == "" {
+			continue
+		}
+
+		switch key {
+		case "host":
+			c.blocks = append(c.blocks, current)
+			current = sshConfigBlock{patterns: strings.Fields(value), options: map[string]string{}}
+		case "match":
+			// match blocks are not supported, skip their options
+			c.blocks = append(c.blocks, current)
+			current = sshConfigBlock{patterns: []string{}, options: map[string]string{}}
+		case "include":
+			if depth > 8 {
+				continue
+			}
+
+			c.blocks = append(c.blocks, current)
+			for _, pattern := range strings.Fields(value) {
+				pattern = expandHome(pattern)
+				if !filepath.IsAbs(pattern) {
+					pattern = filepath.Join(filepath.Dir(file), pattern)
+				}
+
+				matches, _ := filepath.Glob(pattern)
+				for _, match := range matches {
+					c.parseFile(match, depth+1)
+				}
+			}
+			current = sshConfigBlock{patterns: current.patterns, options: map[string]string{}}
+		default:
+			if _, ok := current.options[key]; !ok {
+				current.options[key] = value
+			}
+		}
+	}
+
+	c.blocks = append(c.blocks, current)
+}
+
+// splitSSHConfigLine splits a line into its lower case keyword and value,
+// which may be separated by whitespace or an equals sign.
+func splitSSHConfigLine(line string) (string, string) {
+	i := strings.IndexAny(line, " \t=")
+	if i < 0 {
+		return strings.ToLower(line), ""
+	}
+
+	key := strings.ToLower(line[:i])
+	value := strings.TrimLeft(line[i:], " \t")
+	value = strings.TrimPrefix(value, "=")
+	value = strings.TrimSpace(value)
+	value = strings.Trim(value, "\"")
+	return key, value
+}
+
+// Get returns the first value of the option from the blocks that match
+// the host.
+func (c *sshConfig) Get(host string, key string) string {
+	if c == nil {
+		return ""
+	}
+
+	key = strings.ToLower(key)
+	for _, block := range c.blocks {
+		if !matchSSHHost(block.patterns, host) {
+			continue
+		}
+
+		if value, ok := block.options[key]; ok {
+			return value
+		}
+	}
+
+	return ""
+}
+
+// matchSSHHost reports whether the host matches the patterns of a Host
+// line. A matching negated pattern excludes the host.
+func matchSSHHost(patterns []string, host string) bool {
+	matched := false
+	for _, pattern := range patterns {
+		negate := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+		ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(host))
+		if !ok {
+			continue
+		}
+
+		if negate {
+			return false
+		}
+		matched = true
+	}
+
+	return matched
+}
+
+func expandHome(p string) string {
+	if p == "~" || strings.HasPrefix(p, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, strings.TrimPrefix(p, "~"))
+		}
+	}
+
+	return p
+}
@@ -0,0 +1,101 @@
+package tasks
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSSHConfig(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+
+	write("conf.d/web", `
+Host web*
+  User deploy
+  Port 2222
+`)
+
+	file := write("config", `
+# options before the first host apply to every host
+ServerAliveInterval 30
+
+Include conf.d/*
+
+Host web1
+  User root
+  HostName 10.0.0.1
+
+Host *.internal !bastion.internal
+  ProxyJump bastion.internal
+  IdentityFile="~/.ssh/internal key"
+
+Match host db*
+  User postgres
+
+Host *
+  User nobody
+  Port 22
+`)
+
+	c := &sshConfig{}
+	c.parseFile(file, 0)
+
+	tests := []struct {
+		host string
+		key  string
+		want string
+	}{
+		{"anything", "ServerAliveInterval", "30"},
+		{"web1", "user", "deploy"},
+		{"web1", "hostname", "10.0.0.1"},
+		{"web1", "port", "2222"},
+		{"web2", "user", "deploy"},
+		{"api.internal", "proxyjump", "bastion.internal"},
+		{"API.INTERNAL", "ProxyJump", "bastion.internal"},
+		{"api.internal", "identityfile", "~/.ssh/internal key"},
+		{"bastion.internal", "proxyjump", ""},
+		{"db1", "user", "nobody"},
+		{"other", "port", "22"},
+		{"other", "hostname", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host+" "+tt.key, func(t *testing.T) {
+			assert.Equal(t, tt.want, c.Get(tt.host, tt.key))
+		})
+	}
+}
+
+func TestSplitSSHConfigLine(t *testing.T) {
+	tests := []struct {
+		line  string
+		key   string
+		value string
+	}{
+		{"User deploy", "user", "deploy"},
+		{"Port=22", "port", "22"},
+		{"Port = 22", "port", "22"},
+		{"IdentityFile \"~/my key\"", "identityfile", "~/my key"},
+		{"Compression", "compression", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			key, value := splitSSHConfigLine(tt.line)
+			assert.Equal(t, tt.key, key)
+			assert.Equal(t, tt.value, value)
+		})
+	}
+}
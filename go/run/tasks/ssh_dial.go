@@ -0,0 +1,419 @@
+package tasks
+
+import (
+	"context"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/frostyeti/mvps/go/errors"
+	"github.com/frostyeti/mvps/go/run/schema"
+	goph "github.com/melbahja/goph"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// defaultKeepAlive is the interval of keepalive requests when neither the
+// host entry nor ~/.ssh/config sets one.
+const defaultKeepAlive = 30 * time.Second
+
+// sshTarget is a host entry with the options of ~/.ssh/config applied.
+type sshTarget struct {
+	name           string
+	addr           string
+	user           string
+	identity       string
+	password       string
+	knownHosts     string
+	knownHostsFile string
+	jump           []string
+	keepAlive      time.Duration
+}
+
+// sshClient is a connection to a host, possibly through jump hosts. Closing
+// it closes the connections to the jump hosts as well.
+type sshClient struct {
+	*goph.Client
+	hops []*ssh.Client
+	done chan struct{}
+	once sync.Once
+}
+
+func (c *sshClient) Close() error {
+	var err error
+	c.once.Do(func() {
+		close(c.done)
+		err = c.Client.Close()
+		for i := len(c.hops) - 1; i >= 0; i-- {
+			c.hops[i].Close()
+		}
+	})
+
+	return err
+}
+
+// dialSSH connects to the host entry through its jump hosts, verifying the
+// key of every host against known_hosts.
+func dialSSH(ctx context.Context, taskContext TaskContext, entry schema.HostEntry) (*sshClient, error) {
+	cfg := loadUserSSHConfig()
+	target := resolveSSHTarget(cfg, taskContext, entry)
+
+	chain := []sshTarget{}
+	for _, hop := range target.jump {
+		jumpEntry, ok := taskContext.Inventory.Get(hop)
+		if !ok {
+			jumpEntry = parseHostEntry(hop)
+		}
+
+		jumpTarget := resolveSSHTarget(cfg, taskContext, *jumpEntry)
+		chain = append(chain, jumpTarget)
+	}
+	chain = append(chain, target)
+
+	c := &sshClient{done: make(chan struct{})}
+	var client *ssh.Client
+	for _, hop := range chain {
+		var next *ssh.Client
+		config, err := hop.clientConfig()
+		if err == nil {
+			next, err = dialHop(ctx, client, hop, config, c)
+		}
+
+		if err != nil {
+			if client != nil {
+				client.Close()
+			}
+			for i := len(c.hops) - 1; i >= 0; i-- {
+				c.hops[i].Close()
+			}
+
+			if hop.name != target.name {
+				return nil, errors.WithCause(errors.New("Failed to connect to jump host "+hop.name+": "+err.Error()), err)
+			}
+
+			return nil, err
+		}
+
+		client = next
+	}
+
+	host, port, _ := net.SplitHostPort(target.addr)
+	portValue, _ := strconv.Atoi(port)
+	c.Client = &goph.Client{
+		Client: client,
+		Config: &goph.Config{
+			User:    target.user,
+			Addr:    host,
+			Port:    uint(portValue),
+			Timeout: goph.DefaultTimeout,
+		},
+	}
+
+	if target.keepAlive > 0 {
+		go c.keepAlive(target.keepAlive)
+	}
+
+	return c, nil
+}
+
+// dialHop connects to hop directly, or through the client of the previous
+// hop, which is then kept to be closed with the connection.
+func dialHop(ctx context.Context, through *ssh.Client, hop sshTarget, config *ssh.ClientConfig, c *sshClient) (*ssh.Client, error) {
+	var conn net.Conn
+	var err error
+	if through == nil {
+		dialer := net.Dialer{Timeout: config.Timeout}
+		conn, err = dialer.DialContext(ctx, "tcp", hop.addr)
+	} else {
+		conn, err = through.DialContext(ctx, "tcp", hop.addr)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	ncc, chans, reqs, err := ssh.NewClientConn(conn, hop.addr, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if through != nil {
+		c.hops = append(c.hops, through)
+	}
+
+	return ssh.NewClient(ncc, chans, reqs), nil
+}
+
+// keepAlive sends keepalive requests and closes the connection after three
+// requests in a row went unanswered.
+func (c *sshClient) keepAlive(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	missed := 0
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+
+		reply := make(chan error, 1)
+		go func() {
+			_, _, err := c.Client.SendRequest("keepalive@openssh.com", true, nil)
+			reply <- err
+		}()
+
+		select {
+		case <-c.done:
+			return
+		case err := <-reply:
+			if err != nil {
+				c.Close()
+				return
+			}
+			missed = 0
+		case <-time.After(interval):
+			missed++
+			if missed >= 3 {
+				c.Close()
+				return
+			}
+		}
+	}
+}
+
+// resolveSSHTarget applies ~/.ssh/config to a host entry. Values set on
+// the entry take precedence.
+func resolveSSHTarget(cfg *sshConfig, taskContext TaskContext, entry schema.HostEntry) sshTarget {
+	alias := entry.Host
+	t := sshTarget{name: alias}
+
+	hostname := alias
+	if v := cfg.Get(alias, "HostName"); v != "" {
+		hostname = strings.ReplaceAll(v, "%h", alias)
+	}
+
+	port := 22
+	if entry.Port != nil && *entry.Port > 0 {
+		port = int(*entry.Port)
+	} else if v, err := strconv.Atoi(cfg.Get(alias, "Port")); err == nil && v > 0 {
+		port = v
+	}
+	t.addr = net.JoinHostPort(hostname, strconv.Itoa(port))
+
+	if entry.User != nil && *entry.User != "" {
+		t.user = *entry.User
+	} else if v := cfg.Get(alias, "User"); v != "" {
+		t.user = v
+	} else if u, err := user.Current(); err == nil {
+		t.user = u.Username
+	}
+
+	if entry.IdentityFile != nil && *entry.IdentityFile != "" {
+		t.identity = expandHome(*entry.IdentityFile)
+	} else if v := cfg.Get(alias, "IdentityFile"); v != "" {
+		t.identity = expandHome(v)
+	}
+
+	if entry.Password != nil && *entry.Password != "" {
+		t.password = *entry.Password
+		if p, ok := taskContext.Task.Env.Get(t.password); ok {
+			t.password = p
+		}
+	}
+
+	t.knownHosts = schema.KnownHostsStrict
+	if entry.KnownHosts != nil {
+		t.knownHosts = *entry.KnownHosts
+	} else {
+		switch strings.ToLower(cfg.Get(alias, "StrictHostKeyChecking")) {
+		case "accept-new":
+			t.knownHosts = schema.KnownHostsAcceptNew
+		case "no", "off":
+			t.knownHosts = schema.KnownHostsOff
+		}
+	}
+
+	if entry.KnownHostsFile != nil && *entry.KnownHostsFile != "" {
+		t.knownHostsFile = expandHome(*entry.KnownHostsFile)
+	} else if v := strings.Fields(cfg.Get(alias, "UserKnownHostsFile")); len(v) > 0 {
+		t.knownHostsFile = expandHome(v[0])
+	} else if home, err := os.UserHomeDir(); err == nil {
+		t.knownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+	}
+
+	if entry.Jump != nil {
+		t.jump = entry.Jump
+	} else if v := cfg.Get(alias, "ProxyJump"); v != "" && !strings.EqualFold(v, "none") {
+		for _, hop := range strings.Split(v, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				t.jump = append(t.jump, hop)
+			}
+		}
+	}
+
+	t.keepAlive = defaultKeepAlive
+	if entry.KeepAlive != nil {
+		t.keepAlive = *entry.KeepAlive
+	} else if v, err := strconv.Atoi(cfg.Get(alias, "ServerAliveInterval")); err == nil {
+		t.keepAlive = time.Duration(v) * time.Second
+	}
+
+	return t
+}
+
+// parseHostEntry parses a jump host in the form [user@]host[:port].
+func parseHostEntry(value string) *schema.HostEntry {
+	entry := &schema.HostEntry{Host: value}
+	if i := strings.LastIndex(value, "@"); i >= 0 {
+		user := value[:i]
+		entry.User = &user
+		entry.Host = value[i+1:]
+	}
+
+	if host, port, err := net.SplitHostPort(entry.Host); err == nil {
+		if p, err := strconv.Atoi(port); err == nil {
+			portValue := uint(p)
+			entry.Port = &portValue
+			entry.Host = host
+		}
+	}
+
+	return entry
+}
+
+func (t sshTarget) clientConfig() (*ssh.ClientConfig, error) {
+	auth := goph.Auth{}
+	if t.identity != "" {
+		key, err := goph.Key(t.identity, t.password)
+		if err != nil {
+			return nil, errors.New("Failed to create SSH authentication: " + err.Error())
+		}
+		auth = append(auth, key...)
+	}
+
+	if goph.HasAgent() {
+		agent, err := goph.UseAgent()
+		if err != nil {
+			return nil, errors.New("Failed to create SSH authentication: " + err.Error())
+		}
+		auth = append(auth, agent...)
+	}
+
+	if t.identity == "" && t.password != "" {
+		auth = append(auth, goph.Password(t.password)...)
+	}
+
+	if len(auth) == 0 {
+		return nil, errors.New("No authentication method provided for SSH task")
+	}
+
+	callback, err := hostKeyCallback(t.knownHosts, t.knownHostsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ssh.ClientConfig{
+		User:            t.user,
+		Auth:            auth,
+		Timeout:         goph.DefaultTimeout,
+		HostKeyCallback: callback,
+	}, nil
+}
+
+var (
+	knownHostsMu       sync.Mutex
+	acceptedKnownHosts = map[string]bool{}
+)
+
+// hostKeyCallback verifies host keys against the known_hosts file and the
+// system wide known hosts. With accept-new, keys of hosts that are not
+// known yet are added to the file, changed keys are always rejected.
+func hostKeyCallback(mode string, file string) (ssh.HostKeyCallback, error) {
+	if mode == schema.KnownHostsOff {
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+
+	files := []string{}
+	for _, f := range []string{file, "/etc/ssh/ssh_known_hosts"} {
+		if f != "" && isFile(f) {
+			files = append(files, f)
+		}
+	}
+
+	var check ssh.HostKeyCallback
+	if len(files) > 0 {
+		var err error
+		check, err = knownhosts.New(files...)
+		if err != nil {
+			return nil, errors.New("Failed to read known hosts: " + err.Error())
+		}
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if check != nil {
+			err := check(hostname, remote, key)
+			if err == nil {
+				return nil
+			}
+
+			var keyErr *knownhosts.KeyError
+			if !errors.As(err, &keyErr) {
+				return err
+			}
+
+			if len(keyErr.Want) > 0 {
+				return errors.New("Host key for " + hostname + " does not match the key in known hosts, someone may be intercepting the connection")
+			}
+		}
+
+		if mode != schema.KnownHostsAcceptNew {
+			return errors.New("Host key for " + hostname + " is not in " + file + ", add it with ssh-keyscan or set known-hosts to accept-new")
+		}
+
+		return addKnownHost(file, hostname, key)
+	}, nil
+}
+
+func addKnownHost(file string, hostname string, key ssh.PublicKey) error {
+	knownHostsMu.Lock()
+	defer knownHostsMu.Unlock()
+
+	line := knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key)
+	if acceptedKnownHosts[line] {
+		return nil
+	}
+
+	if file == "" {
+		return errors.New("No known hosts file to add the key of " + hostname + " to")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(line + "\n"); err != nil {
+		return err
+	}
+
+	acceptedKnownHosts[line] = true
+	return nil
+}
+
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
@@ -0,0 +1,245 @@
+package tasks
+
+import (
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/frostyeti/mvps/go/errors"
+	"github.com/frostyeti/mvps/go/rtexec/bash"
+	"github.com/frostyeti/mvps/go/rtexec/deno"
+	"github.com/frostyeti/mvps/go/rtexec/node"
+	"github.com/frostyeti/mvps/go/rtexec/powershell"
+	"github.com/frostyeti/mvps/go/rtexec/pwsh"
+	"github.com/frostyeti/mvps/go/run/schema"
+)
+
+// remoteShell is how a script of a given type is run on a remote host.
+type remoteShell struct {
+	exe  string
+	args []string
+	ext  string
+}
+
+// remoteShells are the script types that can be run on remote hosts. The
+// hosts need a POSIX shell to set up the environment of the script.
+var remoteShells = map[string]remoteShell{
+	"bash":       {exe: "bash", args: bash.ScriptArgs, ext: ".sh"},
+	"sh":         {exe: "sh", args: []string{"-e"}, ext: ".sh"},
+	"pwsh":       {exe: "pwsh", args: append(append([]string{}, pwsh.ScriptArgs...), "-File"), ext: ".ps1"},
+	"powershell": {exe: "powershell", args: append(append([]string{}, powershell.ScriptArgs...), "-File"), ext: ".ps1"},
+	"python":     {exe: "python3", ext: ".py"},
+	"node":       {exe: "node", args: node.ScriptArgs, ext: ".js"},
+	"deno":       {exe: "deno", args: append([]string{"run"}, deno.ScriptArgs...), ext: ".ts"},
+	"bun":        {exe: "bun", args: []string{"run"}, ext: ".ts"},
+	"ruby":       {exe: "ruby", ext: ".rb"},
+	"nushell":    {exe: "nu", ext: ".nu"},
+	"nu":         {exe: "nu", ext: ".nu"},
+}
+
+// remoteFiles are the files a script writes env, paths and outputs to,
+// which are copied back to the local files of the same variables.
+var remoteFiles = []string{"RUN_ENV", "RUN_PATH", "RUN_OUTPUTS"}
+
+var (
+	envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+	// forwardMu serializes appends to the local files, hosts may finish
+	// at the same time.
+	forwardMu sync.Mutex
+)
+
+// remoteScript is a script uploaded to a temporary directory on a host.
+type remoteScript struct {
+	client  *sshClient
+	dir     string
+	command string
+}
+
+// uploadScript uploads the run of the task and an env file to a temporary
+// directory on the host and returns the command that runs the script with
+// that env. A run that is the path of a local file uploads the file.
+func uploadScript(client *sshClient, taskContext TaskContext, shell string) (*remoteScript, error) {
+	rs, ok := remoteShells[shell]
+	if !ok {
+		return nil, errors.New("Unsupported remote shell: " + shell)
+	}
+
+	out, err := client.Run("mktemp -d")
+	if err != nil {
+		return nil, errors.New("Failed to create a temporary directory: " + err.Error())
+	}
+
+	script := &remoteScript{client: client, dir: strings.TrimSpace(string(out))}
+	if script.dir == "" {
+		return nil, errors.New("Failed to create a temporary directory: mktemp printed nothing")
+	}
+
+	content := taskContext.Task.Run
+	trimmed := strings.TrimSpace(content)
+	if !strings.ContainsAny(trimmed, "\r\n") && strings.HasSuffix(trimmed, rs.ext) && isFile(trimmed) {
+		data, err := os.ReadFile(trimmed)
+		if err != nil {
+			script.cleanup()
+			return nil, errors.New("Failed to read script " + trimmed + ": " + err.Error())
+		}
+		content = string(data)
+	}
+
+	files := map[string]string{}
+	for _, name := range remoteFiles {
+		files[path.Join(script.dir, strings.ToLower(name))] = ""
+	}
+
+	scriptFile := path.Join(script.dir, "script"+rs.ext)
+	envFile := path.Join(script.dir, "script.env")
+	files[scriptFile] = content
+	files[envFile] = remoteEnvFile(&taskContext.Task.Env, script.dir)
+
+	ftp, err := client.NewSftp()
+	if err != nil {
+		script.cleanup()
+		return nil, errors.New("Failed to open SFTP session: " + err.Error())
+	}
+	defer ftp.Close()
+
+	for file, data := range files {
+		f, err := ftp.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+		if err == nil {
+			err = f.Chmod(0o600)
+			if err == nil {
+				_, err = io.WriteString(f, data)
+			}
+			f.Close()
+		}
+
+		if err != nil {
+			script.cleanup()
+			return nil, errors.New("Failed to upload " + file + ": " + err.Error())
+		}
+	}
+
+	script.command = remoteCommand(rs, scriptFile, envFile, taskContext.Task.Args)
+	return script, nil
+}
+
+// remoteEnvFile returns the env file of a script in dir, which sets the env
+// of the task and points RUN_ENV, RUN_PATH and RUN_OUTPUTS at files in dir.
+func remoteEnvFile(taskEnv *schema.Environment, dir string) string {
+	env := map[string]string{}
+	for _, key := range taskEnv.Keys() {
+		// variables inherited from this process belong to the local host
+		value := taskEnv.GetString(key)
+		if current, ok := os.LookupEnv(key); ok && current == value {
+			continue
+		}
+
+		if envNamePattern.MatchString(key) {
+			env[key] = value
+		}
+	}
+
+	for _, name := range remoteFiles {
+		env[name] = path.Join(dir, strings.ToLower(name))
+	}
+
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	lines := []string{}
+	for _, key := range keys {
+		lines = append(lines, key+"="+posixQuote(env[key]))
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// remoteCommand returns the command that runs the script with args on a
+// host after it exports the variables of the env file. The host runs the
+// command with the shell of the user, which may not be a POSIX shell, so
+// the command is wrapped in sh -c.
+func remoteCommand(rs remoteShell, scriptFile string, envFile string, args []string) string {
+	cmd := []string{rs.exe}
+	cmd = append(cmd, rs.args...)
+	cmd = append(cmd, scriptFile)
+	cmd = append(cmd, args...)
+	for i, arg := range cmd {
+		cmd[i] = posixQuote(arg)
+	}
+
+	command := "set -a && . " + posixQuote(envFile) + " && set +a && exec " + strings.Join(cmd, " ")
+	return "sh -c " + posixQuote(command)
+}
+
+// forward appends what the script wrote to its RUN_ENV, RUN_PATH and
+// RUN_OUTPUTS files to the local files of the task.
+func (s *remoteScript) forward(taskContext TaskContext) error {
+	ftp, err := s.client.NewSftp()
+	if err != nil {
+		return errors.New("Failed to open SFTP session: " + err.Error())
+	}
+	defer ftp.Close()
+
+	for _, name := range remoteFiles {
+		local := taskContext.Task.Env.GetString(name)
+		if local == "" {
+			continue
+		}
+
+		remote, err := ftp.Open(path.Join(s.dir, strings.ToLower(name)))
+		if err != nil {
+			continue
+		}
+
+		data, err := io.ReadAll(remote)
+		remote.Close()
+		if err != nil {
+			return errors.New("Failed to read remote " + name + " file: " + err.Error())
+		}
+
+		if len(data) == 0 {
+			continue
+		}
+
+		if err := appendLocalFile(local, data); err != nil {
+			return errors.New("Failed to write " + name + " file: " + err.Error())
+		}
+	}
+
+	return nil
+}
+
+// cleanup removes the temporary directory from the host.
+func (s *remoteScript) cleanup() {
+	s.client.Run("rm -rf " + posixQuote(s.dir))
+}
+
+func appendLocalFile(file string, data []byte) error {
+	forwardMu.Lock()
+	defer forwardMu.Unlock()
+
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		data = append(data, '\n')
+	}
+
+	_, err = f.Write(data)
+	return err
+}
+
+// posixQuote quotes s for a POSIX shell.
+func posixQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,113 @@
+package tasks
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/frostyeti/mvps/go/run/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPosixQuote(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"plain", "'plain'"},
+		{"", "''"},
+		{"a b", "'a b'"},
+		{"it's", `'it'\''s'`},
+		{"$HOME `id` $(id)", "'$HOME `id` $(id)'"},
+		{"a\nb", "'a\nb'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			assert.Equal(t, tt.want, posixQuote(tt.in))
+		})
+	}
+}
+
+func TestRemoteEnvFile(t *testing.T) {
+	t.Setenv("RUN_TEST_INHERITED", "local")
+	t.Setenv("RUN_TEST_CHANGED", "local")
+
+	env := schema.NewEnv()
+	env.Set("GREETING", "it's $HOME")
+	env.Set("RUN_TEST_INHERITED", "local")
+	env.Set("RUN_TEST_CHANGED", "task")
+	env.Set("BAD-NAME", "x")
+	env.Set("RUN_OUTPUTS", "/local/outputs")
+
+	// variables of the process and names a shell cannot set are left out,
+	// the RUN_ files point at the files of the script
+	assert.Equal(t, `GREETING='it'\''s $HOME'
+RUN_ENV='/tmp/run.1/run_env'
+RUN_OUTPUTS='/tmp/run.1/run_outputs'
+RUN_PATH='/tmp/run.1/run_path'
+RUN_TEST_CHANGED='task'
+`, remoteEnvFile(env, "/tmp/run.1"))
+}
+
+func TestRemoteCommand(t *testing.T) {
+	tests := []struct {
+		shell string
+		args  []string
+		want  string
+	}{
+		{
+			shell: "sh",
+			want:  `sh -c 'set -a && . '\''/tmp/run.1/script.env'\'' && set +a && exec '\''sh'\'' '\''-e'\'' '\''/tmp/run.1/script.sh'\'''`,
+		},
+		{
+			shell: "python",
+			args:  []string{"it's", "a b"},
+			want:  `sh -c 'set -a && . '\''/tmp/run.1/script.env'\'' && set +a && exec '\''python3'\'' '\''/tmp/run.1/script.py'\'' '\''it'\''\'\'''\''s'\'' '\''a b'\'''`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.shell, func(t *testing.T) {
+			rs := remoteShells[tt.shell]
+			got := remoteCommand(rs, "/tmp/run.1/script"+rs.ext, "/tmp/run.1/script.env", tt.args)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	pwsh := remoteShells["pwsh"]
+	assert.Contains(t, remoteCommand(pwsh, "/tmp/run.1/script.ps1", "/tmp/run.1/script.env", nil), `'\''-File'\'' '\''/tmp/run.1/script.ps1'\''`)
+}
+
+// TestRemoteCommandRuns runs the command a host would run with a local sh,
+// to check that the env and the arguments reach the script unchanged.
+func TestRemoteCommandRuns(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+
+	dir := t.TempDir()
+	env := schema.NewEnv()
+	env.Set("GREETING", "it's $HOME `id`")
+
+	rs := remoteShells["sh"]
+	scriptFile := filepath.Join(dir, "script"+rs.ext)
+	envFile := filepath.Join(dir, "script.env")
+	script := "printf '%s\\n' \"$GREETING\" \"$@\"\necho \"name=$1\" >> \"$RUN_OUTPUTS\"\n"
+	assert.NoError(t, os.WriteFile(scriptFile, []byte(script), 0o600))
+	assert.NoError(t, os.WriteFile(envFile, []byte(remoteEnvFile(env, dir)), 0o600))
+
+	args := []string{"it's", "a  b", "$(touch pwned)", ""}
+	out, err := exec.Command("sh", "-c", remoteCommand(rs, scriptFile, envFile, args)).CombinedOutput()
+	assert.NoError(t, err, string(out))
+	assert.Equal(t, "it's $HOME `id`\nit's\na  b\n$(touch pwned)\n\n", string(out))
+
+	outputs, err := os.ReadFile(filepath.Join(dir, "run_outputs"))
+	assert.NoError(t, err)
+	assert.Equal(t, "name=it's\n", string(outputs))
+
+	_, err = os.Stat("pwned")
+	assert.True(t, os.IsNotExist(err))
+}
@@ -8,3 +8,23 @@ const (
 	Skipped   = 4
 	Cancelled = 5
 )
+
+// Name returns the lower case name of a status, e.g. "ok" or "skipped".
+func Name(status int) string {
+	switch status {
+	case None:
+		return "none"
+	case Running:
+		return "running"
+	case Ok:
+		return "ok"
+	case Error:
+		return "error"
+	case Skipped:
+		return "skipped"
+	case Cancelled:
+		return "cancelled"
+	default:
+		return "unknown"
+	}
+}
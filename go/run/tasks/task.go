@@ -2,9 +2,13 @@ package tasks
 
 import (
 	"context"
+	"io"
+	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/frostyeti/mvps/go/run/schema"
+	"github.com/frostyeti/mvps/go/secrets"
 )
 
 type TaskModel struct {
@@ -22,6 +26,9 @@ type TaskModel struct {
 	Needs   []string
 	With    schema.With
 	Force   bool
+	Retry   *schema.Retry
+	// Strategy controls how the task runs across its hosts.
+	Strategy *schema.Strategy
 }
 
 type TaskContext struct {
@@ -30,6 +37,76 @@ type TaskContext struct {
 	Context     context.Context
 	Args        []string
 	ContextName string
+	Stdout      io.Writer
+	Stderr      io.Writer
+	// Masker holds the secrets masked in the output of the task.
+	Masker *secrets.SecretMasker
+	// Inventory holds every host of the workflow, which jump hosts are
+	// looked up in.
+	Inventory *schema.Hosts
+}
+
+// Out returns the writer a handler should use for standard output,
+// falling back to os.Stdout when the workflow did not set one.
+func (tc TaskContext) Out() io.Writer {
+	if tc.Stdout != nil {
+		return tc.Stdout
+	}
+
+	return os.Stdout
+}
+
+// Err returns the writer a handler should use for standard error,
+// falling back to os.Stderr when the workflow did not set one.
+func (tc TaskContext) Err() io.Writer {
+	if tc.Stderr != nil {
+		return tc.Stderr
+	}
+
+	return os.Stderr
+}
+
+// Path returns path relative to the cwd of the task. Handlers must not
+// rely on the working directory of the process, which every task that
+// runs at the same time shares.
+func (tc TaskContext) Path(path string) string {
+	if path == "" || filepath.IsAbs(path) || tc.Task == nil || tc.Task.Cwd == "" {
+		return path
+	}
+
+	return filepath.Join(tc.Task.Cwd, path)
+}
+
+// maskOutput routes the output of the task through writers that mask the
+// secrets of env. It returns a function that writes any
+// output held back by the writers. Output is not wrapped when there is
+// nothing to mask, so that commands still see a terminal.
+func (tc *TaskContext) maskOutput(env *schema.Environment) func() {
+	if tc.Masker == nil {
+		tc.Masker = secrets.NewSecretMasker()
+	}
+
+	for _, key := range env.Secrets() {
+		tc.Masker.AddValue(env.GetString(key))
+	}
+
+	if tc.Masker.Len() == 0 {
+		return func() {}
+	}
+
+	if _, ok := tc.Stdout.(*secrets.MaskWriter); ok {
+		return func() {}
+	}
+
+	stdout := secrets.NewMaskWriter(tc.Out(), tc.Masker)
+	stderr := secrets.NewMaskWriter(tc.Err(), tc.Masker)
+	tc.Stdout = stdout
+	tc.Stderr = stderr
+
+	return func() {
+		stdout.Flush()
+		stderr.Flush()
+	}
 }
 
 type TaskHandler func(tc TaskContext) *TaskResult
@@ -8,12 +8,43 @@ import (
 )
 
 type TaskResult struct {
+	Id        string
+	Name      string
 	Err       error
 	Status    int
 	StartedAt time.Time
 	EndedAt   time.Time
 	Message   string
 	Output    map[string]interface{}
+	Steps     []TaskResult
+	// ExitCode is the exit code of the process that failed the task, or 0
+	// when the failure did not come from a process.
+	ExitCode int
+	// Attempts holds every attempt made when the task has a retry policy.
+	Attempts []TaskAttempt
+	// Hosts holds the outcome on each host when the task ran on hosts.
+	Hosts []HostResult
+}
+
+// TaskAttempt is the outcome of a single attempt of a task that is retried.
+type TaskAttempt struct {
+	Attempt   int
+	Status    int
+	ExitCode  int
+	Err       error
+	StartedAt time.Time
+	EndedAt   time.Time
+}
+
+// HostResult is the outcome of a task on a single host.
+type HostResult struct {
+	Host      string
+	Status    int
+	ExitCode  int
+	Err       error
+	Message   string
+	StartedAt time.Time
+	EndedAt   time.Time
 }
 
 func (tr *TaskResult) Start() *TaskResult {
@@ -33,6 +64,9 @@ func (tr *TaskResult) Ok() *TaskResult {
 }
 
 func (tr *TaskResult) Fail(err error) *TaskResult {
+	if code, ok := exitCode(err); ok {
+		tr.ExitCode = code
+	}
 	tr.Err = errors.WithCause(err, tr.Err)
 	tr.Status = statuses.Error
 	tr.End()
@@ -61,5 +95,6 @@ func NewTaskResult() *TaskResult {
 		EndedAt:   time.Now().UTC(),
 		Message:   "",
 		Output:    make(map[string]interface{}),
+		Steps:     []TaskResult{},
 	}
 }
@@ -0,0 +1,369 @@
+package validate
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v4"
+)
+
+// jsonSchema validates yaml nodes against the subset of json schema used
+// by the schemas of run: $ref to the same document, type, enum, pattern,
+// minimum, maximum, required, properties, patternProperties,
+// additionalProperties, items, anyOf and oneOf. Scalars are compared the
+// way the yaml decoders of run read them, so a quoted number is an
+// integer and any scalar is a string.
+type jsonSchema struct {
+	root     map[string]interface{}
+	patterns map[string]*regexp.Regexp
+}
+
+func newJSONSchema(data []byte) (*jsonSchema, error) {
+	root := map[string]interface{}{}
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+
+	return &jsonSchema{root: root, patterns: map[string]*regexp.Regexp{}}, nil
+}
+
+// Validate checks node against the schema at ref, a json pointer such as
+// #/definitions/host, or the whole schema when ref is empty.
+func (s *jsonSchema) Validate(node *yaml.Node, ref string) []Problem {
+	schema := interface{}(s.root)
+	if ref != "" {
+		schema = s.resolve(ref)
+	}
+
+	return s.validate(schema, node)
+}
+
+func (s *jsonSchema) resolve(ref string) interface{} {
+	var current interface{} = s.root
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		current = m[part]
+	}
+
+	return current
+}
+
+func (s *jsonSchema) validate(schema interface{}, node *yaml.Node) []Problem {
+	node = resolveNode(node)
+	m, ok := schema.(map[string]interface{})
+	if !ok || node == nil {
+		return nil
+	}
+
+	problems := []Problem{}
+	if ref, ok := m["$ref"].(string); ok {
+		problems = append(problems, s.validate(s.resolve(ref), node)...)
+	}
+
+	if t, ok := m["type"]; ok && !matchesType(t, node) {
+		return append(problems, nodeProblem(node, "expected "+typeNames(t)+", found "+kindName(node)))
+	}
+
+	if values, ok := m["enum"].([]interface{}); ok && node.Kind == yaml.ScalarNode {
+		found := false
+		names := []string{}
+		for _, v := range values {
+			name := scalarString(v)
+			names = append(names, name)
+			if name == node.Value {
+				found = true
+			}
+		}
+
+		if !found {
+			problems = append(problems, nodeProblem(node, "expected one of "+strings.Join(names, ", ")+", found '"+node.Value+"'"))
+		}
+	}
+
+	if pattern, ok := m["pattern"].(string); ok && node.Kind == yaml.ScalarNode {
+		if re := s.regexp(pattern); re != nil && !re.MatchString(node.Value) {
+			problems = append(problems, nodeProblem(node, "'"+node.Value+"' does not match the pattern "+pattern))
+		}
+	}
+
+	if node.Kind == yaml.ScalarNode {
+		if n, err := strconv.ParseFloat(node.Value, 64); err == nil {
+			if min, ok := m["minimum"].(float64); ok && n < min {
+				problems = append(problems, nodeProblem(node, "expected a value of at least "+scalarString(min)))
+			}
+
+			if max, ok := m["maximum"].(float64); ok && n > max {
+				problems = append(problems, nodeProblem(node, "expected a value of at most "+scalarString(max)))
+			}
+		}
+	}
+
+	if node.Kind == yaml.MappingNode {
+		problems = append(problems, s.validateMapping(m, node)...)
+	}
+
+	if items, ok := m["items"]; ok && node.Kind == yaml.SequenceNode {
+		for _, item := range node.Content {
+			problems = append(problems, s.validate(items, item)...)
+		}
+	}
+
+	if options, ok := m["anyOf"].([]interface{}); ok {
+		problems = append(problems, s.validateAnyOf(options, node)...)
+	}
+
+	if options, ok := m["oneOf"].([]interface{}); ok {
+		problems = append(problems, s.validateOneOf(options, node)...)
+	}
+
+	return problems
+}
+
+func (s *jsonSchema) validateMapping(m map[string]interface{}, node *yaml.Node) []Problem {
+	problems := []Problem{}
+	properties, _ := m["properties"].(map[string]interface{})
+	patternProperties, _ := m["patternProperties"].(map[string]interface{})
+
+	keys := map[string]bool{}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode := node.Content[i]
+		valueNode := node.Content[i+1]
+		key := keyNode.Value
+		keys[key] = true
+
+		if property, ok := properties[key]; ok {
+			problems = append(problems, s.validate(property, valueNode)...)
+			continue
+		}
+
+		matched := false
+		for pattern, property := range patternProperties {
+			if re := s.regexp(pattern); re != nil && re.MatchString(key) {
+				matched = true
+				problems = append(problems, s.validate(property, valueNode)...)
+			}
+		}
+
+		if matched {
+			continue
+		}
+
+		switch additional := m["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				problems = append(problems, nodeProblem(keyNode, "unknown field '"+key+"'"))
+			}
+		case map[string]interface{}:
+			problems = append(problems, s.validate(additional, valueNode)...)
+		}
+	}
+
+	if required, ok := m["required"].([]interface{}); ok {
+		for _, r := range required {
+			if name, ok := r.(string); ok && !keys[name] {
+				problems = append(problems, nodeProblem(node, "missing required field '"+name+"'"))
+			}
+		}
+	}
+
+	return problems
+}
+
+// validateAnyOf passes when one of the options matches. Otherwise the
+// problems of the option that matched the type of the node and went the
+// furthest are reported, which are more useful than a generic message.
+func (s *jsonSchema) validateAnyOf(options []interface{}, node *yaml.Node) []Problem {
+	var best []Problem
+	bestTyped := false
+	for _, option := range options {
+		problems := s.validate(option, node)
+		if len(problems) == 0 {
+			return nil
+		}
+
+		typed := true
+		if m, ok := option.(map[string]interface{}); ok {
+			if t, ok := m["type"]; ok {
+				typed = matchesType(t, node)
+			}
+		}
+
+		if best == nil || (typed && !bestTyped) || (typed == bestTyped && len(problems) < len(best)) {
+			best = problems
+			bestTyped = typed
+		}
+	}
+
+	if !bestTyped {
+		return []Problem{nodeProblem(node, "unexpected "+kindName(node))}
+	}
+
+	return best
+}
+
+// validateOneOf passes when exactly one of the options matches. When none
+// does, the problems are those of validateAnyOf.
+func (s *jsonSchema) validateOneOf(options []interface{}, node *yaml.Node) []Problem {
+	matches := 0
+	for _, option := range options {
+		if len(s.validate(option, node)) == 0 {
+			matches++
+		}
+	}
+
+	switch matches {
+	case 0:
+		return s.validateAnyOf(options, node)
+	case 1:
+		return nil
+	}
+
+	return []Problem{nodeProblem(node, "expected exactly one of the alternatives to match, found "+strconv.Itoa(matches))}
+}
+
+func (s *jsonSchema) regexp(pattern string) *regexp.Regexp {
+	if re, ok := s.patterns[pattern]; ok {
+		return re
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		re = nil
+	}
+	s.patterns[pattern] = re
+	return re
+}
+
+func resolveNode(node *yaml.Node) *yaml.Node {
+	for node != nil {
+		switch node.Kind {
+		case yaml.DocumentNode:
+			if len(node.Content) == 0 {
+				return nil
+			}
+			node = node.Content[0]
+		case yaml.AliasNode:
+			node = node.Alias
+		default:
+			return node
+		}
+	}
+
+	return nil
+}
+
+func matchesType(t interface{}, node *yaml.Node) bool {
+	switch t := t.(type) {
+	case string:
+		return matchesTypeName(t, node)
+	case []interface{}:
+		for _, name := range t {
+			if n, ok := name.(string); ok && matchesTypeName(n, node) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+func matchesTypeName(name string, node *yaml.Node) bool {
+	isNull := node.Kind == yaml.ScalarNode && node.Tag == "!!null"
+	switch name {
+	case "object":
+		return node.Kind == yaml.MappingNode
+	case "array":
+		return node.Kind == yaml.SequenceNode
+	case "null":
+		return isNull
+	case "string":
+		return node.Kind == yaml.ScalarNode && !isNull
+	case "integer":
+		_, err := strconv.ParseInt(node.Value, 10, 64)
+		return node.Kind == yaml.ScalarNode && err == nil
+	case "number":
+		_, err := strconv.ParseFloat(node.Value, 64)
+		return node.Kind == yaml.ScalarNode && err == nil
+	case "boolean":
+		_, err := strconv.ParseBool(node.Value)
+		return node.Kind == yaml.ScalarNode && err == nil
+	}
+
+	return true
+}
+
+func typeNames(t interface{}) string {
+	names := []string{}
+	switch t := t.(type) {
+	case string:
+		names = append(names, t)
+	case []interface{}:
+		for _, name := range t {
+			if n, ok := name.(string); ok {
+				names = append(names, n)
+			}
+		}
+	}
+
+	sort.Strings(names)
+	for i, name := range names {
+		names[i] = articleFor(name) + name
+	}
+
+	if len(names) > 1 {
+		return strings.Join(names[:len(names)-1], ", ") + " or " + names[len(names)-1]
+	}
+
+	return strings.Join(names, "")
+}
+
+func articleFor(name string) string {
+	switch name {
+	case "object", "array", "integer":
+		return "an "
+	case "null":
+		return ""
+	}
+
+	return "a "
+}
+
+func kindName(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "a mapping"
+	case yaml.SequenceNode:
+		return "a sequence"
+	}
+
+	if node.Tag == "!!null" {
+		return "null"
+	}
+
+	return "'" + node.Value + "'"
+}
+
+func scalarString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case nil:
+		return "null"
+	}
+
+	data, _ := json.Marshal(v)
+	return string(data)
+}
@@ -0,0 +1,129 @@
+package validate
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.yaml.in/yaml/v4"
+)
+
+const testSchema = `{
+	"definitions": {
+		"port": {"type": "integer", "minimum": 1, "maximum": 65535}
+	},
+	"properties": {
+		"ref": {"$ref": "#/definitions/port"},
+		"object": {"type": "object"},
+		"array": {"type": "array"},
+		"string": {"type": "string"},
+		"integer": {"type": "integer"},
+		"number": {"type": "number"},
+		"boolean": {"type": "boolean"},
+		"null": {"type": "null"},
+		"types": {"type": ["integer", "boolean"]},
+		"enum": {"enum": ["linux", "darwin", 386]},
+		"pattern": {"type": "string", "pattern": "^v[0-9]+$"},
+		"required": {"type": "object", "required": ["id", "name"]},
+		"closed": {
+			"type": "object",
+			"properties": {"id": {"type": "string"}},
+			"patternProperties": {"^x-": {"type": "integer"}},
+			"additionalProperties": false
+		},
+		"open": {"type": "object", "additionalProperties": {"type": "boolean"}},
+		"items": {"type": "array", "items": {"type": "integer"}},
+		"anyOf": {"anyOf": [{"type": "integer"}, {"type": "array", "items": {"type": "integer"}}]},
+		"anyOfObject": {"anyOf": [{"type": "string"}, {"type": "object", "required": ["id"]}]},
+		"oneOf": {"oneOf": [{"type": "string", "enum": ["a", "b"]}, {"type": "string", "pattern": "^b"}]},
+		"oneOfType": {"oneOf": [{"type": "string"}, {"type": "array"}]}
+	},
+	"additionalProperties": false
+}`
+
+func TestJSONSchemaValidate(t *testing.T) {
+	s, err := newJSONSchema([]byte(testSchema))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name string
+		doc  string
+		want []string
+	}{
+		{name: "ref", doc: "ref: 22", want: []string{}},
+		{name: "ref type", doc: "ref: http", want: []string{"1:6 expected an integer, found 'http'"}},
+		{name: "ref minimum", doc: "ref: 0", want: []string{"1:6 expected a value of at least 1"}},
+		{name: "ref maximum", doc: "ref: 65536", want: []string{"1:6 expected a value of at most 65535"}},
+		{name: "object", doc: "object: {a: 1}", want: []string{}},
+		{name: "object type", doc: "object: [a]", want: []string{"1:9 expected an object, found a sequence"}},
+		{name: "array", doc: "array: [a]", want: []string{}},
+		{name: "array type", doc: "array: a", want: []string{"1:8 expected an array, found 'a'"}},
+		{name: "string", doc: "string: '1'", want: []string{}},
+		{name: "string any scalar", doc: "string: 1", want: []string{}},
+		{name: "string type", doc: "string: {}", want: []string{"1:9 expected a string, found a mapping"}},
+		{name: "string null", doc: "string: ~", want: []string{"1:9 expected a string, found null"}},
+		{name: "integer quoted", doc: "integer: '7'", want: []string{}},
+		{name: "integer type", doc: "integer: 1.5", want: []string{"1:10 expected an integer, found '1.5'"}},
+		{name: "number", doc: "number: 1.5", want: []string{}},
+		{name: "number type", doc: "number: one", want: []string{"1:9 expected a number, found 'one'"}},
+		{name: "boolean", doc: "boolean: true", want: []string{}},
+		{name: "boolean type", doc: "boolean: yes", want: []string{"1:10 expected a boolean, found 'yes'"}},
+		{name: "null", doc: "null: ~", want: []string{}},
+		{name: "null type", doc: "null: a", want: []string{"1:7 expected null, found 'a'"}},
+		{name: "types", doc: "types: false", want: []string{}},
+		{name: "types none", doc: "types: a", want: []string{"1:8 expected a boolean or an integer, found 'a'"}},
+		{name: "enum", doc: "enum: darwin", want: []string{}},
+		{name: "enum number", doc: "enum: 386", want: []string{}},
+		{name: "enum none", doc: "enum: windows", want: []string{"1:7 expected one of linux, darwin, 386, found 'windows'"}},
+		{name: "pattern", doc: "pattern: v2", want: []string{}},
+		{name: "pattern none", doc: "pattern: 2", want: []string{"1:10 '2' does not match the pattern ^v[0-9]+$"}},
+		{name: "required", doc: "required: {id: a, name: b}", want: []string{}},
+		{name: "required missing", doc: "required: {id: a}", want: []string{"1:11 missing required field 'name'"}},
+		{name: "properties", doc: "closed: {id: a}", want: []string{}},
+		{name: "properties type", doc: "closed: {id: {}}", want: []string{"1:14 expected a string, found a mapping"}},
+		{name: "pattern properties", doc: "closed: {x-port: 1}", want: []string{}},
+		{name: "pattern properties type", doc: "closed: {x-port: a}", want: []string{"1:18 expected an integer, found 'a'"}},
+		{name: "additional properties false", doc: "closed: {other: 1}", want: []string{"1:10 unknown field 'other'"}},
+		{name: "additional properties schema", doc: "open: {a: true, b: x}", want: []string{"1:20 expected a boolean, found 'x'"}},
+		{name: "unknown top level field", doc: "taks: {}", want: []string{"1:1 unknown field 'taks'"}},
+		{name: "items", doc: "items: [1, 2]", want: []string{}},
+		{name: "items type", doc: "items: [1, a]", want: []string{"1:12 expected an integer, found 'a'"}},
+		{name: "anyOf first", doc: "anyOf: 1", want: []string{}},
+		{name: "anyOf second", doc: "anyOf: [1, 2]", want: []string{}},
+		{name: "anyOf typed problems", doc: "anyOf: [1, a]", want: []string{"1:12 expected an integer, found 'a'"}},
+		{name: "anyOf no type", doc: "anyOf: {}", want: []string{"1:8 unexpected a mapping"}},
+		{name: "anyOf object", doc: "anyOfObject: {name: a}", want: []string{"1:14 missing required field 'id'"}},
+		{name: "oneOf one", doc: "oneOf: a", want: []string{}},
+		{name: "oneOf other", doc: "oneOf: bc", want: []string{}},
+		{name: "oneOf many", doc: "oneOf: b", want: []string{"1:8 expected exactly one of the alternatives to match, found 2"}},
+		{name: "oneOf none", doc: "oneOf: c", want: []string{"1:8 expected one of a, b, found 'c'"}},
+		{name: "oneOf type", doc: "oneOfType: [a]", want: []string{}},
+		{name: "oneOf no type", doc: "oneOfType: {}", want: []string{"1:12 unexpected a mapping"}},
+		{name: "alias", doc: "a: &a 1\nref: *a", want: []string{"1:1 unknown field 'a'"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := &yaml.Node{}
+			assert.NoError(t, yaml.Unmarshal([]byte(tt.doc), doc))
+
+			got := []string{}
+			for _, p := range s.Validate(doc, "") {
+				got = append(got, strconv.Itoa(p.Line)+":"+strconv.Itoa(p.Column)+" "+p.Message)
+			}
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestJSONSchemaValidateRef(t *testing.T) {
+	s, err := newJSONSchema([]byte(testSchema))
+	assert.NoError(t, err)
+
+	doc := &yaml.Node{}
+	assert.NoError(t, yaml.Unmarshal([]byte("0"), doc))
+	problems := s.Validate(doc, "#/definitions/port")
+	assert.Len(t, problems, 1)
+	assert.Equal(t, "expected a value of at least 1", problems[0].Message)
+}
@@ -0,0 +1,664 @@
+// Package validate checks runfiles, and the task definition and hosts
+// files they import, against the json schema of run and for mistakes the
+// schema cannot catch, such as needs of tasks that do not exist.
+package validate
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	jsonschemas "github.com/frostyeti/mvps/go/run/json-schemas"
+	"github.com/frostyeti/mvps/go/run/schema"
+	"github.com/frostyeti/mvps/go/run/tasks"
+	"go.yaml.in/yaml/v4"
+)
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Problem is an error or warning found in a file, at the line and column
+// of the yaml node it is about.
+type Problem struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+func (p Problem) String() string {
+	return p.File + ":" + strconv.Itoa(p.Line) + ":" + strconv.Itoa(p.Column) + ": " + p.Severity + ": " + p.Message
+}
+
+// HasErrors reports whether any of the problems is an error.
+func HasErrors(problems []Problem) bool {
+	for _, p := range problems {
+		if p.Severity == SeverityError {
+			return true
+		}
+	}
+
+	return false
+}
+
+var (
+	positionPattern = regexp.MustCompile(` on line (\d+), at column (\d+)`)
+	linePattern     = regexp.MustCompile(`line (\d+)`)
+)
+
+// validator collects the problems of a runfile and the files it imports.
+type validator struct {
+	schema *jsonSchema
+
+	// problems holds the problems of the semantic checks, which are more
+	// specific than the problems the schema and the decoders report for the
+	// same node.
+	problems       []Problem
+	schemaProblems []Problem
+	decodeProblems []Problem
+
+	tasks map[string]bool
+	// dynamic holds the ids of the imported task definitions.
+	dynamic map[string]bool
+	// hosts holds the key node of every host, by name.
+	hosts      map[string]hostRef
+	groups     map[string]bool
+	referenced map[string]bool
+
+	// uncheckedImports and uncheckedHosts are set when an import could not
+	// be read, such as a remote one, so that uses or hosts it may define
+	// are not reported as unknown.
+	uncheckedImports bool
+	uncheckedHosts   bool
+	// uncheckedIncludes holds the namespaces of includes that could not be
+	// read, needs of their tasks are not reported as unknown.
+	uncheckedIncludes map[string]bool
+}
+
+type hostRef struct {
+	file   string
+	node   *yaml.Node
+	groups []string
+}
+
+// File validates the runfile at path and the local task definition and
+// hosts files it imports. The problems are sorted by file and position.
+func File(path string) ([]Problem, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := newJSONSchema(jsonschemas.Runfile)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &validator{
+		schema:     s,
+		tasks:      map[string]bool{},
+		dynamic:    map[string]bool{},
+		hosts:      map[string]hostRef{},
+		groups:     map[string]bool{},
+		referenced: map[string]bool{},
+
+		uncheckedIncludes: map[string]bool{},
+	}
+
+	root, ok := v.parse(path, data, "")
+	if ok {
+		rf := schema.NewRunfile()
+		if err := root.Decode(rf); err != nil {
+			v.addDecodeError(path, err)
+		}
+
+		v.checkRunfile(path, root)
+	}
+
+	return v.sorted(), nil
+}
+
+// parse reads the yaml of a file and checks it against the schema at ref.
+func (v *validator) parse(file string, data []byte, ref string) (*yaml.Node, bool) {
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal(data, doc); err != nil {
+		line := 1
+		if m := linePattern.FindStringSubmatch(err.Error()); m != nil {
+			line, _ = strconv.Atoi(m[1])
+		}
+
+		v.decodeProblems = append(v.decodeProblems, Problem{File: file, Line: line, Column: 1, Severity: SeverityError, Message: err.Error()})
+		return nil, false
+	}
+
+	root := resolveNode(doc)
+	if root == nil {
+		return nil, false
+	}
+
+	for _, p := range v.schema.Validate(root, ref) {
+		p.File = file
+		v.schemaProblems = append(v.schemaProblems, p)
+	}
+
+	return root, true
+}
+
+// addDecodeError adds an error of the yaml decoders of run, which point to
+// the node with "on line N, at column M". Errors that wrap other errors
+// hold the innermost position first, after the innermost message.
+func (v *validator) addDecodeError(file string, err error) {
+	msg := err.Error()
+	p := Problem{File: file, Line: 1, Column: 1, Severity: SeverityError}
+	if loc := positionPattern.FindStringSubmatchIndex(msg); loc != nil {
+		p.Line, _ = strconv.Atoi(msg[loc[2]:loc[3]])
+		p.Column, _ = strconv.Atoi(msg[loc[4]:loc[5]])
+		msg = msg[:loc[0]]
+	}
+
+	lines := strings.Split(strings.TrimSpace(msg), "\n")
+	p.Message = strings.TrimSpace(lines[len(lines)-1])
+	if m := linePattern.FindStringIndex(p.Message); m != nil && m[0] == 0 && strings.HasPrefix(p.Message[m[1]:], ": ") {
+		p.Message = p.Message[m[1]+2:]
+	}
+
+	v.decodeProblems = append(v.decodeProblems, p)
+}
+
+func (v *validator) add(file string, node *yaml.Node, severity string, message string) {
+	p := nodeProblem(node, message)
+	p.File = file
+	p.Severity = severity
+	v.problems = append(v.problems, p)
+}
+
+func (v *validator) checkRunfile(file string, root *yaml.Node) {
+	if root.Kind != yaml.MappingNode {
+		return
+	}
+
+	dir := filepath.Dir(file)
+	fields := map[string]*yaml.Node{}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key := root.Content[i].Value
+		switch key {
+		case "imports":
+			key = "import"
+		case "host-imports", "hostimports":
+			key = "hosts"
+		case "includes":
+			key = "include"
+		}
+		fields[key] = resolveNode(root.Content[i+1])
+	}
+
+	v.collectIncludes(file, fields["include"], "", map[string]bool{file: true})
+
+	if imports := mappingValue(fields["import"], "tasks"); imports != nil && imports.Kind == yaml.SequenceNode {
+		for _, item := range imports.Content {
+			item = resolveNode(item)
+			path := item
+			if item.Kind == yaml.MappingNode {
+				path = mappingValue(item, "path")
+			}
+
+			if path != nil && path.Kind == yaml.ScalarNode {
+				v.checkTaskImport(file, dir, path)
+			}
+		}
+	}
+
+	if hosts := fields["hosts"]; hosts != nil {
+		v.collectHosts(file, dir, hosts)
+	}
+
+	// the hosts of a context are known to the tasks as well
+	if contexts := fields["contexts"]; contexts != nil && contexts.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(contexts.Content); i += 2 {
+			if hosts := mappingValue(contexts.Content[i+1], "hosts"); hosts != nil {
+				v.collectHosts(file, dir, hosts)
+			}
+		}
+	}
+
+	config := fields["config"]
+	shell := ""
+	if s := mappingValue(config, "shell"); s != nil {
+		shell = s.Value
+	}
+	v.checkDuration(file, mappingValue(config, "timeout"), "timeout", false)
+
+	taskNodes := fields["tasks"]
+	if taskNodes != nil && taskNodes.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(taskNodes.Content); i += 2 {
+			v.tasks[taskNodes.Content[i].Value] = true
+		}
+
+		for i := 0; i+1 < len(taskNodes.Content); i += 2 {
+			v.checkTask(file, taskNodes.Content[i].Value, resolveNode(taskNodes.Content[i+1]), shell)
+		}
+	}
+
+	names := []string{}
+	for name := range v.hosts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		host := v.hosts[name]
+		if v.referenced[name] {
+			continue
+		}
+
+		used := false
+		for _, group := range host.groups {
+			if v.referenced[group] {
+				used = true
+				break
+			}
+		}
+
+		if !used {
+			v.add(host.file, host.node, SeverityWarning, "host '"+name+"' is not used by any task")
+		}
+	}
+}
+
+// collectIncludes adds the tasks of the included runfiles, prefixed with
+// their namespace, so that needs of the tasks of the runfile can point to
+// them. The included runfiles are checked against the schema as well.
+func (v *validator) collectIncludes(file string, node *yaml.Node, prefix string, seen map[string]bool) {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return
+	}
+
+	dir := filepath.Dir(file)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		namespace := prefix + node.Content[i].Value
+		pathNode := resolveNode(node.Content[i+1])
+		if pathNode.Kind == yaml.MappingNode {
+			pathNode = mappingValue(pathNode, "path")
+		}
+
+		if pathNode == nil || pathNode.Kind != yaml.ScalarNode {
+			continue
+		}
+
+		path := strings.TrimSpace(pathNode.Value)
+		if strings.ContainsRune(path, '$') {
+			v.uncheckedIncludes[namespace] = true
+			continue
+		}
+
+		optional := strings.HasSuffix(path, "?")
+		path = strings.TrimSuffix(path, "?")
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			path = filepath.Join(path, "runfile")
+		}
+
+		if seen[path] {
+			v.add(file, pathNode, SeverityError, "runfile includes itself: "+path)
+			continue
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if !optional {
+				v.add(file, pathNode, SeverityError, "failed to read include: "+err.Error())
+				v.uncheckedIncludes[namespace] = true
+			}
+			continue
+		}
+
+		root, ok := v.parse(path, data, "")
+		if !ok {
+			v.uncheckedIncludes[namespace] = true
+			continue
+		}
+
+		rf := schema.NewRunfile()
+		if err := root.Decode(rf); err != nil {
+			v.addDecodeError(path, err)
+		}
+
+		if tasks := mappingValue(root, "tasks"); tasks != nil && tasks.Kind == yaml.MappingNode {
+			for j := 0; j+1 < len(tasks.Content); j += 2 {
+				v.tasks[namespace+":"+tasks.Content[j].Value] = true
+			}
+		}
+
+		next := map[string]bool{path: true}
+		for k := range seen {
+			next[k] = true
+		}
+
+		includes := mappingValue(root, "include")
+		if includes == nil {
+			includes = mappingValue(root, "includes")
+		}
+		v.collectIncludes(path, includes, namespace+":", next)
+	}
+}
+
+func (v *validator) checkTaskImport(file string, dir string, pathNode *yaml.Node) {
+	path := strings.TrimSpace(pathNode.Value)
+	if strings.Contains(path, "://") || strings.HasPrefix(path, "git+") || strings.ContainsRune(path, '$') {
+		v.uncheckedImports = true
+		return
+	}
+
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = filepath.Join(path, "tasks.yaml")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		v.add(file, pathNode, SeverityError, "failed to read task import: "+err.Error())
+		v.uncheckedImports = true
+		return
+	}
+
+	root, ok := v.parse(path, data, "#/definitions/taskdefs")
+	if !ok {
+		v.uncheckedImports = true
+		return
+	}
+
+	defs := &schema.TaskDefs{}
+	if err := root.Decode(defs); err != nil {
+		v.addDecodeError(path, err)
+	}
+
+	defsNode := mappingValue(root, "tasks")
+	if defsNode == nil || defsNode.Kind != yaml.SequenceNode {
+		return
+	}
+
+	for _, def := range defsNode.Content {
+		if id := mappingValue(resolveNode(def), "id"); id != nil {
+			v.dynamic[id.Value] = true
+		}
+	}
+}
+
+// collectHosts records the hosts of the hosts field of the runfile, a
+// mapping of hosts or a sequence of hosts and hosts files to import.
+func (v *validator) collectHosts(file string, dir string, node *yaml.Node) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			v.addHost(file, node.Content[i], resolveNode(node.Content[i+1]))
+		}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			item = resolveNode(item)
+			switch item.Kind {
+			case yaml.ScalarNode:
+				v.checkHostsImport(file, dir, item)
+			case yaml.MappingNode:
+				if host := mappingValue(item, "host"); host != nil {
+					v.addHost(file, host, item)
+				}
+			}
+		}
+	}
+}
+
+func (v *validator) addHost(file string, keyNode *yaml.Node, entry *yaml.Node) {
+	ref := hostRef{file: file, node: keyNode}
+	if groups := mappingValue(entry, "groups"); groups != nil && groups.Kind == yaml.SequenceNode {
+		for _, group := range groups.Content {
+			ref.groups = append(ref.groups, group.Value)
+			v.groups[group.Value] = true
+		}
+	}
+
+	v.checkDuration(file, mappingValue(entry, "keepalive"), "keepalive", true)
+	v.checkDuration(file, mappingValue(entry, "keep-alive"), "keepalive", true)
+
+	// jump hosts are used by the hosts that connect through them
+	jump := mappingValue(entry, "jump")
+	if jump == nil {
+		jump = mappingValue(entry, "proxy-jump")
+	}
+	if jump != nil {
+		hops := []string{}
+		if jump.Kind == yaml.ScalarNode {
+			hops = strings.Split(jump.Value, ",")
+		}
+		for _, hop := range jump.Content {
+			hops = append(hops, hop.Value)
+		}
+		for _, hop := range hops {
+			v.referenced[strings.TrimSpace(hop)] = true
+		}
+	}
+
+	v.hosts[keyNode.Value] = ref
+}
+
+func (v *validator) checkHostsImport(file string, dir string, pathNode *yaml.Node) {
+	path := strings.TrimSpace(pathNode.Value)
+	if strings.ContainsRune(path, '$') {
+		v.uncheckedHosts = true
+		return
+	}
+
+	optional := strings.HasSuffix(path, "?")
+	path = strings.TrimSuffix(path, "?")
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !optional {
+			v.add(file, pathNode, SeverityError, "failed to read hosts import: "+err.Error())
+			v.uncheckedHosts = true
+		}
+		return
+	}
+
+	root, ok := v.parse(path, data, "#/definitions/hostsfile")
+	if !ok {
+		v.uncheckedHosts = true
+		return
+	}
+
+	hostsfile := &schema.RunHostsfile{Defaults: map[string]schema.XHostfileDefaults{}}
+	if err := hostsfile.Decode(data); err != nil {
+		v.addDecodeError(path, err)
+	}
+
+	hosts := mappingValue(root, "host")
+	if hosts == nil || hosts.Kind != yaml.MappingNode {
+		return
+	}
+
+	for i := 0; i+1 < len(hosts.Content); i += 2 {
+		v.addHost(path, hosts.Content[i], resolveNode(hosts.Content[i+1]))
+	}
+}
+
+func (v *validator) checkTask(file string, id string, task *yaml.Node, shell string) {
+	if task == nil || task.Kind != yaml.MappingNode {
+		return
+	}
+
+	uses := shell
+	for i := 0; i+1 < len(task.Content); i += 2 {
+		keyNode := task.Content[i]
+		valueNode := resolveNode(task.Content[i+1])
+		switch keyNode.Value {
+		case "uses":
+			uses = valueNode.Value
+			if uses == "" {
+				uses = shell
+			}
+		case "needs", "deps", "dependencies":
+			for _, need := range valueNode.Content {
+				if !v.hasTask(need.Value) {
+					v.add(file, need, SeverityError, "task '"+id+"' needs unknown task '"+need.Value+"'")
+				}
+			}
+		case "hooks":
+			for _, hook := range []string{"before", "after"} {
+				suffixes := mappingValue(valueNode, hook)
+				if suffixes == nil {
+					continue
+				}
+
+				items := suffixes.Content
+				if suffixes.Kind == yaml.ScalarNode {
+					items = []*yaml.Node{suffixes}
+				}
+
+				for _, suffix := range items {
+					name := id + ":" + suffix.Value
+					if !v.tasks[name] {
+						v.add(file, suffix, SeverityWarning, hook+" hook of task '"+id+"' points to missing task '"+name+"'")
+					}
+				}
+			}
+		case "hosts":
+			for _, host := range valueNode.Content {
+				v.referenced[host.Value] = true
+				if _, ok := v.hosts[host.Value]; !ok && !v.groups[host.Value] && !v.uncheckedHosts {
+					v.add(file, host, SeverityError, "task '"+id+"' uses unknown host or group '"+host.Value+"'")
+				}
+			}
+		case "timeout":
+			v.checkDuration(file, valueNode, "timeout", true)
+		case "retry":
+			v.checkDuration(file, mappingValue(valueNode, "delay"), "delay", false)
+		case "service":
+			for _, key := range []string{"ready", "probe"} {
+				probe := mappingValue(valueNode, key)
+				v.checkDuration(file, mappingValue(probe, "timeout"), "timeout", false)
+				v.checkDuration(file, mappingValue(probe, "interval"), "interval", false)
+			}
+		}
+	}
+
+	if uses == "" || v.uncheckedImports || strings.ContainsAny(uses, "{$") {
+		return
+	}
+
+	name, ok := tasks.HandlerName(uses)
+	if !ok && !v.dynamic[uses] && !v.dynamic[name] {
+		node := mappingValue(task, "uses")
+		if node == nil {
+			node = task
+		}
+		v.add(file, node, SeverityError, "task '"+id+"' uses unknown handler '"+uses+"'")
+	}
+}
+
+// hasTask reports whether a need resolves to a task, either the task
+// itself or a context specific task:context.
+func (v *validator) hasTask(name string) bool {
+	if v.tasks[name] {
+		return true
+	}
+
+	for task := range v.tasks {
+		if strings.HasPrefix(task, name+":") {
+			return true
+		}
+	}
+
+	for namespace := range v.uncheckedIncludes {
+		if strings.HasPrefix(name, namespace+":") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkDuration reports values that do not parse as a duration, or as a
+// number of seconds for the fields that accept one.
+func (v *validator) checkDuration(file string, node *yaml.Node, field string, seconds bool) {
+	if node == nil || node.Kind != yaml.ScalarNode || node.Value == "" {
+		return
+	}
+
+	if d, err := time.ParseDuration(node.Value); err == nil && d >= 0 {
+		return
+	}
+
+	expected := "a duration such as 30s or 1h30m"
+	if seconds {
+		if _, err := strconv.Atoi(node.Value); err == nil {
+			return
+		}
+		expected += ", or a number of seconds"
+	}
+
+	v.add(file, node, SeverityError, "invalid duration '"+node.Value+"' for '"+field+"', expected "+expected)
+}
+
+// sorted returns the problems ordered by file and position, without the
+// repeated problems the semantic checks, the schema and the decoders found
+// on the same node.
+func (v *validator) sorted() []Problem {
+	seen := map[string]bool{}
+	problems := []Problem{}
+	all := append(append(append([]Problem{}, v.problems...), v.schemaProblems...), v.decodeProblems...)
+	for _, p := range all {
+		key := p.File + ":" + strconv.Itoa(p.Line) + ":" + strconv.Itoa(p.Column)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		problems = append(problems, p)
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		a, b := problems[i], problems[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+
+	return problems
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	node = resolveNode(node)
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return resolveNode(node.Content[i+1])
+		}
+	}
+
+	return nil
+}
+
+func nodeProblem(node *yaml.Node, message string) Problem {
+	return Problem{Line: node.Line, Column: node.Column, Severity: SeverityError, Message: message}
+}
@@ -0,0 +1,439 @@
+package validate
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// validateFiles writes the files to a temporary directory and validates
+// its runfile. The problems are returned as file:line:col: severity:
+// message with the file relative to the directory.
+func validateFiles(t *testing.T, files map[string]string) []string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	problems, err := File(filepath.Join(dir, "runfile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{}
+	for _, p := range problems {
+		rel, _ := filepath.Rel(dir, p.File)
+		got = append(got, filepath.ToSlash(rel)+":"+strconv.Itoa(p.Line)+":"+strconv.Itoa(p.Column)+": "+p.Severity+": "+p.Message)
+	}
+
+	return got
+}
+
+func TestFile(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []string
+	}{
+		{
+			name: "valid",
+			files: map[string]string{"runfile": `
+tasks:
+  build:
+    run: go build
+  test:
+    needs: [build]
+    run: go test
+`},
+			want: []string{},
+		},
+		{
+			name:  "yaml syntax",
+			files: map[string]string{"runfile": "tasks:\n  build: [\n"},
+			want:  []string{"runfile:2:1: error: yaml: line 2: did not find expected node content"},
+		},
+		{
+			name: "schema unknown field",
+			files: map[string]string{"runfile": `
+tasks:
+  build:
+    run: go build
+    sorces: ["*.go"]
+`},
+			want: []string{"runfile:5:5: error: unknown field 'sorces'"},
+		},
+		{
+			name: "decode error",
+			files: map[string]string{"runfile": `
+hosts:
+  web1: 10.0.0.1:ssh
+tasks:
+  deploy:
+    uses: ssh
+    hosts: [web1]
+    run: uptime
+`},
+			want: []string{`runfile:3:3: error: strconv.Atoi: parsing "ssh": invalid syntax`},
+		},
+		{
+			name: "needs unknown task",
+			files: map[string]string{"runfile": `
+tasks:
+  test:
+    needs: [biuld]
+    run: go test
+`},
+			want: []string{"runfile:4:13: error: task 'test' needs unknown task 'biuld'"},
+		},
+		{
+			name: "needs context task",
+			files: map[string]string{"runfile": `
+tasks:
+  db:prod:
+    run: echo db
+  app:
+    needs: [db]
+    run: echo app
+`},
+			want: []string{},
+		},
+		{
+			name: "hook points to missing task",
+			files: map[string]string{"runfile": `
+tasks:
+  test:pre:
+    run: echo pre
+  test:
+    hooks:
+      before: [pre]
+      after: post
+    run: go test
+`},
+			want: []string{"runfile:8:14: warning: after hook of task 'test' points to missing task 'test:post'"},
+		},
+		{
+			name: "unknown host",
+			files: map[string]string{"runfile": `
+hosts:
+  web1:
+    host: 10.0.0.1
+    groups: [web]
+tasks:
+  deploy:
+    uses: ssh
+    hosts: [web, db]
+    run: uptime
+`},
+			want: []string{"runfile:9:18: error: task 'deploy' uses unknown host or group 'db'"},
+		},
+		{
+			name: "unused host",
+			files: map[string]string{"runfile": `
+hosts:
+  web1:
+    host: 10.0.0.1
+  bastion:
+    host: 10.0.0.2
+  db1:
+    host: 10.0.0.3
+    jump: bastion
+tasks:
+  deploy:
+    uses: ssh
+    hosts: [db1]
+    run: uptime
+`},
+			want: []string{"runfile:3:3: warning: host 'web1' is not used by any task"},
+		},
+		{
+			name: "context hosts",
+			files: map[string]string{"runfile": `
+contexts:
+  prod:
+    hosts:
+      web1:
+        host: 10.0.0.1
+tasks:
+  deploy:
+    uses: ssh
+    hosts: [web1]
+    run: uptime
+`},
+			want: []string{},
+		},
+		{
+			name: "hosts import",
+			files: map[string]string{
+				"runfile": `
+hosts:
+  - hosts.yaml
+  - missing.yaml?
+tasks:
+  deploy:
+    uses: ssh
+    hosts: [web1]
+    run: uptime
+`,
+				"hosts.yaml": `
+host:
+  web1:
+    host: 10.0.0.1
+`,
+			},
+			want: []string{},
+		},
+		{
+			name: "hosts import missing",
+			files: map[string]string{"runfile": `
+hosts:
+  - missing.yaml
+tasks:
+  deploy:
+    uses: ssh
+    hosts: [web1]
+    run: uptime
+`},
+			want: []string{"runfile:3:5: error: failed to read hosts import: open {dir}/missing.yaml: no such file or directory"},
+		},
+		{
+			name: "durations",
+			files: map[string]string{"runfile": `
+config:
+  timeout: 30
+tasks:
+  build:
+    timeout: 90
+    run: go build
+  test:
+    timeout: soon
+    retry: {attempts: 2, delay: 1}
+    run: go test
+`},
+			want: []string{
+				"runfile:3:12: error: invalid duration '30' for 'timeout', expected a duration such as 30s or 1h30m",
+				"runfile:9:14: error: invalid duration 'soon' for 'timeout', expected a duration such as 30s or 1h30m, or a number of seconds",
+				"runfile:10:33: error: invalid duration '1' for 'delay', expected a duration such as 30s or 1h30m",
+			},
+		},
+		{
+			name: "service probe durations",
+			files: map[string]string{"runfile": `
+tasks:
+  db:
+    service:
+      ready:
+        tcp: localhost:5432
+        timeout: later
+    run: postgres
+`},
+			want: []string{"runfile:7:18: error: invalid duration 'later' for 'timeout', expected a duration such as 30s or 1h30m"},
+		},
+		{
+			name: "unknown handler",
+			files: map[string]string{"runfile": `
+tasks:
+  build:
+    uses: makefile
+    run: build
+  lint:
+    uses: "{{ .env.SHELL }}"
+    run: lint
+`},
+			want: []string{"runfile:4:11: error: task 'build' uses unknown handler 'makefile'"},
+		},
+		{
+			name: "task import",
+			files: map[string]string{
+				"runfile": `
+import:
+  tasks: [tasks.yaml]
+tasks:
+  greet:
+    uses: hello
+`,
+				"tasks.yaml": `
+tasks:
+  - id: hello
+    steps:
+      - uses: bash
+        run: echo hello
+`,
+			},
+			want: []string{},
+		},
+		{
+			name: "task import missing",
+			files: map[string]string{"runfile": `
+import:
+  tasks: [tasks.yaml]
+tasks:
+  greet:
+    uses: hello
+`},
+			want: []string{"runfile:3:11: error: failed to read task import: open {dir}/tasks.yaml: no such file or directory"},
+		},
+		{
+			name: "remote task import",
+			files: map[string]string{"runfile": `
+import:
+  tasks: [https://example.com/tasks.yaml]
+tasks:
+  greet:
+    uses: hello
+`},
+			want: []string{},
+		},
+		{
+			name: "includes",
+			files: map[string]string{
+				"runfile": `
+include:
+  api: api
+  web: web/runfile?
+tasks:
+  build:
+    needs: [api:build, api:db:migrate]
+    run: echo build
+`,
+				"api/runfile": `
+include:
+  db: ../db
+tasks:
+  build:
+    run: go build
+`,
+				"db/runfile": `
+tasks:
+  migrate:
+    run: migrate up
+`,
+			},
+			want: []string{},
+		},
+		{
+			name: "include missing",
+			files: map[string]string{"runfile": `
+include:
+  api: api/runfile
+tasks:
+  build:
+    needs: [api:build]
+    run: echo build
+`},
+			want: []string{"runfile:3:8: error: failed to read include: open {dir}/api/runfile: no such file or directory"},
+		},
+		{
+			name: "include itself",
+			files: map[string]string{"runfile": `
+include:
+  self: runfile
+tasks:
+  build:
+    run: echo build
+`},
+			want: []string{"runfile:3:9: error: runfile includes itself: {dir}/runfile"},
+		},
+		{
+			name: "include with a variable",
+			files: map[string]string{"runfile": `
+include:
+  api: ${API_DIR}
+tasks:
+  build:
+    needs: [api:build]
+    run: echo build
+`},
+			want: []string{},
+		},
+		{
+			name: "problems of an included runfile",
+			files: map[string]string{
+				"runfile": `
+include:
+  api: api
+`,
+				"api/runfile": `
+tasks:
+  build:
+    needs: [lint]
+    rn: go build
+`,
+			},
+			want: []string{"api/runfile:5:5: error: unknown field 'rn'"},
+		},
+		{
+			name: "one problem per position",
+			files: map[string]string{"runfile": `
+tasks:
+  build:
+    run: go build
+    timeout: soon
+    needs: {}
+`},
+			want: []string{
+				"runfile:5:14: error: invalid duration 'soon' for 'timeout', expected a duration such as 30s or 1h30m, or a number of seconds",
+				"runfile:6:12: error: expected an array, found a mapping",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := validateFiles(t, tt.files)
+			assert.Equal(t, len(tt.want), len(got), "%v", got)
+			for i := range got {
+				if i < len(tt.want) {
+					assert.Regexp(t, "^"+regexpQuoteDir(tt.want[i])+"$", got[i])
+				}
+			}
+		})
+	}
+}
+
+// regexpQuoteDir quotes want for a regular expression, with {dir} matching
+// the temporary directory of the test.
+func regexpQuoteDir(want string) string {
+	parts := strings.Split(want, "{dir}")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+
+	return strings.Join(parts, ".+")
+}
+
+func TestHasErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		problems []Problem
+		want     bool
+	}{
+		{"none", nil, false},
+		{"warnings", []Problem{{Severity: SeverityWarning}}, false},
+		{"errors", []Problem{{Severity: SeverityWarning}, {Severity: SeverityError}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, HasErrors(tt.problems))
+		})
+	}
+}
+
+func TestProblemString(t *testing.T) {
+	p := Problem{File: "runfile", Line: 3, Column: 5, Severity: SeverityError, Message: "unknown field 'rn'"}
+	assert.Equal(t, "runfile:3:5: error: unknown field 'rn'", p.String())
+}
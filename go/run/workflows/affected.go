@@ -0,0 +1,248 @@
+package workflows
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/frostyeti/mvps/go/exec"
+	"github.com/frostyeti/mvps/go/run/schema"
+	"github.com/gobwas/glob"
+)
+
+// findAffected returns the ids of the tasks whose inputs changed since the
+// Since ref, of the tasks that need them, and of the tasks those tasks
+// need, so that an affected task runs with what it depends on.
+func (ws *Workflow) findAffected(flatTasks []schema.Task, contextName string) (map[string]bool, error) {
+	runDir, ok := ws.Env.Get("RUN_DIR")
+	if !ok {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		runDir = cwd
+	}
+
+	changed, err := changedFiles(ws.ctx, runDir, ws.Since)
+	if err != nil {
+		return nil, err
+	}
+
+	return ws.affectedTasks(flatTasks, contextName, runDir, changed)
+}
+
+// affectedTasks returns the ids of the tasks the changed files affect. A
+// task is affected when a changed file matches its sources, is under its
+// cwd or the directory of its included runfile, is in the project the
+// workflow was loaded for by --all, or is in a project of
+// config.dirs.projects that the task belongs to, by its cwd or by a segment
+// of its id. The tasks that need an affected task, and the tasks an
+// affected task needs, are affected as well.
+func (ws *Workflow) affectedTasks(flatTasks []schema.Task, contextName string, runDir string, changed []string) (map[string]bool, error) {
+	changedUnder := func(dir string) bool {
+		return slices.ContainsFunc(changed, func(file string) bool { return isUnder(dir, file) })
+	}
+
+	project := ws.projectDir != "" && changedUnder(ws.projectDir)
+	projects := ws.affectedProjects(runDir, changed)
+	nodes := newTaskGraph(flatTasks, contextName)
+	changedNodes := []int{}
+	for _, node := range nodes {
+		task := node.task
+		dir, own := ws.taskDir(task, runDir)
+		affected := false
+		if len(task.Sources) > 0 {
+			matched, err := matchesSources(dir, task.Sources, changed)
+			if err != nil {
+				return nil, errors.New("invalid sources of task " + task.Id + ": " + err.Error())
+			}
+
+			affected = matched
+		} else if own && changedUnder(dir) {
+			affected = true
+		}
+
+		// every task of a project is affected by its changes, other than
+		// the tasks of runfiles it includes from outside of the project
+		if project && (!own || isUnder(ws.projectDir, dir)) {
+			affected = true
+		}
+
+		for name, projectDir := range projects {
+			if (own && isUnder(projectDir, dir)) || slices.Contains(strings.Split(task.Id, ":"), name) {
+				affected = true
+			}
+		}
+
+		if affected {
+			changedNodes = append(changedNodes, node.index)
+		}
+	}
+
+	// the needs of the tasks are resolved like the scheduler resolves them,
+	// so the context and the case of a need do not matter
+	dependents := map[int]bool{}
+	stack := append([]int{}, changedNodes...)
+	for len(stack) > 0 {
+		i := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if dependents[i] {
+			continue
+		}
+
+		dependents[i] = true
+		stack = append(stack, nodes[i].dependents...)
+	}
+
+	affected := map[string]bool{}
+	for i := range dependents {
+		affected[nodes[i].task.Id] = true
+		for _, dep := range ancestors(nodes, nodes[i]) {
+			affected[nodes[dep].task.Id] = true
+		}
+	}
+
+	return affected, nil
+}
+
+// affectedProjects returns the projects of config.dirs.projects that hold a
+// changed file, by name. An entry is a directory whose subdirectories are
+// projects, written with or without a trailing /*.
+func (ws *Workflow) affectedProjects(runDir string, changed []string) map[string]string {
+	projects := map[string]string{}
+	for _, entry := range ws.Config.Dirs.Projects {
+		parent := strings.TrimSuffix(strings.TrimRight(strings.TrimSpace(entry), "*"), "/")
+		if len(parent) == 0 {
+			continue
+		}
+
+		if !filepath.IsAbs(parent) {
+			parent = filepath.Join(runDir, parent)
+		}
+
+		for _, file := range changed {
+			rel, err := filepath.Rel(parent, file)
+			if err != nil || !isUnder(parent, file) {
+				continue
+			}
+
+			name := strings.SplitN(filepath.ToSlash(rel), "/", 2)[0]
+			if isDir(filepath.Join(parent, name)) {
+				projects[name] = filepath.Join(parent, name)
+			}
+		}
+	}
+
+	return projects
+}
+
+// changedFiles returns the absolute paths of the files of the git
+// repository that holds dir that changed since the merge base of since and
+// HEAD, including the changes that are not committed and untracked files.
+// since defaults to HEAD.
+func changedFiles(ctx context.Context, dir string, since string) ([]string, error) {
+	if since == "" {
+		since = "HEAD"
+	}
+
+	top, err := gitOutput(ctx, dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, errors.New("--affected needs a git repository: " + err.Error())
+	}
+	top = strings.TrimSpace(top)
+
+	base, err := gitOutput(ctx, dir, "merge-base", since, "HEAD")
+	if err != nil {
+		return nil, errors.New("failed to find the merge base of " + since + " and HEAD: " + err.Error())
+	}
+
+	diff, err := gitOutput(ctx, dir, "diff", "--name-only", "--no-renames", strings.TrimSpace(base))
+	if err != nil {
+		return nil, errors.New("failed to list the files changed since " + since + ": " + err.Error())
+	}
+
+	untracked, err := gitOutput(ctx, dir, "ls-files", "--others", "--exclude-standard", "--full-name")
+	if err != nil {
+		return nil, errors.New("failed to list untracked files: " + err.Error())
+	}
+
+	files := []string{}
+	for _, line := range strings.Split(diff+"\n"+untracked, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) > 0 {
+			files = append(files, filepath.Join(top, filepath.FromSlash(line)))
+		}
+	}
+
+	return files, nil
+}
+
+// gitOutput runs git in dir and returns its output.
+func gitOutput(ctx context.Context, dir string, args ...string) (string, error) {
+	out := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	cmd := exec.NewContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+	cmd.WithStdout(out)
+	cmd.WithStderr(stderr)
+	cmd.DisableLogger()
+	if _, err := cmd.Run(); err != nil {
+		return "", errors.New(err.Error() + "\n" + strings.TrimSpace(stderr.String()))
+	}
+
+	return out.String(), nil
+}
+
+// matchesSources reports whether one of the files matches the patterns,
+// which are relative to dir. Patterns prefixed with '!' exclude files.
+func matchesSources(dir string, patterns []string, files []string) (bool, error) {
+	includes := []glob.Glob{}
+	excludes := []glob.Glob{}
+	for _, pattern := range patterns {
+		exclude := strings.HasPrefix(pattern, "!")
+		pattern = filepath.ToSlash(strings.TrimPrefix(pattern, "!"))
+		pattern = strings.TrimPrefix(pattern, "./")
+
+		g, err := compileGlob(pattern)
+		if err != nil {
+			return false, errors.New("invalid glob pattern: " + pattern + " error: " + err.Error())
+		}
+
+		if exclude {
+			excludes = append(excludes, g)
+		} else {
+			includes = append(includes, g)
+		}
+	}
+
+	for _, file := range files {
+		if !isUnder(dir, file) {
+			continue
+		}
+
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			continue
+		}
+
+		rel = filepath.ToSlash(rel)
+		if matchAny(includes, rel) && !matchAny(excludes, rel) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// isUnder reports whether path is dir or is in dir.
+func isUnder(dir string, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
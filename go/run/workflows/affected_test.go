@@ -0,0 +1,146 @@
+package workflows
+
+import (
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/frostyeti/mvps/go/run/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsUnder(t *testing.T) {
+	tests := []struct {
+		dir   string
+		path  string
+		under bool
+	}{
+		{"/src", "/src", true},
+		{"/src", "/src/main.go", true},
+		{"/src", "/src/pkg/main.go", true},
+		{"/src", "/srcs/main.go", false},
+		{"/src", "/main.go", false},
+		{"/src/app", "/src/app/../lib/main.go", false},
+		{"/src", "/src/..data/main.go", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dir+" "+tt.path, func(t *testing.T) {
+			assert.Equal(t, tt.under, isUnder(filepath.FromSlash(tt.dir), filepath.FromSlash(tt.path)))
+		})
+	}
+}
+
+func TestMatchesSources(t *testing.T) {
+	dir := filepath.FromSlash("/repo/app")
+	file := func(p string) string { return filepath.FromSlash(p) }
+
+	tests := []struct {
+		name     string
+		patterns []string
+		files    []string
+		match    bool
+		err      bool
+	}{
+		{name: "match", patterns: []string{"**/*.go"}, files: []string{file("/repo/app/pkg/main.go")}, match: true},
+		{name: "dot slash", patterns: []string{"./src/*.go"}, files: []string{file("/repo/app/src/main.go")}, match: true},
+		{name: "no match", patterns: []string{"**/*.go"}, files: []string{file("/repo/app/README.md")}},
+		{name: "outside of dir", patterns: []string{"**/*.go"}, files: []string{file("/repo/lib/main.go")}},
+		{name: "excluded", patterns: []string{"**/*.go", "!**/*_test.go"}, files: []string{file("/repo/app/main_test.go")}},
+		{name: "one of the files", patterns: []string{"**/*.go", "!**/*_test.go"}, files: []string{file("/repo/app/main_test.go"), file("/repo/app/main.go")}, match: true},
+		{name: "invalid pattern", patterns: []string{"[a-"}, files: []string{file("/repo/app/a")}, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, err := matchesSources(dir, tt.patterns, tt.files)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.match, match)
+		})
+	}
+}
+
+func TestAffectedTasks(t *testing.T) {
+	root := filepath.FromSlash("/repo")
+	file := func(p string) string { return filepath.Join(root, filepath.FromSlash(p)) }
+	str := func(s string) *string { return &s }
+
+	tasks := []schema.Task{
+		{Id: "tools", Sources: []string{"tools/**"}},
+		{Id: "build", Needs: []string{"tools"}, Sources: []string{"src/**/*.go"}},
+		{Id: "Lint", Sources: []string{"lint/**"}},
+		{Id: "test:prod", Needs: []string{"BUILD", "lint"}, Cwd: str("e2e")},
+		{Id: "test", Needs: []string{"build"}, Cwd: str("tests")},
+		{Id: "docs", Sources: []string{"docs/**"}},
+		{Id: "deploy", Needs: []string{"test"}},
+	}
+
+	tests := []struct {
+		name       string
+		context    string
+		changed    []string
+		projectDir string
+		affected   []string
+	}{
+		{
+			name:     "nothing changed",
+			changed:  []string{},
+			affected: []string{},
+		},
+		{
+			name:     "sources",
+			changed:  []string{file("docs/index.md")},
+			affected: []string{"docs"},
+		},
+		{
+			name:     "dependents and their needs",
+			changed:  []string{file("src/main.go")},
+			affected: []string{"Lint", "build", "deploy", "test", "test:prod", "tools"},
+		},
+		{
+			name:     "needs of the context ignoring case",
+			context:  "prod",
+			changed:  []string{file("lint/rules.yaml")},
+			affected: []string{"Lint", "build", "deploy", "test:prod", "tools"},
+		},
+		{
+			name:     "cwd",
+			changed:  []string{file("tests/api_test.sh")},
+			affected: []string{"build", "deploy", "test", "tools"},
+		},
+		{
+			name:       "project",
+			changed:    []string{file("README.md")},
+			projectDir: root,
+			affected:   []string{"Lint", "build", "deploy", "docs", "test", "test:prod", "tools"},
+		},
+		{
+			name:       "other project",
+			changed:    []string{file("../other/README.md")},
+			projectDir: root,
+			affected:   []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := NewWorkflow()
+			ws.projectDir = tt.projectDir
+
+			affected, err := ws.affectedTasks(tasks, tt.context, root, tt.changed)
+			assert.NoError(t, err)
+
+			ids := []string{}
+			for id := range affected {
+				ids = append(ids, id)
+			}
+			sort.Strings(ids)
+			assert.Equal(t, tt.affected, ids)
+		})
+	}
+}
@@ -1,13 +1,26 @@
 package workflows
 
-import "github.com/frostyeti/mvps/go/run/schema"
+import (
+	"strings"
+
+	"github.com/frostyeti/mvps/go/run/schema"
+)
 
 type CyclicalReferenceError struct {
 	Cycles []schema.Task
+	// Paths holds the tasks of each cycle in order, e.g. [a b c a].
+	Paths [][]string
 }
 
 func (e *CyclicalReferenceError) Error() string {
 	msg := "Cyclical references found in tasks:\n"
+	if len(e.Paths) > 0 {
+		for _, path := range e.Paths {
+			msg += " - " + strings.Join(path, " -> ") + "\n"
+		}
+		return msg
+	}
+
 	for _, cycle := range e.Cycles {
 		msg += " - " + cycle.Id + "\n"
 	}
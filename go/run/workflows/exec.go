@@ -3,35 +3,71 @@ package workflows
 import (
 	"errors"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/frostyeti/mvps/go/exec"
 )
 
-func (ws *Workflow) Exec(args []string) error {
+// Exec runs a command in RUN_DIR with the env of the workflow, including
+// its dotenv files and path additions, and returns the exit code of the
+// command. On Unix the process is replaced by the command, so Exec only
+// returns when the command could not be started.
+func (ws *Workflow) Exec(args []string) (int, error) {
 	if ws == nil {
-		return errors.New("workflow is nil")
+		return 1, errors.New("workflow is nil")
+	}
+
+	if len(args) == 0 {
+		return 1, errors.New("no command given")
 	}
 
 	dir, ok := ws.Env.Get("RUN_DIR")
 	if !ok || len(dir) == 0 {
-		return errors.New("RUN_DIR is not set")
+		return 1, errors.New("RUN_DIR is not set")
+	}
+
+	// nothing reads the RUN_ENV and RUN_PATH files of the workflow after the
+	// command, remove them now as there is no later point to do so.
+	cmdEnv := ws.Env.Clone()
+	if ws.cleanupEnv {
+		os.Remove(cmdEnv.GetString("RUN_ENV"))
+		cmdEnv.Delete("RUN_ENV")
 	}
 
-	os.Stdout.WriteString(strings.Join(args, " ") + "\n")
-	cmd := exec.NewContext(ws.Context, args[0], args[1:]...)
-	cmd.Dir = dir
+	if ws.cleanupPath {
+		os.Remove(cmdEnv.GetString("RUN_PATH"))
+		cmdEnv.Delete("RUN_PATH")
+	}
 
-	cmd.WithEnvMap(ws.Env.ToMap())
-	o, err := cmd.Run()
-	if err != nil || o.Code != 0 {
-		if o.Code != 0 {
-			os.Exit(o.Code)
-		} else {
-			os.Exit(1)
+	paths := []string{}
+	for _, p := range cmdEnv.SplitPath() {
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(dir, p)
 		}
+		paths = append(paths, p)
+	}
+
+	// ./bin and the other relative path additions are resolved against
+	// RUN_DIR, so they are found by the processes the command starts in
+	// other directories as well.
+	cmdEnv.SetPath(strings.Join(paths, string(os.PathListSeparator)))
+
+	exe := args[0]
+	if !filepath.IsAbs(exe) && filepath.Base(exe) == exe {
+		found, ok := exec.WhichFirst(exe, &exec.WhichOptions{PrependPaths: paths})
+		if !ok {
+			return 127, errors.New("command not found: " + exe)
+		}
+		exe = found
+	} else if !filepath.IsAbs(exe) {
+		exe = filepath.Join(dir, exe)
+	}
+
+	environ := []string{}
+	for k, v := range cmdEnv.Iter() {
+		environ = append(environ, k+"="+v)
 	}
 
-	os.Exit(o.Code)
-	return nil
+	return ws.execCommand(exe, args, environ, dir)
 }
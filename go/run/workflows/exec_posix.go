@@ -0,0 +1,20 @@
+//go:build !windows
+// +build !windows
+
+package workflows
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// execCommand replaces the process with the command.
+func (ws *Workflow) execCommand(exe string, args []string, environ []string, dir string) (int, error) {
+	if err := os.Chdir(dir); err != nil {
+		return 1, errors.New("failed to change to directory " + dir + ": " + err.Error())
+	}
+
+	err := syscall.Exec(exe, args, environ)
+	return 126, errors.New("failed to exec " + exe + ": " + err.Error())
+}
@@ -0,0 +1,139 @@
+//go:build !windows
+// +build !windows
+
+package workflows
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/frostyeti/mvps/go/run/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestExecHelperProcess is the process TestExec replaces with the command,
+// as Exec replaces the process it runs in.
+func TestExecHelperProcess(t *testing.T) {
+	file := os.Getenv("RUN_TEST_EXEC_RUNFILE")
+	if file == "" {
+		t.Skip("run by TestExec")
+	}
+
+	rf := schema.NewRunfile()
+	if err := rf.DecodeYAMLFile(file); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	rf.Path = file
+
+	wf := NewWorkflow()
+	if err := wf.Load(*rf); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	code, err := wf.Exec(flag.Args())
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(code)
+}
+
+func TestExec(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "runfile", "env:\n  GREETING: hello\ndotenv: [.env]\n")
+	writeFile(t, dir, ".env", "FROM_DOTENV=yes\n")
+	writeFile(t, dir, "bin/greet", "#!/bin/sh\necho \"$PWD $GREETING $FROM_DOTENV $1\"\nexit \"${2:-0}\"\n")
+	if err := os.Chmod(filepath.Join(dir, "bin", "greet"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		args   []string
+		code   int
+		stdout string
+		stderr string
+	}{
+		{
+			name:   "command in the path of the runfile",
+			args:   []string{"greet", "world"},
+			stdout: dir + " hello yes world\n",
+		},
+		{
+			name:   "exit code",
+			args:   []string{"greet", "world", "7"},
+			code:   7,
+			stdout: dir + " hello yes world\n",
+		},
+		{
+			name:   "relative to the runfile",
+			args:   []string{"bin/greet", "again", "3"},
+			code:   3,
+			stdout: dir + " hello yes again\n",
+		},
+		{
+			name:   "path additions are absolute",
+			args:   []string{"sh", "-c", `cd / && greet "$(echo "$PATH" | cut -d: -f1)"`},
+			stdout: "/ hello yes " + filepath.Join(dir, "bin") + "\n",
+		},
+		{
+			name:   "env of the process",
+			args:   []string{"sh", "-c", `echo "$RUN_TEST_EXEC_PARENT"`},
+			stdout: "parent\n",
+		},
+		{
+			name:   "command not found",
+			args:   []string{"missing-command"},
+			code:   127,
+			stderr: "command not found: missing-command",
+		},
+		{
+			name:   "cannot exec",
+			args:   []string{"./runfile"},
+			code:   126,
+			stderr: "failed to exec " + filepath.Join(dir, "runfile"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := osexec.Command(os.Args[0], append([]string{"-test.run=^TestExecHelperProcess$", "--"}, tt.args...)...)
+			// the command runs in RUN_DIR, not the directory run was started in
+			cmd.Dir = t.TempDir()
+			cmd.Env = append(os.Environ(), "RUN_TEST_EXEC_RUNFILE="+filepath.Join(dir, "runfile"), "RUN_TEST_EXEC_PARENT=parent")
+			stdout := &strings.Builder{}
+			stderr := &strings.Builder{}
+			cmd.Stdout = stdout
+			cmd.Stderr = stderr
+
+			err := cmd.Run()
+			code := 0
+			if exitErr, ok := err.(*osexec.ExitError); ok {
+				code = exitErr.ExitCode()
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, tt.code, code, stderr.String())
+			if tt.stdout != "" {
+				assert.Equal(t, tt.stdout, stdout.String())
+			}
+			assert.Contains(t, stderr.String(), tt.stderr)
+		})
+	}
+}
+
+func TestExecErrors(t *testing.T) {
+	wf := NewWorkflow()
+	code, err := wf.Exec(nil)
+	assert.Equal(t, 1, code)
+	assert.EqualError(t, err, "no command given")
+
+	code, err = wf.Exec([]string{"true"})
+	assert.Equal(t, 1, code)
+	assert.EqualError(t, err, "RUN_DIR is not set")
+}
@@ -0,0 +1,33 @@
+//go:build windows
+// +build windows
+
+package workflows
+
+import (
+	"context"
+
+	"github.com/frostyeti/mvps/go/exec"
+)
+
+// execCommand runs the command as a child process and waits for it, as
+// Windows cannot replace a process.
+func (ws *Workflow) execCommand(exe string, args []string, environ []string, dir string) (int, error) {
+	ctx := ws.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	cmd := exec.NewContext(ctx, exe, args[1:]...)
+	cmd.Dir = dir
+	cmd.Env = environ
+	o, err := cmd.Run()
+	if o != nil && o.Code != 0 {
+		return o.Code, nil
+	}
+
+	if err != nil {
+		return 1, err
+	}
+
+	return 0, nil
+}
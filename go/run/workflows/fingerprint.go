@@ -0,0 +1,373 @@
+package workflows
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/frostyeti/mvps/go/crypto/hashes"
+	"github.com/frostyeti/mvps/go/run/paths"
+	"github.com/frostyeti/mvps/go/run/schema"
+	"github.com/gobwas/glob"
+)
+
+// fingerprint records the hash of a task's definition and the content
+// hashes of its sources and generated files from its last successful run,
+// along with the outputs of that run.
+type fingerprint struct {
+	Task      string                 `json:"task"`
+	Sources   string                 `json:"sources"`
+	Generates string                 `json:"generates"`
+	Outputs   map[string]interface{} `json:"outputs"`
+}
+
+// isUpToDate reports whether the task's definition, sources and generated
+// files match the fingerprint stored by its last successful run, and
+// returns the outputs of that run for the tasks that need them. Tasks
+// without sources, whose sources match no files, or that are forced, are
+// never up to date.
+func (ws *Workflow) isUpToDate(task schema.Task, cwd string) (map[string]interface{}, bool, error) {
+	if len(task.Sources) == 0 || task.Force || ws.Force {
+		return nil, false, nil
+	}
+
+	file, err := ws.fingerprintFile(task)
+	if err != nil {
+		return nil, false, err
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, false, nil
+		}
+
+		return nil, false, err
+	}
+
+	stored := fingerprint{}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		// a corrupt fingerprint only means the task runs again
+		return nil, false, nil
+	}
+
+	current, err := newFingerprint(task, cwd)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if current.Sources == "" {
+		return nil, false, nil
+	}
+
+	if len(task.Generates) > 0 && current.Generates == "" {
+		return nil, false, nil
+	}
+
+	if stored.Task != current.Task || stored.Sources != current.Sources || stored.Generates != current.Generates {
+		return nil, false, nil
+	}
+
+	// a fingerprint without outputs predates them, the task runs again
+	// so that the tasks that need it see its outputs
+	if stored.Outputs == nil {
+		return nil, false, nil
+	}
+
+	return stored.Outputs, true, nil
+}
+
+// saveFingerprint stores the fingerprint and the outputs of a task after it
+// ran successfully.
+func (ws *Workflow) saveFingerprint(task schema.Task, cwd string, outputs map[string]interface{}) error {
+	if len(task.Sources) == 0 {
+		return nil
+	}
+
+	file, err := ws.fingerprintFile(task)
+	if err != nil {
+		return err
+	}
+
+	current, err := newFingerprint(task, cwd)
+	if err != nil {
+		return err
+	}
+
+	current.Outputs = outputs
+	if current.Outputs == nil {
+		current.Outputs = map[string]interface{}{}
+	}
+
+	data, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(file, data, 0o644)
+}
+
+// fingerprintFile returns the path of the task's fingerprint. Fingerprints are
+// kept per runfile so that tasks with the same id in different projects do
+// not share state.
+func (ws *Workflow) fingerprintFile(task schema.Task) (string, error) {
+	return ws.stateFile("fingerprints", task, ".json")
+}
+
+// stateFile returns the path of the file of kind for the task in the state
+// directory of the runfile, e.g. its fingerprint or its service log.
+func (ws *Workflow) stateFile(kind string, task schema.Task, ext string) (string, error) {
+	stateHome := ws.Env.GetString("RUN_STATE_HOME")
+	if stateHome == "" {
+		dir, err := paths.UserStateDir()
+		if err != nil {
+			return "", err
+		}
+		stateHome = dir
+	}
+
+	h := hashes.SHA256.HashNew()()
+	h.Write([]byte(ws.Path))
+	project := hex.EncodeToString(h.Sum(nil))[:16]
+
+	name := strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			return '_'
+		}
+		return r
+	}, task.Id)
+
+	return filepath.Join(stateHome, kind, project, name+ext), nil
+}
+
+func newFingerprint(task schema.Task, cwd string) (*fingerprint, error) {
+	def, err := hashTask(task)
+	if err != nil {
+		return nil, err
+	}
+
+	sources, err := hashGlobs(cwd, task.Sources)
+	if err != nil {
+		return nil, err
+	}
+
+	generates, err := hashGlobs(cwd, task.Generates)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fingerprint{
+		Task:      def,
+		Sources:   sources,
+		Generates: generates,
+	}, nil
+}
+
+// hashTask hashes what the task runs and with what, so that editing its
+// run, uses, args, cwd, env or with runs it again.
+func hashTask(task schema.Task) (string, error) {
+	env := []string{}
+	if task.Env != nil {
+		for _, key := range task.Env.Keys() {
+			env = append(env, key+"="+task.Env.GetString(key))
+		}
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"run":       task.Run,
+		"uses":      task.Uses,
+		"args":      task.Args,
+		"cwd":       task.Cwd,
+		"env":       env,
+		"with":      task.With,
+		"sources":   task.Sources,
+		"generates": task.Generates,
+	})
+	if err != nil {
+		return "", errors.New("failed to hash task " + task.Id + ": " + err.Error())
+	}
+
+	h := hashes.SHA256.HashNew()()
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashGlobs hashes the paths and contents of the files under dir that match
+// the patterns. Patterns prefixed with '!' exclude files. An empty string is
+// returned when no files match.
+func hashGlobs(dir string, patterns []string) (string, error) {
+	if len(patterns) == 0 {
+		return "", nil
+	}
+
+	includes := []glob.Glob{}
+	excludes := []glob.Glob{}
+	roots := []string{}
+	for _, pattern := range patterns {
+		exclude := strings.HasPrefix(pattern, "!")
+		pattern = filepath.ToSlash(strings.TrimPrefix(pattern, "!"))
+		pattern = strings.TrimPrefix(pattern, "./")
+
+		g, err := compileGlob(pattern)
+		if err != nil {
+			return "", errors.New("invalid glob pattern: " + pattern + " error: " + err.Error())
+		}
+
+		if exclude {
+			excludes = append(excludes, g)
+			continue
+		}
+
+		includes = append(includes, g)
+		roots = append(roots, globRoot(pattern))
+	}
+
+	files := map[string]bool{}
+	for _, root := range roots {
+		start := filepath.Join(dir, filepath.FromSlash(root))
+		if _, err := os.Stat(start); err != nil {
+			continue
+		}
+
+		err := filepath.WalkDir(start, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if d.IsDir() {
+				if d.Name() == ".git" {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+
+			rel = filepath.ToSlash(rel)
+			if matchAny(includes, rel) && !matchAny(excludes, rel) {
+				files[rel] = true
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if len(files) == 0 {
+		return "", nil
+	}
+
+	sorted := make([]string, 0, len(files))
+	for f := range files {
+		sorted = append(sorted, f)
+	}
+	sort.Strings(sorted)
+
+	h := hashes.SHA256.HashNew()()
+	for _, rel := range sorted {
+		f, err := os.Open(filepath.Join(dir, filepath.FromSlash(rel)))
+		if err != nil {
+			return "", err
+		}
+
+		h.Write([]byte(rel))
+		h.Write([]byte{0})
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+		h.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// globRoot returns the leading directories of a pattern that contain no
+// glob characters, which is where the walk for the pattern starts.
+func globRoot(pattern string) string {
+	parts := strings.Split(pattern, "/")
+	root := []string{}
+	for _, part := range parts[:len(parts)-1] {
+		if strings.ContainsAny(part, "*?[{") {
+			break
+		}
+		root = append(root, part)
+	}
+
+	if len(root) == 0 {
+		return "."
+	}
+
+	return strings.Join(root, "/")
+}
+
+// compileGlob compiles a slash separated pattern where "**/" also matches
+// zero directories, so "src/**/*.go" matches "src/main.go".
+func compileGlob(pattern string) (glob.Glob, error) {
+	variants := []string{pattern}
+	seen := map[string]bool{pattern: true}
+	for i := 0; i < len(variants); i++ {
+		v := variants[i]
+		next := []string{}
+		if strings.HasPrefix(v, "**/") {
+			next = append(next, v[3:])
+		}
+
+		for j := 0; j < len(v); j++ {
+			if strings.HasPrefix(v[j:], "/**/") {
+				next = append(next, v[:j]+v[j+3:])
+			}
+		}
+
+		for _, n := range next {
+			if !seen[n] {
+				seen[n] = true
+				variants = append(variants, n)
+			}
+		}
+	}
+
+	set := globSet{}
+	for _, v := range variants {
+		g, err := glob.Compile(v, '/')
+		if err != nil {
+			return nil, err
+		}
+		set = append(set, g)
+	}
+
+	return set, nil
+}
+
+type globSet []glob.Glob
+
+func (set globSet) Match(path string) bool {
+	return matchAny(set, path)
+}
+
+func matchAny(globs []glob.Glob, path string) bool {
+	for _, g := range globs {
+		if g.Match(path) {
+			return true
+		}
+	}
+	return false
+}
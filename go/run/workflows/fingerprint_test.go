@@ -0,0 +1,219 @@
+package workflows
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/frostyeti/mvps/go/run/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompileGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "src/main.go", false},
+		{"src/**/*.go", "src/main.go", true},
+		{"src/**/*.go", "src/a/b/main.go", true},
+		{"src/**/*.go", "lib/main.go", false},
+		{"**/*.go", "main.go", true},
+		{"**/*.go", "a/b/main.go", true},
+		{"a/**/b/**/*.txt", "a/b/c.txt", true},
+		{"a/**/b/**/*.txt", "a/x/b/y/c.txt", true},
+		{"{src,lib}/*.go", "lib/main.go", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.path, func(t *testing.T) {
+			g, err := compileGlob(tt.pattern)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.match, g.Match(tt.path))
+		})
+	}
+}
+
+func TestGlobRoot(t *testing.T) {
+	tests := []struct {
+		pattern string
+		root    string
+	}{
+		{"*.go", "."},
+		{"main.go", "."},
+		{"src/*.go", "src"},
+		{"src/pkg/**/*.go", "src/pkg"},
+		{"**/*.go", "."},
+		{"{src,lib}/*.go", "."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			assert.Equal(t, tt.root, globRoot(tt.pattern))
+		})
+	}
+}
+
+func TestHashGlobs(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "src/main.go", "package main")
+	writeFile(t, dir, "src/main_test.go", "package main")
+	writeFile(t, dir, "README.md", "readme")
+
+	empty, err := hashGlobs(dir, []string{"*.txt"})
+	assert.NoError(t, err)
+	assert.Equal(t, "", empty)
+
+	all, err := hashGlobs(dir, []string{"src/**/*.go"})
+	assert.NoError(t, err)
+	assert.NotEqual(t, "", all)
+
+	excluded, err := hashGlobs(dir, []string{"src/**/*.go", "!**/*_test.go"})
+	assert.NoError(t, err)
+	assert.NotEqual(t, all, excluded)
+
+	writeFile(t, dir, "src/main.go", "package main\n")
+	changed, err := hashGlobs(dir, []string{"src/**/*.go"})
+	assert.NoError(t, err)
+	assert.NotEqual(t, all, changed)
+}
+
+func TestIsUpToDate(t *testing.T) {
+	run := func(s string) *string { return &s }
+
+	tests := []struct {
+		name   string
+		task   schema.Task
+		change func(task *schema.Task)
+		want   bool
+	}{
+		{
+			name: "unchanged",
+			task: schema.Task{Id: "build", Run: run("go build"), Sources: []string{"*.go"}},
+			want: true,
+		},
+		{
+			name:   "run changed",
+			task:   schema.Task{Id: "build", Run: run("go build"), Sources: []string{"*.go"}},
+			change: func(task *schema.Task) { task.Run = run("go build -v") },
+			want:   false,
+		},
+		{
+			name: "env changed",
+			task: schema.Task{Id: "build", Run: run("go build"), Sources: []string{"*.go"}},
+			change: func(task *schema.Task) {
+				task.Env = schema.NewEnv()
+				task.Env.Set("GOOS", "linux")
+			},
+			want: false,
+		},
+		{
+			name:   "with changed",
+			task:   schema.Task{Id: "build", Uses: run("docker"), Sources: []string{"*.go"}},
+			change: func(task *schema.Task) { task.With = schema.With{"image": "golang"} },
+			want:   false,
+		},
+		{
+			name: "no matched sources",
+			task: schema.Task{Id: "build", Run: run("go build"), Sources: []string{"*.txt"}},
+			want: false,
+		},
+		{
+			name: "forced",
+			task: schema.Task{Id: "build", Run: run("go build"), Sources: []string{"*.go"}, Force: true},
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFile(t, dir, "main.go", "package main")
+
+			ws := NewWorkflow()
+			ws.Path = filepath.Join(dir, "runfile")
+			ws.Env.Set("RUN_STATE_HOME", filepath.Join(dir, "state"))
+
+			task := tt.task
+			assert.NoError(t, ws.saveFingerprint(task, dir, map[string]interface{}{"VERSION": "1.0"}))
+			if tt.change != nil {
+				tt.change(&task)
+			}
+
+			outputs, ok, err := ws.isUpToDate(task, dir)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, ok)
+			if tt.want {
+				assert.Equal(t, map[string]interface{}{"VERSION": "1.0"}, outputs)
+			}
+		})
+	}
+}
+
+func TestIsUpToDateWithoutOutputs(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "main.go", "package main")
+
+	ws := NewWorkflow()
+	ws.Path = filepath.Join(dir, "runfile")
+	ws.Env.Set("RUN_STATE_HOME", filepath.Join(dir, "state"))
+
+	run := "go build"
+	task := schema.Task{Id: "build", Run: &run, Sources: []string{"*.go"}}
+	current, err := newFingerprint(task, dir)
+	assert.NoError(t, err)
+
+	// a fingerprint saved before outputs were stored runs the task again
+	file, err := ws.fingerprintFile(task)
+	assert.NoError(t, err)
+	data := `{"task":"` + current.Task + `","sources":"` + current.Sources + `","generates":""}`
+	writeFile(t, filepath.Dir(file), filepath.Base(file), data)
+
+	_, ok, err := ws.isUpToDate(task, dir)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestRunUpToDateOutputs(t *testing.T) {
+	wf, dir := loadWorkflow(t, `
+env:
+  RUN_STATE_HOME: "{dir}/state"
+tasks:
+  build:
+    sources: ["*.go"]
+    run: echo "VERSION=1.0" >> "$RUN_OUTPUTS"
+  deploy:
+    needs: [build]
+    run: echo "{{ .tasks.build.outputs.VERSION }}" > "{dir}/version"
+`)
+	writeFile(t, dir, "main.go", "package main")
+
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, wf.Run([]string{"deploy"}, nil))
+
+		data, err := os.ReadFile(filepath.Join(dir, "version"))
+		assert.NoError(t, err)
+		assert.Equal(t, "1.0", strings.TrimSpace(string(data)))
+	}
+
+	results := wf.Results()
+	assert.Equal(t, "build", results[2].Id)
+	assert.Equal(t, "up to date", results[2].Message)
+	assert.Equal(t, map[string]interface{}{"VERSION": "1.0"}, results[2].Output)
+}
+
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+
+	file := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,130 @@
+package workflows
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gobwas/glob"
+)
+
+// gitignore holds the patterns of a .gitignore file. Patterns match paths
+// relative to the directory of the file.
+type gitignore struct {
+	dir   string
+	rules []gitignoreRule
+}
+
+type gitignoreRule struct {
+	glob    glob.Glob
+	negate  bool
+	dirOnly bool
+}
+
+// loadGitignores reads the .gitignore files of dir and of its parents up
+// to the root of the git repository, the outermost first.
+func loadGitignores(dir string) []*gitignore {
+	ignores := []*gitignore{}
+	for {
+		if g := readGitignore(dir); g != nil {
+			ignores = append([]*gitignore{g}, ignores...)
+		}
+
+		if isDir(filepath.Join(dir, ".git")) || isFile(filepath.Join(dir, ".git")) {
+			break
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	return ignores
+}
+
+func readGitignore(dir string) *gitignore {
+	f, err := os.Open(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	g := &gitignore{dir: dir}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rule := gitignoreRule{}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+
+		// a pattern with a slash is relative to the directory of the
+		// .gitignore, any other pattern matches at any depth
+		if strings.Contains(line, "/") {
+			line = strings.TrimPrefix(line, "/")
+		} else {
+			line = "**/" + line
+		}
+
+		pattern, err := compileGlob(line)
+		if err != nil {
+			continue
+		}
+
+		rule.glob = pattern
+		g.rules = append(g.rules, rule)
+	}
+
+	return g
+}
+
+// ignored reports whether path, or one of the directories it is in, is
+// ignored by the .gitignore files. The last matching pattern wins, like
+// it does for git.
+func ignored(ignores []*gitignore, path string, isDir bool) bool {
+	for _, g := range ignores {
+		rel, err := filepath.Rel(g.dir, path)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			continue
+		}
+
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		for i := range parts {
+			prefix := strings.Join(parts[:i+1], "/")
+			dir := i < len(parts)-1 || isDir
+			if g.match(prefix, dir) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (g *gitignore) match(rel string, isDir bool) bool {
+	result := false
+	for _, rule := range g.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+
+		if rule.glob.Match(rel) {
+			result = !rule.negate
+		}
+	}
+
+	return result
+}
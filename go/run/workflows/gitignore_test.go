@@ -0,0 +1,59 @@
+package workflows
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGitignore(t *testing.T) {
+	parent := t.TempDir()
+	root := filepath.Join(parent, "repo")
+	if err := os.MkdirAll(filepath.Join(root, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// the .gitignore outside of the repository is not read
+	writeFile(t, parent, ".gitignore", "*\n")
+	writeFile(t, root, ".gitignore", `
+# comments and blank lines are skipped
+
+*.log
+!keep.log
+build/
+/docs/tmp
+`)
+	writeFile(t, root, "app/.gitignore", "secret.txt\n")
+
+	ignores := loadGitignores(filepath.Join(root, "app"))
+	assert.Len(t, ignores, 2)
+
+	tests := []struct {
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		{"main.go", false, false},
+		{"debug.log", false, true},
+		{"app/logs/debug.log", false, true},
+		{"keep.log", false, false},
+		{"build", true, true},
+		{"build/out.txt", false, true},
+		{"app/build/out.txt", false, true},
+		{"build", false, false},
+		{"docs/tmp/x.md", false, true},
+		{"app/docs/tmp/x.md", false, false},
+		{"app/secret.txt", false, true},
+		{"app/config/secret.txt", false, true},
+		{"secret.txt", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			path := filepath.Join(root, filepath.FromSlash(tt.path))
+			assert.Equal(t, tt.ignored, ignored(ignores, path, tt.isDir))
+		})
+	}
+}
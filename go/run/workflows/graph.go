@@ -0,0 +1,342 @@
+package workflows
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/frostyeti/mvps/go/run/schema"
+)
+
+// GraphNode is a task or a dynamic task in the task graph. Kind is one of
+// task, hook, context or uses.
+type GraphNode struct {
+	Id    string `json:"id"`
+	Label string `json:"label"`
+	Kind  string `json:"kind"`
+	Uses  string `json:"uses,omitempty"`
+	Cycle bool   `json:"cycle,omitempty"`
+}
+
+// GraphEdge points in the order tasks run: from a need to the task that
+// needs it, from a before hook to its task, from a task to its after hook,
+// to its context overrides and to the dynamic task it uses. Kind is one of
+// needs, before, after, context or uses.
+type GraphEdge struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Kind  string `json:"kind"`
+	Cycle bool   `json:"cycle,omitempty"`
+}
+
+// TaskGraph is the dependency graph of the tasks of a workflow. Cycles
+// holds the tasks of each cycle in the needs in order, e.g. [a b c a].
+type TaskGraph struct {
+	Nodes  []GraphNode `json:"nodes"`
+	Edges  []GraphEdge `json:"edges"`
+	Cycles [][]string  `json:"cycles"`
+}
+
+// Graph returns the graph of the targets and every task they reach. When
+// no targets are given, the graph holds all tasks. Needs resolve as they do
+// when the workflow runs in its context.
+func (ws *Workflow) Graph(targets []string) (*TaskGraph, error) {
+	if ws == nil {
+		return nil, errors.New("workflow is nil")
+	}
+
+	contextName := ws.ContextName
+	if len(contextName) == 0 {
+		contextName = "default"
+	}
+
+	g := &TaskGraph{Nodes: []GraphNode{}, Edges: []GraphEdge{}, Cycles: [][]string{}}
+	nodes := map[string]int{}
+	edges := map[string]bool{}
+
+	hooks := map[string]bool{}
+	for _, key := range ws.Tasks.Keys() {
+		task, _ := ws.Tasks.Get(key)
+		for _, suffix := range append(append([]string{}, task.Hooks.Before...), task.Hooks.After...) {
+			hooks[task.Id+":"+suffix] = true
+		}
+	}
+
+	addNode := func(node GraphNode) {
+		if _, ok := nodes[node.Id]; ok {
+			return
+		}
+
+		nodes[node.Id] = len(g.Nodes)
+		g.Nodes = append(g.Nodes, node)
+	}
+
+	addEdge := func(from, to, kind string) {
+		key := from + "\x00" + to + "\x00" + kind
+		if edges[key] {
+			return
+		}
+
+		edges[key] = true
+		g.Edges = append(g.Edges, GraphEdge{From: from, To: to, Kind: kind})
+	}
+
+	queue := []string{}
+	if len(targets) == 0 {
+		queue = append(queue, ws.Tasks.Keys()...)
+	} else {
+		for _, target := range targets {
+			task, ok := ws.Tasks.Get(target)
+			if !ok {
+				return nil, errors.New("task not found: " + target)
+			}
+			queue = append(queue, task.Id)
+		}
+	}
+
+	visited := map[string]bool{}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if visited[id] {
+			continue
+		}
+		visited[id] = true
+
+		task, ok := ws.Tasks.Get(id)
+		if !ok {
+			continue
+		}
+
+		kind := "task"
+		if hooks[task.Id] {
+			kind = "hook"
+		} else if base, _, ok := strings.Cut(task.Id, ":"); ok {
+			if _, found := ws.Tasks.Get(base); found {
+				kind = "context"
+			}
+		}
+
+		label := task.Id
+		if task.Name != nil && len(*task.Name) > 0 {
+			label = *task.Name
+		}
+
+		uses := ""
+		if task.Uses != nil {
+			uses = *task.Uses
+		}
+
+		addNode(GraphNode{Id: task.Id, Label: label, Kind: kind, Uses: uses})
+
+		for _, need := range task.Needs {
+			next, ok := ws.findNeed(need, contextName)
+			if !ok {
+				continue
+			}
+
+			addEdge(next.Id, task.Id, "needs")
+			queue = append(queue, next.Id)
+		}
+
+		for _, suffix := range task.Hooks.Before {
+			if next, ok := ws.Tasks.Get(task.Id + ":" + suffix); ok {
+				addEdge(next.Id, task.Id, "before")
+				queue = append(queue, next.Id)
+			}
+		}
+
+		for _, suffix := range task.Hooks.After {
+			if next, ok := ws.Tasks.Get(task.Id + ":" + suffix); ok {
+				addEdge(task.Id, next.Id, "after")
+				queue = append(queue, next.Id)
+			}
+		}
+
+		// a task:context task replaces the task when that context is used
+		for _, key := range ws.Tasks.Keys() {
+			suffix, ok := strings.CutPrefix(key, task.Id+":")
+			if !ok || len(suffix) == 0 || strings.Contains(suffix, ":") || hooks[key] {
+				continue
+			}
+
+			addEdge(task.Id, key, "context")
+			queue = append(queue, key)
+		}
+
+		ws.addUses(uses, task.Id, addNode, addEdge, map[string]bool{})
+	}
+
+	all := []schema.Task{}
+	for _, node := range g.Nodes {
+		if task, ok := ws.Tasks.Get(node.Id); ok {
+			all = append(all, task)
+		}
+	}
+
+	g.Cycles = schema.FindCycles(all)
+	for _, cycle := range g.Cycles {
+		for i := 0; i < len(cycle)-1; i++ {
+			g.Nodes[nodes[cycle[i]]].Cycle = true
+			for j := range g.Edges {
+				edge := &g.Edges[j]
+				// a needs b is drawn as b -> a
+				if edge.Kind == "needs" && edge.From == cycle[i+1] && edge.To == cycle[i] {
+					edge.Cycle = true
+				}
+			}
+		}
+	}
+
+	return g, nil
+}
+
+// findNeed returns the task a need runs in contextName, see resolveNeed.
+func (ws *Workflow) findNeed(need string, contextName string) (schema.Task, bool) {
+	id, ok := resolveNeed(need, contextName, func(id string) bool {
+		_, ok := ws.Tasks.Get(id)
+		return ok
+	})
+	if !ok {
+		return schema.Task{}, false
+	}
+
+	return ws.Tasks.Get(id)
+}
+
+// addUses adds the dynamic task that from uses and the dynamic tasks its
+// steps use.
+func (ws *Workflow) addUses(uses string, from string, addNode func(GraphNode), addEdge func(string, string, string), seen map[string]bool) {
+	def, ok := ws.DynamicTasks[uses]
+	if !ok {
+		return
+	}
+
+	id := "uses:" + def.Id
+	addEdge(from, id, "uses")
+	if seen[id] {
+		return
+	}
+	seen[id] = true
+
+	label := def.Id
+	if len(def.Name) > 0 {
+		label = def.Name
+	}
+	addNode(GraphNode{Id: id, Label: label, Kind: "uses", Uses: def.Id})
+
+	for _, step := range def.Steps {
+		ws.addUses(step.Uses, id, addNode, addEdge, seen)
+	}
+}
+
+// WriteDot writes the graph in the Graphviz dot format. Cycles are drawn
+// in red.
+func (g *TaskGraph) WriteDot(w io.Writer) error {
+	b := &strings.Builder{}
+	b.WriteString("digraph tasks {\n")
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=box];\n")
+	for _, node := range g.Nodes {
+		attrs := []string{"label=" + strconv.Quote(node.Label)}
+		switch node.Kind {
+		case "hook":
+			attrs = append(attrs, "style=rounded")
+		case "context":
+			attrs = append(attrs, "style=dashed")
+		case "uses":
+			attrs = append(attrs, "shape=component")
+		}
+		if node.Cycle {
+			attrs = append(attrs, "color=red")
+		}
+
+		b.WriteString("  " + strconv.Quote(node.Id) + " [" + strings.Join(attrs, ", ") + "];\n")
+	}
+
+	for _, edge := range g.Edges {
+		attrs := []string{}
+		switch edge.Kind {
+		case "before", "after":
+			attrs = append(attrs, "label="+strconv.Quote(edge.Kind), "style=dotted")
+		case "context", "uses":
+			attrs = append(attrs, "label="+strconv.Quote(edge.Kind), "style=dashed")
+		}
+		if edge.Cycle {
+			attrs = append(attrs, "color=red", "penwidth=2")
+		}
+
+		line := "  " + strconv.Quote(edge.From) + " -> " + strconv.Quote(edge.To)
+		if len(attrs) > 0 {
+			line += " [" + strings.Join(attrs, ", ") + "]"
+		}
+		b.WriteString(line + ";\n")
+	}
+
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteMermaid writes the graph as a mermaid flowchart. Cycles are drawn
+// in red.
+func (g *TaskGraph) WriteMermaid(w io.Writer) error {
+	ids := map[string]string{}
+	for i, node := range g.Nodes {
+		ids[node.Id] = "n" + strconv.Itoa(i)
+	}
+
+	b := &strings.Builder{}
+	b.WriteString("flowchart LR\n")
+	for _, node := range g.Nodes {
+		label := strings.ReplaceAll(node.Label, `"`, "#quot;")
+		switch node.Kind {
+		case "hook":
+			b.WriteString("  " + ids[node.Id] + "(\"" + label + "\")\n")
+		case "uses":
+			b.WriteString("  " + ids[node.Id] + "[[\"" + label + "\"]]\n")
+		default:
+			b.WriteString("  " + ids[node.Id] + "[\"" + label + "\"]\n")
+		}
+	}
+
+	cycles := []string{}
+	for i, edge := range g.Edges {
+		arrow := " --> "
+		switch edge.Kind {
+		case "before", "after", "context", "uses":
+			arrow = " -. " + edge.Kind + " .-> "
+		}
+		b.WriteString("  " + ids[edge.From] + arrow + ids[edge.To] + "\n")
+
+		if edge.Cycle {
+			cycles = append(cycles, strconv.Itoa(i))
+		}
+	}
+
+	for _, node := range g.Nodes {
+		if node.Cycle {
+			b.WriteString("  style " + ids[node.Id] + " stroke:#d00,stroke-width:2px\n")
+		}
+	}
+
+	if len(cycles) > 0 {
+		b.WriteString("  linkStyle " + strings.Join(cycles, ",") + " stroke:#d00,stroke-width:2px\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteJSON writes the graph as indented json.
+func (g *TaskGraph) WriteJSON(w io.Writer) error {
+	data, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
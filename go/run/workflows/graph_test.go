@@ -0,0 +1,228 @@
+package workflows
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const graphRunfile = `
+tasks:
+  lint:
+    run: echo lint
+  build:
+    needs: [Lint]
+    run: echo build
+  build:ci:
+    run: echo build ci
+  test:
+    needs: [build]
+    hooks:
+      before: [setup]
+      after: [report]
+    run: echo test
+  test:setup:
+    run: echo setup
+  test:report:
+    run: echo report
+  deploy:
+    needs: [test]
+    run: echo deploy
+`
+
+// graphEdges returns the edges of the graph as from -> to (kind).
+func graphEdges(g *TaskGraph) []string {
+	edges := []string{}
+	for _, edge := range g.Edges {
+		s := edge.From + " -> " + edge.To + " (" + edge.Kind + ")"
+		if edge.Cycle {
+			s += " cycle"
+		}
+		edges = append(edges, s)
+	}
+
+	return edges
+}
+
+// graphNodes returns the kind of each node of the graph.
+func graphNodes(g *TaskGraph) map[string]string {
+	nodes := map[string]string{}
+	for _, node := range g.Nodes {
+		nodes[node.Id] = node.Kind
+		if node.Cycle {
+			nodes[node.Id] += " cycle"
+		}
+	}
+
+	return nodes
+}
+
+func TestGraph(t *testing.T) {
+	tests := []struct {
+		name    string
+		runfile string
+		context string
+		targets []string
+		nodes   map[string]string
+		edges   []string
+		cycles  [][]string
+		err     string
+	}{
+		{
+			name:    "needs and hooks",
+			runfile: graphRunfile,
+			targets: []string{"deploy"},
+			nodes: map[string]string{
+				"deploy": "task", "test": "task", "test:setup": "hook", "test:report": "hook",
+				"build": "task", "build:ci": "context", "lint": "task",
+			},
+			edges: []string{
+				"test -> deploy (needs)",
+				"build -> test (needs)",
+				"test:setup -> test (before)",
+				"test -> test:report (after)",
+				"lint -> build (needs)",
+				"build -> build:ci (context)",
+			},
+			cycles: [][]string{},
+		},
+		{
+			name:    "needs of the context",
+			runfile: graphRunfile,
+			context: "ci",
+			targets: []string{"DEPLOY"},
+			nodes: map[string]string{
+				"deploy": "task", "test": "task", "test:setup": "hook", "test:report": "hook",
+				"build:ci": "context",
+			},
+			edges: []string{
+				"test -> deploy (needs)",
+				"build:ci -> test (needs)",
+				"test:setup -> test (before)",
+				"test -> test:report (after)",
+			},
+			cycles: [][]string{},
+		},
+		{
+			name: "cycle",
+			runfile: `
+tasks:
+  a:
+    needs: [b]
+  b:
+    needs: [A]
+  c:
+    needs: [a]
+`,
+			nodes: map[string]string{"a": "task cycle", "b": "task cycle", "c": "task"},
+			edges: []string{
+				"b -> a (needs) cycle",
+				"a -> b (needs) cycle",
+				"a -> c (needs)",
+			},
+			cycles: [][]string{{"a", "b", "a"}},
+		},
+		{
+			name:    "unknown target",
+			runfile: graphRunfile,
+			targets: []string{"missing"},
+			err:     "task not found: missing",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wf, _ := loadWorkflow(t, tt.runfile)
+			if tt.context != "" {
+				wf.ContextName = tt.context
+			}
+
+			g, err := wf.Graph(tt.targets)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.nodes, graphNodes(g))
+			assert.ElementsMatch(t, tt.edges, graphEdges(g))
+			assert.Equal(t, tt.cycles, g.Cycles)
+		})
+	}
+}
+
+// writerGraph has a node and an edge of each kind and a cycle.
+var writerGraph = &TaskGraph{
+	Nodes: []GraphNode{
+		{Id: "a", Label: "a", Kind: "task", Cycle: true},
+		{Id: "b", Label: "b", Kind: "task", Cycle: true},
+		{Id: "a:setup", Label: "setup", Kind: "hook"},
+		{Id: "a:ci", Label: "a:ci", Kind: "context"},
+		{Id: "uses:docker", Label: `Docker "run"`, Kind: "uses", Uses: "docker"},
+	},
+	Edges: []GraphEdge{
+		{From: "a", To: "b", Kind: "needs", Cycle: true},
+		{From: "b", To: "a", Kind: "needs", Cycle: true},
+		{From: "a:setup", To: "a", Kind: "before"},
+		{From: "a", To: "a:ci", Kind: "context"},
+		{From: "a", To: "uses:docker", Kind: "uses"},
+	},
+	Cycles: [][]string{{"a", "b", "a"}},
+}
+
+func TestGraphWriteDot(t *testing.T) {
+	out := &bytes.Buffer{}
+	assert.NoError(t, writerGraph.WriteDot(out))
+	assert.Equal(t, `digraph tasks {
+  rankdir=LR;
+  node [shape=box];
+  "a" [label="a", color=red];
+  "b" [label="b", color=red];
+  "a:setup" [label="setup", style=rounded];
+  "a:ci" [label="a:ci", style=dashed];
+  "uses:docker" [label="Docker \"run\"", shape=component];
+  "a" -> "b" [color=red, penwidth=2];
+  "b" -> "a" [color=red, penwidth=2];
+  "a:setup" -> "a" [label="before", style=dotted];
+  "a" -> "a:ci" [label="context", style=dashed];
+  "a" -> "uses:docker" [label="uses", style=dashed];
+}
+`, out.String())
+}
+
+func TestGraphWriteMermaid(t *testing.T) {
+	out := &bytes.Buffer{}
+	assert.NoError(t, writerGraph.WriteMermaid(out))
+	assert.Equal(t, `flowchart LR
+  n0["a"]
+  n1["b"]
+  n2("setup")
+  n3["a:ci"]
+  n4[["Docker #quot;run#quot;"]]
+  n0 --> n1
+  n1 --> n0
+  n2 -. before .-> n0
+  n0 -. context .-> n3
+  n0 -. uses .-> n4
+  style n0 stroke:#d00,stroke-width:2px
+  style n1 stroke:#d00,stroke-width:2px
+  linkStyle 0,1 stroke:#d00,stroke-width:2px
+`, out.String())
+}
+
+func TestGraphWriteJSON(t *testing.T) {
+	out := &bytes.Buffer{}
+	assert.NoError(t, writerGraph.WriteJSON(out))
+	assert.Contains(t, out.String(), `"uses": "docker"`)
+	assert.Contains(t, out.String(), `{
+      "id": "a:setup",
+      "label": "setup",
+      "kind": "hook"
+    }`)
+
+	got := &TaskGraph{}
+	assert.NoError(t, json.Unmarshal(out.Bytes(), got))
+	assert.Equal(t, writerGraph, got)
+}
@@ -0,0 +1,262 @@
+package workflows
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+
+	"github.com/frostyeti/mvps/go/env"
+	"github.com/frostyeti/mvps/go/run/schema"
+)
+
+// include is a runfile included into a namespace. Its tasks run with the
+// variables it sets on top of the workflow env, in its directory and with
+// its values.
+type include struct {
+	namespace string
+	dir       string
+	env       *schema.Environment
+	values    map[string]interface{}
+}
+
+// includeEnvSkip are the variables every workflow gets its own value for,
+// they are not carried from an included runfile to its tasks.
+var includeEnvSkip = map[string]bool{
+	"RUN_ENV":     true,
+	"RUN_PATH":    true,
+	"RUN_OUTPUTS": true,
+}
+
+// loadIncludes loads the included runfiles of runfile and adds their tasks
+// and hosts to the workflow, prefixed with the namespace of the include.
+func (wf *Workflow) loadIncludes(runfile schema.Runfile, rootDir string) error {
+	envMap := wf.Env
+	for _, inc := range runfile.Includes {
+		opts := &env.ExpandOptions{
+			Get: func(key string) string {
+				s, ok := envMap.Get(key)
+				if ok {
+					return s
+				}
+
+				return ""
+			},
+			Set: func(key, value string) error {
+				envMap.Set(key, value)
+				return nil
+			},
+			Keys:                envMap.Keys(),
+			ExpandUnixArgs:      true,
+			ExpandWindowsVars:   false,
+			CommandSubstitution: runfile.Config.Substitution,
+		}
+
+		next, err := includeFile(inc.Path, rootDir, opts)
+		if err != nil {
+			return err
+		}
+
+		if next == "" {
+			continue
+		}
+
+		for p := wf; p != nil; p = p.parent {
+			if p.Path == next {
+				return errors.New("runfile includes itself: " + next)
+			}
+		}
+
+		rf := schema.NewRunfile()
+		if err := rf.DecodeYAMLFile(next); err != nil {
+			return errors.New("failed to parse included runfile: " + next + " error: " + err.Error())
+		}
+		rf.Path = next
+
+		child := NewWorkflow()
+		child.parent = wf
+		child.Context = wf.Context
+		child.ContextName = wf.ContextName
+		err = child.Load(*rf)
+		child.Cleanup()
+		if err != nil {
+			return errors.New("failed to load included runfile: " + next + " error: " + err.Error())
+		}
+
+		// tasks without uses run with the shell the included runfile sets
+		shell := rf.Config.Shell
+		if shell != nil && (len(*shell) == 0 || *shell == *schema.NewRunfile().Config.Shell) {
+			shell = nil
+		}
+
+		wf.addInclude(inc.Namespace, child, shell)
+	}
+
+	return nil
+}
+
+// includeFile expands the path of an include and returns the runfile it
+// points to, which is the runfile of a directory. An empty string is
+// returned for an optional include, one that ends with ?, that does not
+// exist.
+func includeFile(path string, rootDir string, opts *env.ExpandOptions) (string, error) {
+	next, err := env.ExpandWithOptions(path, opts)
+	if err != nil {
+		return "", errors.New("failed to expand include path: " + path + " error: " + err.Error())
+	}
+
+	next = strings.TrimSpace(next)
+	optional := false
+	if strings.HasSuffix(next, "?") {
+		optional = true
+		next = strings.TrimSuffix(next, "?")
+	}
+
+	if !(filepath.IsAbs(next)) {
+		next = filepath.Join(rootDir, next)
+	}
+
+	if isDir(next) {
+		next = filepath.Join(next, "runfile")
+	}
+
+	if !isFile(next) {
+		if optional {
+			return "", nil
+		}
+
+		return "", errors.New("included runfile does not exist: " + next)
+	}
+
+	return next, nil
+}
+
+// addInclude adds the tasks and hosts of child to the workflow under the
+// namespace. needs and hosts of the tasks that point to tasks and hosts of
+// child are prefixed as well, other needs point to tasks of the workflow,
+// including the tasks of other namespaces.
+func (wf *Workflow) addInclude(namespace string, child *Workflow, shell *string) {
+	prefix := namespace + ":"
+
+	inc := &include{
+		namespace: namespace,
+		dir:       filepath.Dir(child.Path),
+		env:       schema.NewEnv(),
+		values:    child.Values,
+	}
+
+	for _, key := range child.Env.Keys() {
+		if includeEnvSkip[key] {
+			continue
+		}
+
+		value := child.Env.GetString(key)
+		secret := child.Env.IsSecret(key)
+		if old, ok := wf.Env.Get(key); ok && old == value && !secret {
+			continue
+		}
+
+		if secret {
+			inc.env.SetSecret(key, value)
+		} else {
+			inc.env.Set(key, value)
+		}
+	}
+
+	hosts := map[string]bool{}
+	for name, host := range child.Hosts.Iter() {
+		hosts[name] = true
+		for _, group := range host.Groups {
+			hosts[group] = true
+		}
+	}
+
+	rename := func(names []string, known func(string) bool) []string {
+		if names == nil {
+			return nil
+		}
+
+		renamed := make([]string, 0, len(names))
+		for _, name := range names {
+			if known(name) {
+				name = prefix + name
+			}
+			renamed = append(renamed, name)
+		}
+
+		return renamed
+	}
+
+	isHost := func(name string) bool { return hosts[name] }
+	for name, host := range child.Hosts.Iter() {
+		host.Groups = rename(host.Groups, isHost)
+		host.Jump = rename(host.Jump, isHost)
+		wf.Hosts.Set(prefix+name, &host)
+	}
+
+	isTask := func(name string) bool { return child.hasTask(name) }
+	merged := map[*include]*include{}
+	for _, key := range child.Tasks.Keys() {
+		task, _ := child.Tasks.Get(key)
+		task.Id = prefix + task.Id
+		if task.Name != nil && *task.Name == key {
+			name := task.Id
+			task.Name = &name
+		}
+		task.Needs = rename(task.Needs, isTask)
+		task.Hosts = rename(task.Hosts, isHost)
+		if (task.Uses == nil || len(*task.Uses) == 0) && shell != nil {
+			task.Uses = shell
+		}
+
+		wf.Tasks.Set(&task)
+
+		// tasks of runfiles the child includes get the variables of both
+		if nested, ok := child.includes[key]; ok {
+			if _, ok := merged[nested]; !ok {
+				next := *nested
+				next.namespace = prefix + nested.namespace
+				next.env = inc.env.Clone()
+				nested.applyEnv(next.env)
+				merged[nested] = &next
+			}
+
+			wf.includes[task.Id] = merged[nested]
+			continue
+		}
+
+		wf.includes[task.Id] = inc
+	}
+
+	for id, def := range child.DynamicTasks {
+		if _, ok := wf.DynamicTasks[id]; !ok {
+			wf.DynamicTasks[id] = def
+		}
+	}
+}
+
+// hasTask reports whether name is a task of the workflow or the base of
+// its context specific tasks, name:context.
+func (wf *Workflow) hasTask(name string) bool {
+	if _, ok := wf.Tasks.Get(name); ok {
+		return true
+	}
+
+	for _, key := range wf.Tasks.Keys() {
+		if strings.HasPrefix(key, name+":") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// applyEnv sets the variables of the included runfile in taskEnv.
+func (inc *include) applyEnv(taskEnv *schema.Environment) {
+	for _, key := range inc.env.Keys() {
+		if inc.env.IsSecret(key) {
+			taskEnv.SetSecret(key, inc.env.GetString(key))
+		} else {
+			taskEnv.Set(key, inc.env.GetString(key))
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package workflows
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/frostyeti/mvps/go/env"
+	"github.com/frostyeti/mvps/go/run/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+// loadFiles writes the files to a temporary directory and loads its
+// runfile.
+func loadFiles(t *testing.T, files map[string]string) (*Workflow, string, error) {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		writeFile(t, dir, name, strings.ReplaceAll(content, "{dir}", dir))
+	}
+
+	rf := schema.NewRunfile()
+	if err := rf.DecodeYAMLFile(filepath.Join(dir, "runfile")); err != nil {
+		t.Fatal(err)
+	}
+	rf.Path = filepath.Join(dir, "runfile")
+
+	wf := NewWorkflow()
+	err := wf.Load(*rf)
+	t.Cleanup(wf.Cleanup)
+	return wf, dir, err
+}
+
+func TestIncludeNamespaces(t *testing.T) {
+	wf, _, err := loadFiles(t, map[string]string{
+		"runfile": `
+include:
+  api: services/api
+  db: services/db/runfile
+tasks:
+  build:
+    needs: [api:build]
+    run: echo build
+`,
+		"services/api/runfile": `
+hosts:
+  web1:
+    host: 10.0.0.1
+    groups: [web]
+tasks:
+  lint:
+    run: echo lint
+  build:
+    needs: [lint, db:migrate, build:linux]
+    run: echo build
+  build:linux:
+    run: echo linux
+  deploy:
+    hosts: [web]
+    run: uptime
+`,
+		"services/db/runfile": `
+tasks:
+  migrate:
+    run: migrate up
+`,
+	})
+	assert.NoError(t, err)
+
+	keys := wf.Tasks.Keys()
+	for _, key := range []string{"build", "api:lint", "api:build", "api:build:linux", "api:deploy", "db:migrate"} {
+		assert.Contains(t, keys, key)
+	}
+
+	// needs of tasks of the include are prefixed, other needs are left to
+	// point to the tasks of the workflow
+	build, _ := wf.Tasks.Get("api:build")
+	assert.Equal(t, []string{"api:lint", "db:migrate", "api:build:linux"}, build.Needs)
+
+	deploy, _ := wf.Tasks.Get("api:deploy")
+	assert.Equal(t, []string{"api:web"}, deploy.Hosts)
+
+	host, ok := wf.Hosts.Get("api:web1")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"api:web"}, host.Groups)
+}
+
+func TestIncludeRunsInItsDir(t *testing.T) {
+	wf, dir, err := loadFiles(t, map[string]string{
+		"runfile": `
+include:
+  api: services/api
+tasks:
+  all:
+    needs: [api:where]
+    run: echo all
+`,
+		"services/api/runfile": `
+env:
+  SERVICE: api
+tasks:
+  where:
+    run: echo "$SERVICE $PWD $RUN_DIR" >> "{dir}/log"
+`,
+	})
+	assert.NoError(t, err)
+	wf.stdout = io.Discard
+
+	assert.NoError(t, wf.Run([]string{"all"}, nil))
+
+	data, err := os.ReadFile(filepath.Join(dir, "log"))
+	assert.NoError(t, err)
+	api := filepath.Join(dir, "services", "api")
+	assert.Equal(t, "api "+api+" "+api+"\n", string(data))
+}
+
+func TestIncludeErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		err   string
+	}{
+		{
+			name:  "optional missing",
+			files: map[string]string{"runfile": "include:\n  api: services/api?\ntasks:\n  a:\n    run: echo a\n"},
+		},
+		{
+			name:  "missing",
+			files: map[string]string{"runfile": "include:\n  api: services/api\ntasks:\n  a:\n    run: echo a\n"},
+			err:   "included runfile does not exist: {dir}/services/api",
+		},
+		{
+			name:  "itself",
+			files: map[string]string{"runfile": "include:\n  self: .\ntasks:\n  a:\n    run: echo a\n"},
+			err:   "runfile includes itself: {dir}/runfile",
+		},
+		{
+			name: "cycle",
+			files: map[string]string{
+				"runfile":     "include:\n  api: api\ntasks:\n  a:\n    run: echo a\n",
+				"api/runfile": "include:\n  root: ..\ntasks:\n  b:\n    run: echo b\n",
+			},
+			err: "runfile includes itself: {dir}/runfile",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, dir, err := loadFiles(t, tt.files)
+			if tt.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.ErrorContains(t, err, strings.ReplaceAll(tt.err, "{dir}", dir))
+		})
+	}
+}
+
+func TestIncludeFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "api/runfile", "tasks: {}\n")
+	writeFile(t, dir, "web.yaml", "tasks: {}\n")
+
+	tests := []struct {
+		path string
+		want string
+		err  bool
+	}{
+		{path: "api", want: "api/runfile"},
+		{path: "api/runfile", want: "api/runfile"},
+		{path: "web.yaml", want: "web.yaml"},
+		{path: "${APP}", want: "api/runfile"},
+		{path: " api? ", want: "api/runfile"},
+		{path: "missing?", want: ""},
+		{path: "missing", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			opts := &env.ExpandOptions{Get: func(key string) string {
+				if key == "APP" {
+					return "api"
+				}
+				return ""
+			}}
+
+			got, err := includeFile(tt.path, dir, opts)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			if tt.want == "" {
+				assert.Equal(t, "", got)
+				return
+			}
+
+			assert.Equal(t, filepath.Join(dir, filepath.FromSlash(tt.want)), got)
+		})
+	}
+}
@@ -0,0 +1,267 @@
+package workflows
+
+import (
+	"errors"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/frostyeti/mvps/go/run/prompts"
+	"github.com/frostyeti/mvps/go/run/schema"
+	"github.com/frostyeti/mvps/go/run/tasks"
+)
+
+// isTarget reports whether the task, or the matrix task it was expanded
+// from, was named on the command line.
+func (ws *Workflow) isTarget(task schema.Task) bool {
+	id := task.Id
+	if task.MatrixValues != nil {
+		id, _, _ = strings.Cut(id, "[")
+	}
+
+	for _, target := range ws.targets {
+		if strings.EqualFold(target, id) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// resolveInputs applies the inputs given on the command line to the with
+// values of a target task, then validates the inputs the task declares and
+// sets them as INPUT_ variables. The returned with includes the defaults of
+// the declared inputs and the returned map holds the values for templates.
+func (ws *Workflow) resolveInputs(task schema.Task, with schema.With, taskEnv *schema.Environment) (schema.With, map[string]string, error) {
+	next := schema.With{}
+	for k, v := range with {
+		next[k] = v
+	}
+
+	ws.applyInputs(task, next)
+
+	// the answers were prompted for before the tasks started
+	for k, v := range ws.answers[strings.ToLower(task.Id)] {
+		if value, ok := next.TryGetValue(k); !ok || value == nil {
+			next[k] = v
+		}
+	}
+
+	inputs := map[string]string{}
+	for _, input := range task.Inputs {
+		value, ok, err := input.Resolve(next)
+		if err != nil {
+			return nil, nil, errors.New("task " + task.Id + ": " + err.Error())
+		}
+
+		if !ok {
+			continue
+		}
+
+		if _, found := next.TryGetValue(input.Id); !found {
+			next[input.Id] = value
+		}
+
+		inputs[input.Id] = value
+		envName := "INPUT_" + string(tasks.ScreamingCase([]rune(input.Id)))
+		if input.IsSecret() {
+			taskEnv.SetSecret(envName, value)
+		} else {
+			taskEnv.Set(envName, value)
+		}
+	}
+
+	return next, inputs, nil
+}
+
+// applyInputs sets the inputs given on the command line in the with values
+// of a target task.
+func (ws *Workflow) applyInputs(task schema.Task, with schema.With) {
+	if len(ws.Inputs) == 0 || !ws.isTarget(task) {
+		return
+	}
+
+	for k, v := range ws.Inputs {
+		for key := range with {
+			if strings.EqualFold(key, k) {
+				delete(with, key)
+			}
+		}
+		with[k] = v
+	}
+}
+
+// declaredInputs returns the inputs of the task and of the task definition
+// it uses.
+func (ws *Workflow) declaredInputs(task schema.Task) []schema.Input {
+	declared := append([]schema.Input{}, task.Inputs...)
+	if task.Uses != nil {
+		if taskDef, ok := ws.DynamicTasks[*task.Uses]; ok {
+			declared = append(declared, taskDef.Inputs...)
+		}
+	}
+
+	return declared
+}
+
+// promptInputs prompts for the required inputs of the tasks that have
+// neither a value nor a default before any task starts, so that the
+// prompts are not mixed with the output of running tasks and do not read
+// the stdin of their commands. The answers are applied by resolveInputs.
+func (ws *Workflow) promptInputs(flatTasks []schema.Task) error {
+	ws.answers = map[string]schema.With{}
+	for _, task := range flatTasks {
+		with := schema.With{}
+		for k, v := range task.With {
+			with[k] = v
+		}
+		ws.applyInputs(task, with)
+
+		answers := schema.With{}
+		for _, input := range ws.declaredInputs(task) {
+			if err := ws.promptInput(task, input, with, answers); err != nil {
+				return err
+			}
+		}
+
+		if len(answers) > 0 {
+			ws.answers[strings.ToLower(task.Id)] = answers
+		}
+	}
+
+	return nil
+}
+
+// interactive reports whether missing values can be prompted for.
+func (ws *Workflow) interactive() bool {
+	return !ws.NoInput && prompts.Interactive()
+}
+
+// promptInput prompts for a required input that has neither a value in
+// with nor a default and sets the answer in answers. Nothing is done when
+// prompts are not possible, which leaves the input to fail validation.
+func (ws *Workflow) promptInput(task schema.Task, input schema.Input, with schema.With, answers schema.With) error {
+	if input.Required == nil || !*input.Required || input.Default != nil || !ws.interactive() {
+		return nil
+	}
+
+	if v, ok := with.TryGetValue(input.Id); ok && v != nil {
+		return nil
+	}
+
+	if _, ok := answers.TryGetValue(input.Id); ok {
+		return nil
+	}
+
+	label := input.Id
+	if input.Name != nil && len(*input.Name) > 0 {
+		label = *input.Name
+	}
+	label = task.Id + ": " + label
+	if input.Desc != nil && len(*input.Desc) > 0 {
+		label += " (" + *input.Desc + ")"
+	}
+
+	for {
+		var value string
+		var err error
+		switch {
+		case input.IsSecret():
+			value, err = prompts.Secret(label)
+		case len(input.Selection) > 0 && input.InputType() != schema.InputList:
+			value, err = prompts.Select(label, input.Selection, "")
+		default:
+			value, err = prompts.Text(label, "")
+		}
+
+		if err != nil {
+			return errors.New("task " + task.Id + ": failed to read input '" + input.Id + "': " + err.Error())
+		}
+
+		if value == "" {
+			continue
+		}
+
+		if err := input.Validate(value); err != nil {
+			tasks.WriteLine(os.Stderr, err.Error())
+			continue
+		}
+
+		answers[input.Id] = value
+		return nil
+	}
+}
+
+// confirm asks whether a task with a confirm message should run. Without a
+// terminal the task fails unless --yes was given. Unlike inputs, the
+// confirmation is asked when the task starts, as its message may use the
+// outputs of the tasks it needs.
+func (ws *Workflow) confirm(task schema.Task, message string) (bool, error) {
+	if ws.AssumeYes {
+		return true, nil
+	}
+
+	if !ws.interactive() {
+		return false, errors.New("task " + task.Id + " requires confirmation, use --yes to confirm without a terminal")
+	}
+
+	ok, err := prompts.Confirm(message)
+	if err != nil {
+		return false, errors.New("task " + task.Id + ": failed to read confirmation: " + err.Error())
+	}
+
+	return ok, nil
+}
+
+// resolveValues prompts for the values of the runfile, and of the
+// runfiles it includes, that are declared without a value.
+func (ws *Workflow) resolveValues() error {
+	if err := ws.promptValues("", ws.Values); err != nil {
+		return err
+	}
+
+	seen := map[*include]bool{}
+	for _, key := range ws.Tasks.Keys() {
+		inc, ok := ws.includes[key]
+		if !ok || seen[inc] {
+			continue
+		}
+		seen[inc] = true
+
+		if err := ws.promptValues(inc.namespace+":", inc.values); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (ws *Workflow) promptValues(prefix string, values map[string]interface{}) error {
+	keys := make([]string, 0, len(values))
+	for k, v := range values {
+		if v == nil {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if !ws.interactive() {
+			return errors.New("missing value '" + prefix + k + "', set it in the runfile or run in a terminal to be prompted")
+		}
+
+		for {
+			value, err := prompts.Text(prefix+k, "")
+			if err != nil {
+				return errors.New("failed to read value '" + prefix + k + "': " + err.Error())
+			}
+
+			if value != "" {
+				values[k] = value
+				break
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package workflows
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/frostyeti/mvps/go/run/prompts"
+	"github.com/stretchr/testify/assert"
+)
+
+// answerReader answers the prompts and records whether any task had
+// written to the log by the time an answer was read.
+type answerReader struct {
+	r       io.Reader
+	log     string
+	started bool
+}
+
+func (a *answerReader) Read(p []byte) (int, error) {
+	if _, err := os.Stat(a.log); err == nil {
+		a.started = true
+	}
+
+	return a.r.Read(p)
+}
+
+func TestPromptInputsBeforeTasksStart(t *testing.T) {
+	runfile := `
+tasks:
+  build:
+    run: echo build >> "{dir}/log"
+  deploy:
+    needs: [build]
+    inputs:
+      - id: target
+        required: true
+      - id: region
+        default: eu
+    run: echo "deploy $INPUT_TARGET $INPUT_REGION" >> "{dir}/log"
+`
+
+	tests := []struct {
+		name        string
+		parallelism int
+	}{
+		{name: "sequential", parallelism: 1},
+		{name: "graph", parallelism: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wf, dir := loadWorkflow(t, runfile)
+			wf.Config.Parallelism = tt.parallelism
+			wf.stdout = io.Discard
+			wf.stderr = io.Discard
+
+			answers := &answerReader{r: strings.NewReader("web\n"), log: filepath.Join(dir, "log")}
+			out := &strings.Builder{}
+			defer prompts.Redirect(answers, out)()
+
+			assert.NoError(t, wf.Run([]string{"deploy"}, nil))
+			assert.False(t, answers.started, "prompted after a task started")
+			assert.Equal(t, "deploy: target: ", out.String())
+
+			data, err := os.ReadFile(filepath.Join(dir, "log"))
+			assert.NoError(t, err)
+			assert.Equal(t, "build\ndeploy web eu\n", string(data))
+		})
+	}
+}
+
+func TestPromptInputsSkipsGivenInputs(t *testing.T) {
+	wf, dir := loadWorkflow(t, `
+tasks:
+  deploy:
+    inputs:
+      - id: target
+        required: true
+    run: echo "deploy $INPUT_TARGET" >> "{dir}/log"
+`)
+	wf.stdout = io.Discard
+	wf.Inputs = map[string]string{"TARGET": "db"}
+
+	out := &strings.Builder{}
+	defer prompts.Redirect(strings.NewReader(""), out)()
+
+	assert.NoError(t, wf.Run([]string{"deploy"}, nil))
+	assert.Equal(t, "", out.String())
+
+	data, err := os.ReadFile(filepath.Join(dir, "log"))
+	assert.NoError(t, err)
+	assert.Equal(t, "deploy db\n", string(data))
+}
+
+func TestPromptInputsNoInput(t *testing.T) {
+	wf, dir := loadWorkflow(t, `
+tasks:
+  deploy:
+    inputs:
+      - id: target
+        required: true
+    run: echo "deploy $INPUT_TARGET" >> "{dir}/log"
+`)
+	wf.stdout = io.Discard
+	wf.NoInput = true
+
+	out := &strings.Builder{}
+	defer prompts.Redirect(strings.NewReader("web\n"), out)()
+
+	err := wf.Run([]string{"deploy"}, nil)
+	assert.ErrorContains(t, err, "target")
+	assert.Equal(t, "", out.String())
+	assert.NoFileExists(t, filepath.Join(dir, "log"))
+}
@@ -16,3 +16,23 @@ func (wf *Workflow) List() []schema.Task {
 
 	return tasks
 }
+
+// ListContexts returns the contexts of the workflow, the default context
+// first, merged with the contexts they extend.
+func (wf *Workflow) ListContexts() []schema.Context {
+	if wf == nil {
+		return []schema.Context{}
+	}
+
+	contexts := []schema.Context{}
+	for _, name := range wf.Contexts {
+		context, err := wf.contexts.Resolve(name)
+		if err != nil {
+			continue
+		}
+
+		contexts = append(contexts, *context)
+	}
+
+	return contexts
+}
@@ -8,6 +8,7 @@ import (
 	"os/user"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
 
 	"github.com/frostyeti/mvps/go/dotenv"
@@ -22,10 +23,37 @@ import (
 func (wf *Workflow) Load(runfile schema.Runfile) error {
 
 	wf.Path = runfile.Path
+	if len(runfile.Name) > 0 && wf.Name == nil {
+		name := runfile.Name
+		wf.Name = &name
+	}
+	if wf.Parallel > 0 {
+		wf.Config.Parallelism = wf.Parallel
+	}
+	if wf.Config.Parallelism == 0 {
+		wf.Config.Parallelism = runfile.Config.Parallelism
+	}
+	if wf.Config.Timeout == 0 {
+		wf.Config.Timeout = runfile.Config.Timeout
+	}
+	if len(runfile.Config.Dirs.Projects) > 0 {
+		wf.Config.Dirs.Projects = slices.Clone(runfile.Config.Dirs.Projects)
+	}
+
 	err := wf.LoadEnv(runfile)
 	if err != nil {
 		return err
 	}
+
+	// the values of the context override those of the runfile
+	for _, values := range []map[string]interface{}{wf.context.Values, runfile.Values} {
+		for k, v := range values {
+			if _, ok := wf.Values[k]; !ok {
+				wf.Values[k] = v
+			}
+		}
+	}
+
 	oldDir, err := os.Getwd()
 	if err != nil {
 		return err
@@ -34,80 +62,26 @@ func (wf *Workflow) Load(runfile schema.Runfile) error {
 	rootDir := filepath.Dir(runfile.Path)
 	os.Chdir(rootDir)
 
-	envMap := wf.Env
-	if len(runfile.HostImports.Imports) > 0 {
-		imports := runfile.HostImports.Imports
-		for _, imp := range imports {
-			opts := &env.ExpandOptions{
-				Get: func(key string) string {
-					s, ok := envMap.Get(key)
-					if ok {
-						return s
-					}
-
-					return ""
-				},
-				Set: func(key, value string) error {
-					envMap.Set(key, value)
-					return nil
-				},
-				Keys:                envMap.Keys(),
-				ExpandUnixArgs:      true,
-				ExpandWindowsVars:   false,
-				CommandSubstitution: runfile.Config.Substitution,
-			}
-			next, err := env.ExpandWithOptions(imp, opts)
-			if err != nil {
-				return errors.New("failed to expand hosts import path: " + imp + " error: " + err.Error())
-			}
-
-			next = strings.TrimSpace(next)
-			optional := false
-			if strings.HasSuffix(next, "?") {
-				optional = true
-				next = strings.TrimSuffix(next, "?")
-			}
-
-			if !(filepath.IsAbs(next)) {
-				p, err := filepath.Abs(next)
-				if err != nil {
-					return errors.New("failed to get absolute path of hosts import: " + next + " error: " + err.Error())
-				}
-				next = p
-			}
-
-			if !isFile(next) {
-				if optional {
-					continue
-				} else {
-					return errors.New("required hosts import file does not exist: " + next)
-				}
-			}
-
-			data, err := os.ReadFile(next)
-			if err != nil {
-				return errors.New("failed to read hosts import file: " + next + " error: " + err.Error())
-			}
+	if err := wf.loadHostImports(runfile.HostImports.Imports, runfile.Config.Substitution); err != nil {
+		return err
+	}
 
-			var hostfile schema.RunHostsfile
-			err = hostfile.Decode(data)
-			if err != nil {
-				return errors.New("failed to parse hosts import file: " + next + " error: " + err.Error())
-			}
+	for k, v := range runfile.HostImports.Hosts.Iter() {
+		wf.Hosts.Set(k, &v)
+	}
 
-			for k, v := range hostfile.Hosts.Entries() {
-				wf.Hosts.Set(k, &v)
-			}
-		}
+	if err := wf.loadHostImports(wf.context.Hosts.Imports, runfile.Config.Substitution); err != nil {
+		return err
 	}
 
-	if len(runfile.HostImports.Imports) > 0 {
-		for k, v := range runfile.HostImports.Hosts.Entries() {
-			wf.Hosts.Set(k, &v)
-		}
+	for k, v := range wf.context.Hosts.Hosts.Iter() {
+		wf.Hosts.Set(k, &v)
 	}
 
-	for _, v := range runfile.Tasks.Entries() {
+	envMap := wf.Env
+
+	for _, k := range runfile.Tasks.Keys() {
+		v, _ := runfile.Tasks.Get(k)
 		wf.Tasks.Set(&v)
 
 		run := ""
@@ -126,12 +100,18 @@ func (wf *Workflow) Load(runfile schema.Runfile) error {
 						return errors.New("failed to parse task import URI: " + run + " error: " + err.Error())
 					}
 
-					if uri.Scheme != "file" {
+					if isRemoteSource(run) {
+						local, err := wf.resolveImport(run, "")
+						if err != nil {
+							return errors.New("failed to fetch task import: " + run + " error: " + err.Error())
+						}
+
+						run = local
+					} else if uri.Scheme != "file" {
 						continue
+					} else {
+						run = strings.TrimSpace(uri.Path)
 					}
-
-					r := uri.Path
-					run = strings.TrimSpace(r)
 				}
 
 				opts := &env.ExpandOptions{
@@ -188,11 +168,87 @@ func (wf *Workflow) Load(runfile schema.Runfile) error {
 		}
 	}
 
+	wf.Tasks.ExpandMatrices()
+
+	if err := wf.loadIncludes(runfile, rootDir); err != nil {
+		return err
+	}
+
 	// continue loadding other parts like Hosts, Tasks, etc.
 
 	return nil
 }
 
+// loadHostImports adds the hosts of the hosts files to the workflow. A
+// path that ends with ? is optional.
+func (wf *Workflow) loadHostImports(imports []string, substitution bool) error {
+	envMap := wf.Env
+	for _, imp := range imports {
+		opts := &env.ExpandOptions{
+			Get: func(key string) string {
+				s, ok := envMap.Get(key)
+				if ok {
+					return s
+				}
+
+				return ""
+			},
+			Set: func(key, value string) error {
+				envMap.Set(key, value)
+				return nil
+			},
+			Keys:                envMap.Keys(),
+			ExpandUnixArgs:      true,
+			ExpandWindowsVars:   false,
+			CommandSubstitution: substitution,
+		}
+		next, err := env.ExpandWithOptions(imp, opts)
+		if err != nil {
+			return errors.New("failed to expand hosts import path: " + imp + " error: " + err.Error())
+		}
+
+		next = strings.TrimSpace(next)
+		optional := false
+		if strings.HasSuffix(next, "?") {
+			optional = true
+			next = strings.TrimSuffix(next, "?")
+		}
+
+		if !(filepath.IsAbs(next)) {
+			p, err := filepath.Abs(next)
+			if err != nil {
+				return errors.New("failed to get absolute path of hosts import: " + next + " error: " + err.Error())
+			}
+			next = p
+		}
+
+		if !isFile(next) {
+			if optional {
+				continue
+			} else {
+				return errors.New("required hosts import file does not exist: " + next)
+			}
+		}
+
+		data, err := os.ReadFile(next)
+		if err != nil {
+			return errors.New("failed to read hosts import file: " + next + " error: " + err.Error())
+		}
+
+		var hostfile schema.RunHostsfile
+		err = hostfile.Decode(data)
+		if err != nil {
+			return errors.New("failed to parse hosts import file: " + next + " error: " + err.Error())
+		}
+
+		for k, v := range hostfile.Hosts.Iter() {
+			wf.Hosts.Set(k, &v)
+		}
+	}
+
+	return nil
+}
+
 func (wf *Workflow) LoadEnv(runfile schema.Runfile) error {
 
 	if len(runfile.Path) == 0 {
@@ -224,15 +280,30 @@ func (wf *Workflow) LoadEnv(runfile schema.Runfile) error {
 		wf = NewWorkflow()
 	}
 
+	wf.lockfile = schema.NewLockfile(filepath.Join(rootDir, schema.LockfileName))
+	if err := wf.lockfile.DecodeYAMLFile(wf.lockfile.Path); err != nil {
+		return errors.New("failed to read lockfile: " + wf.lockfile.Path + " error: " + err.Error())
+	}
+
 	for _, k := range runfile.Import.Tasks {
 		if len(k.Path) == 0 {
 			return errors.New("task import path is empty")
 		}
 
+		checksum := ""
+		if k.Checksum != nil {
+			checksum = *k.Checksum
+		}
+
+		local, err := wf.resolveImport(k.Path, checksum)
+		if err != nil {
+			return errors.New("failed to load task import: " + k.Path + " error: " + err.Error())
+		}
+
 		taskDefs := &schema.TaskDefs{
-			Path: k.Path,
+			Path: local,
 		}
-		err := taskDefs.DecodeYAMLFile(k.Path)
+		err = taskDefs.DecodeYAMLFile(local)
 		if err != nil {
 			return errors.New("failed to load task import file: " + k.Path + " error: " + err.Error())
 		}
@@ -242,18 +313,29 @@ func (wf *Workflow) LoadEnv(runfile schema.Runfile) error {
 				return errors.New("task import file: " + k.Path + " has task with empty id")
 			}
 
-			taskDef.Path = k.Path
+			taskDef.Path = local
+			wf.DynamicTasks[taskDef.Id] = taskDef
 			tasks.RegisterDynamicTask(taskDef.Id, taskDef)
 		}
 	}
 
+	// a workflow loaded by another one, such as a project, starts from the
+	// env of that workflow rather than from that of the process, which
+	// every workflow that loads at the same time shares.
 	envMap := schema.NewEnv()
-	for _, n := range os.Environ() {
-		parts := strings.SplitN(n, "=", 2)
-		if len(parts) == 2 {
-			envMap.Set(parts[0], parts[1])
-		} else {
-			envMap.Set(parts[0], "")
+	if wf.baseEnv != nil {
+		envMap = wf.baseEnv.Clone()
+		for key := range includeEnvSkip {
+			envMap.Delete(key)
+		}
+	} else {
+		for _, n := range os.Environ() {
+			parts := strings.SplitN(n, "=", 2)
+			if len(parts) == 2 {
+				envMap.Set(parts[0], parts[1])
+			} else {
+				envMap.Set(parts[0], "")
+			}
 		}
 	}
 
@@ -264,6 +346,9 @@ func (wf *Workflow) LoadEnv(runfile schema.Runfile) error {
 	envMap.Set("RUN_ROOT_FILE", runfile.Path)
 	if wf.parent != nil {
 		wf0 := wf.parent
+		for wf0.parent != nil {
+			wf0 = wf0.parent
+		}
 		if wf0.Path != "" {
 			envMap.Set("RUN_ROOT_FILE", wf0.Path)
 			envMap.Set("RUN_ROOT_DIR", filepath.Dir(wf0.Path))
@@ -274,11 +359,44 @@ func (wf *Workflow) LoadEnv(runfile schema.Runfile) error {
 		wf.ContextName = env.Get("RUN_CONTEXT")
 	}
 
+	contextName := wf.ContextName
+	if contextName == "" {
+		contextName = "default"
+	}
+
+	// included runfiles run with the context of the runfile that includes
+	// them, which they need not declare
+	if wf.parent == nil && len(runfile.Contexts) > 0 && contextName != "default" {
+		if _, ok := runfile.Contexts.Get(contextName); !ok {
+			return errors.New("unknown context '" + contextName + "', the runfile declares: " + strings.Join(runfile.Contexts.Names(), ", "))
+		}
+	}
+
+	context, err := runfile.Contexts.Resolve(contextName)
+	if err != nil {
+		return err
+	}
+	wf.context = context
+	wf.contexts = runfile.Contexts
+
+	for _, name := range runfile.Contexts.Names() {
+		if !slices.Contains(wf.Contexts, name) {
+			wf.Contexts = append(wf.Contexts, name)
+		}
+	}
+
 	defaultShell := "shell"
 	if runfile.Config.Shell != nil && len(*runfile.Config.Shell) > 0 {
 		defaultShell = *runfile.Config.Shell
 	}
 
+	// tasks without uses run with the shell of the context
+	if context.Shell != nil {
+		defaultShell = *context.Shell
+		shell := *context.Shell
+		wf.Config.Shell = &shell
+	}
+
 	envMap.Set("RUN_CONTEXT", wf.ContextName)
 	envMap.Set("RUN_SHELL", defaultShell)
 
@@ -425,8 +543,8 @@ func (wf *Workflow) LoadEnv(runfile schema.Runfile) error {
 		dotenvFiles = append(dotenvFiles, filepath.Join(rootDir, ".env."+wf.ContextName+"?"))
 	}
 
-	if len(runfile.DotEnv) > 0 {
-		for _, f := range runfile.DotEnv {
+	if len(runfile.DotEnv) > 0 || len(context.DotEnv) > 0 {
+		for _, f := range append(append([]string{}, runfile.DotEnv...), context.DotEnv...) {
 			skip := false
 			for _, existing := range dotenvFiles {
 				if existing == f {
@@ -466,7 +584,11 @@ func (wf *Workflow) LoadEnv(runfile schema.Runfile) error {
 			if err != nil {
 				return err
 			}
-			envMap.Set(k, expandedValue)
+			if runfile.Config.Env.IsSecret(k) {
+				envMap.SetSecret(k, expandedValue)
+			} else {
+				envMap.Set(k, expandedValue)
+			}
 
 			hasKey := false
 			for _, key := range opts.Keys {
@@ -599,7 +721,55 @@ func (wf *Workflow) LoadEnv(runfile schema.Runfile) error {
 			if err != nil {
 				return err
 			}
-			envMap.Set(k, expandedValue)
+			if runfile.Env.IsSecret(k) {
+				envMap.SetSecret(k, expandedValue)
+			} else {
+				envMap.Set(k, expandedValue)
+			}
+
+			hasKey := false
+			for _, key := range opts.Keys {
+				if key == k {
+					hasKey = true
+					break
+				}
+			}
+			if !hasKey {
+				opts.Keys = append(opts.Keys, k)
+			}
+		}
+	}
+
+	// the env of the context overrides the env of the runfile
+	if context.Env.Len() > 0 {
+		opts := &env.ExpandOptions{
+			Get: func(key string) string {
+				s, ok := envMap.Get(key)
+				if ok {
+					return s
+				}
+
+				return ""
+			},
+			Set: func(key, value string) error {
+				envMap.Set(key, value)
+				return nil
+			},
+			Keys:                envMap.Keys(),
+			ExpandUnixArgs:      true,
+			ExpandWindowsVars:   false,
+			CommandSubstitution: runfile.Config.Substitution,
+		}
+		for k, v := range context.Env.Iter() {
+			expandedValue, err := env.ExpandWithOptions(v, opts)
+			if err != nil {
+				return err
+			}
+			if context.Env.IsSecret(k) {
+				envMap.SetSecret(k, expandedValue)
+			} else {
+				envMap.Set(k, expandedValue)
+			}
 
 			hasKey := false
 			for _, key := range opts.Keys {
@@ -0,0 +1,66 @@
+package workflows
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/frostyeti/mvps/go/run/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadContext(t *testing.T) {
+	tests := []struct {
+		name     string
+		runfile  string
+		context  string
+		err      string
+		contexts []string
+	}{
+		{
+			name:     "declared",
+			runfile:  "contexts:\n  dev: {}\n  prod: {}\ntasks:\n  a:\n    run: echo a\n",
+			context:  "prod",
+			contexts: []string{"default", "dev", "prod"},
+		},
+		{
+			name:     "default need not be declared",
+			runfile:  "contexts:\n  dev: {}\ntasks:\n  a:\n    run: echo a\n",
+			context:  "default",
+			contexts: []string{"default", "dev"},
+		},
+		{
+			name:     "any context without contexts",
+			runfile:  "tasks:\n  a:\n    run: echo a\n",
+			context:  "nope",
+			contexts: []string{"default"},
+		},
+		{
+			name:    "unknown",
+			runfile: "contexts:\n  dev: {}\n  prod: {}\ntasks:\n  a:\n    run: echo a\n",
+			context: "nope",
+			err:     "unknown context 'nope', the runfile declares: dev, prod",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFile(t, dir, "runfile", tt.runfile)
+
+			rf := schema.NewRunfile()
+			assert.NoError(t, rf.DecodeYAMLFile(filepath.Join(dir, "runfile")))
+
+			wf := NewWorkflow()
+			wf.ContextName = tt.context
+			err := wf.Load(*rf)
+			defer wf.Cleanup()
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.contexts, wf.Contexts)
+		})
+	}
+}
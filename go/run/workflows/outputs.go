@@ -0,0 +1,269 @@
+package workflows
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/Masterminds/sprig"
+	"github.com/frostyeti/mvps/go/run/schema"
+)
+
+var (
+	// templateRef matches template actions that reference the data the
+	// workflow provides. Other actions, such as docker's {{.Names}}, are
+	// left for the task's own tools.
+	templateRef = regexp.MustCompile(`\{\{[^}]*?[\s({-]\.(tasks|env|os|arch|matrix|inputs|values)\b`)
+
+	// outputRef matches references to another task's outputs, either
+	// .tasks.build.outputs or (index .tasks "build").outputs.
+	outputRef = regexp.MustCompile(`\.tasks\.([A-Za-z0-9_]+)\.outputs|index\s+\.tasks\s+"([^"]+)"`)
+)
+
+// setOutputs stores the outputs of a task for the tasks that run after it.
+func (ws *Workflow) setOutputs(id string, outputs map[string]interface{}) {
+	ws.resultsMu.Lock()
+	defer ws.resultsMu.Unlock()
+
+	if ws.outputs == nil {
+		ws.outputs = map[string]map[string]interface{}{}
+	}
+
+	ws.outputs[id] = outputs
+
+	// context specific tasks are needed by their base name.
+	suffix := ":" + ws.ContextName
+	if strings.HasSuffix(id, suffix) {
+		base := strings.TrimSuffix(id, suffix)
+		if _, ok := ws.outputs[base]; !ok {
+			ws.outputs[base] = outputs
+		}
+	}
+}
+
+// templateData returns the data available to if, with, env and run
+// templates of a task.
+func (ws *Workflow) templateData(task schema.Task, taskEnv *schema.Environment) map[string]interface{} {
+	ws.resultsMu.Lock()
+	defer ws.resultsMu.Unlock()
+
+	// every task has outputs, so the outputs of a task that was skipped
+	// render as missing ones do.
+	taskData := map[string]interface{}{}
+	for _, id := range ws.Tasks.Keys() {
+		taskData[id] = map[string]interface{}{
+			"outputs": map[string]string{},
+		}
+	}
+
+	for id, outputs := range ws.outputs {
+		values := map[string]string{}
+		for k, v := range outputs {
+			values[k] = fmt.Sprint(v)
+		}
+
+		taskData[id] = map[string]interface{}{
+			"outputs": values,
+		}
+	}
+
+	matrix := map[string]string{}
+	if task.MatrixValues != nil {
+		matrix = task.MatrixValues.ToMap()
+	}
+
+	values := ws.Values
+	if inc, ok := ws.includes[task.Id]; ok {
+		values = inc.values
+	}
+
+	return map[string]interface{}{
+		"env":    taskEnv.ToMap(),
+		"os":     runtime.GOOS,
+		"arch":   runtime.GOARCH,
+		"tasks":  taskData,
+		"matrix": matrix,
+		"values": values,
+	}
+}
+
+// newTemplate returns a template with the sprig functions. Outputs and env
+// values that do not exist render as empty strings, which default can
+// replace, instead of <no value>.
+func newTemplate(name string) *template.Template {
+	return template.New(name).Funcs(sprig.TxtFuncMap()).Option("missingkey=zero")
+}
+
+// renderTemplate renders text as a template when it references the
+// workflow's template data, otherwise text is returned as is.
+func renderTemplate(name string, text string, data map[string]interface{}) (string, error) {
+	if !templateRef.MatchString(text) {
+		return text, nil
+	}
+
+	tmp, err := newTemplate(name).Parse(text)
+	if err != nil {
+		return "", errors.New("failed to parse template " + name + ": " + err.Error())
+	}
+
+	out := &bytes.Buffer{}
+	if err := tmp.Execute(out, data); err != nil {
+		return "", errors.New("failed to execute template " + name + ": " + err.Error())
+	}
+
+	return out.String(), nil
+}
+
+// renderWith renders the string values of a task's with section, including
+// strings nested in lists and maps.
+func renderWith(name string, with schema.With, data map[string]interface{}) (schema.With, error) {
+	if with == nil {
+		return nil, nil
+	}
+
+	var render func(key string, value interface{}) (interface{}, error)
+	render = func(key string, value interface{}) (interface{}, error) {
+		switch v := value.(type) {
+		case string:
+			return renderTemplate(key, v, data)
+		case []interface{}:
+			next := make([]interface{}, len(v))
+			for i, item := range v {
+				r, err := render(key, item)
+				if err != nil {
+					return nil, err
+				}
+				next[i] = r
+			}
+			return next, nil
+		case map[string]interface{}:
+			next := map[string]interface{}{}
+			for k, item := range v {
+				r, err := render(key+"."+k, item)
+				if err != nil {
+					return nil, err
+				}
+				next[k] = r
+			}
+			return next, nil
+		default:
+			return value, nil
+		}
+	}
+
+	next := schema.With{}
+	for k, v := range with {
+		r, err := render(name+".with."+k, v)
+		if err != nil {
+			return nil, err
+		}
+		next[k] = r
+	}
+
+	return next, nil
+}
+
+// validateOutputReferences returns an error when a task references the
+// outputs of a task that it does not need, directly or indirectly, since
+// those outputs may not exist yet when the task runs.
+func (ws *Workflow) validateOutputReferences(flatTasks []schema.Task, contextName string) error {
+	for _, task := range flatTasks {
+		refs := outputReferences(task)
+		if len(refs) == 0 {
+			continue
+		}
+
+		needs := ws.transitiveNeeds(task, contextName)
+		for _, ref := range refs {
+			if !needs[strings.ToLower(ref)] {
+				return errors.New("task " + task.Id + " references the outputs of task " + ref + " but does not need it")
+			}
+		}
+	}
+
+	return nil
+}
+
+func outputReferences(task schema.Task) []string {
+	texts := []string{}
+	if task.Condition != nil {
+		texts = append(texts, *task.Condition)
+	}
+
+	if task.Run != nil {
+		texts = append(texts, *task.Run)
+	}
+
+	if task.Env != nil {
+		for _, v := range task.Env.Iter() {
+			texts = append(texts, v)
+		}
+	}
+
+	var collect func(value interface{})
+	collect = func(value interface{}) {
+		switch v := value.(type) {
+		case string:
+			texts = append(texts, v)
+		case []interface{}:
+			for _, item := range v {
+				collect(item)
+			}
+		case map[string]interface{}:
+			for _, item := range v {
+				collect(item)
+			}
+		}
+	}
+
+	for _, v := range task.With {
+		collect(v)
+	}
+
+	set := map[string]bool{}
+	for _, text := range texts {
+		for _, match := range outputRef.FindAllStringSubmatch(text, -1) {
+			id := match[1]
+			if id == "" {
+				id = match[2]
+			}
+			set[id] = true
+		}
+	}
+
+	refs := make([]string, 0, len(set))
+	for id := range set {
+		refs = append(refs, id)
+	}
+	sort.Strings(refs)
+
+	return refs
+}
+
+// transitiveNeeds returns the lower cased ids of every task the task needs,
+// directly or indirectly, including both the base and context specific ids.
+func (ws *Workflow) transitiveNeeds(task schema.Task, contextName string) map[string]bool {
+	set := map[string]bool{}
+	stack := append([]string{}, task.Needs...)
+	for len(stack) > 0 {
+		need := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if set[strings.ToLower(need)] {
+			continue
+		}
+
+		set[strings.ToLower(need)] = true
+
+		if next, ok := ws.findNeed(need, contextName); ok {
+			set[strings.ToLower(next.Id)] = true
+			stack = append(stack, next.Needs...)
+		}
+	}
+
+	return set
+}
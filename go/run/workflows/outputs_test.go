@@ -0,0 +1,217 @@
+package workflows
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/frostyeti/mvps/go/run/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutputReferences(t *testing.T) {
+	str := func(s string) *string { return &s }
+	env := schema.NewEnv()
+	env.Set("VERSION", "{{ .tasks.version.outputs.value }}")
+
+	tests := []struct {
+		name string
+		task schema.Task
+		want []string
+	}{
+		{
+			name: "none",
+			task: schema.Task{Run: str(`docker ps --format "{{.Names}}"`)},
+			want: []string{},
+		},
+		{
+			name: "run",
+			task: schema.Task{Run: str("echo {{ .tasks.build.outputs.version }} {{ .tasks.lint.outputs.ok }}")},
+			want: []string{"build", "lint"},
+		},
+		{
+			name: "index",
+			task: schema.Task{Run: str(`echo {{ (index .tasks "build:ci").outputs.version }}`)},
+			want: []string{"build:ci"},
+		},
+		{
+			name: "if",
+			task: schema.Task{Condition: str(`{{ eq .tasks.test.outputs.passed "true" }}`)},
+			want: []string{"test"},
+		},
+		{
+			name: "env",
+			task: schema.Task{Env: env},
+			want: []string{"version"},
+		},
+		{
+			name: "nested with",
+			task: schema.Task{With: schema.With{
+				"args": []interface{}{"--tag", "{{ .tasks.build.outputs.tag }}"},
+				"labels": map[string]interface{}{
+					"commit": "{{ .tasks.git.outputs.sha }}",
+				},
+			}},
+			want: []string{"build", "git"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, outputReferences(tt.task))
+		})
+	}
+}
+
+func TestRenderTemplate(t *testing.T) {
+	data := map[string]interface{}{
+		"env": map[string]string{"HOME": "/home/app"},
+		"tasks": map[string]interface{}{
+			"build": map[string]interface{}{
+				"outputs": map[string]string{"version": "1.2.0"},
+			},
+		},
+	}
+
+	tests := []struct {
+		name string
+		text string
+		want string
+		err  string
+	}{
+		{name: "no reference", text: `docker ps --format "{{.Names}}"`, want: `docker ps --format "{{.Names}}"`},
+		{name: "output", text: "v{{ .tasks.build.outputs.version }}", want: "v1.2.0"},
+		{name: "missing output", text: "[{{ .tasks.build.outputs.tag }}]", want: "[]"},
+		{name: "missing output with default", text: `{{ .tasks.build.outputs.tag | default "latest" }}`, want: "latest"},
+		{name: "output with default", text: `{{ .tasks.build.outputs.version | default "0.0.0" }}`, want: "1.2.0"},
+		{name: "env", text: "{{ .env.HOME }}/bin", want: "/home/app/bin"},
+		{name: "parse error", text: "{{ .env.HOME", err: "failed to parse template build.run"},
+		{name: "execute error", text: "{{ .tasks.test.outputs.ok }}", err: "failed to execute template build.run"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderTemplate("build.run", tt.text, data)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestValidateOutputReferences(t *testing.T) {
+	tests := []struct {
+		name  string
+		tasks string
+		err   string
+	}{
+		{
+			name: "need",
+			tasks: `
+  build:
+    run: echo build
+  deploy:
+    needs: [build]
+    run: echo {{ .tasks.build.outputs.version }}
+`,
+		},
+		{
+			name: "indirect need",
+			tasks: `
+  build:
+    run: echo build
+  test:
+    needs: [build]
+    run: echo test
+  deploy:
+    needs: [test]
+    with:
+      tag: "{{ .tasks.build.outputs.version }}"
+    run: echo deploy
+`,
+		},
+		{
+			name: "need of the context",
+			tasks: `
+  build:ci:
+    run: echo build
+  deploy:
+    needs: [build]
+    run: echo {{ (index .tasks "build:ci").outputs.version }}
+`,
+		},
+		{
+			name: "not needed",
+			tasks: `
+  build:
+    run: echo build
+  deploy:
+    run: echo {{ .tasks.build.outputs.version }}
+`,
+			err: "task deploy references the outputs of task build but does not need it",
+		},
+		{
+			name: "not needed in if",
+			tasks: `
+  build:
+    run: echo build
+  lint:
+    run: echo lint
+  deploy:
+    needs: [lint]
+    if: '{{ eq .tasks.build.outputs.ok "true" }}'
+    run: echo deploy
+`,
+			err: "task deploy references the outputs of task build but does not need it",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wf, _ := loadWorkflow(t, "tasks:"+tt.tasks)
+
+			flatTasks, err := wf.Tasks.FlattenTasks([]string{"deploy"}, "ci")
+			assert.NoError(t, err)
+
+			err = wf.validateOutputReferences(flatTasks, "ci")
+			if tt.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
+
+func TestRunOutputs(t *testing.T) {
+	wf, dir := loadWorkflow(t, `
+tasks:
+  build:
+    run: echo "version=1.2.0" >> "$RUN_OUTPUTS"
+  lint:
+    if: "false"
+    run: echo "ok=true" >> "$RUN_OUTPUTS"
+  deploy:
+    needs: [build, lint]
+    if: '{{ eq .tasks.build.outputs.version "1.2.0" }}'
+    env:
+      VERSION: "{{ .tasks.build.outputs.version }}"
+    run: >-
+      echo "$VERSION [{{ .tasks.build.outputs.tag }}]
+      {{ .tasks.build.outputs.tag | default "latest" }}
+      {{ .tasks.lint.outputs.ok | default "skipped" }}" > "{dir}/deploy"
+`)
+	wf.stdout = io.Discard
+
+	assert.NoError(t, wf.Run([]string{"deploy"}, nil))
+
+	data, err := os.ReadFile(filepath.Join(dir, "deploy"))
+	assert.NoError(t, err)
+	assert.Equal(t, "1.2.0 [] latest skipped\n", string(data))
+}
@@ -0,0 +1,161 @@
+package workflows
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/frostyeti/mvps/go/run/schema"
+	"github.com/frostyeti/mvps/go/run/tasks"
+)
+
+// planEnvSkip are the variables every task gets its own value for, they
+// are left out of the env diff of the plan.
+var planEnvSkip = map[string]bool{
+	"RUN_ENV":     true,
+	"RUN_PATH":    true,
+	"RUN_OUTPUTS": true,
+}
+
+// writePlan writes what a task would do when it ran: the handler, cwd,
+// the result of its if, the hosts it would contact, the env it changes
+// compared to the workflow env and its expanded run. Secrets are masked.
+// An if that uses the outputs of other tasks is shown as unknown, since
+// those tasks do not run in a dry run.
+func (ws *Workflow) writePlan(w io.Writer, task schema.Task, data *tasks.TaskModel, parent *schema.Environment, predicate bool) {
+	for _, key := range data.Env.Secrets() {
+		ws.masker.AddValue(data.Env.GetString(key))
+	}
+
+	b := &strings.Builder{}
+	name := task.Id
+	if task.Name != nil && len(*task.Name) > 0 && *task.Name != task.Id {
+		name = *task.Name + " (" + task.Id + ")"
+	}
+	b.WriteString("\x1b[1m" + name + "\x1b[22m\n")
+
+	handler, ok := tasks.HandlerName(data.Uses)
+	if !ok {
+		handler += " (unknown handler)"
+	}
+	b.WriteString("  uses:  " + handler + "\n")
+	b.WriteString("  cwd:   " + data.Cwd + "\n")
+
+	if task.Service != nil {
+		ready := "once started"
+		if probe := task.Service.Ready; probe != nil {
+			ready = "when " + probe.Kind + " " + probe.Target + " passes"
+		}
+		b.WriteString("  service: ready " + ready + "\n")
+	}
+
+	if task.Condition != nil && len(*task.Condition) > 0 {
+		result := strconv.FormatBool(predicate)
+		if outputRef.MatchString(*task.Condition) {
+			result = "unknown (depends on outputs)"
+		}
+		b.WriteString("  if:    " + result + " (" + ws.masker.Mask(strings.TrimSpace(*task.Condition)) + ")\n")
+	}
+
+	if len(task.Needs) > 0 {
+		b.WriteString("  needs: " + strings.Join(task.Needs, ", ") + "\n")
+	}
+
+	if !data.Hosts.IsEmpty() {
+		b.WriteString("  hosts:\n")
+		for name, entry := range data.Hosts.Iter() {
+			addr := entry.Host
+			if entry.Port != nil && *entry.Port > 0 {
+				addr += ":" + strconv.Itoa(int(*entry.Port))
+			}
+			if entry.User != nil && len(*entry.User) > 0 {
+				addr = *entry.User + "@" + addr
+			}
+
+			b.WriteString("    " + name + " (" + addr + ")\n")
+		}
+	}
+
+	diff := planEnvDiff(parent, &data.Env)
+	if len(diff) > 0 {
+		b.WriteString("  env:\n")
+		for _, line := range diff {
+			b.WriteString("    " + ws.masker.Mask(line) + "\n")
+		}
+	}
+
+	if len(data.With) > 0 {
+		keys := make([]string, 0, len(data.With))
+		for k := range data.With {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		b.WriteString("  with:\n")
+		for _, k := range keys {
+			b.WriteString("    " + k + ": " + ws.masker.Mask(planValue(data.With[k])) + "\n")
+		}
+	}
+
+	if run := strings.TrimRight(data.Run, "\r\n\t "); len(run) > 0 {
+		b.WriteString("  run:\n")
+		for _, line := range strings.Split(ws.masker.Mask(run), "\n") {
+			b.WriteString("    " + line + "\n")
+		}
+	}
+
+	tasks.WriteLine(w, strings.TrimRight(b.String(), "\n"))
+}
+
+// planEnvDiff returns the variables of env that were added (+), changed
+// (~) or removed (-) compared to parent. The values of secrets are
+// replaced with ****.
+func planEnvDiff(parent *schema.Environment, env *schema.Environment) []string {
+	value := func(key string, v string) string {
+		if env.IsSecret(key) || parent.IsSecret(key) {
+			return "****"
+		}
+		return v
+	}
+
+	lines := []string{}
+	for _, key := range env.Keys() {
+		if planEnvSkip[key] {
+			continue
+		}
+
+		v := env.GetString(key)
+		old, ok := parent.Get(key)
+		if !ok {
+			lines = append(lines, "+ "+key+"="+value(key, v))
+		} else if old != v {
+			lines = append(lines, "~ "+key+"="+value(key, v))
+		}
+	}
+
+	for _, key := range parent.Keys() {
+		if !planEnvSkip[key] && !env.Has(key) {
+			lines = append(lines, "- "+key)
+		}
+	}
+
+	return lines
+}
+
+func planValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(data)
+	}
+}
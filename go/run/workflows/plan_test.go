@@ -0,0 +1,55 @@
+package workflows
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/frostyeti/mvps/go/run/schema"
+	"github.com/frostyeti/mvps/go/run/tasks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWritePlan(t *testing.T) {
+	str := func(s string) *string { return &s }
+
+	tests := []struct {
+		name      string
+		condition string
+		predicate bool
+		want      string
+	}{
+		{name: "if", condition: "{{ eq .os \"linux\" }}", predicate: true, want: "if:    true ({{ eq .os \"linux\" }})"},
+		{name: "if with outputs", condition: "{{ .tasks.build.outputs.ok }}", want: "if:    unknown (depends on outputs) ({{ .tasks.build.outputs.ok }})"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := NewWorkflow()
+			parent := schema.NewEnv()
+			env := schema.NewEnv()
+			env.SetSecret("TOKEN", "hunter2")
+			env.Set("MODE", "fast")
+
+			task := schema.Task{Id: "deploy", Condition: str(tt.condition)}
+			data := &tasks.TaskModel{
+				Id:   "deploy",
+				Uses: "bash",
+				Cwd:  "/src",
+				Env:  *env,
+				Run:  "deploy --token hunter2",
+				With: schema.With{"token": "hunter2"},
+			}
+
+			out := &bytes.Buffer{}
+			ws.writePlan(out, task, data, parent, tt.predicate)
+			plan := out.String()
+
+			assert.Contains(t, plan, tt.want)
+			assert.Contains(t, plan, "+ TOKEN=****")
+			assert.Contains(t, plan, "+ MODE=fast")
+			assert.Contains(t, plan, "token: ****")
+			assert.Contains(t, plan, "deploy --token ****")
+			assert.NotContains(t, plan, "hunter2")
+		})
+	}
+}
@@ -0,0 +1,342 @@
+package workflows
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/frostyeti/mvps/go/run/schema"
+	"github.com/frostyeti/mvps/go/run/tasks"
+	"github.com/frostyeti/mvps/go/run/tasks/statuses"
+)
+
+// Project is a directory of config.dirs.projects with its own runfile.
+type Project struct {
+	Name    string
+	Dir     string
+	Runfile string
+}
+
+// ProjectResult is the outcome of the targets in a single project. Status
+// is one of the statuses, a project without the targets is skipped.
+type ProjectResult struct {
+	Project   Project
+	Status    int
+	Message   string
+	Err       error
+	StartedAt time.Time
+	EndedAt   time.Time
+}
+
+// Duration returns how long the targets ran in the project.
+func (r ProjectResult) Duration() time.Duration {
+	if r.StartedAt.IsZero() || r.EndedAt.IsZero() {
+		return 0
+	}
+
+	return r.EndedAt.Sub(r.StartedAt)
+}
+
+// Projects returns the projects under config.dirs.projects in the order
+// they are found. An entry that holds a runfile is a project, otherwise,
+// or when it ends with *, each of its directories with a runfile is. The
+// runfile of the context, e.g. apps/api/prod/runfile, is preferred.
+func (ws *Workflow) Projects() ([]Project, error) {
+	runDir, ok := ws.Env.Get("RUN_DIR")
+	if !ok {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		runDir = cwd
+	}
+
+	contextName := ws.ContextName
+	if contextName == "" {
+		contextName = "default"
+	}
+
+	projects := []Project{}
+	seen := map[string]bool{}
+	add := func(dir string) {
+		runfile := projectRunfile(dir, contextName)
+		if runfile == "" || seen[runfile] {
+			return
+		}
+
+		// the runfile of the workflow is not one of its projects
+		if ws.Path != "" && filepath.Clean(ws.Path) == runfile {
+			return
+		}
+
+		seen[runfile] = true
+		projects = append(projects, Project{
+			Name:    filepath.Base(dir),
+			Dir:     dir,
+			Runfile: runfile,
+		})
+	}
+
+	for _, entry := range ws.Config.Dirs.Projects {
+		entry = strings.TrimSpace(entry)
+		children := strings.HasSuffix(entry, "*")
+		dir := strings.TrimSpace(strings.TrimRight(entry, "*"))
+		if len(dir) == 0 {
+			continue
+		}
+
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(runDir, dir)
+		}
+		dir = filepath.Clean(dir)
+
+		if !children && projectRunfile(dir, contextName) != "" {
+			add(dir)
+			continue
+		}
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			return nil, errors.New("failed to read projects dir " + dir + ": " + err.Error())
+		}
+
+		for _, e := range entries {
+			if e.IsDir() {
+				add(filepath.Join(dir, e.Name()))
+			}
+		}
+	}
+
+	return projects, nil
+}
+
+// RunEach runs the targets with their before and after hooks in every
+// project, up to ProjectParallelism projects at once. The projects load
+// their env from that of the workflow. The output of each
+// project is prefixed with its name when more than one runs at once, and
+// projects then run without prompting for inputs.
+//
+// After a project fails, no other project is started unless KeepGoing is
+// set, and with FailFast the projects that are running are cancelled. The
+// results are returned in the order of the projects along with an error
+// that names the projects that failed.
+func (ws *Workflow) RunEach(targets []string, args []string) ([]ProjectResult, error) {
+	if ws.FailFast && ws.KeepGoing {
+		return nil, errors.New("--fail-fast and --keep-going cannot be used together")
+	}
+
+	projects, err := ws.Projects()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(projects) == 0 {
+		return nil, errors.New("no projects found in " + strings.Join(ws.Config.Dirs.Projects, ", "))
+	}
+
+	contextName := ws.ContextName
+	if contextName == "" {
+		contextName = "default"
+	}
+
+	parent := ws.Context
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	limit := ws.ProjectParallelism
+	if limit < 1 {
+		limit = 1
+	}
+
+	// Load changes the working directory, so every project is loaded
+	// before any of them runs.
+	results := make([]ProjectResult, len(projects))
+	runs := make([]*Workflow, len(projects))
+	lifecycles := make([][]string, len(projects))
+	failed := false
+	pending := 0
+	for i, project := range projects {
+		results[i] = ProjectResult{Project: project, Status: statuses.None}
+
+		wf, err := ws.loadProject(project, contextName, ctx)
+		if err != nil {
+			results[i].Status = statuses.Error
+			results[i].Err = err
+			failed = true
+			continue
+		}
+
+		ids := []string{}
+		for _, target := range targets {
+			lifecycle, found := wf.lifecycleTargets(target, contextName)
+			if found {
+				ids = append(ids, lifecycle...)
+			}
+		}
+
+		if len(ids) == 0 {
+			wf.Cleanup()
+			results[i].Status = statuses.Skipped
+			results[i].Message = "no " + strings.Join(targets, ", ") + " task"
+			continue
+		}
+
+		runs[i] = wf
+		lifecycles[i] = ids
+		pending++
+	}
+
+	prefix := limit > 1 && pending > 1
+	if prefix {
+		limit = min(limit, pending)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, limit)
+	stopped := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return (failed && !ws.KeepGoing) || ctx.Err() != nil
+	}
+
+	for i, wf := range runs {
+		if wf == nil {
+			continue
+		}
+
+		sem <- struct{}{}
+		if stopped() {
+			<-sem
+			wf.Cleanup()
+			results[i].Status = statuses.Cancelled
+			results[i].Message = "not started"
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, wf *Workflow) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			project := projects[i]
+			var stdout, stderr *tasks.PrefixWriter
+			if prefix {
+				stdout = tasks.NewPrefixWriter(ws.out(), "["+project.Name+"] ")
+				stderr = tasks.NewPrefixWriter(ws.errOut(), "["+project.Name+"] ")
+				wf.stdout = stdout
+				wf.stderr = stderr
+				wf.NoInput = true
+			}
+
+			rel, err := filepath.Rel(ws.Env.GetString("RUN_DIR"), project.Runfile)
+			if err != nil || strings.HasPrefix(rel, "..") {
+				rel = project.Runfile
+			}
+
+			tasks.WriteLine(ws.out(), "\x1b[2m"+strings.Join(targets, ", ")+" in "+project.Name+" ("+rel+")\x1b[22m")
+			results[i].StartedAt = time.Now().UTC()
+			err = wf.Run(lifecycles[i], args)
+			results[i].EndedAt = time.Now().UTC()
+			if stdout != nil {
+				stdout.Flush()
+				stderr.Flush()
+			}
+
+			if err == nil {
+				results[i].Status = statuses.Ok
+				return
+			}
+
+			results[i].Err = err
+			results[i].Status = statuses.Error
+			if ctx.Err() != nil {
+				results[i].Status = statuses.Cancelled
+			}
+
+			mu.Lock()
+			failed = true
+			mu.Unlock()
+			if ws.FailFast {
+				cancel()
+			}
+		}(i, wf)
+	}
+
+	wg.Wait()
+
+	names := []string{}
+	for _, result := range results {
+		if result.Status == statuses.Error {
+			names = append(names, result.Project.Name)
+		}
+	}
+
+	if err := parent.Err(); err != nil {
+		return results, cancelledError(parent, ws.Config.Timeout)
+	}
+
+	if len(names) > 0 {
+		return results, errors.New(strconv.Itoa(len(names)) + " of " + strconv.Itoa(len(projects)) + " projects failed: " + strings.Join(names, ", "))
+	}
+
+	return results, nil
+}
+
+// loadProject loads the runfile of the project into a workflow with the
+// options of ws.
+func (ws *Workflow) loadProject(project Project, contextName string, ctx context.Context) (*Workflow, error) {
+	rf := schema.NewRunfile()
+	err := rf.DecodeYAMLFile(project.Runfile)
+	rf.Path = project.Runfile
+	if err != nil {
+		return nil, errors.New("failed to read runfile: " + project.Runfile + " " + err.Error())
+	}
+
+	wf := NewWorkflow()
+	wf.ContextName = contextName
+	wf.Context = ctx
+	wf.Force = ws.Force
+	wf.Inputs = ws.Inputs
+	wf.NoInput = ws.NoInput
+	wf.AssumeYes = ws.AssumeYes
+	wf.DryRun = ws.DryRun
+	wf.Affected = ws.Affected
+	wf.Since = ws.Since
+	wf.Parallel = ws.Parallel
+	wf.projectDir = project.Dir
+	wf.baseEnv = ws.Env
+	if err := wf.Load(*rf); err != nil {
+		return nil, errors.New("failed to load runfile: " + project.Runfile + " " + err.Error())
+	}
+
+	return wf, nil
+}
+
+// projectRunfile returns the runfile of the project in dir, the runfile of
+// the context first, or an empty string when there is none.
+func projectRunfile(dir string, contextName string) string {
+	try := filepath.Join(dir, contextName, "runfile")
+	if isFile(try) {
+		return try
+	}
+
+	try = filepath.Join(dir, "runfile")
+	if isFile(try) {
+		return try
+	}
+
+	return ""
+}
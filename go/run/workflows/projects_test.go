@@ -0,0 +1,143 @@
+package workflows
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/frostyeti/mvps/go/run/tasks/statuses"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunEachEnv(t *testing.T) {
+	wf, dir, err := loadFiles(t, map[string]string{
+		"runfile": `
+env:
+  ROOT_VAR: root
+config:
+  dirs:
+    projects: [apps/*]
+`,
+		"apps/a/runfile": `
+tasks:
+  build:
+    run: echo "$ROOT_VAR ${PROJECT_VAR:-none} $RUN_DIR" > "{dir}/log-a"
+`,
+		"apps/b/runfile": `
+env:
+  PROJECT_VAR: b
+tasks:
+  build:
+    run: echo "$ROOT_VAR ${PROJECT_VAR:-none} $RUN_DIR" > "{dir}/log-b"
+`,
+	})
+	assert.NoError(t, err)
+	wf.stdout = io.Discard
+	wf.stderr = io.Discard
+	wf.ProjectParallelism = 2
+
+	results, err := wf.RunEach([]string{"build"}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+
+	// the projects see the env of the workflow, not each other's, and the
+	// env of the process is left alone
+	for name, want := range map[string]string{"a": "root none", "b": "root b"} {
+		data, err := os.ReadFile(filepath.Join(dir, "log-"+name))
+		assert.NoError(t, err)
+		assert.Equal(t, want+" "+filepath.Join(dir, "apps", name)+"\n", string(data))
+	}
+
+	_, ok := os.LookupEnv("ROOT_VAR")
+	assert.False(t, ok)
+}
+
+func TestRunEachFailures(t *testing.T) {
+	files := map[string]string{
+		"runfile": `
+config:
+  dirs:
+    projects: [apps/*]
+`,
+		"apps/a/runfile": "tasks:\n  test:\n    run: exit 1\n",
+		"apps/b/runfile": "tasks:\n  test:\n    run: sleep 10\n",
+		"apps/c/runfile": "tasks:\n  test:\n    run: sleep 10\n",
+		"apps/d/runfile": "tasks:\n  lint:\n    run: echo lint\n",
+	}
+
+	fast := map[string]string{
+		"runfile":        files["runfile"],
+		"apps/a/runfile": files["apps/a/runfile"],
+		"apps/b/runfile": "tasks:\n  test:\n    run: echo b\n",
+		"apps/c/runfile": "tasks:\n  test:\n    run: echo c\n",
+	}
+
+	tests := []struct {
+		name      string
+		files     map[string]string
+		parallel  int
+		failFast  bool
+		keepGoing bool
+		want      []int
+		err       string
+	}{
+		{
+			name:  "stop starting projects",
+			files: fast,
+			want:  []int{statuses.Error, statuses.Cancelled, statuses.Cancelled},
+			err:   "1 of 3 projects failed: a",
+		},
+		{
+			name:      "keep going",
+			files:     fast,
+			keepGoing: true,
+			want:      []int{statuses.Error, statuses.Ok, statuses.Ok},
+			err:       "1 of 3 projects failed: a",
+		},
+		{
+			name:     "fail fast",
+			files:    files,
+			parallel: 4,
+			failFast: true,
+			want:     []int{statuses.Error, statuses.Cancelled, statuses.Cancelled, statuses.Skipped},
+			err:      "1 of 4 projects failed: a",
+		},
+		{
+			name:      "fail fast and keep going",
+			files:     fast,
+			failFast:  true,
+			keepGoing: true,
+			err:       "--fail-fast and --keep-going cannot be used together",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wf, _, err := loadFiles(t, tt.files)
+			assert.NoError(t, err)
+			wf.stdout = io.Discard
+			wf.stderr = io.Discard
+			wf.ProjectParallelism = tt.parallel
+			wf.FailFast = tt.failFast
+			wf.KeepGoing = tt.keepGoing
+
+			start := time.Now()
+			results, err := wf.RunEach([]string{"test"}, nil)
+			assert.EqualError(t, err, tt.err)
+			assert.Less(t, time.Since(start), 8*time.Second)
+
+			got := []int{}
+			for _, result := range results {
+				got = append(got, result.Status)
+			}
+			if tt.want == nil {
+				assert.Empty(t, got)
+				return
+			}
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,492 @@
+package workflows
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/frostyeti/mvps/go/crypto/hashes"
+	"github.com/frostyeti/mvps/go/env"
+	"github.com/frostyeti/mvps/go/exec"
+	"github.com/frostyeti/mvps/go/run/paths"
+	"github.com/frostyeti/mvps/go/run/schema"
+)
+
+// remoteSource is a task import that is downloaded over https or cloned
+// with git. Git sources use the form git+https://host/repo.git#ref:path
+// where both the ref and the path within the repository are optional.
+type remoteSource struct {
+	source string
+	url    string
+	git    bool
+	ref    string
+	path   string
+}
+
+// isRemoteSource reports whether the import source must be fetched.
+func isRemoteSource(source string) bool {
+	return strings.HasPrefix(source, "https://") || strings.HasPrefix(source, "git+https://")
+}
+
+func parseRemoteSource(source string) (*remoteSource, error) {
+	src := &remoteSource{source: source}
+	if strings.HasPrefix(source, "git+") {
+		src.git = true
+		rest := strings.TrimPrefix(source, "git+")
+		fragment := ""
+		if i := strings.Index(rest, "#"); i >= 0 {
+			fragment = rest[i+1:]
+			rest = rest[:i]
+		}
+
+		src.url = rest
+		if i := strings.Index(fragment, ":"); i >= 0 {
+			src.ref = fragment[:i]
+			p, err := checkoutPath(fragment[i+1:])
+			if err != nil {
+				return nil, errors.New(err.Error() + ": " + source)
+			}
+			src.path = p
+		} else {
+			src.ref = fragment
+		}
+	} else {
+		src.url = source
+	}
+
+	uri, err := url.Parse(src.url)
+	if err != nil {
+		return nil, errors.New("failed to parse import source: " + source + " error: " + err.Error())
+	}
+
+	if uri.Scheme != "https" || uri.Host == "" {
+		return nil, errors.New("unsupported import source: " + source)
+	}
+
+	if base := path.Base(uri.Path); !src.git && (base == "." || base == "/" || base == ".." || strings.HasSuffix(uri.Path, "/")) {
+		return nil, errors.New("import source has no file name: " + source)
+	}
+
+	return src, nil
+}
+
+// checkoutPath cleans the path of a git source. The path must be relative
+// and stay within the checkout, "." is returned as an empty path.
+func checkoutPath(p string) (string, error) {
+	p = strings.ReplaceAll(p, "\\", "/")
+	if path.IsAbs(p) || filepath.IsAbs(p) || filepath.VolumeName(p) != "" {
+		return "", errors.New("import source path must be relative")
+	}
+
+	p = path.Clean(p)
+	if p == ".." || strings.HasPrefix(p, "../") {
+		return "", errors.New("import source path is outside of the repository")
+	}
+
+	if p == "." {
+		return "", nil
+	}
+
+	return p, nil
+}
+
+// fetchSource downloads or clones a remote import into the cache under
+// RUN_CACHE_HOME and returns the local path of the task file. When checksum
+// is not empty the content must match it. Cached content is only reused
+// when it matches the checksum and refresh is false, so a source without a
+// checksum is fetched again on every load.
+func fetchSource(ctx context.Context, source string, checksum string, refresh bool) (string, error) {
+	src, err := parseRemoteSource(source)
+	if err != nil {
+		return "", err
+	}
+
+	cacheHome, err := paths.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	h := hashes.SHA256.HashNew()()
+	h.Write([]byte(source))
+	dir := filepath.Join(cacheHome, "imports", hex.EncodeToString(h.Sum(nil))[:16])
+
+	local := ""
+	if src.git {
+		local = filepath.Join(dir, "repo", filepath.FromSlash(src.path))
+	} else {
+		uri, _ := url.Parse(src.url)
+		local = filepath.Join(dir, path.Base(uri.Path))
+	}
+
+	if !refresh && checksum != "" && (isFile(local) || isDir(local)) {
+		if err := verifyChecksum(local, checksum); err == nil {
+			return local, nil
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	if src.git {
+		err = cloneSource(ctx, src, filepath.Join(dir, "repo"))
+	} else {
+		err = downloadSource(ctx, src, local)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if !isFile(local) && !isDir(local) {
+		return "", errors.New("import source does not contain " + src.path + ": " + source)
+	}
+
+	if checksum != "" {
+		if err := verifyChecksum(local, checksum); err != nil {
+			return "", errors.New("failed to verify import source: " + source + " error: " + err.Error())
+		}
+	}
+
+	return local, nil
+}
+
+func downloadSource(ctx context.Context, src *remoteSource, dest string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src.url, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.New("failed to download import source: " + src.source + " error: " + err.Error())
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return errors.New("failed to download import source: " + src.source + " status: " + res.Status)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(dest), ".download-")
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(f, res.Body)
+	f.Close()
+	if err != nil {
+		os.Remove(f.Name())
+		return errors.New("failed to download import source: " + src.source + " error: " + err.Error())
+	}
+
+	return os.Rename(f.Name(), dest)
+}
+
+// cloneSource fetches only the requested ref of the repository, which works
+// for branches, tags and commit hashes alike.
+func cloneSource(ctx context.Context, src *remoteSource, dest string) error {
+	if err := os.RemoveAll(dest); err != nil {
+		return err
+	}
+
+	ref := src.ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+
+	commands := [][]string{
+		{"init", "-q", dest},
+		{"-C", dest, "fetch", "-q", "--depth", "1", src.url, ref},
+		{"-C", dest, "checkout", "-q", "FETCH_HEAD"},
+	}
+
+	for _, args := range commands {
+		out := &bytes.Buffer{}
+		cmd := exec.NewContext(ctx, "git", args...)
+		cmd.WithStdout(out)
+		cmd.WithStderr(out)
+		cmd.DisableLogger()
+		if _, err := cmd.Run(); err != nil {
+			return errors.New("failed to clone import source: " + src.source + " error: " + err.Error() + "\n" + strings.TrimSpace(out.String()))
+		}
+	}
+
+	return nil
+}
+
+// importFile returns the task file for a local import path, which is the
+// path itself or the tasks.yaml file of a directory.
+func importFile(local string) string {
+	if isDir(local) {
+		return filepath.Join(local, "tasks.yaml")
+	}
+
+	return local
+}
+
+// digest returns the checksum of the import in the form algorithm:hex. The
+// checksum of a directory covers every file of its tree, as the tasks it
+// defines may run the scripts next to them, but not the .git directory.
+func digest(local string, hashType hashes.HashType) (string, error) {
+	h := hashType.HashNew()()
+	if !isDir(local) {
+		data, err := os.ReadFile(local)
+		if err != nil {
+			return "", err
+		}
+
+		h.Write(data)
+		return strings.ToLower(hashType.String()) + ":" + hex.EncodeToString(h.Sum(nil)), nil
+	}
+
+	if !isFile(importFile(local)) {
+		return "", errors.New("import directory has no tasks.yaml: " + local)
+	}
+
+	// each entry is hashed as its path, its kind, its length and its
+	// content, so that moving bytes between files changes the digest.
+	err := filepath.WalkDir(local, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		rel, err := filepath.Rel(local, p)
+		if err != nil {
+			return err
+		}
+
+		kind := "file"
+		var data []byte
+		if d.Type()&fs.ModeSymlink != 0 {
+			kind = "link"
+			target, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			data = []byte(filepath.ToSlash(target))
+		} else {
+			data, err = os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+		}
+
+		h.Write([]byte(filepath.ToSlash(rel) + "\x00" + kind + "\x00" + strconv.Itoa(len(data)) + "\x00"))
+		h.Write(data)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return strings.ToLower(hashType.String()) + ":" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// verifyChecksum compares the import against a sha256 or sha512 checksum.
+// The algorithm prefix may be omitted, in which case it is inferred from the
+// length of the digest.
+func verifyChecksum(local string, checksum string) error {
+	algorithm, expected, found := strings.Cut(strings.TrimSpace(checksum), ":")
+	if !found {
+		expected = algorithm
+		algorithm = ""
+	}
+
+	expected = strings.ToLower(expected)
+	hashType := hashes.Unknown
+	switch strings.ToLower(algorithm) {
+	case "sha256":
+		hashType = hashes.SHA256
+	case "sha512":
+		hashType = hashes.SHA512
+	case "":
+		switch len(expected) {
+		case hex.EncodedLen(hashes.SHA256.Size()):
+			hashType = hashes.SHA256
+		case hex.EncodedLen(hashes.SHA512.Size()):
+			hashType = hashes.SHA512
+		}
+	}
+
+	if hashType == hashes.Unknown {
+		return errors.New("unsupported checksum: " + checksum)
+	}
+
+	actual, err := digest(local, hashType)
+	if err != nil {
+		return err
+	}
+
+	_, actual, _ = strings.Cut(actual, ":")
+	if actual != expected {
+		return errors.New("checksum mismatch, expected " + expected + " but got " + actual)
+	}
+
+	return nil
+}
+
+// resolveImport returns the local path of a task import. Remote sources are
+// fetched and checked against the declared checksum, or the checksum pinned
+// in the lockfile when none is declared.
+func (wf *Workflow) resolveImport(source string, checksum string) (string, error) {
+	if !isRemoteSource(source) {
+		if checksum != "" {
+			if err := verifyChecksum(source, checksum); err != nil {
+				return "", err
+			}
+		}
+
+		return source, nil
+	}
+
+	// included runfiles are pinned in their own lockfile or in the
+	// lockfile of a runfile that includes them.
+	for p := wf; p != nil && checksum == ""; p = p.parent {
+		if p.lockfile != nil {
+			checksum, _ = p.lockfile.Get(source)
+		}
+	}
+
+	ctx := wf.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	return fetchSource(ctx, source, checksum, false)
+}
+
+// remoteTaskRef returns the source of a task whose run field references a
+// remote .run.yaml file.
+func remoteTaskRef(task schema.Task) (string, bool) {
+	if task.Run == nil {
+		return "", false
+	}
+
+	run := strings.TrimSpace(*task.Run)
+	if strings.ContainsAny(run, "\n\r") || !(strings.HasSuffix(run, ".run.yaml") || strings.HasSuffix(run, ".run.yml")) {
+		return "", false
+	}
+
+	return run, isRemoteSource(run)
+}
+
+// LockImports fetches every remote import of the runfile and of the
+// runfiles it includes, ignoring cached content, and pins their sha256
+// digests in the lockfile next to the runfile. Declared checksums are still
+// verified.
+func LockImports(ctx context.Context, runfile schema.Runfile) (*schema.Lockfile, error) {
+	runfilePath, err := filepath.Abs(runfile.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	runfile.Path = runfilePath
+	lockfile := schema.NewLockfile(filepath.Join(filepath.Dir(runfilePath), schema.LockfileName))
+
+	sources := []string{}
+	checksums := map[string]string{}
+	if err := collectRemoteSources(runfile, map[string]bool{}, &sources, checksums); err != nil {
+		return nil, err
+	}
+
+	for _, source := range sources {
+		local, err := fetchSource(ctx, source, checksums[source], true)
+		if err != nil {
+			return nil, err
+		}
+
+		sum, err := digest(local, hashes.SHA256)
+		if err != nil {
+			return nil, err
+		}
+
+		lockfile.Set(source, sum)
+	}
+
+	if err := lockfile.WriteFile(); err != nil {
+		return nil, err
+	}
+
+	return lockfile, nil
+}
+
+// collectRemoteSources adds the remote task imports and remote task runs of
+// the runfile and of the runfiles it includes to sources. Include paths are
+// expanded with the environment of the process.
+func collectRemoteSources(runfile schema.Runfile, seen map[string]bool, sources *[]string, checksums map[string]string) error {
+	if seen[runfile.Path] {
+		return nil
+	}
+	seen[runfile.Path] = true
+
+	add := func(source string) {
+		for _, s := range *sources {
+			if s == source {
+				return
+			}
+		}
+		*sources = append(*sources, source)
+	}
+
+	for _, imp := range runfile.Import.Tasks {
+		if !isRemoteSource(imp.Path) {
+			continue
+		}
+
+		add(imp.Path)
+		if imp.Checksum != nil {
+			checksums[imp.Path] = *imp.Checksum
+		}
+	}
+
+	for _, task := range runfile.Tasks.Entries() {
+		if source, ok := remoteTaskRef(task); ok {
+			add(source)
+		}
+	}
+
+	rootDir := filepath.Dir(runfile.Path)
+	for _, inc := range runfile.Includes {
+		next, err := includeFile(inc.Path, rootDir, &env.ExpandOptions{
+			Set:            func(key, value string) error { return nil },
+			ExpandUnixArgs: true,
+		})
+		if err != nil {
+			return err
+		}
+
+		if next == "" {
+			continue
+		}
+
+		rf := schema.NewRunfile()
+		if err := rf.DecodeYAMLFile(next); err != nil {
+			return errors.New("failed to parse included runfile: " + next + " error: " + err.Error())
+		}
+		rf.Path = next
+
+		if err := collectRemoteSources(*rf, seen, sources, checksums); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
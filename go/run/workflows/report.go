@@ -0,0 +1,326 @@
+package workflows
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/frostyeti/mvps/go/run/tasks"
+	"github.com/frostyeti/mvps/go/run/tasks/statuses"
+	"github.com/frostyeti/mvps/go/secrets"
+)
+
+// Report is the outcome of a workflow run, written by run --report.
+type Report struct {
+	Name      string       `json:"name"`
+	Path      string       `json:"path"`
+	Context   string       `json:"context"`
+	Status    string       `json:"status"`
+	Error     string       `json:"error,omitempty"`
+	StartedAt time.Time    `json:"startedAt"`
+	EndedAt   time.Time    `json:"endedAt"`
+	Duration  float64      `json:"duration"`
+	Tasks     []ReportTask `json:"tasks"`
+}
+
+// ReportTask is the outcome of a single task or step. Durations are in seconds.
+type ReportTask struct {
+	Id        string                 `json:"id"`
+	Name      string                 `json:"name"`
+	Status    string                 `json:"status"`
+	Message   string                 `json:"message,omitempty"`
+	Error     string                 `json:"error,omitempty"`
+	StartedAt time.Time              `json:"startedAt"`
+	EndedAt   time.Time              `json:"endedAt"`
+	Duration  float64                `json:"duration"`
+	ExitCode  int                    `json:"exitCode,omitempty"`
+	Output    map[string]interface{} `json:"output,omitempty"`
+	Attempts  []ReportAttempt        `json:"attempts,omitempty"`
+	Hosts     []ReportHost           `json:"hosts,omitempty"`
+	Steps     []ReportTask           `json:"steps,omitempty"`
+}
+
+// ReportAttempt is the outcome of a single attempt of a retried task or step.
+type ReportAttempt struct {
+	Attempt   int       `json:"attempt"`
+	Status    string    `json:"status"`
+	ExitCode  int       `json:"exitCode,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	StartedAt time.Time `json:"startedAt"`
+	EndedAt   time.Time `json:"endedAt"`
+	Duration  float64   `json:"duration"`
+}
+
+// ReportHost is the outcome of a task on a single host.
+type ReportHost struct {
+	Host      string    `json:"host"`
+	Status    string    `json:"status"`
+	Message   string    `json:"message,omitempty"`
+	ExitCode  int       `json:"exitCode,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	StartedAt time.Time `json:"startedAt"`
+	EndedAt   time.Time `json:"endedAt"`
+	Duration  float64   `json:"duration"`
+}
+
+// Report builds a report from the results of the last call to Run. runErr
+// is the error Run returned, if any. The secrets of the run are masked in
+// every message, error and output of the report.
+func (ws *Workflow) Report(runErr error) *Report {
+	report := &Report{
+		Path:      ws.Path,
+		Context:   ws.ContextName,
+		Status:    statuses.Name(statuses.Ok),
+		StartedAt: ws.startedAt,
+		EndedAt:   ws.endedAt,
+		Duration:  ws.endedAt.Sub(ws.startedAt).Seconds(),
+		Tasks:     []ReportTask{},
+	}
+
+	if ws.Name != nil {
+		report.Name = *ws.Name
+	}
+
+	for _, result := range ws.Results() {
+		report.Tasks = append(report.Tasks, newReportTask(*result, ws.masker))
+	}
+
+	if runErr != nil {
+		report.Status = statuses.Name(statuses.Error)
+		report.Error = ws.masker.Mask(runErr.Error())
+	}
+
+	return report
+}
+
+func newReportTask(result tasks.TaskResult, masker *secrets.SecretMasker) ReportTask {
+	task := ReportTask{
+		Id:        result.Id,
+		Name:      result.Name,
+		Status:    statuses.Name(result.Status),
+		Message:   masker.Mask(result.Message),
+		StartedAt: result.StartedAt,
+		EndedAt:   result.EndedAt,
+		Duration:  result.EndedAt.Sub(result.StartedAt).Seconds(),
+		ExitCode:  result.ExitCode,
+	}
+
+	if result.Err != nil {
+		task.Error = masker.Mask(result.Err.Error())
+	}
+
+	for _, attempt := range result.Attempts {
+		a := ReportAttempt{
+			Attempt:   attempt.Attempt,
+			Status:    statuses.Name(attempt.Status),
+			ExitCode:  attempt.ExitCode,
+			StartedAt: attempt.StartedAt,
+			EndedAt:   attempt.EndedAt,
+			Duration:  attempt.EndedAt.Sub(attempt.StartedAt).Seconds(),
+		}
+
+		if attempt.Err != nil {
+			a.Error = masker.Mask(attempt.Err.Error())
+		}
+
+		task.Attempts = append(task.Attempts, a)
+	}
+
+	for _, host := range result.Hosts {
+		h := ReportHost{
+			Host:      host.Host,
+			Status:    statuses.Name(host.Status),
+			Message:   masker.Mask(host.Message),
+			ExitCode:  host.ExitCode,
+			StartedAt: host.StartedAt,
+			EndedAt:   host.EndedAt,
+			Duration:  host.EndedAt.Sub(host.StartedAt).Seconds(),
+		}
+
+		if host.Err != nil {
+			h.Error = masker.Mask(host.Err.Error())
+		}
+
+		task.Hosts = append(task.Hosts, h)
+	}
+
+	if len(result.Output) > 0 {
+		task.Output = map[string]interface{}{}
+		for k, v := range result.Output {
+			task.Output[k] = maskValue(v, masker)
+		}
+	}
+
+	for _, step := range result.Steps {
+		task.Steps = append(task.Steps, newReportTask(step, masker))
+	}
+
+	return task
+}
+
+// maskValue masks the secrets in the strings of an output value, which may
+// be decoded json or yaml.
+func maskValue(value interface{}, masker *secrets.SecretMasker) interface{} {
+	switch v := value.(type) {
+	case string:
+		return masker.Mask(v)
+	case map[string]interface{}:
+		masked := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			masked[k] = maskValue(item, masker)
+		}
+		return masked
+	case []interface{}:
+		masked := make([]interface{}, len(v))
+		for i, item := range v {
+			masked[i] = maskValue(item, masker)
+		}
+		return masked
+	default:
+		return value
+	}
+}
+
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the report as JUnit XML. Each task is a test case and
+// each step of a task is an additional test case named "task / step".
+func (r *Report) WriteJUnit(w io.Writer) error {
+	name := r.Name
+	if name == "" {
+		name = r.Path
+	}
+
+	suite := junitTestSuite{
+		Name:      name,
+		Time:      seconds(r.Duration),
+		Timestamp: r.StartedAt.Format(time.RFC3339),
+		Cases:     []junitTestCase{},
+	}
+
+	var add func(task ReportTask, prefix string, className string)
+	add = func(task ReportTask, prefix string, className string) {
+		tc := junitTestCase{
+			Name:      prefix + task.Name,
+			ClassName: className,
+			Time:      seconds(task.Duration),
+		}
+
+		switch task.Status {
+		case statuses.Name(statuses.Error), statuses.Name(statuses.Cancelled):
+			msg := task.Error
+			if msg == "" {
+				msg = task.Message
+			}
+			tc.Failure = &junitMessage{Message: msg, Text: msg}
+			suite.Failures++
+		case statuses.Name(statuses.Skipped):
+			tc.Skipped = &junitMessage{Message: task.Message}
+			suite.Skipped++
+		}
+
+		for _, attempt := range task.Attempts {
+			if attempt.Error != "" {
+				tc.SystemOut += "attempt " + strconv.Itoa(attempt.Attempt) + ": " + attempt.Error + "\n"
+			}
+		}
+
+		for _, host := range task.Hosts {
+			line := "host " + host.Host + ": " + host.Status
+			if host.Error != "" {
+				line += ": " + host.Error
+			}
+			tc.SystemOut += line + "\n"
+		}
+
+		if len(task.Output) > 0 {
+			keys := make([]string, 0, len(task.Output))
+			for k := range task.Output {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				tc.SystemOut += k + "=" + fmt.Sprint(task.Output[k]) + "\n"
+			}
+		}
+
+		suite.Cases = append(suite.Cases, tc)
+		suite.Tests++
+
+		for _, step := range task.Steps {
+			add(step, prefix+task.Name+" / ", className+"."+task.Id)
+		}
+	}
+
+	for _, task := range r.Tasks {
+		add(task, "", name)
+	}
+
+	suites := junitTestSuites{
+		Name:     name,
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Skipped:  suite.Skipped,
+		Time:     suite.Time,
+		Suites:   []junitTestSuite{suite},
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func seconds(d float64) string {
+	return strconv.FormatFloat(d, 'f', 3, 64)
+}
@@ -0,0 +1,153 @@
+package workflows
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/frostyeti/mvps/go/run/tasks"
+	"github.com/frostyeti/mvps/go/run/tasks/statuses"
+	"github.com/stretchr/testify/assert"
+)
+
+func testReport() *Report {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	result := func(id string, status int, d time.Duration) tasks.TaskResult {
+		return tasks.TaskResult{
+			Id:        id,
+			Name:      id,
+			Status:    status,
+			StartedAt: start,
+			EndedAt:   start.Add(d),
+		}
+	}
+
+	build := result("build", statuses.Ok, 1500*time.Millisecond)
+	build.Output = map[string]interface{}{"VERSION": "1.0", "ARCH": "amd64"}
+	build.Steps = []tasks.TaskResult{result("compile", statuses.Ok, time.Second)}
+
+	test := result("test", statuses.Error, 2*time.Second)
+	test.Err = errors.New("exit status 1")
+	test.ExitCode = 1
+	test.Attempts = []tasks.TaskAttempt{
+		{Attempt: 1, Status: statuses.Error, ExitCode: 1, Err: errors.New("exit status 1"), StartedAt: start, EndedAt: start.Add(time.Second)},
+		{Attempt: 2, Status: statuses.Error, ExitCode: 1, Err: errors.New("exit status 1"), StartedAt: start, EndedAt: start.Add(time.Second)},
+	}
+
+	deploy := result("deploy", statuses.Skipped, 0)
+	deploy.Message = "condition was false"
+	deploy.Hosts = []tasks.HostResult{{Host: "web1", Status: statuses.Ok, StartedAt: start, EndedAt: start}}
+
+	ws := NewWorkflow()
+	ws.Path = "/src/runfile"
+	ws.ContextName = "default"
+	ws.startedAt = start
+	ws.endedAt = start.Add(4 * time.Second)
+	for _, r := range []tasks.TaskResult{build, test, deploy} {
+		r := r
+		ws.recordResult(&r)
+	}
+
+	return ws.Report(errors.New("task test failed"))
+}
+
+func TestReportWriteJSON(t *testing.T) {
+	out := &bytes.Buffer{}
+	assert.NoError(t, testReport().WriteJSON(out))
+
+	report := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &report))
+	assert.Equal(t, "error", report["status"])
+	assert.Equal(t, "task test failed", report["error"])
+	assert.Equal(t, float64(4), report["duration"])
+
+	list := report["tasks"].([]interface{})
+	assert.Len(t, list, 3)
+
+	build := list[0].(map[string]interface{})
+	assert.Equal(t, "ok", build["status"])
+	assert.Equal(t, 1.5, build["duration"])
+	assert.Equal(t, map[string]interface{}{"VERSION": "1.0", "ARCH": "amd64"}, build["output"])
+	assert.Len(t, build["steps"], 1)
+	assert.NotContains(t, build, "attempts")
+
+	test := list[1].(map[string]interface{})
+	assert.Equal(t, "exit status 1", test["error"])
+	assert.Equal(t, float64(1), test["exitCode"])
+	assert.Len(t, test["attempts"], 2)
+
+	deploy := list[2].(map[string]interface{})
+	assert.Equal(t, "skipped", deploy["status"])
+	assert.NotContains(t, deploy, "output")
+	assert.Len(t, deploy["hosts"], 1)
+}
+
+func TestReportWriteJUnit(t *testing.T) {
+	out := &bytes.Buffer{}
+	assert.NoError(t, testReport().WriteJUnit(out))
+
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites name="/src/runfile" tests="4" failures="1" skipped="1" time="4.000">
+  <testsuite name="/src/runfile" tests="4" failures="1" skipped="1" time="4.000" timestamp="2024-01-02T03:04:05Z">
+    <testcase name="build" classname="/src/runfile" time="1.500">
+      <system-out>ARCH=amd64&#xA;VERSION=1.0&#xA;</system-out>
+    </testcase>
+    <testcase name="build / compile" classname="/src/runfile.build" time="1.000"></testcase>
+    <testcase name="test" classname="/src/runfile" time="2.000">
+      <failure message="exit status 1">exit status 1</failure>
+      <system-out>attempt 1: exit status 1&#xA;attempt 2: exit status 1&#xA;</system-out>
+    </testcase>
+    <testcase name="deploy" classname="/src/runfile" time="0.000">
+      <skipped message="condition was false"></skipped>
+      <system-out>host web1: ok&#xA;</system-out>
+    </testcase>
+  </testsuite>
+</testsuites>
+`
+	assert.Equal(t, want, out.String())
+}
+
+func TestReportMasksSecrets(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	deploy := tasks.TaskResult{
+		Id:        "deploy",
+		Name:      "deploy",
+		Status:    statuses.Error,
+		Message:   "token s3cr3t rejected",
+		Err:       errors.New("login with s3cr3t failed"),
+		StartedAt: start,
+		EndedAt:   start,
+		Output: map[string]interface{}{
+			"TOKEN":  "s3cr3t",
+			"CONFIG": map[string]interface{}{"auth": []interface{}{"user", "s3cr3t"}, "port": 22},
+		},
+		Attempts: []tasks.TaskAttempt{{Attempt: 1, Status: statuses.Error, Err: errors.New("bad s3cr3t")}},
+		Hosts:    []tasks.HostResult{{Host: "web1", Status: statuses.Error, Message: "s3cr3t", Err: errors.New("s3cr3t denied")}},
+		Steps:    []tasks.TaskResult{{Id: "login", Name: "login", Status: statuses.Error, Err: errors.New("echo s3cr3t")}},
+	}
+
+	ws := NewWorkflow()
+	ws.masker.AddValue("s3cr3t")
+	ws.recordResult(&deploy)
+
+	report := ws.Report(errors.New("task deploy failed with s3cr3t"))
+	task := report.Tasks[0]
+	assert.Equal(t, "task deploy failed with ****", report.Error)
+	assert.Equal(t, "token **** rejected", task.Message)
+	assert.Equal(t, "login with **** failed", task.Error)
+	assert.Equal(t, "****", task.Output["TOKEN"])
+	assert.Equal(t, map[string]interface{}{"auth": []interface{}{"user", "****"}, "port": 22}, task.Output["CONFIG"])
+	assert.Equal(t, "bad ****", task.Attempts[0].Error)
+	assert.Equal(t, "****", task.Hosts[0].Message)
+	assert.Equal(t, "**** denied", task.Hosts[0].Error)
+	assert.Equal(t, "echo ****", task.Steps[0].Error)
+
+	// the results of the run keep the values the tasks produced
+	assert.Equal(t, "s3cr3t", deploy.Output["TOKEN"])
+
+	out := &bytes.Buffer{}
+	assert.NoError(t, report.WriteJUnit(out))
+	assert.NotContains(t, out.String(), "s3cr3t")
+}
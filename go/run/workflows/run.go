@@ -2,21 +2,23 @@ package workflows
 
 import (
 	"bufio"
+	"context"
 	"errors"
-	"html/template"
+	"io"
 	"os"
-	"runtime"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/Masterminds/sprig"
 	"github.com/frostyeti/mvps/go/dotenv"
 	"github.com/frostyeti/mvps/go/env"
 	"github.com/frostyeti/mvps/go/run/schema"
 	"github.com/frostyeti/mvps/go/run/tasks"
+	"github.com/frostyeti/mvps/go/run/tasks/statuses"
 )
 
-func (ws *Workflow) Run(taskNames []string, args []string) error {
+func (ws *Workflow) Run(taskNames []string, args []string) (err error) {
 	if ws == nil {
 		return errors.New("workflow is nil")
 	}
@@ -24,16 +26,43 @@ func (ws *Workflow) Run(taskNames []string, args []string) error {
 	if len(taskNames) == 0 {
 		taskNames = []string{"default"}
 	}
+	ws.targets = taskNames
+
+	ws.startedAt = time.Now().UTC()
+	defer func() {
+		ws.endedAt = time.Now().UTC()
+	}()
+
+	parent := ws.Context
+	if parent == nil {
+		parent = context.Background()
+	}
+
+	var cancel context.CancelFunc
+	if ws.Config.Timeout > 0 {
+		ws.ctx, cancel = context.WithTimeout(parent, ws.Config.Timeout)
+	} else {
+		ws.ctx, cancel = context.WithCancel(parent)
+	}
+	defer cancel()
+
+	// services run until the workflow ends, whether it failed or not
+	defer func() {
+		if stopErr := ws.stopServices(err != nil); err == nil {
+			err = stopErr
+		}
+	}()
 
 	allTasks := []schema.Task{}
 
-	for _, target := range ws.Tasks.Entries() {
+	for _, key := range ws.Tasks.Keys() {
+		target, _ := ws.Tasks.Get(key)
 		allTasks = append(allTasks, target)
 	}
 
 	cycles := schema.FindCyclicalReferences(allTasks)
 	if len(cycles) > 0 {
-		return &CyclicalReferenceError{Cycles: cycles}
+		return &CyclicalReferenceError{Cycles: cycles, Paths: schema.FindCycles(allTasks)}
 	}
 
 	contextName := ws.ContextName
@@ -46,6 +75,28 @@ func (ws *Workflow) Run(taskNames []string, args []string) error {
 		return err
 	}
 
+	if err := ws.validateOutputReferences(flatTasks, contextName); err != nil {
+		return err
+	}
+
+	ws.affected = nil
+	if ws.Affected {
+		affected, err := ws.findAffected(flatTasks, contextName)
+		if err != nil {
+			return err
+		}
+
+		ws.affected = affected
+	}
+
+	if err := ws.resolveValues(); err != nil {
+		return err
+	}
+
+	if err := ws.promptInputs(flatTasks); err != nil {
+		return err
+	}
+
 	// skip last task if there is more than one task and
 	// the last task has no run or uses defined
 	lastId := ""
@@ -84,419 +135,612 @@ func (ws *Workflow) Run(taskNames []string, args []string) error {
 
 	envMap := ws.Env.Clone()
 	if envMap.Has("RUN_ENV") && !ws.cleanupEnv {
-		envFile := envMap.GetString("RUN_ENV")
-		if len(envFile) > 0 {
-			canOpen := true
-			if _, err := os.Stat(envFile); err != nil {
-				canOpen = false
-			}
-
-			if canOpen {
-				bytes, err := os.ReadFile(envFile)
-				if err != nil {
-					return errors.New("Failed to read RUN_ENV file: " + err.Error())
-				}
+		delta, err := readTaskDelta(envMap.GetString("RUN_ENV"), "")
+		if err != nil {
+			return err
+		}
 
-				if len(bytes) > 0 {
-					opts := &env.ExpandOptions{
-						Get: func(key string) string {
-							val, ok := envMap.Get(key)
-							if ok {
-								return val
-							}
-							return ""
-						},
-						Set: func(key, value string) error {
-							envMap.Set(key, value)
-							return nil
-						},
-						Keys:                envMap.Keys(),
-						ExpandUnixArgs:      true,
-						ExpandWindowsVars:   false,
-						CommandSubstitution: ws.Config.Substitution,
-					}
-					doc2, err := dotenv.Parse(string(bytes))
-					if err != nil {
-						return errors.New("Failed to parse RUN_ENV file: " + err.Error())
-					}
-
-					for _, node := range doc2.ToArray() {
-						if node.Type == dotenv.VARIABLE_TOKEN {
-							key := ""
-							value := node.Value
-							if node.Key != nil {
-								key = *node.Key
-							}
-
-							if strings.HasPrefix("RUN_", key) {
-								if strings.HasSuffix(key, "_EXE") {
-									value, err := env.ExpandWithOptions(value, opts)
-									if err != nil {
-										return errors.New("Failed to expand environment variable: " + err.Error())
-									}
-
-									envMap.Set(key, value)
-								}
-								continue
-							}
-
-							value, err := env.ExpandWithOptions(value, opts)
-							if err != nil {
-								return errors.New("Failed to expand environment variable: " + err.Error())
-							}
-							envMap.Set(key, value)
-						}
-					}
-				}
-			}
+		if err := ws.applyDelta(envMap, delta); err != nil {
+			return err
 		}
 	}
 
-	hostGroups := map[string][]schema.HostEntry{}
-	for name, host := range ws.Hosts.Entries() {
-		if len(host.Groups) > 0 {
-			for _, group := range host.Groups {
-				if _, ok := hostGroups[group]; !ok {
-					hostGroups[group] = []schema.HostEntry{}
-				}
-				hostGroups[group] = append(hostGroups[group], host)
-			}
+	// hostGroups maps each host and group to the names of its hosts, in the
+	// order the hosts were declared.
+	hostGroups := map[string][]string{}
+	for name, host := range ws.Hosts.Iter() {
+		for _, group := range host.Groups {
+			hostGroups[group] = append(hostGroups[group], name)
 		}
 
-		if _, ok := hostGroups[name]; !ok {
-			hostGroups[name] = []schema.HostEntry{host}
-		} else {
-			hostGroups[name] = append(hostGroups[name], host)
-		}
+		hostGroups[name] = append(hostGroups[name], name)
 	}
 
-	for _, task := range flatTasks {
-		taskEnv := envMap.Clone()
+	// a dry run writes the plan of every task in order without running it
+	if ws.Config.Parallelism > 1 && len(flatTasks) > 1 && !ws.DryRun {
+		return ws.runGraph(flatTasks, lastId, contextName, envMap, hostGroups, args)
+	}
 
+	ran := map[string]bool{}
+	for _, task := range flatTasks {
 		if lastId != "" && task.Id == lastId {
 			name := task.Id
 			if task.Name != nil && len(*task.Name) > 0 {
 				name = *task.Name
 			}
 
-			os.Stdout.WriteString("\x1b[1m" + name + "\x1b[22m\n")
+			tasks.WriteLine(ws.out(), "\x1b[1m"+name+"\x1b[22m")
 			return nil
 		}
 
-		f, err := os.CreateTemp("", "run-env-")
+		ran[strings.ToLower(task.Id)] = true
+		delta, err := ws.runTask(task, envMap, hostGroups, args, ws.stdout, ws.stderr)
 		if err != nil {
+			nodes := newTaskGraph(flatTasks, contextName)
+			started := make([]bool, len(nodes))
+			failed := make([]bool, len(nodes))
+			for _, node := range nodes {
+				started[node.index] = ran[strings.ToLower(node.task.Id)]
+				failed[node.index] = strings.EqualFold(node.task.Id, task.Id)
+			}
+
+			ws.skipUnstarted(nodes, started, failed, lastId)
 			return err
 		}
-		f.Write([]byte{})
-		f.Close()
-		taskEnv.Set("RUN_ENV", f.Name())
 
-		defer func() {
-			if isFile(f.Name()) {
-				os.Remove(f.Name())
-			}
-		}()
-
-		f2, err := os.CreateTemp("", "run-path-")
-		if err != nil {
+		if err := ws.applyDelta(envMap, delta); err != nil {
 			return err
 		}
-		f2.Write([]byte{})
-		f2.Close()
-		taskEnv.Set("RUN_PATH", f2.Name())
+	}
 
-		defer func() {
-			if isFile(f2.Name()) {
-				os.Remove(f2.Name())
-			}
-		}()
+	return nil
+}
 
-		if task.Name == nil || len(*task.Name) == 0 {
-			task.Name = &task.Id
+// runTask runs a single task with a copy of envMap and records its result.
+// The variables and paths the task wrote to RUN_ENV and RUN_PATH are returned
+// rather than applied so that the caller decides the order in which they are
+// merged.
+func (ws *Workflow) runTask(task schema.Task, envMap *schema.Environment, hostGroups map[string][]string, args []string, stdout, stderr io.Writer) (*taskDelta, error) {
+	result, delta, err := ws.execTask(task, envMap, hostGroups, args, stdout, stderr)
+	if result == nil {
+		result = tasks.NewTaskResult()
+		if err != nil {
+			result.Fail(err)
 		}
+	}
 
-		uses := ws.Config.Shell
-		if task.Uses != nil && len(*task.Uses) > 0 {
-			uses = task.Uses
-		}
+	result.Id = task.Id
+	result.Name = taskName(task)
 
-		desc := ""
-		if task.Desc != nil {
-			desc = *task.Desc
+	ws.recordResult(result)
+	return delta, err
+}
+
+// skipTask records a skipped result for a task that never started, so the
+// report lists every task of the run.
+func (ws *Workflow) skipTask(task schema.Task, message string) {
+	result := tasks.NewTaskResult().Skip(message)
+	result.Id = task.Id
+	result.Name = taskName(task)
+	ws.recordResult(result)
+}
+
+// taskName returns the name of the task, or its id when it has none.
+func taskName(task schema.Task) string {
+	if task.Name != nil && len(*task.Name) > 0 {
+		return *task.Name
+	}
+
+	return task.Id
+}
+
+func (ws *Workflow) execTask(task schema.Task, envMap *schema.Environment, hostGroups map[string][]string, args []string, stdout, stderr io.Writer) (*tasks.TaskResult, *taskDelta, error) {
+	ctx := ws.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if err := ctx.Err(); err != nil {
+		return tasks.NewTaskResult().Cancel("Task " + task.Id + " cancelled"), nil, cancelledError(ctx, ws.Config.Timeout)
+	}
+
+	if ws.affected != nil && !ws.affected[task.Id] {
+		name := task.Id
+		if task.Name != nil && len(*task.Name) > 0 {
+			name = *task.Name
 		}
 
-		help := ""
-		if task.Help != nil {
-			help = *task.Help
+		tasks.WriteLine(ws.out(), "\x1b[1m"+name+"\x1b[22m (not affected)")
+		return tasks.NewTaskResult().Skip("not affected"), nil, nil
+	}
+
+	taskEnv := envMap.Clone()
+	inc := ws.includes[task.Id]
+	if inc != nil {
+		inc.applyEnv(taskEnv)
+	}
+
+	f, err := os.CreateTemp("", "run-env-")
+	if err != nil {
+		return nil, nil, err
+	}
+	f.Write([]byte{})
+	f.Close()
+	taskEnv.Set("RUN_ENV", f.Name())
+
+	defer func() {
+		if isFile(f.Name()) {
+			os.Remove(f.Name())
 		}
+	}()
 
-		cwd := ""
-		if task.Cwd != nil && len(*task.Cwd) > 0 {
-			cwd = *task.Cwd
+	f2, err := os.CreateTemp("", "run-path-")
+	if err != nil {
+		return nil, nil, err
+	}
+	f2.Write([]byte{})
+	f2.Close()
+	taskEnv.Set("RUN_PATH", f2.Name())
+
+	defer func() {
+		if isFile(f2.Name()) {
+			os.Remove(f2.Name())
 		}
-		if len(cwd) == 0 {
-			c, ok := ws.Env.Get("RUN_DIR")
-			if ok {
-				cwd = c
-			} else {
-				c, err := os.Getwd()
-				if err != nil {
-					return err
-				}
-				cwd = c
-			}
+	}()
+
+	f3, err := os.CreateTemp("", "run-outputs-")
+	if err != nil {
+		return nil, nil, err
+	}
+	f3.Write([]byte{})
+	f3.Close()
+	taskEnv.Set("RUN_OUTPUTS", f3.Name())
+
+	defer func() {
+		if isFile(f3.Name()) {
+			os.Remove(f3.Name())
 		}
+	}()
+
+	if task.Name == nil || len(*task.Name) == 0 {
+		task.Name = &task.Id
+	}
+
+	uses := ws.Config.Shell
+	if task.Uses != nil && len(*task.Uses) > 0 {
+		uses = task.Uses
+	}
+
+	desc := ""
+	if task.Desc != nil {
+		desc = *task.Desc
+	}
+
+	help := ""
+	if task.Help != nil {
+		help = *task.Help
+	}
 
-		var timeout time.Duration
-		timeout = 0
-		if task.Timeout != nil && len(*task.Timeout) > 0 {
-			t, err := time.ParseDuration(*task.Timeout)
+	cwd := ""
+	if task.Cwd != nil && len(*task.Cwd) > 0 {
+		cwd = *task.Cwd
+	}
+	if len(cwd) == 0 && inc != nil {
+		cwd = inc.dir
+	}
+	if len(cwd) == 0 {
+		c, ok := ws.Env.Get("RUN_DIR")
+		if ok {
+			cwd = c
+		} else {
+			c, err := os.Getwd()
 			if err != nil {
-				return err
+				return nil, nil, err
 			}
-			timeout = t
+			cwd = c
 		}
+	}
 
-		run := ""
-		if task.Run != nil && len(*task.Run) > 0 {
-			run = *task.Run
+	var timeout time.Duration
+	timeout = 0
+	if task.Timeout != nil && len(*task.Timeout) > 0 {
+		t, err := time.ParseDuration(*task.Timeout)
+		if err != nil {
+			// a plain number is a number of seconds
+			seconds, err2 := strconv.Atoi(*task.Timeout)
+			if err2 != nil {
+				return nil, nil, errors.New("invalid timeout for task " + task.Id + ": " + err.Error())
+			}
+			t = time.Duration(seconds) * time.Second
 		}
+		timeout = t
+	}
 
-		hosts := schema.NewHosts()
-		if len(task.Hosts) > 0 {
-			for _, h := range task.Hosts {
-				if groupHosts, ok := hostGroups[h]; ok {
-					for _, gh := range groupHosts {
-						hosts.Set(h, &gh)
-					}
+	run := ""
+	if task.Run != nil && len(*task.Run) > 0 {
+		run = *task.Run
+	}
+
+	hosts := schema.NewHosts()
+	if len(task.Hosts) > 0 {
+		for _, h := range task.Hosts {
+			for _, name := range hostGroups[h] {
+				if entry, ok := ws.Hosts.Get(name); ok {
+					hosts.Set(name, entry)
 				}
 			}
 		}
+	}
 
-		opts := &env.ExpandOptions{
-			Get: func(key string) string {
-				val, ok := taskEnv.Get(key)
-				if ok {
-					return val
-				}
-				return ""
-			},
-			Set: func(key, value string) error {
-				taskEnv.Set(key, value)
-				return nil
-			},
-			Keys:                taskEnv.Keys(),
-			ExpandUnixArgs:      true,
-			ExpandWindowsVars:   false,
-			CommandSubstitution: ws.Config.Substitution,
-		}
+	opts := &env.ExpandOptions{
+		Get: func(key string) string {
+			val, ok := taskEnv.Get(key)
+			if ok {
+				return val
+			}
+			return ""
+		},
+		Set: func(key, value string) error {
+			taskEnv.Set(key, value)
+			return nil
+		},
+		Keys:                taskEnv.Keys(),
+		ExpandUnixArgs:      true,
+		ExpandWindowsVars:   false,
+		CommandSubstitution: ws.Config.Substitution && !ws.DryRun,
+	}
 
-		if task.Env.Len() > 0 {
+	if task.Env.Len() > 0 {
+		tplData := ws.templateData(task, taskEnv)
 
-			for k, v := range task.Env.Iter() {
+		for k, v := range task.Env.Iter() {
+			v, err := renderTemplate(task.Id+".env."+k, v, tplData)
+			if err != nil {
+				return nil, nil, err
+			}
 
-				ev, err := env.ExpandWithOptions(v, opts)
-				if err != nil {
-					return errors.New("failed to expand env var: " + k + " for task: " + task.Id + " error: " + err.Error())
-				}
+			ev, err := env.ExpandWithOptions(v, opts)
+			if err != nil {
+				return nil, nil, errors.New("failed to expand env var: " + k + " for task: " + task.Id + " error: " + err.Error())
+			}
+			if task.Env.IsSecret(k) {
+				taskEnv.SetSecret(k, ev)
+			} else {
 				taskEnv.Set(k, ev)
-				hasKey := false
-				for _, keys := range opts.Keys {
-					if keys == k {
-						hasKey = true
-						break
-					}
+			}
+			hasKey := false
+			for _, keys := range opts.Keys {
+				if keys == k {
+					hasKey = true
+					break
 				}
+			}
 
-				if !hasKey {
-					opts.Keys = append(opts.Keys, k)
-				}
+			if !hasKey {
+				opts.Keys = append(opts.Keys, k)
 			}
 		}
+	}
 
-		if strings.ContainsRune(cwd, '$') {
-			c, err := env.ExpandWithOptions(cwd, opts)
-			if err != nil {
-				return errors.New("failed to expand cwd: " + cwd + " for task: " + task.Id + " error: " + err.Error())
-			}
-			cwd = c
+	if strings.ContainsRune(cwd, '$') {
+		c, err := env.ExpandWithOptions(cwd, opts)
+		if err != nil {
+			return nil, nil, errors.New("failed to expand cwd: " + cwd + " for task: " + task.Id + " error: " + err.Error())
+		}
+		cwd = c
+	}
+
+	// the cwd of an included task is relative to the included runfile
+	if inc != nil && !filepath.IsAbs(cwd) {
+		cwd = filepath.Join(inc.dir, cwd)
+	}
+
+	tplData := ws.templateData(task, taskEnv)
+	with, err := renderWith(task.Id, task.With, tplData)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	with, inputs, err := ws.resolveInputs(task, with, taskEnv)
+	if err != nil {
+		return nil, nil, err
+	}
+	tplData["inputs"] = inputs
+	tplData["env"] = taskEnv.ToMap()
+
+	run, err = renderTemplate(task.Id+".run", run, tplData)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data := &tasks.TaskModel{
+		Env:      *taskEnv,
+		Id:       task.Id,
+		Hosts:    *hosts,
+		Uses:     *uses,
+		Desc:     desc,
+		Help:     help,
+		Run:      run,
+		Needs:    task.Needs,
+		With:     with,
+		Cwd:      cwd,
+		Timeout:  timeout,
+		Retry:    task.Retry,
+		Strategy: task.Strategy,
+	}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	taskCtx := &tasks.TaskContext{
+		Schema:      &task,
+		Task:        data,
+		Args:        args,
+		Context:     ctx,
+		ContextName: ws.ContextName,
+		Stdout:      stdout,
+		Stderr:      stderr,
+		Masker:      ws.masker,
+		Inventory:   &ws.Hosts,
+	}
+
+	name := data.Id
+	if task.Name != nil && len(*task.Name) > 0 {
+		name = *task.Name
+	}
+
+	predicate := true
+	// the outputs an if uses do not exist in a dry run, the plan shows it
+	// as unknown instead
+	if task.Condition != nil && len(*task.Condition) > 0 && !(ws.DryRun && outputRef.MatchString(*task.Condition)) {
+		predicateRaw := *task.Condition
+		if predicateRaw == "0" || strings.EqualFold(predicateRaw, "false") {
+			predicate = false
+		} else if predicateRaw == "1" || strings.EqualFold(predicateRaw, "true") {
+			predicate = true
+		} else {
+			predicate = false
 		}
 
-		data := &tasks.TaskModel{
-			Env:     *taskEnv,
-			Id:      task.Id,
-			Hosts:   *hosts,
-			Uses:    *uses,
-			Desc:    desc,
-			Help:    help,
-			Run:     run,
-			Needs:   task.Needs,
-			With:    task.With,
-			Cwd:     cwd,
-			Timeout: timeout,
+		tmp, err := newTemplate(task.Id + "." + "if").Parse(predicateRaw)
+		if err != nil {
+			return nil, nil, errors.New("failed to parse if section for task " + task.Id + ": " + err.Error())
 		}
 
-		taskCtx := &tasks.TaskContext{
-			Schema:      &task,
-			Task:        data,
-			Args:        args,
-			Context:     ws.Context,
-			ContextName: ws.ContextName,
+		out := &strings.Builder{}
+		if err := tmp.Execute(out, tplData); err != nil {
+			return nil, nil, errors.New("failed to execute template for task " + task.Id + ": " + err.Error())
 		}
 
-		name := data.Id
-		if task.Name != nil && len(*task.Name) > 0 {
-			name = *task.Name
+		output := strings.TrimSpace(out.String())
+		if output == "1" || strings.EqualFold(output, "true") {
+			predicate = true
 		}
+	}
 
-		predicate := true
-		if task.Condition != nil && len(*task.Condition) > 0 {
-			predicateRaw := *task.Condition
-			if predicateRaw == "0" || strings.EqualFold(predicateRaw, "false") {
-				predicate = false
-			} else if predicateRaw == "1" || strings.EqualFold(predicateRaw, "true") {
-				predicate = true
-			} else {
-				predicate = false
-			}
+	if ws.DryRun {
+		ws.writePlan(ws.out(), task, data, envMap, predicate)
+		return tasks.NewTaskResult().Skip("dry run"), nil, nil
+	}
 
-			tplData := map[string]interface{}{
-				"env":  taskEnv.ToMap(),
-				"os":   runtime.GOOS,
-				"arch": runtime.GOARCH,
-			}
+	if !predicate {
+		tasks.WriteLine(ws.out(), "\x1b[1m"+name+"\x1b[22m (skipped)")
+		return tasks.NewTaskResult().Skip("condition was false"), nil, nil
+	}
 
-			tmp, err := template.New(task.Id + "." + "if").Funcs(sprig.FuncMap()).Parse(predicateRaw)
-			if err != nil {
-				return errors.New("failed to parse if section for task " + task.Id + ": " + err.Error())
-			}
+	stored, upToDate, err := ws.isUpToDate(task, cwd)
+	if err != nil {
+		return nil, nil, errors.New("failed to check sources for task " + task.Id + ": " + err.Error())
+	}
 
-			out := &strings.Builder{}
-			if err := tmp.Execute(out, tplData); err != nil {
-				return errors.New("failed to execute template for task " + task.Id + ": " + err.Error())
-			}
+	if upToDate {
+		// the tasks that need it still see the outputs of its last run
+		ws.setOutputs(task.Id, stored)
+		tasks.WriteLine(ws.out(), "\x1b[1m"+name+"\x1b[22m (up to date)")
+		result := tasks.NewTaskResult().Skip("up to date")
+		result.Output = stored
+		return result, nil, nil
+	}
 
-			output := strings.TrimSpace(out.String())
-			if output == "1" || strings.EqualFold(output, "true") {
-				predicate = true
-			}
+	if task.Confirm != nil && len(*task.Confirm) > 0 {
+		message, err := renderTemplate(task.Id+".confirm", *task.Confirm, tplData)
+		if err != nil {
+			return nil, nil, err
 		}
 
-		if !predicate {
-			os.Stdout.WriteString("\x1b[1m" + name + "\x1b[22m (skipped)\n")
-			continue
+		ok, err := ws.confirm(task, message)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if !ok {
+			return tasks.NewTaskResult().Cancel("Task " + task.Id + " was not confirmed"), nil, errors.New("task " + task.Id + " was not confirmed")
+		}
+	}
+
+	tasks.WriteLine(ws.out(), "\x1b[1m"+name+"\x1b[22m")
+
+	// a matrix task only groups its combinations, which already ran as
+	// its needs.
+	if task.Matrix != nil && task.MatrixValues == nil {
+		return tasks.NewTaskResult().Ok(), nil, nil
+	}
+
+	if task.Service != nil {
+		result, err := ws.startService(task, name, *taskCtx)
+		return result, nil, err
+	}
+
+	result := tasks.Run(*taskCtx)
+
+	if result.Status == statuses.Cancelled {
+		if ws.ctx.Err() == nil && ctx.Err() != nil {
+			return result, nil, errors.New("task " + task.Id + " timed out after " + timeout.String())
 		}
 
-		os.Stdout.WriteString("\x1b[1m" + name + "\x1b[22m\n")
-		result := tasks.Run(*taskCtx)
+		return result, nil, cancelledError(ws.ctx, ws.Config.Timeout)
+	}
+
+	if result.Err != nil {
+		return result, nil, result.Err
+	}
 
-		if result.Err != nil {
-			return result.Err
+	outputs, err := tasks.ReadOutputs(taskEnv.GetString("RUN_OUTPUTS"))
+	if err != nil {
+		return result, nil, err
+	}
+
+	for k, v := range result.Output {
+		outputs[k] = v
+	}
+	result.Output = outputs
+	ws.setOutputs(task.Id, outputs)
+
+	if err := ws.saveFingerprint(task, cwd, outputs); err != nil {
+		return result, nil, errors.New("failed to save sources for task " + task.Id + ": " + err.Error())
+	}
+
+	delta, err := readTaskDelta(taskEnv.GetString("RUN_ENV"), taskEnv.GetString("RUN_PATH"))
+	return result, delta, err
+}
+
+// cancelledError describes why the workflow's context ended.
+func cancelledError(ctx context.Context, timeout time.Duration) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return errors.New("workflow timed out after " + timeout.String())
+	}
+
+	return errors.New("workflow cancelled")
+}
+
+// taskDelta holds the variables a task wrote to its RUN_ENV file and
+// the directories it wrote to its RUN_PATH file.
+type taskDelta struct {
+	env   []dotenv.Node
+	paths []string
+	masks []string
+}
+
+func readTaskDelta(envFile, pathFile string) (*taskDelta, error) {
+	delta := &taskDelta{
+		env:   []dotenv.Node{},
+		paths: []string{},
+		masks: []string{},
+	}
+
+	if len(envFile) > 0 && isFile(envFile) {
+		bytes, err := os.ReadFile(envFile)
+		if err != nil {
+			return nil, errors.New("Failed to read RUN_ENV file: " + err.Error())
 		}
 
-		envFile := taskEnv.GetString("RUN_ENV")
-		if len(envFile) > 0 {
-			canOpen := true
-			if _, err := os.Stat(envFile); err != nil {
-				canOpen = false
+		// ::add-mask::value lines register secrets rather than variables
+		lines := []string{}
+		for _, line := range strings.Split(string(bytes), "\n") {
+			if value, ok := strings.CutPrefix(strings.TrimSpace(line), "::add-mask::"); ok {
+				if len(value) > 0 {
+					delta.masks = append(delta.masks, value)
+				}
+				continue
 			}
 
-			if canOpen {
-				bytes, err := os.ReadFile(envFile)
-				if err != nil {
-					return errors.New("Failed to read RUN_ENV file: " + err.Error())
-				}
+			lines = append(lines, line)
+		}
+
+		content := strings.Join(lines, "\n")
+		if len(strings.TrimSpace(content)) > 0 {
+			doc, err := dotenv.Parse(content)
+			if err != nil {
+				return nil, errors.New("Failed to parse RUN_ENV file: " + err.Error())
+			}
 
-				if len(bytes) > 0 {
-					opts := &env.ExpandOptions{
-						Get: func(key string) string {
-							val, ok := envMap.Get(key)
-							if ok {
-								return val
-							}
-							return ""
-						},
-						Set: func(key, value string) error {
-							envMap.Set(key, value)
-							return nil
-						},
-						Keys:                envMap.Keys(),
-						ExpandUnixArgs:      true,
-						ExpandWindowsVars:   false,
-						CommandSubstitution: ws.Config.Substitution,
-					}
-					doc2, err := dotenv.Parse(string(bytes))
-					if err != nil {
-						return errors.New("Failed to parse RUN_ENV file: " + err.Error())
-					}
-
-					for _, node := range doc2.ToArray() {
-						if node.Type == dotenv.VARIABLE_TOKEN {
-							key := ""
-							value := node.Value
-							if node.Key != nil {
-								key = *node.Key
-							}
-
-							if strings.HasPrefix("RUN_", key) {
-								if strings.HasSuffix(key, "_EXE") {
-									value, err := env.ExpandWithOptions(value, opts)
-									if err != nil {
-										return errors.New("Failed to expand environment variable: " + err.Error())
-									}
-
-									envMap.Set(key, value)
-								}
-								continue
-							}
-
-							value, err := env.ExpandWithOptions(value, opts)
-							if err != nil {
-								return errors.New("Failed to expand environment variable: " + err.Error())
-							}
-							envMap.Set(key, value)
-						}
-					}
+			for _, node := range doc.ToArray() {
+				if node.Type == dotenv.VARIABLE_TOKEN {
+					delta.env = append(delta.env, node)
 				}
 			}
+		}
+	}
 
-			if isFile(envFile) {
-				os.Remove(envFile)
+	if len(pathFile) > 0 && isFile(pathFile) {
+		bytes, err := os.ReadFile(pathFile)
+		if err != nil {
+			return nil, errors.New("Failed to read RUN_PATH file: " + err.Error())
+		}
+
+		scanner := bufio.NewScanner(strings.NewReader(string(bytes)))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if len(line) > 0 {
+				delta.paths = append(delta.paths, line)
 			}
 		}
+	}
 
-		pathFile := taskEnv.GetString("RUN_PATH")
-		if len(pathFile) > 0 {
+	return delta, nil
+}
 
-			canOpen := true
-			if _, err := os.Stat(pathFile); err != nil {
-				canOpen = false
+// applyDelta merges the variables and paths of a task into envMap.
+func (ws *Workflow) applyDelta(envMap *schema.Environment, delta *taskDelta) error {
+	if delta == nil {
+		return nil
+	}
+
+	for _, value := range delta.masks {
+		ws.masker.AddValue(value)
+	}
+
+	opts := &env.ExpandOptions{
+		Get: func(key string) string {
+			val, ok := envMap.Get(key)
+			if ok {
+				return val
 			}
+			return ""
+		},
+		Set: func(key, value string) error {
+			envMap.Set(key, value)
+			return nil
+		},
+		Keys:                envMap.Keys(),
+		ExpandUnixArgs:      true,
+		ExpandWindowsVars:   false,
+		CommandSubstitution: ws.Config.Substitution,
+	}
 
-			if canOpen {
-				bytes, err := os.ReadFile(pathFile)
+	for _, node := range delta.env {
+		key := ""
+		value := node.Value
+		if node.Key != nil {
+			key = *node.Key
+		}
+
+		if strings.HasPrefix("RUN_", key) {
+			if strings.HasSuffix(key, "_EXE") {
+				value, err := env.ExpandWithOptions(value, opts)
 				if err != nil {
-					return errors.New("Failed to read RUN_PATH file: " + err.Error())
+					return errors.New("Failed to expand environment variable: " + err.Error())
 				}
 
-				if len(bytes) > 0 {
-					content := string(bytes)
-					scanner := bufio.NewScanner(strings.NewReader(content))
-					for scanner.Scan() {
-						line := strings.TrimSpace(scanner.Text())
-						if len(line) > 0 {
-							if _, err := os.Stat(line); err == nil {
-								// LAST IN SHOULD BE FIRST IN PATH
-								envMap.PrependPath(line)
-							}
-						}
-					}
-				}
+				envMap.Set(key, value)
 			}
+			continue
+		}
 
-			if isFile(pathFile) {
-				os.Remove(pathFile)
-			}
+		value, err := env.ExpandWithOptions(value, opts)
+		if err != nil {
+			return errors.New("Failed to expand environment variable: " + err.Error())
+		}
+		envMap.Set(key, value)
+	}
+
+	for _, line := range delta.paths {
+		if _, err := os.Stat(line); err == nil {
+			// LAST IN SHOULD BE FIRST IN PATH
+			envMap.PrependPath(line)
 		}
 	}
 
@@ -21,35 +21,9 @@ func (wf *Workflow) RunLifecycle(target string, app string, contextName string)
 	}
 	targets := []string{}
 	if app == "" || app == "default" {
-		testFound := false
-		if _, ok := taskMap[target+":default:"+contextName+":before"]; ok {
-			targets = append(targets, target+":default:"+contextName+":before")
-		} else if _, ok := taskMap[target+":default:before"]; ok {
-			targets = append(targets, target+":default:before")
-		} else if _, ok := taskMap[target+":before"]; ok {
-			targets = append(targets, target+":before")
-		}
-
-		if _, ok := taskMap[target+":default:"+contextName]; ok {
-			targets = append(targets, target+":default:"+contextName)
-			testFound = true
-		} else if _, ok := taskMap[target+":default"]; ok {
-			targets = append(targets, target+":default")
-			testFound = true
-		} else if _, ok := taskMap[target]; ok {
-			targets = append(targets, target)
-			testFound = true
-		}
-
-		if _, ok := taskMap[target+":default:"+contextName+":after"]; ok {
-			targets = append(targets, target+":default:"+contextName+":after")
-		} else if _, ok := taskMap[target+":default:after"]; ok {
-			targets = append(targets, target+":default:after")
-		} else if _, ok := taskMap[target+":after"]; ok {
-			targets = append(targets, target+":after")
-		}
-
-		if !testFound {
+		var found bool
+		targets, found = wf.lifecycleTargets(target, contextName)
+		if !found {
 			return errors.New("no default test task found")
 		}
 
@@ -114,14 +88,7 @@ func (wf *Workflow) RunLifecycle(target string, app string, contextName string)
 
 				basename := filepath.Base(dir)
 				if strings.EqualFold(basename, app) {
-					try := filepath.Join(dir, contextName, "runfile")
-					if isFile(try) {
-						nextTaskfile = try
-						break
-					}
-
-					try = filepath.Join(dir, "runfile")
-					if isFile(try) {
+					if try := projectRunfile(dir, contextName); try != "" {
 						nextTaskfile = try
 						break
 					}
@@ -141,14 +108,8 @@ func (wf *Workflow) RunLifecycle(target string, app string, contextName string)
 					return errors.New("Failed to read runfile: " + nextTaskfile + " " + err.Error())
 				}
 
-				for _, k := range wf.Env.Keys() {
-					v0 := wf.Env.GetString(k)
-					if v, ok := os.LookupEnv(k); !ok || v0 != v {
-						os.Setenv(k, v0)
-					}
-				}
-
 				wf2 := NewWorkflow()
+				wf2.baseEnv = wf.Env
 				err = wf2.Load(*tf)
 
 				if err != nil {
@@ -169,3 +130,38 @@ func (wf *Workflow) RunLifecycle(target string, app string, contextName string)
 	wf.ContextName = contextName
 	return wf.Run(targets, []string{})
 }
+
+// lifecycleTargets returns the before hook, the task and the after hook of
+// the target for the default app, preferring the tasks of the context.
+// found is false when the runfile has no task for the target.
+func (wf *Workflow) lifecycleTargets(target string, contextName string) (targets []string, found bool) {
+	taskMap := wf.Tasks.Entries()
+	if _, ok := taskMap[target+":default:"+contextName+":before"]; ok {
+		targets = append(targets, target+":default:"+contextName+":before")
+	} else if _, ok := taskMap[target+":default:before"]; ok {
+		targets = append(targets, target+":default:before")
+	} else if _, ok := taskMap[target+":before"]; ok {
+		targets = append(targets, target+":before")
+	}
+
+	if _, ok := taskMap[target+":default:"+contextName]; ok {
+		targets = append(targets, target+":default:"+contextName)
+		found = true
+	} else if _, ok := taskMap[target+":default"]; ok {
+		targets = append(targets, target+":default")
+		found = true
+	} else if _, ok := taskMap[target]; ok {
+		targets = append(targets, target)
+		found = true
+	}
+
+	if _, ok := taskMap[target+":default:"+contextName+":after"]; ok {
+		targets = append(targets, target+":default:"+contextName+":after")
+	} else if _, ok := taskMap[target+":default:after"]; ok {
+		targets = append(targets, target+":default:after")
+	} else if _, ok := taskMap[target+":after"]; ok {
+		targets = append(targets, target+":after")
+	}
+
+	return targets, found
+}
@@ -0,0 +1,288 @@
+package workflows
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/frostyeti/mvps/go/run/schema"
+	"github.com/frostyeti/mvps/go/run/tasks"
+)
+
+// taskNode is a task in the dependency graph built from the flattened
+// task list. The index is the task's position in the flattened list,
+// which is the order a sequential run would use.
+type taskNode struct {
+	index      int
+	task       schema.Task
+	deps       []int
+	dependents []int
+}
+
+// newTaskGraph builds the dependency graph for the flattened tasks. A task
+// depends on the tasks it needs (including their after hooks) and on its own
+// before hooks. After hooks depend on the task they belong to.
+func newTaskGraph(flatTasks []schema.Task, contextName string) []*taskNode {
+	nodes := []*taskNode{}
+	index := map[string]int{}
+
+	for _, task := range flatTasks {
+		key := strings.ToLower(task.Id)
+		if _, ok := index[key]; ok {
+			continue
+		}
+
+		index[key] = len(nodes)
+		nodes = append(nodes, &taskNode{
+			index:      len(nodes),
+			task:       task,
+			deps:       []int{},
+			dependents: []int{},
+		})
+	}
+
+	lookup := func(id string) (int, bool) {
+		i, ok := index[strings.ToLower(id)]
+		return i, ok
+	}
+
+	afterHooks := func(task schema.Task) []int {
+		set := []int{}
+		for _, suffix := range task.Hooks.After {
+			if i, ok := lookup(task.Id + ":" + suffix); ok {
+				set = append(set, i)
+			}
+		}
+		return set
+	}
+
+	addDep := func(node *taskNode, dep int) {
+		if dep == node.index {
+			return
+		}
+
+		for _, d := range node.deps {
+			if d == dep {
+				return
+			}
+		}
+
+		node.deps = append(node.deps, dep)
+		nodes[dep].dependents = append(nodes[dep].dependents, node.index)
+	}
+
+	for _, node := range nodes {
+		for _, need := range node.task.Needs {
+			id, ok := resolveNeed(need, contextName, func(id string) bool {
+				_, ok := lookup(id)
+				return ok
+			})
+			if !ok {
+				continue
+			}
+
+			dep, _ := lookup(id)
+
+			addDep(node, dep)
+			for _, hook := range afterHooks(nodes[dep].task) {
+				addDep(node, hook)
+			}
+		}
+
+		for _, suffix := range node.task.Hooks.Before {
+			if dep, ok := lookup(node.task.Id + ":" + suffix); ok {
+				addDep(node, dep)
+			}
+		}
+
+		for _, hook := range afterHooks(node.task) {
+			addDep(nodes[hook], node.index)
+		}
+	}
+
+	return nodes
+}
+
+// resolveNeed returns the id of the task a need runs when the workflow
+// runs in contextName: the need:context task when it exists, otherwise
+// the need itself. exists reports whether a task exists, ignoring case.
+func resolveNeed(need string, contextName string, exists func(id string) bool) (string, bool) {
+	if contextName != "" && exists(need+":"+contextName) {
+		return need + ":" + contextName, true
+	}
+
+	if exists(need) {
+		return need, true
+	}
+
+	return "", false
+}
+
+// ancestors returns the indexes of every task the node transitively depends
+// on, sorted by their position in the flattened task list.
+func ancestors(nodes []*taskNode, node *taskNode) []int {
+	seen := map[int]bool{}
+	stack := append([]int{}, node.deps...)
+	for len(stack) > 0 {
+		i := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[i] {
+			continue
+		}
+
+		seen[i] = true
+		stack = append(stack, nodes[i].deps...)
+	}
+
+	set := make([]int, 0, len(seen))
+	for i := range seen {
+		set = append(set, i)
+	}
+
+	sort.Ints(set)
+	return set
+}
+
+type taskDone struct {
+	index int
+	delta *taskDelta
+	err   error
+}
+
+// runGraph runs the flattened tasks as a dependency graph, starting up to
+// Config.Parallelism tasks at once as soon as their dependencies complete.
+//
+// Each task starts from the workflow env with the RUN_ENV and RUN_PATH
+// changes of its dependencies applied in flattened order, so the env a task
+// sees does not depend on which unrelated task happened to finish first.
+// Output of each task is prefixed with its name.
+func (ws *Workflow) runGraph(flatTasks []schema.Task, lastId string, contextName string, envMap *schema.Environment, hostGroups map[string][]string, args []string) error {
+	nodes := newTaskGraph(flatTasks, contextName)
+	limit := ws.Config.Parallelism
+
+	pending := make([]int, len(nodes))
+	for _, node := range nodes {
+		pending[node.index] = len(node.deps)
+	}
+
+	started := make([]bool, len(nodes))
+	failed := make([]bool, len(nodes))
+	deltas := make([]*taskDelta, len(nodes))
+	done := make(chan taskDone)
+	running := 0
+	var firstErr error
+
+	start := func(node *taskNode) error {
+		taskEnv := envMap.Clone()
+		for _, i := range ancestors(nodes, node) {
+			if err := ws.applyDelta(taskEnv, deltas[i]); err != nil {
+				return err
+			}
+		}
+
+		name := node.task.Id
+		if node.task.Name != nil && len(*node.task.Name) > 0 {
+			name = *node.task.Name
+		}
+
+		started[node.index] = true
+		running++
+
+		if lastId != "" && node.task.Id == lastId {
+			go func() {
+				tasks.WriteLine(ws.out(), "\x1b[1m"+name+"\x1b[22m")
+				done <- taskDone{index: node.index}
+			}()
+			return nil
+		}
+
+		go func() {
+			stdout := tasks.NewPrefixWriter(ws.out(), "["+name+"] ")
+			stderr := tasks.NewPrefixWriter(ws.errOut(), "["+name+"] ")
+			delta, err := ws.runTask(node.task, taskEnv, hostGroups, args, stdout, stderr)
+			stdout.Flush()
+			stderr.Flush()
+			done <- taskDone{index: node.index, delta: delta, err: err}
+		}()
+
+		return nil
+	}
+
+	for {
+		if firstErr == nil {
+			for _, node := range nodes {
+				if running >= limit {
+					break
+				}
+
+				if started[node.index] || pending[node.index] > 0 {
+					continue
+				}
+
+				if err := start(node); err != nil {
+					firstErr = err
+					break
+				}
+			}
+		}
+
+		if running == 0 {
+			break
+		}
+
+		result := <-done
+		running--
+
+		if result.err != nil {
+			failed[result.index] = true
+			if firstErr == nil {
+				firstErr = result.err
+			}
+			continue
+		}
+
+		deltas[result.index] = result.delta
+		for _, i := range nodes[result.index].dependents {
+			pending[i]--
+		}
+	}
+
+	if firstErr != nil {
+		ws.skipUnstarted(nodes, started, failed, lastId)
+	}
+
+	return firstErr
+}
+
+// skipUnstarted records a skipped result for every task of the graph that
+// never started, except the last task when it only groups its needs. A
+// task that needs a failed task says which one, the others were not
+// started because the run stopped.
+func (ws *Workflow) skipUnstarted(nodes []*taskNode, started []bool, failed []bool, lastId string) {
+	stopped := ""
+	for _, node := range nodes {
+		if failed[node.index] {
+			stopped = "not started after " + taskName(node.task) + " failed"
+			break
+		}
+	}
+
+	if stopped == "" {
+		stopped = "not started"
+	}
+
+	for _, node := range nodes {
+		if started[node.index] || (lastId != "" && node.task.Id == lastId) {
+			continue
+		}
+
+		message := stopped
+		for _, i := range ancestors(nodes, node) {
+			if failed[i] {
+				message = "needs " + taskName(nodes[i].task) + " failed"
+				break
+			}
+		}
+
+		ws.skipTask(node.task, message)
+	}
+}
@@ -0,0 +1,279 @@
+package workflows
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/frostyeti/mvps/go/run/schema"
+	"github.com/frostyeti/mvps/go/run/tasks/statuses"
+	"github.com/stretchr/testify/assert"
+)
+
+// loadWorkflow writes the runfile to a temporary directory and loads it.
+func loadWorkflow(t *testing.T, runfile string) (*Workflow, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "runfile")
+	runfile = strings.ReplaceAll(runfile, "{dir}", dir)
+	if err := os.WriteFile(file, []byte(runfile), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	rf := schema.NewRunfile()
+	if err := rf.DecodeYAMLFile(file); err != nil {
+		t.Fatal(err)
+	}
+	rf.Path = file
+
+	wf := NewWorkflow()
+	if err := wf.Load(*rf); err != nil {
+		t.Fatal(err)
+	}
+
+	return wf, dir
+}
+
+func TestNewTaskGraph(t *testing.T) {
+	task := func(id string, needs ...string) schema.Task {
+		return schema.Task{Id: id, Needs: needs}
+	}
+
+	tests := []struct {
+		name    string
+		tasks   []schema.Task
+		context string
+		deps    map[string][]string
+	}{
+		{
+			name:  "needs",
+			tasks: []schema.Task{task("a"), task("b", "a"), task("c", "a"), task("d", "b", "c")},
+			deps:  map[string][]string{"a": {}, "b": {"a"}, "c": {"a"}, "d": {"b", "c"}},
+		},
+		{
+			name:  "needs ignore case",
+			tasks: []schema.Task{task("One"), task("two", "ONE")},
+			deps:  map[string][]string{"One": {}, "two": {"One"}},
+		},
+		{
+			name:    "needs prefer the task of the context",
+			tasks:   []schema.Task{task("db"), task("db:prod"), task("app", "db")},
+			context: "prod",
+			deps:    map[string][]string{"db": {}, "db:prod": {}, "app": {"db:prod"}},
+		},
+		{
+			name: "hooks",
+			tasks: []schema.Task{
+				task("test:before"),
+				{Id: "test", Hooks: schema.Hooks{Before: []string{"before"}, After: []string{"after"}}},
+				task("test:after"),
+				task("deploy", "test"),
+			},
+			deps: map[string][]string{
+				"test:before": {},
+				"test":        {"test:before"},
+				"test:after":  {"test"},
+				"deploy":      {"test", "test:after"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes := newTaskGraph(tt.tasks, tt.context)
+			deps := map[string][]string{}
+			for _, node := range nodes {
+				ids := []string{}
+				for _, dep := range node.deps {
+					ids = append(ids, nodes[dep].task.Id)
+				}
+				deps[node.task.Id] = ids
+			}
+
+			assert.Equal(t, tt.deps, deps)
+		})
+	}
+}
+
+func TestAncestors(t *testing.T) {
+	tasks := []schema.Task{
+		{Id: "a"},
+		{Id: "b", Needs: []string{"a"}},
+		{Id: "c"},
+		{Id: "d", Needs: []string{"b", "c"}},
+	}
+
+	nodes := newTaskGraph(tasks, "")
+	assert.Equal(t, []int{0, 1, 2}, ancestors(nodes, nodes[3]))
+	assert.Equal(t, []int{0}, ancestors(nodes, nodes[1]))
+	assert.Equal(t, []int{}, ancestors(nodes, nodes[0]))
+}
+
+// TestRunGraph runs tasks at the same time, each finding bash through its
+// own BASH_EXE variable, and is meant to be run with -race.
+func TestRunGraph(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the tasks use bash wrappers written as shell scripts")
+	}
+
+	if _, err := os.Stat("/bin/bash"); err != nil {
+		t.Skip("bash not found")
+	}
+
+	wf, dir := loadWorkflow(t, `
+tasks:
+  a:
+    uses: bash
+    env:
+      BASH_EXE: "{dir}/bash-a"
+    run: echo a >> "{dir}/log"
+  b:
+    uses: bash
+    needs: [a]
+    env:
+      BASH_EXE: "{dir}/bash-b"
+    run: sleep 0.2; echo b >> "{dir}/log"
+  c:
+    uses: bash
+    needs: [a]
+    env:
+      BASH_EXE: "{dir}/bash-c"
+    run: sleep 0.2; echo c >> "{dir}/log"
+  d:
+    uses: bash
+    needs: [b, c]
+    env:
+      BASH_EXE: "{dir}/bash-d"
+    run: echo d >> "{dir}/log"
+`)
+
+	for _, id := range []string{"a", "b", "c", "d"} {
+		wrapper := "#!/bin/sh\necho " + id + " > \"" + dir + "/used-" + id + "\"\nexec /bin/bash \"$@\"\n"
+		if err := os.WriteFile(filepath.Join(dir, "bash-"+id), []byte(wrapper), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wf.Config.Parallelism = 4
+	assert.NoError(t, wf.Run([]string{"d"}, nil))
+
+	data, err := os.ReadFile(filepath.Join(dir, "log"))
+	assert.NoError(t, err)
+	lines := strings.Fields(string(data))
+	assert.Len(t, lines, 4)
+	assert.Equal(t, "a", lines[0])
+	assert.ElementsMatch(t, []string{"b", "c"}, lines[1:3])
+	assert.Equal(t, "d", lines[3])
+
+	// each task ran with the bash of its own env
+	for _, id := range []string{"a", "b", "c", "d"} {
+		used, err := os.ReadFile(filepath.Join(dir, "used-"+id))
+		assert.NoError(t, err)
+		assert.Equal(t, id, strings.TrimSpace(string(used)))
+	}
+}
+
+func TestRunMatrixHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the tasks append to the log with bash")
+	}
+
+	if _, err := os.Stat("/bin/bash"); err != nil {
+		t.Skip("bash not found")
+	}
+
+	wf, dir := loadWorkflow(t, `
+tasks:
+  test:pre:
+    uses: bash
+    run: sleep 0.2; echo pre >> "{dir}/log"
+  test:
+    uses: bash
+    matrix:
+      os: [linux, windows, darwin]
+    hooks:
+      before: [pre]
+      after: [post]
+    run: echo $MATRIX_OS >> "{dir}/log"
+  test:post:
+    uses: bash
+    run: echo post >> "{dir}/log"
+`)
+
+	wf.Config.Parallelism = 4
+	assert.NoError(t, wf.Run([]string{"test"}, nil))
+
+	data, err := os.ReadFile(filepath.Join(dir, "log"))
+	assert.NoError(t, err)
+	lines := strings.Fields(string(data))
+	assert.Len(t, lines, 5)
+	assert.Equal(t, "pre", lines[0])
+	assert.ElementsMatch(t, []string{"linux", "windows", "darwin"}, lines[1:4])
+	assert.Equal(t, "post", lines[4])
+}
+
+func TestRunSkipsUnstartedTasks(t *testing.T) {
+	tests := []struct {
+		name        string
+		parallelism int
+		targets     []string
+		want        map[string]string
+	}{
+		{
+			name:        "sequential",
+			parallelism: 1,
+			targets:     []string{"c", "d"},
+			want: map[string]string{
+				"a": "error",
+				"b": "skipped: needs a failed",
+				"c": "skipped: needs a failed",
+				"d": "skipped: not started after a failed",
+			},
+		},
+		{
+			name:        "graph",
+			parallelism: 4,
+			targets:     []string{"c"},
+			want: map[string]string{
+				"a": "error",
+				"b": "skipped: needs a failed",
+				"c": "skipped: needs a failed",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wf, _ := loadWorkflow(t, `
+tasks:
+  a:
+    run: exit 1
+  b:
+    needs: [a]
+    run: echo b
+  c:
+    needs: [b]
+    run: echo c
+  d:
+    run: echo d
+`)
+
+			wf.Config.Parallelism = tt.parallelism
+			assert.Error(t, wf.Run(tt.targets, nil))
+
+			got := map[string]string{}
+			for _, result := range wf.Results() {
+				status := statuses.Name(result.Status)
+				if result.Message != "" {
+					status += ": " + result.Message
+				}
+				got[result.Id] = status
+			}
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,302 @@
+package workflows
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/frostyeti/mvps/go/run/schema"
+	"github.com/frostyeti/mvps/go/run/tasks"
+)
+
+// serviceLogLines is how many of the last lines of a service log are
+// written when the service or the workflow fails.
+const serviceLogLines = 50
+
+// service is a task that runs in the background until the workflow stops it.
+type service struct {
+	id      string
+	name    string
+	logFile string
+	log     *os.File
+	cancel  context.CancelFunc
+	done    chan struct{}
+	result  *tasks.TaskResult
+	once    sync.Once
+}
+
+// startService starts a service task in the background with its output
+// written to its log file and waits until its probe passes. The service
+// runs with the context of the workflow rather than the timeout of the
+// task, it runs until the workflow stops it.
+func (ws *Workflow) startService(task schema.Task, name string, tc tasks.TaskContext) (*tasks.TaskResult, error) {
+	res := tasks.NewTaskResult().Start()
+
+	logFile, err := ws.stateFile("logs", task, ".log")
+	if err != nil {
+		return res.Fail(err), err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(logFile), 0o755); err != nil {
+		return res.Fail(err), err
+	}
+
+	log, err := os.Create(logFile)
+	if err != nil {
+		return res.Fail(err), err
+	}
+
+	ctx, cancel := context.WithCancel(ws.ctx)
+	svc := &service{
+		id:      task.Id,
+		name:    name,
+		logFile: logFile,
+		log:     log,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+
+	probe := task.Service.Ready
+	var matcher *lineMatcher
+	var out io.Writer = log
+	if probe != nil && probe.Kind == schema.ProbeLog {
+		matcher = newLineMatcher(regexp.MustCompile(probe.Target))
+		out = io.MultiWriter(log, matcher)
+	}
+
+	tc.Context = ctx
+	tc.Stdout = out
+	tc.Stderr = out
+
+	ws.servicesMu.Lock()
+	ws.services = append(ws.services, svc)
+	ws.servicesMu.Unlock()
+
+	go func() {
+		defer close(svc.done)
+		svc.result = tasks.Run(tc)
+	}()
+
+	// the log is written when the workflow stops its services
+	if err := ws.waitReady(svc, probe, matcher, tc); err != nil {
+		svc.stop()
+		return res.Fail(err), err
+	}
+
+	tasks.WriteLine(ws.out(), "\x1b[2m"+name+" is ready, its output is written to "+logFile+"\x1b[22m")
+	return res.Ok(), nil
+}
+
+// waitReady tries the probe every interval until it passes, the service
+// exits, the probe times out or the workflow is cancelled. A service
+// without a probe is ready once it started.
+func (ws *Workflow) waitReady(svc *service, probe *schema.Probe, matcher *lineMatcher, tc tasks.TaskContext) error {
+	if probe == nil {
+		select {
+		case <-svc.done:
+			return svc.exitError("before it was ready")
+		default:
+			return nil
+		}
+	}
+
+	deadline := time.NewTimer(probe.Timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(probe.Interval)
+	defer ticker.Stop()
+
+	var matched <-chan struct{}
+	if matcher != nil {
+		matched = matcher.matched
+	}
+
+	for {
+		if matcher == nil && ws.probe(svc, probe, tc) {
+			return nil
+		}
+
+		select {
+		case <-matched:
+			return nil
+		case <-svc.done:
+			return svc.exitError("before it was ready")
+		case <-deadline.C:
+			return errors.New("service " + svc.id + " was not ready after " + probe.Timeout.String())
+		case <-ws.ctx.Done():
+			return cancelledError(ws.ctx, ws.Config.Timeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+// probe tries the tcp, http or run probe once. The output of a run probe
+// is written to the log of the service.
+func (ws *Workflow) probe(svc *service, probe *schema.Probe, tc tasks.TaskContext) bool {
+	switch probe.Kind {
+	case schema.ProbeTcp:
+		conn, err := net.DialTimeout("tcp", probe.Target, probe.Interval)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+
+	case schema.ProbeHttp:
+		ctx, cancel := context.WithTimeout(ws.ctx, probe.Interval)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, probe.Target, nil)
+		if err != nil {
+			return false
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return false
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+
+	case schema.ProbeRun:
+		model := *tc.Task
+		model.Run = probe.Target
+		model.Uses = *ws.Config.Shell
+		model.Args = nil
+		model.Retry = nil
+		model.Hosts = *schema.NewHosts()
+
+		tc.Task = &model
+		tc.Context = ws.ctx
+		tc.Stdout = svc.log
+		tc.Stderr = svc.log
+		result := tasks.Run(tc)
+		return result.Err == nil
+	}
+
+	return false
+}
+
+// stopServices stops the services the workflow started, the last started
+// first. When failed is true, the logs of the services are written to
+// stderr. An error is returned for a service that exited with an error
+// before it was stopped, a service that exited with 0 is not an error.
+func (ws *Workflow) stopServices(failed bool) error {
+	ws.servicesMu.Lock()
+	services := ws.services
+	ws.services = nil
+	ws.servicesMu.Unlock()
+
+	var exitErr error
+	for i := len(services) - 1; i >= 0; i-- {
+		svc := services[i]
+		exited := false
+		select {
+		case <-svc.done:
+			exited = true
+		default:
+		}
+
+		if !exited {
+			tasks.WriteLine(ws.out(), "\x1b[2mstopping "+svc.name+"\x1b[22m")
+		}
+
+		svc.stop()
+		crashed := exited && svc.result != nil && svc.result.Err != nil
+		if crashed && exitErr == nil {
+			exitErr = svc.exitError("while the workflow ran")
+		}
+
+		if failed || crashed {
+			svc.writeLog(ws.errOut())
+		}
+	}
+
+	return exitErr
+}
+
+// stop cancels the service, waits for it to exit and closes its log.
+func (svc *service) stop() {
+	svc.once.Do(func() {
+		svc.cancel()
+		<-svc.done
+		svc.log.Close()
+	})
+}
+
+// exitError describes a service that exited on its own.
+func (svc *service) exitError(when string) error {
+	msg := "service " + svc.id + " exited " + when
+	if svc.result != nil && svc.result.Err != nil {
+		return errors.New(msg + ": " + svc.result.Err.Error())
+	}
+
+	return errors.New(msg)
+}
+
+// writeLog writes the last lines of the log of the service to w.
+func (svc *service) writeLog(w io.Writer) {
+	data, err := os.ReadFile(svc.logFile)
+	if err != nil {
+		return
+	}
+
+	lines := strings.Split(strings.TrimRight(string(data), "\r\n"), "\n")
+	if len(lines) > serviceLogLines {
+		lines = lines[len(lines)-serviceLogLines:]
+	}
+
+	b := &strings.Builder{}
+	b.WriteString("\x1b[1m" + svc.name + "\x1b[22m log (" + svc.logFile + "):\n")
+	for _, line := range lines {
+		b.WriteString("  " + line + "\n")
+	}
+
+	tasks.WriteLine(w, strings.TrimRight(b.String(), "\n"))
+}
+
+// lineMatcher is a writer that closes matched once a line written to it
+// matches the pattern.
+type lineMatcher struct {
+	pattern *regexp.Regexp
+	matched chan struct{}
+	buf     bytes.Buffer
+	once    sync.Once
+	mu      sync.Mutex
+}
+
+func newLineMatcher(pattern *regexp.Regexp) *lineMatcher {
+	return &lineMatcher{
+		pattern: pattern,
+		matched: make(chan struct{}),
+	}
+}
+
+func (m *lineMatcher) Write(p []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.buf.Write(p)
+	for {
+		i := bytes.IndexByte(m.buf.Bytes(), '\n')
+		if i < 0 {
+			break
+		}
+
+		line := strings.TrimRight(string(m.buf.Next(i+1)), "\r\n")
+		if m.pattern.MatchString(line) {
+			m.once.Do(func() { close(m.matched) })
+		}
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,226 @@
+package workflows
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServices(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	// an address nothing listens on
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddr := closed.Addr().String()
+	closed.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		service string
+		tasks   string
+		err     string
+		stdout  []string
+		stderr  []string
+	}{
+		{
+			name:    "tcp probe",
+			service: "db",
+			tasks: `
+  db:
+    service:
+      ready: {tcp: "{addr}", interval: 50ms}
+    run: sleep 30
+`,
+			stdout: []string{"db is ready", "stopping db"},
+		},
+		{
+			name:    "http probe",
+			service: "api",
+			tasks: `
+  api:
+    service:
+      ready: {http: "{url}/health", interval: 50ms}
+    run: sleep 30
+`,
+			stdout: []string{"api is ready", "stopping api"},
+		},
+		{
+			name:    "log probe",
+			service: "api",
+			tasks: `
+  api:
+    service:
+      ready: {log: 'listening on \d+$', interval: 50ms}
+    run: echo starting; sleep 0.2; echo listening on 8080; sleep 30
+`,
+			stdout: []string{"api is ready", "stopping api"},
+		},
+		{
+			name:    "run probe",
+			service: "api",
+			tasks: `
+  api:
+    service:
+      ready: {run: 'test -f "{dir}/ready"', interval: 50ms}
+    run: sleep 0.2; touch "{dir}/ready"; sleep 30
+`,
+			stdout: []string{"api is ready", "stopping api"},
+		},
+		{
+			name:    "no probe",
+			service: "api",
+			tasks: `
+  api:
+    service: true
+    run: sleep 30
+`,
+			stdout: []string{"api is ready", "stopping api"},
+		},
+		{
+			name:    "probe timeout",
+			service: "db",
+			tasks: `
+  db:
+    service:
+      ready: {tcp: "{closed}", interval: 50ms, timeout: 300ms}
+    run: sleep 30
+`,
+			err: "service db was not ready after 300ms",
+		},
+		{
+			name:    "log probe timeout",
+			service: "api",
+			tasks: `
+  api:
+    service:
+      ready: {log: never, interval: 50ms, timeout: 300ms}
+    run: echo starting; sleep 30
+`,
+			err: "service api was not ready after 300ms",
+		},
+		{
+			name:    "exits before it is ready",
+			service: "db",
+			tasks: `
+  db:
+    service:
+      ready: {tcp: "{closed}", interval: 50ms}
+    run: echo no config; exit 3
+`,
+			err:    "service db exited before it was ready",
+			stderr: []string{"db\x1b[22m log", "  no config"},
+		},
+		{
+			name:    "exits while the workflow runs",
+			service: "db",
+			tasks: `
+  db:
+    service:
+      ready: {log: started, interval: 50ms}
+    run: echo started; sleep 0.2; echo crashed; exit 3
+`,
+			err:    "service db exited while the workflow ran",
+			stderr: []string{"  started", "  crashed"},
+		},
+	}
+
+	replacer := strings.NewReplacer("{addr}", listener.Addr().String(), "{closed}", closedAddr, "{url}", server.URL)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the task after the service runs once the service is ready and
+			// outlives a service that crashes
+			runfile := `
+env:
+  RUN_STATE_HOME: "{dir}/state"
+tasks:` + replacer.Replace(tt.tasks) + `
+  test:
+    needs: [` + tt.service + `]
+    run: sleep 0.5; echo test > "{dir}/test"
+`
+			wf, dir := loadWorkflow(t, runfile)
+			stdout := &bytes.Buffer{}
+			stderr := &bytes.Buffer{}
+			wf.stdout = stdout
+			wf.stderr = stderr
+
+			start := time.Now()
+			err := wf.Run([]string{"test"}, nil)
+			assert.Less(t, time.Since(start), 10*time.Second)
+
+			_, statErr := os.Stat(filepath.Join(dir, "test"))
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+			} else {
+				assert.NoError(t, err)
+				assert.NoError(t, statErr)
+			}
+
+			for _, s := range tt.stdout {
+				assert.Contains(t, stdout.String(), s)
+			}
+
+			for _, s := range tt.stderr {
+				assert.Contains(t, stderr.String(), s)
+			}
+		})
+	}
+}
+
+func TestStopServicesInReverseOrder(t *testing.T) {
+	wf, dir := loadWorkflow(t, `
+env:
+  RUN_STATE_HOME: "{dir}/state"
+tasks:
+  db:
+    service: true
+    run: trap 'echo db >> "{dir}/stopped"; exit 0' TERM; while true; do sleep 0.05; done
+  cache:
+    service: true
+    needs: [db]
+    run: trap 'echo cache >> "{dir}/stopped"; exit 0' TERM; while true; do sleep 0.05; done
+  api:
+    service: true
+    needs: [cache]
+    run: trap 'echo api >> "{dir}/stopped"; exit 0' TERM; while true; do sleep 0.05; done
+  test:
+    needs: [api]
+    run: sleep 0.2
+`)
+	stdout := &bytes.Buffer{}
+	wf.stdout = stdout
+
+	assert.NoError(t, wf.Run([]string{"test"}, nil))
+
+	// the last service started is stopped first
+	data, err := os.ReadFile(filepath.Join(dir, "stopped"))
+	assert.NoError(t, err)
+	assert.Equal(t, "api\ncache\ndb\n", string(data))
+
+	out := stdout.String()
+	api := strings.Index(out, "stopping api")
+	cache := strings.Index(out, "stopping cache")
+	db := strings.Index(out, "stopping db")
+	assert.True(t, api >= 0 && api < cache && cache < db, out)
+}
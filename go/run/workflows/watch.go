@@ -0,0 +1,319 @@
+package workflows
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/frostyeti/mvps/go/run/schema"
+	"github.com/frostyeti/mvps/go/run/tasks"
+	"github.com/fsnotify/fsnotify"
+	"github.com/gobwas/glob"
+)
+
+// watchDebounce is how long the watcher waits for the changes to settle
+// before it runs the tasks again, so that saving many files runs them once.
+const watchDebounce = 300 * time.Millisecond
+
+// watchSet holds the compiled watch patterns of the tasks that run in dir.
+type watchSet struct {
+	dir      string
+	includes []glob.Glob
+	excludes []glob.Glob
+	roots    []string
+	ignores  []*gitignore
+}
+
+// Watch runs the tasks and runs them again whenever a file that matches the
+// watch patterns of one of the tasks changes, or their sources when a task
+// has no watch patterns. A change cancels the run in progress. Watch returns
+// when the context of the workflow is done.
+func (ws *Workflow) Watch(taskNames []string, args []string) error {
+	if ws == nil {
+		return errors.New("workflow is nil")
+	}
+
+	if len(taskNames) == 0 {
+		taskNames = []string{"default"}
+	}
+
+	contextName := ws.ContextName
+	if len(contextName) == 0 {
+		contextName = "default"
+	}
+
+	flatTasks, err := ws.Tasks.FlattenTasks(taskNames, contextName)
+	if err != nil {
+		return err
+	}
+
+	sets, err := ws.watchSets(flatTasks)
+	if err != nil {
+		return err
+	}
+
+	if len(sets) == 0 {
+		return errors.New("nothing to watch: none of the tasks " + strings.Join(taskNames, ", ") + " have watch or sources patterns")
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return errors.New("failed to create file watcher: " + err.Error())
+	}
+	defer watcher.Close()
+
+	for _, set := range sets {
+		for _, root := range set.roots {
+			if err := set.addDirs(watcher, filepath.Join(set.dir, filepath.FromSlash(root))); err != nil {
+				return err
+			}
+		}
+	}
+
+	parent := ws.Context
+	if parent == nil {
+		parent = context.Background()
+	}
+	defer func() {
+		ws.Context = parent
+	}()
+
+	var cancel context.CancelFunc
+	var done chan struct{}
+	start := func() {
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(parent)
+		ws.Context = ctx
+		ws.resultsMu.Lock()
+		ws.results = nil
+		ws.resultsMu.Unlock()
+
+		done = make(chan struct{})
+		go func(ctx context.Context, done chan struct{}) {
+			defer close(done)
+			err := ws.Run(taskNames, args)
+			if err != nil && ctx.Err() == nil {
+				tasks.WriteLine(os.Stderr, "\x1b[31m"+err.Error()+"\x1b[0m")
+			}
+
+			if ctx.Err() == nil {
+				tasks.WriteLine(os.Stdout, "\x1b[2mwatching for changes\x1b[22m")
+			}
+		}(ctx, done)
+	}
+
+	stop := func() {
+		cancel()
+		<-done
+	}
+
+	start()
+
+	var timer *time.Timer
+	var fire <-chan time.Time
+	changed := ""
+	for {
+		select {
+		case <-parent.Done():
+			stop()
+			return nil
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				stop()
+				return nil
+			}
+
+			tasks.WriteLine(os.Stderr, "\x1b[31mwatch error: "+err.Error()+"\x1b[0m")
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				stop()
+				return nil
+			}
+
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+
+			matched := false
+			for _, set := range sets {
+				if _, ok := set.rel(event.Name); ok && event.Has(fsnotify.Create) && isDir(event.Name) {
+					set.addDirs(watcher, event.Name)
+				}
+
+				if set.match(event.Name) {
+					matched = true
+				}
+			}
+
+			if !matched {
+				continue
+			}
+
+			changed = event.Name
+			if timer == nil {
+				timer = time.NewTimer(watchDebounce)
+			} else {
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(watchDebounce)
+			}
+			fire = timer.C
+
+		case <-fire:
+			fire = nil
+			name := changed
+			if cwd, err := os.Getwd(); err == nil {
+				if rel, err := filepath.Rel(cwd, changed); err == nil && !strings.HasPrefix(rel, "..") {
+					name = rel
+				}
+			}
+
+			tasks.WriteLine(os.Stdout, "\x1b[2m"+name+" changed, running "+strings.Join(taskNames, ", ")+" again\x1b[22m")
+			stop()
+			start()
+		}
+	}
+}
+
+// watchSets returns the watch patterns of the tasks grouped by the
+// directory the patterns are relative to.
+func (ws *Workflow) watchSets(flatTasks []schema.Task) ([]*watchSet, error) {
+	runDir, ok := ws.Env.Get("RUN_DIR")
+	if !ok {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		runDir = cwd
+	}
+
+	byDir := map[string]*watchSet{}
+	sets := []*watchSet{}
+	for _, task := range flatTasks {
+		patterns := task.Watch
+		if len(patterns) == 0 {
+			patterns = task.Sources
+		}
+
+		if len(patterns) == 0 {
+			continue
+		}
+
+		dir, _ := ws.taskDir(task, runDir)
+		set, ok := byDir[dir]
+		if !ok {
+			set = &watchSet{dir: dir, ignores: loadGitignores(dir)}
+			byDir[dir] = set
+			sets = append(sets, set)
+		}
+
+		for _, pattern := range patterns {
+			exclude := strings.HasPrefix(pattern, "!")
+			pattern = filepath.ToSlash(strings.TrimPrefix(pattern, "!"))
+			pattern = strings.TrimPrefix(pattern, "./")
+
+			g, err := compileGlob(pattern)
+			if err != nil {
+				return nil, errors.New("invalid watch pattern: " + pattern + " for task: " + task.Id + " error: " + err.Error())
+			}
+
+			if exclude {
+				set.excludes = append(set.excludes, g)
+				continue
+			}
+
+			set.includes = append(set.includes, g)
+			set.roots = append(set.roots, globRoot(pattern))
+		}
+	}
+
+	return sets, nil
+}
+
+// taskDir returns the directory the patterns of the task are relative to:
+// its cwd, the directory of its included runfile or runDir. It reports
+// whether the task has a directory of its own, a cwd or an include.
+func (ws *Workflow) taskDir(task schema.Task, runDir string) (string, bool) {
+	dir := runDir
+	own := false
+	if inc, ok := ws.includes[task.Id]; ok {
+		dir = inc.dir
+		own = true
+	}
+
+	// a cwd that is expanded when the task runs cannot be known here
+	if task.Cwd != nil && len(*task.Cwd) > 0 && !strings.ContainsRune(*task.Cwd, '$') && !strings.Contains(*task.Cwd, "{{") {
+		if filepath.IsAbs(*task.Cwd) {
+			dir = *task.Cwd
+		} else {
+			dir = filepath.Join(dir, *task.Cwd)
+		}
+		own = true
+	}
+
+	return filepath.Clean(dir), own
+}
+
+// addDirs watches dir and the directories under it, other than .git and
+// the directories that are ignored by .gitignore.
+func (set *watchSet) addDirs(watcher *fsnotify.Watcher, dir string) error {
+	if !isDir(dir) {
+		return nil
+	}
+
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		if !d.IsDir() {
+			return nil
+		}
+
+		if d.Name() == ".git" || ignored(set.ignores, path, true) {
+			return filepath.SkipDir
+		}
+
+		if err := watcher.Add(path); err != nil {
+			return errors.New("failed to watch directory: " + path + " error: " + err.Error())
+		}
+
+		return nil
+	})
+}
+
+// match reports whether the changed path matches the patterns of the set
+// and is not ignored.
+func (set *watchSet) match(path string) bool {
+	rel, ok := set.rel(path)
+	if !ok {
+		return false
+	}
+
+	if !matchAny(set.includes, rel) || matchAny(set.excludes, rel) {
+		return false
+	}
+
+	return !ignored(set.ignores, path, false)
+}
+
+// rel returns path relative to the directory of the set, with slashes, or
+// false when path is not under the directory.
+func (set *watchSet) rel(path string) (string, bool) {
+	rel, err := filepath.Rel(set.dir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+
+	return filepath.ToSlash(rel), true
+}
@@ -2,9 +2,14 @@ package workflows
 
 import (
 	"context"
+	"io"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/frostyeti/mvps/go/run/schema"
+	"github.com/frostyeti/mvps/go/run/tasks"
+	"github.com/frostyeti/mvps/go/secrets"
 )
 
 type Workflow struct {
@@ -20,11 +25,47 @@ type Workflow struct {
 	Hosts        schema.Hosts
 	Values       map[string]interface{}
 	Args         []string
+	Inputs       map[string]string
 	ContextName  string
 	Context      context.Context
-	cleanupEnv   bool
-	cleanupPath  bool
-	parent       *Workflow
+	Force        bool
+	NoInput      bool
+	AssumeYes    bool
+	DryRun       bool
+	Affected     bool
+	Since        string
+	FailFast     bool
+	KeepGoing    bool
+	// Parallel is the maximum number of tasks that run at the same time,
+	// in the workflow and in each of its projects, and overrides
+	// config.parallelism when it is set.
+	Parallel int
+	// ProjectParallelism is the maximum number of projects RunEach runs at
+	// the same time, 1 when it is not set.
+	ProjectParallelism int
+	ctx                context.Context
+	cleanupEnv         bool
+	cleanupPath        bool
+	parent             *Workflow
+	baseEnv            *schema.Environment
+	context            *schema.Context
+	contexts           schema.Contexts
+	affected           map[string]bool
+	projectDir         string
+	includes           map[string]*include
+	targets            []string
+	answers            map[string]schema.With
+	lockfile           *schema.Lockfile
+	masker             *secrets.SecretMasker
+	results            []*tasks.TaskResult
+	outputs            map[string]map[string]interface{}
+	resultsMu          sync.Mutex
+	services           []*service
+	stdout             io.Writer
+	stderr             io.Writer
+	servicesMu         sync.Mutex
+	startedAt          time.Time
+	endedAt            time.Time
 }
 
 func NewWorkflow() *Workflow {
@@ -56,6 +97,8 @@ func NewWorkflow() *Workflow {
 		},
 
 		DynamicTasks: map[string]schema.TaskDef{},
+		includes:     map[string]*include{},
+		context:      schema.NewContext(defaultContext),
 
 		Env:         schema.NewEnv(),
 		Values:      map[string]interface{}{},
@@ -67,8 +110,59 @@ func NewWorkflow() *Workflow {
 		Tasks:       *schema.NewTasks(),
 		Hosts:       *schema.NewHosts(),
 		Args:        []string{},
+		Inputs:      map[string]string{},
 		Context:     context.Background(),
+		masker:      secrets.NewSecretMasker(),
 		cleanupEnv:  false,
 		cleanupPath: false,
 	}
 }
+
+func (ws *Workflow) recordResult(result *tasks.TaskResult) {
+	ws.resultsMu.Lock()
+	defer ws.resultsMu.Unlock()
+	ws.results = append(ws.results, result)
+}
+
+// Results returns the results of the tasks that ran, in the order they
+// finished, followed by those that never started as skipped.
+func (ws *Workflow) Results() []*tasks.TaskResult {
+	ws.resultsMu.Lock()
+	defer ws.resultsMu.Unlock()
+	return append([]*tasks.TaskResult{}, ws.results...)
+}
+
+// out returns the writer for the task output and status lines, stdout
+// unless the workflow runs as one of several projects at once.
+func (ws *Workflow) out() io.Writer {
+	if ws.stdout != nil {
+		return ws.stdout
+	}
+
+	return os.Stdout
+}
+
+// errOut returns the writer for the task errors and service logs.
+func (ws *Workflow) errOut() io.Writer {
+	if ws.stderr != nil {
+		return ws.stderr
+	}
+
+	return os.Stderr
+}
+
+// Cleanup removes the RUN_ENV and RUN_PATH files the workflow created when
+// it loaded, for workflows that are loaded but never run.
+func (ws *Workflow) Cleanup() {
+	if ws.cleanupEnv {
+		if file := ws.Env.GetString("RUN_ENV"); len(file) > 0 && isFile(file) {
+			os.Remove(file)
+		}
+	}
+
+	if ws.cleanupPath {
+		if file := ws.Env.GetString("RUN_PATH"); len(file) > 0 && isFile(file) {
+			os.Remove(file)
+		}
+	}
+}
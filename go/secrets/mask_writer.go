@@ -0,0 +1,126 @@
+package secrets
+
+import (
+	"io"
+	"sync"
+	"unicode/utf8"
+)
+
+// MaskWriter masks the values of a SecretMasker in everything written to
+// the underlying writer. Text that may be the start of a secret is held
+// back until the next write shows whether it is one, so that secrets split
+// across writes are still masked. Flush writes any text held back.
+type MaskWriter struct {
+	w      io.Writer
+	masker *SecretMasker
+	buf    []byte
+	mu     sync.Mutex
+}
+
+func NewMaskWriter(w io.Writer, masker *SecretMasker) *MaskWriter {
+	return &MaskWriter{
+		w:      w,
+		masker: masker,
+		buf:    []byte{},
+	}
+}
+
+func (m *MaskWriter) Write(p []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.buf = append(m.buf, p...)
+	if err := m.flush(false); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// Flush masks and writes any text that was held back.
+func (m *MaskWriter) Flush() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.flush(true)
+}
+
+func (m *MaskWriter) flush(final bool) error {
+	if len(m.buf) == 0 {
+		return nil
+	}
+
+	end := len(m.buf)
+	if !final {
+		end = completeRunes(m.buf)
+	}
+
+	m.masker.mu.RLock()
+	text := []rune(string(m.buf[:end]))
+	hits := searchAll(string(text), m.masker.values)
+	cut := len(text)
+	if !final {
+		cut -= partialSuffix(text, m.masker.values)
+		for _, hit := range hits {
+			if hit.Start < cut && hit.End() > cut {
+				cut = hit.Start
+			}
+		}
+	}
+	m.masker.mu.RUnlock()
+
+	if cut == 0 {
+		return nil
+	}
+
+	safe := []searchHit{}
+	for _, hit := range hits {
+		if hit.End() <= cut {
+			safe = append(safe, hit)
+		}
+	}
+
+	out := replace(string(text[:cut]), safe, "****")
+	rest := append([]byte(string(text[cut:])), m.buf[end:]...)
+	m.buf = rest
+
+	_, err := io.WriteString(m.w, out)
+	return err
+}
+
+// completeRunes returns the length of b without a trailing incomplete
+// utf-8 sequence.
+func completeRunes(b []byte) int {
+	for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			if !utf8.FullRune(b[i:]) {
+				return i
+			}
+			break
+		}
+	}
+
+	return len(b)
+}
+
+// partialSuffix returns the length of the longest suffix of text that is
+// the start, but not the whole, of one of the values.
+func partialSuffix(text []rune, values []string) int {
+	longest := 0
+	for _, value := range values {
+		v := []rune(value)
+		k := len(v) - 1
+		if k > len(text) {
+			k = len(text)
+		}
+
+		for ; k > longest; k-- {
+			if hasPrefixFold(v, text[len(text)-k:]) {
+				longest = k
+				break
+			}
+		}
+	}
+
+	return longest
+}
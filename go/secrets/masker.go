@@ -3,12 +3,15 @@ package secrets
 import (
 	"slices"
 	"sort"
+	"strings"
+	"sync"
 	"unicode"
 )
 
 type SecretMasker struct {
 	values    []string
 	generator []func(string) string
+	mu        sync.RWMutex
 }
 
 var DefaultMasker = NewSecretMasker()
@@ -21,15 +24,35 @@ func NewSecretMasker() *SecretMasker {
 }
 
 func (s *SecretMasker) AddGenerator(gen func(string) string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.generator = append(s.generator, gen)
 }
 
+// AddValue adds a secret to mask. Each line of a multi-line secret is also
+// masked on its own, as output is often written line by line.
 func (s *SecretMasker) AddValue(value string) {
 	if value == "" {
 		return
 	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if slices.Contains(s.values, value) {
+		return
+	}
+
 	s.values = append(s.values, value)
 
+	if strings.ContainsAny(value, "\r\n") {
+		for _, line := range strings.FieldsFunc(value, func(r rune) bool { return r == '\r' || r == '\n' }) {
+			if strings.TrimSpace(line) != "" && !slices.Contains(s.values, line) {
+				s.values = append(s.values, line)
+			}
+		}
+	}
+
 	for _, gen := range s.generator {
 		value = gen(value)
 		s.values = append(s.values, value)
@@ -40,7 +63,16 @@ func (s *SecretMasker) AddValue(value string) {
 
 }
 
+// Len returns the number of values that are masked.
+func (s *SecretMasker) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.values)
+}
+
 func (s *SecretMasker) ApplyGenerators(input string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	for _, gen := range s.generator {
 		input = gen(input)
 	}
@@ -48,6 +80,9 @@ func (s *SecretMasker) ApplyGenerators(input string) string {
 }
 
 func (s *SecretMasker) Mask(input string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	if len(input) == 0 || len(s.values) == 0 {
 		return input
 	}
@@ -86,48 +121,55 @@ func search(haystack []rune, needle []rune) []searchHit {
 		return []searchHit{}
 	}
 
-	j := 0
-
 	hits := []searchHit{}
-	for i := 0; i < l; i++ {
-		if j == n {
-			hit := searchHit{Start: i - j, Length: n}
-			hits = append(hits, hit)
-			j = 0
+	for i := 0; i+n <= l; {
+		if hasPrefixFold(haystack[i:], needle) {
+			hits = append(hits, searchHit{Start: i, Length: n})
+			i += n
+			continue
 		}
 
-		if j < n {
-			sr := haystack[i]
-			tr := needle[j]
-
-			if sr == tr {
-				j++
-				continue
-			}
+		i++
+	}
 
-			if tr < sr {
-				tr, sr = sr, tr
-			}
+	return hits
+}
 
-			if 'A' <= sr && sr <= 'Z' && tr == sr+'a'-'A' {
-				j++
-				continue
-			}
+// hasPrefixFold reports whether s starts with prefix under simple
+// unicode case folding.
+func hasPrefixFold(s []rune, prefix []rune) bool {
+	if len(s) < len(prefix) {
+		return false
+	}
 
-			r := unicode.SimpleFold(sr)
-			for r != sr && r < tr {
-				r = unicode.SimpleFold(r)
-			}
-			if r == tr {
-				j++
-				continue
-			}
+	for i, tr := range prefix {
+		if !equalFold(s[i], tr) {
+			return false
 		}
+	}
 
-		j = 0
+	return true
+}
+
+func equalFold(sr, tr rune) bool {
+	if sr == tr {
+		return true
 	}
 
-	return hits
+	if tr < sr {
+		tr, sr = sr, tr
+	}
+
+	if 'A' <= sr && sr <= 'Z' && tr == sr+'a'-'A' {
+		return true
+	}
+
+	r := unicode.SimpleFold(sr)
+	for r != sr && r < tr {
+		r = unicode.SimpleFold(r)
+	}
+
+	return r == tr
 }
 
 func searchAll(haystack string, needles []string) []searchHit {
@@ -139,7 +181,7 @@ func searchAll(haystack string, needles []string) []searchHit {
 			continue
 		}
 
-		for j, hit := range hits {
+		for _, hit := range hits {
 			match := false
 			replace := -1
 			for i, existingHit := range allHits {
@@ -166,7 +208,7 @@ func searchAll(haystack string, needles []string) []searchHit {
 			if !match {
 				allHits = append(allHits, hit)
 			} else if replace != -1 {
-				allHits[j] = hit
+				allHits[replace] = hit
 			}
 		}
 	}
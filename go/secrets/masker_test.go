@@ -1,6 +1,7 @@
 package secrets_test
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/frostyeti/mvps/go/secrets"
@@ -81,3 +82,91 @@ func TestMaskNoValues(t *testing.T) {
 	result := m.Mask("something")
 	assert.Equal(t, "something", result)
 }
+
+func TestMaskSecretAtEnd(t *testing.T) {
+	m := &secrets.SecretMasker{}
+	m.AddValue("secret")
+	result := m.Mask("a secret")
+	assert.Equal(t, "a ****", result)
+}
+
+func TestMaskAfterPartialMatch(t *testing.T) {
+	m := &secrets.SecretMasker{}
+	m.AddValue("secret")
+	result := m.Mask("sesecret and secretsecret")
+	assert.Equal(t, "se**** and ********", result)
+}
+
+func TestMaskMultiLineSecret(t *testing.T) {
+	m := &secrets.SecretMasker{}
+	m.AddValue("line one\nline two")
+	result := m.Mask("key:\nline two\n")
+	assert.Equal(t, "key:\n****\n", result)
+}
+
+func TestMaskWriterSplitWrites(t *testing.T) {
+	m := secrets.NewSecretMasker()
+	m.AddValue("hunter2")
+
+	out := &strings.Builder{}
+	w := secrets.NewMaskWriter(out, m)
+	for _, chunk := range []string{"password: hun", "te", "r2\n", "done h", "unt\n"} {
+		n, err := w.Write([]byte(chunk))
+		assert.NoError(t, err)
+		assert.Equal(t, len(chunk), n)
+	}
+
+	assert.NoError(t, w.Flush())
+	assert.Equal(t, "password: ****\ndone hunt\n", out.String())
+}
+
+func TestMaskWriterHoldsOnlyPossibleSecrets(t *testing.T) {
+	m := secrets.NewSecretMasker()
+	m.AddValue("token")
+
+	out := &strings.Builder{}
+	w := secrets.NewMaskWriter(out, m)
+	_, err := w.Write([]byte("the to"))
+	assert.NoError(t, err)
+	assert.Equal(t, "the ", out.String())
+
+	_, err = w.Write([]byte("p"))
+	assert.NoError(t, err)
+	assert.Equal(t, "the top", out.String())
+
+	_, err = w.Write([]byte(" tok"))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Flush())
+	assert.Equal(t, "the top tok", out.String())
+}
+
+func TestMaskWriterSplitRune(t *testing.T) {
+	m := secrets.NewSecretMasker()
+	m.AddValue("pässword")
+
+	out := &strings.Builder{}
+	w := secrets.NewMaskWriter(out, m)
+	data := []byte("my pässword!")
+	for i := range data {
+		_, err := w.Write(data[i : i+1])
+		assert.NoError(t, err)
+	}
+
+	assert.NoError(t, w.Flush())
+	assert.Equal(t, "my ****!", out.String())
+}
+
+func TestMaskWriterSecretAddedLater(t *testing.T) {
+	m := secrets.NewSecretMasker()
+
+	out := &strings.Builder{}
+	w := secrets.NewMaskWriter(out, m)
+	_, err := w.Write([]byte("abc\n"))
+	assert.NoError(t, err)
+
+	m.AddValue("xyz")
+	_, err = w.Write([]byte("xyz abc\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Flush())
+	assert.Equal(t, "abc\n**** abc\n", out.String())
+}